@@ -0,0 +1,63 @@
+package admin
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// A Server serves operational HTTP endpoints, such as metrics, separately from
+// the rest of the application.
+type Server struct {
+	addr   string
+	mux    *http.ServeMux
+	server *http.Server
+	log    *zap.Logger
+}
+
+// NewServer creates and returns a *Server that will listen on the supplied address.
+func NewServer(addr string, logger *zap.Logger) *Server {
+	mux := http.NewServeMux()
+
+	return &Server{
+		addr: addr,
+		mux:  mux,
+		server: &http.Server{
+			Addr:              addr,
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		},
+		log: logger,
+	}
+}
+
+// Handle registers a handler for the supplied pattern.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Start starts listening on the Server's address and serves requests in a Goroutine.
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			s.log.Error("admin server stopped unexpectedly", zap.Error(err))
+		}
+	}()
+
+	s.log.Info("admin server listening", zap.String("addr", listener.Addr().String()))
+
+	return nil
+}
+
+// Shutdown gracefully stops the Server.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
@@ -2,6 +2,7 @@ package communication
 
 import (
 	"encoding/json"
+	"errors"
 	"strings"
 
 	"github.com/streadway/amqp"
@@ -38,7 +39,17 @@ func ConnectAMQP(url string) (*Connection, error) {
 	}, nil
 }
 
-// Subscribe subscribes to a queue, returning a channel of Messages.
+// Check returns an error if the connection to the AMQP server has been closed.
+func (c *Connection) Check() error {
+	if c.conn.IsClosed() {
+		return errors.New("amqp connection closed")
+	}
+
+	return nil
+}
+
+// Subscribe subscribes to a queue, returning a channel of Messages. The channel is
+// closed when the AMQP channel stops delivering messages.
 func (c *Connection) Subscribe(queue string) (chan Message, error) {
 	ch, err := c.conn.Channel()
 	if err != nil {
@@ -62,7 +73,7 @@ func (c *Connection) Subscribe(queue string) (chan Message, error) {
 		"",    // name
 		false, // durable
 		false, // delete when unused
-		false, // exclusive
+		true,  // exclusive, so that it is deleted when the connection closes
 		false, // no-wait
 		nil,   // arguments
 	)
@@ -83,6 +94,8 @@ func (c *Connection) Subscribe(queue string) (chan Message, error) {
 	}
 
 	go func() {
+		defer close(channel)
+
 		for message := range in {
 			body := string(message.Body)
 
@@ -1,23 +1,31 @@
 package communication
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"strings"
+	"sync/atomic"
 )
 
 // A QueueConnection wraps an AMQP connection and allows for event handlers to be registered.
 type QueueConnection struct {
-	conn                           *Connection
-	queueName                      string
-	heartbeatHandler               func(heartbeat *Heartbeat)
-	statusUpdateHandler            func(statusUpdate *StatusUpdate)
-	hubWelcomeHandler              func(hubWelcome *HubWelcome)
-	hubWelcomeAckHandler           func(hubWelcomeAck *HubWelcomeAck)
-	goingAwayHandler               func(goingAway *GoingAway)
-	infoRetrievedHandler           func(infoRetrieved *InfoRetrieved)
-	taskFulfillmentRequestHandler  func(taskFulfillmentRequest *TaskFulfillmentRequest)
-	crawlFulfillmentRequestHandler func(crawlFulfillmentRequest *CrawlFulfillmentRequest)
-	crawlRetrievedHandler          func(crawlRetrieved *CrawlRetrieved)
+	conn                               *Connection
+	queueName                          string
+	heartbeatHandler                   func(heartbeat *Heartbeat)
+	statusUpdateHandler                func(statusUpdate *StatusUpdate)
+	hubWelcomeHandler                  func(hubWelcome *HubWelcome)
+	hubWelcomeAckHandler               func(hubWelcomeAck *HubWelcomeAck)
+	goingAwayHandler                   func(goingAway *GoingAway)
+	infoRetrievedHandler               func(infoRetrieved *InfoRetrieved)
+	taskFailedHandler                  func(taskFailed *TaskFailed)
+	taskFulfillmentRequestHandler      func(taskFulfillmentRequest *TaskFulfillmentRequest)
+	crawlFulfillmentRequestHandler     func(crawlFulfillmentRequest *CrawlFulfillmentRequest)
+	crawlRetrievedHandler              func(crawlRetrieved *CrawlRetrieved)
+	crawlRequestHandler                func(crawlRequest *CrawlRequest)
+	discoveryFulfillmentRequestHandler func(discoveryFulfillmentRequest *DiscoveryFulfillmentRequest)
+	discoveryRetrievedHandler          func(discoveryRetrieved *DiscoveryRetrieved)
+	consuming                          int32 // set to 1 while the consumer is running, accessed atomically
 }
 
 // NewQueueConnection creates and returns a new QueueConnection.
@@ -35,16 +43,31 @@ func (q *QueueConnection) Consume() error {
 		return err
 	}
 
+	atomic.StoreInt32(&q.consuming, 1)
 	go q.consumer(channel)
 
 	return nil
 }
 
+// Check returns an error if the connection is closed or is no longer consuming
+// messages, for use as a health check.
+func (q *QueueConnection) Check(ctx context.Context) error {
+	if err := q.conn.Check(); err != nil {
+		return err
+	}
+
+	if atomic.LoadInt32(&q.consuming) != 1 {
+		return errors.New("amqp channel not consuming")
+	}
+
+	return nil
+}
+
 // consumer consumes messages from the queue.
 func (q *QueueConnection) consumer(channel chan Message) {
-	for {
-		msg := <-channel
+	defer atomic.StoreInt32(&q.consuming, 0)
 
+	for msg := range channel {
 		decoder := json.NewDecoder(strings.NewReader(string(msg.Content)))
 
 		switch msg.Type {
@@ -84,6 +107,12 @@ func (q *QueueConnection) consumer(channel chan Message) {
 				q.infoRetrievedHandler(d)
 			}
 			break
+		case "taskFailed":
+			d := &TaskFailed{}
+			if err := decoder.Decode(d); err == nil && q.taskFailedHandler != nil {
+				q.taskFailedHandler(d)
+			}
+			break
 		case "taskFulfillmentRequest":
 			d := &TaskFulfillmentRequest{}
 			if err := decoder.Decode(d); err == nil && q.taskFulfillmentRequestHandler != nil {
@@ -102,6 +131,24 @@ func (q *QueueConnection) consumer(channel chan Message) {
 				q.crawlRetrievedHandler(d)
 			}
 			break
+		case "crawlRequest":
+			d := &CrawlRequest{}
+			if err := decoder.Decode(d); err == nil && q.crawlRequestHandler != nil {
+				q.crawlRequestHandler(d)
+			}
+			break
+		case "discoveryFulfillmentRequest":
+			d := &DiscoveryFulfillmentRequest{}
+			if err := decoder.Decode(d); err == nil && q.discoveryFulfillmentRequestHandler != nil {
+				q.discoveryFulfillmentRequestHandler(d)
+			}
+			break
+		case "discoveryRetrieved":
+			d := &DiscoveryRetrieved{}
+			if err := decoder.Decode(d); err == nil && q.discoveryRetrievedHandler != nil {
+				q.discoveryRetrievedHandler(d)
+			}
+			break
 		}
 	}
 }
@@ -136,6 +183,11 @@ func (q *QueueConnection) RegisterInfoRetrievedHandler(handler func(infoRetrieve
 	q.infoRetrievedHandler = handler
 }
 
+// RegisterTaskFailedHandler registers a handler for TaskFailed messages.
+func (q *QueueConnection) RegisterTaskFailedHandler(handler func(taskFailed *TaskFailed)) {
+	q.taskFailedHandler = handler
+}
+
 // RegisterTaskFulfillmentRequest registers a handler for TaskFulfillmentRequest messages.
 func (q *QueueConnection) RegisterTaskFulfillmentRequest(handler func(taskFulfillmentRequest *TaskFulfillmentRequest)) {
 	q.taskFulfillmentRequestHandler = handler
@@ -151,6 +203,21 @@ func (q *QueueConnection) RegisterCrawlRetrievedHandler(handler func(crawlRetrie
 	q.crawlRetrievedHandler = handler
 }
 
+// RegisterCrawlRequestHandler registers a handler for CrawlRequest messages.
+func (q *QueueConnection) RegisterCrawlRequestHandler(handler func(crawlRequest *CrawlRequest)) {
+	q.crawlRequestHandler = handler
+}
+
+// RegisterDiscoveryFulfillmentRequestHandler registers a handler for DiscoveryFulfillmentRequest messages.
+func (q *QueueConnection) RegisterDiscoveryFulfillmentRequestHandler(handler func(discoveryFulfillmentRequest *DiscoveryFulfillmentRequest)) {
+	q.discoveryFulfillmentRequestHandler = handler
+}
+
+// RegisterDiscoveryRetrievedHandler registers a handler for DiscoveryRetrieved messages.
+func (q *QueueConnection) RegisterDiscoveryRetrievedHandler(handler func(discoveryRetrieved *DiscoveryRetrieved)) {
+	q.discoveryRetrievedHandler = handler
+}
+
 // SendMessage sends a message of any supported type to the queue,
 // panicking if an invalid type is sent.
 func (q *QueueConnection) SendMessage(message interface{}) error {
@@ -169,12 +236,20 @@ func (q *QueueConnection) SendMessage(message interface{}) error {
 		typeName = "goingAway"
 	case InfoRetrieved:
 		typeName = "infoRetrieved"
+	case TaskFailed:
+		typeName = "taskFailed"
 	case TaskFulfillmentRequest:
 		typeName = "taskFulfillmentRequest"
 	case CrawlFulfillmentRequest:
 		typeName = "crawlFulfillmentRequest"
 	case CrawlRetrieved:
 		typeName = "crawlRetrieved"
+	case CrawlRequest:
+		typeName = "crawlRequest"
+	case DiscoveryFulfillmentRequest:
+		typeName = "discoveryFulfillmentRequest"
+	case DiscoveryRetrieved:
+		typeName = "discoveryRetrieved"
 	}
 
 	if typeName != "" {
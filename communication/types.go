@@ -1,13 +1,16 @@
 package communication
 
 import (
+	"time"
+
 	"github.com/bfoody/Walmart-Scraper/domain"
 )
 
 // A SingleReceiverPacket is a message meant to be received by a single client.
 type SingleReceiverPacket struct {
-	SenderID   string
-	ReceiverID string
+	SenderID     string
+	ReceiverID   string
+	TraceContext map[string]string `json:",omitempty"` // the sender's trace context, see tracing.Inject
 }
 
 // A FanoutPacket is a message meant to be received by all clients.
@@ -24,7 +27,17 @@ type Heartbeat struct {
 // A StatusUpdate is sent by a server to notify others of an update of capabilities.
 type StatusUpdate struct {
 	FanoutPacket
-	AvailableForWork bool // whether or not the server can be assigned work yet
+	ReceiverID       string    `json:",omitempty"` // the hub the update is meant for, or "" for every hub, eg. when a client starts
+	AvailableForWork bool      // whether or not the server can be assigned work yet
+	OpenCircuits     []Circuit `json:",omitempty"` // the hosts a client is failing requests to while they are degraded
+}
+
+// A Circuit is the state of a client's circuit breaker for a host it scrapes.
+type Circuit struct {
+	Host       string
+	Retailer   string        // the retailer scraped from the host, eg. "walmart"
+	State      string        // "open" or "half_open"
+	RetryAfter time.Duration // how long until an open circuit starts probing the host
 }
 
 // A HubWelcome is sent to a client when the hub registers it.
@@ -50,6 +63,21 @@ type InfoRetrieved struct {
 	SingleReceiverPacket
 	TaskID      string
 	ProductInfo domain.ProductInfo
+	Product     domain.Product           // details describing the product scraped along with the info, without an ID
+	Offers      []domain.Offer           // every seller's offer observed along with the info, without IDs
+	Variants    []domain.ProductLocation // the product's other variants, without IDs
+	Retailer    string                   // the retailer the info was scraped from, eg. "walmart"
+}
+
+// A TaskFailed is sent by a client to a hub when it gives up on fetching product info,
+// so that the hub can slow down if the retailer is blocking or rate limiting clients.
+type TaskFailed struct {
+	SingleReceiverPacket
+	TaskID            string
+	ProductLocationID string
+	Retailer          string        // the retailer the info was scraped from, eg. "walmart"
+	Reason            string        // why the task failed, eg. "blocked", "rate_limited", "not_found", "circuit_open", "unsupported_store" or "error"
+	RetryAfter        time.Duration // how long the retailer, or an open circuit, asked to wait before retrying, or 0
 }
 
 // A TaskFTaskFulfillmentRequest is sent by a hub to a client as a request for a task to be executed and fulfilled.
@@ -57,12 +85,15 @@ type TaskFulfillmentRequest struct {
 	SingleReceiverPacket
 	TaskID          string
 	ProductLocation domain.ProductLocation
+	Location        domain.Location     // the product's location, which chooses the retailer adapter to scrape with
+	Store           domain.StoreContext // the store to scrape the product's prices and availability at
 }
 
 // A CrawlFulfillmentRequest is sent by a hub to a client as a request for a product to have its recommendations scraped.
 type CrawlFulfillmentRequest struct {
 	SingleReceiverPacket
 	ProductLocation domain.ProductLocation
+	Location        domain.Location // the product's location, which chooses the retailer adapter to scrape with
 }
 
 // A CrawlRetrieved is sent by a client to the hub when a crawl is completed.
@@ -71,3 +102,28 @@ type CrawlRetrieved struct {
 	ProductLocationID string
 	Recommendations   []domain.ProductLocation
 }
+
+// A CrawlRequest is sent by an operator tool to a hub to request that a product's
+// recommendations be crawled, even if it has already been crawled before.
+type CrawlRequest struct {
+	SingleReceiverPacket
+	ProductLocationID string
+}
+
+// A DiscoveryFulfillmentRequest is sent by a hub to a client as a request for the products
+// found by a search or on a category page to be scraped.
+type DiscoveryFulfillmentRequest struct {
+	SingleReceiverPacket
+	DiscoveryTaskID string
+	Kind            string          // the kind of discovery, "search" or "browse"
+	Query           string          // the search query, or the category ID to browse
+	MaxPages        int             // the maximum number of result pages to scrape
+	Location        domain.Location // the location to discover products from
+}
+
+// A DiscoveryRetrieved is sent by a client to the hub when a discovery is completed.
+type DiscoveryRetrieved struct {
+	SingleReceiverPacket
+	DiscoveryTaskID string
+	Products        []domain.ProductLocation
+}
@@ -0,0 +1,28 @@
+package domain
+
+import "time"
+
+const (
+	// DiscoveryKindSearch discovers the products in a retailer's search results for a query.
+	DiscoveryKindSearch = "search"
+	// DiscoveryKindBrowse discovers the products listed on a retailer's category page.
+	DiscoveryKindBrowse = "browse"
+)
+
+// IsDiscoveryKind returns true if `kind` is a kind of discovery clients can run.
+func IsDiscoveryKind(kind string) bool {
+	return kind == DiscoveryKindSearch || kind == DiscoveryKindBrowse
+}
+
+// A DiscoveryTask represents a repeating job for tracking the products found by
+// a search or on a category page of a location.
+type DiscoveryTask struct {
+	ID           string        `db:"id"`            // the entity's unique ID
+	CreatedAt    time.Time     `db:"created_at"`    // when the task was created
+	LocationID   string        `db:"location_id"`   // the ID of the location to discover products from
+	Kind         string        `db:"kind"`          // the kind of discovery, "search" or "browse"
+	Query        string        `db:"query"`         // the search query, or the category ID to browse
+	MaxPages     int           `db:"max_pages"`     // the maximum number of result pages to scrape
+	ScheduledFor time.Time     `db:"scheduled_for"` // when the task is next to be run
+	Interval     time.Duration `db:"interval"`      // the duration between runs of the task
+}
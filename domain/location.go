@@ -1,7 +1,34 @@
 package domain
 
+const (
+	// RetailerWalmart is the retailer key of locations scraped with the Walmart adapter.
+	RetailerWalmart = "walmart"
+	// RetailerJSONLD is the retailer key of locations scraped with the generic adapter
+	// for websites describing products with schema.org JSON-LD.
+	RetailerJSONLD = "jsonld"
+)
+
+// knownRetailers contains the keys of every retailer adapter clients implement.
+var knownRetailers = map[string]bool{
+	RetailerWalmart: true,
+	RetailerJSONLD:  true,
+}
+
+// IsKnownRetailer returns true if clients implement a retailer adapter with the key.
+func IsKnownRetailer(retailer string) bool {
+	return knownRetailers[retailer]
+}
+
 // A Location represents a single source from which products are found.
 type Location struct {
-	ID   string // the entity's unique ID
-	Name string // the location's aname
+	ID       string `db:"id"`       // the entity's unique ID
+	Name     string `db:"name"`     // the location's name
+	Retailer string `db:"retailer"` // the key of the retailer adapter used to scrape the location, eg. "walmart"
+	BaseURL  string `db:"base_url"` // the base URL of the location's website, eg. "https://www.walmart.com"
+}
+
+// CanDiscover returns true if clients can discover products from locations using the
+// retailer, by searching or browsing categories.
+func CanDiscover(retailer string) bool {
+	return retailer == RetailerWalmart
 }
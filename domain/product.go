@@ -4,8 +4,13 @@ import "time"
 
 // A Product represents a single product, detached from a seller or price.
 type Product struct {
-	ID         string // the entity's unique ID
-	CommonName string // a common name shown for the product throughout the UI
+	ID           string   `db:"id"`           // the entity's unique ID
+	CommonName   string   `db:"common_name"`  // a common name shown for the product throughout the UI
+	Brand        string   `db:"brand"`        // the product's brand
+	Manufacturer string   `db:"manufacturer"` // the product's manufacturer
+	UPC          string   `db:"upc"`          // the product's UPC or GTIN barcode number
+	ImageURLs    []string `db:"image_urls"`   // the URLs of the product's images, primary image first
+	ParentID     string   `db:"parent_id"`    // the ID of the product this is a variant of, eg. another size or color, or "" (NULL) if it isn't a variant
 }
 
 // A ProductLocation describes a location where a product is being sold, used to
@@ -20,16 +25,48 @@ type ProductLocation struct {
 	Slug       string `db:"slug"`        // the slug being use on the seller's website
 	CategoryID string `db:"category_id"` // the product's category ID
 	Category   string `db:"category"`    // the product's category on the seller's website
+	Variant    string `db:"variant"`     // the attributes distinguishing the product from its other variants, eg. "Color: Black, Size: L"
 }
 
 // A ProductInfo represents a single crawl of a product and the details scraped
 // from the crawl.
 type ProductInfo struct {
-	ID                 string    // the entity's unique ID
-	CreatedAt          time.Time // the time at which the info was crawled/logged
-	ProductID          string    // the product's ID
-	ProductLocationID  string    // the product-location ID
-	Price              float32   // the current price of the item in USD
-	AvailabilityStatus string    // the availability of the item, eg. "IN_STOCK"
-	InStock            bool      // whether or not the item is in stock (AvailabilityStatus but as a boolean)
+	ID                 string    `db:"id"`                  // the entity's unique ID
+	CreatedAt          time.Time `db:"created_at"`          // the time at which the info was crawled/logged
+	ProductID          string    `db:"product_id"`          // the product's ID
+	ProductLocationID  string    `db:"product_location_id"` // the product-location ID
+	Price              float32   `db:"price"`               // the current price of the item in USD
+	ListPrice          float32   `db:"list_price"`          // the price of the item before any rollback or sale in USD, 0 if it isn't discounted
+	UnitPrice          float32   `db:"unit_price"`          // the price per unit of measure in USD, 0 if not shown
+	UnitOfMeasure      string    `db:"unit_of_measure"`     // the unit UnitPrice is given in, eg. "oz"
+	AvailabilityStatus string    `db:"availability_status"` // the availability of the item, eg. "IN_STOCK"
+	InStock            bool      `db:"in_stock"`            // whether or not the item is in stock (AvailabilityStatus but as a boolean)
+	SellerID           string    `db:"seller_id"`           // the ID of the seller of the offer, given by the location
+	SellerName         string    `db:"seller_name"`         // the display name of the seller of the offer
+	ThirdPartySeller   bool      `db:"third_party_seller"`  // whether or not the offer is sold by a seller other than the location itself
+	Rating             float32   `db:"rating"`              // the average customer rating, out of 5
+	ReviewCount        int       `db:"review_count"`        // the number of customer reviews
+	FreeShipping       bool      `db:"free_shipping"`       // whether or not the item ships for free
+	InStore            bool      `db:"in_store"`            // whether or not the item is sold in stores
+	Online             bool      `db:"online"`              // whether or not the item is sold online
+	Preorder           bool      `db:"preorder"`            // whether or not the item is only available for preorder
+	ShippingOptions    []string  `db:"shipping_options"`    // the shipping methods offered, eg. "STANDARD"
+	StoreID            string    `db:"store_id"`            // the ID of the store the info was observed at, empty for the default store
+	ZIPCode            string    `db:"zip_code"`            // the ZIP code the info was observed at, empty for the default ZIP code
+	ExtractionStrategy string    `db:"extraction_strategy"` // the strategy the info was extracted from the page with, eg. "item_script"
+	TaskID             string    `db:"task_id"`             // the ID of the scrape task the info was retrieved for, empty if none
+}
+
+// An Offer represents a single seller's offer for a product, observed along with a
+// ProductInfo.
+type Offer struct {
+	ID                 string  `db:"id"`                  // the entity's unique ID
+	ProductInfoID      string  `db:"product_info_id"`     // the ID of the product info the offer was observed with
+	SellerID           string  `db:"seller_id"`           // the ID of the seller, given by the location
+	SellerName         string  `db:"seller_name"`         // the display name of the seller
+	ThirdPartySeller   bool    `db:"third_party_seller"`  // whether or not the seller is someone other than the location itself
+	Price              float32 `db:"price"`               // the offer's price in USD
+	AvailabilityStatus string  `db:"availability_status"` // the availability of the offer, eg. "IN_STOCK"
+	InStock            bool    `db:"in_stock"`            // whether or not the offer is in stock (AvailabilityStatus but as a boolean)
+	BuyBox             bool    `db:"buy_box"`             // whether or not the offer is the one shown by default, which the ProductInfo describes
 }
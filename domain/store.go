@@ -0,0 +1,14 @@
+package domain
+
+// A StoreContext is the store a product is scraped at, since prices and pickup
+// availability vary between stores. Either field may be empty to use the retailer's
+// default.
+type StoreContext struct {
+	StoreID string // the retailer's ID of the store, eg. "5435"
+	ZIPCode string // the ZIP code of the area, eg. "72712"
+}
+
+// IsZero returns true if neither a store nor a ZIP code is set.
+func (sc StoreContext) IsZero() bool {
+	return sc.StoreID == "" && sc.ZIPCode == ""
+}
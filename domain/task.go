@@ -11,6 +11,27 @@ type ScrapeTask struct {
 	ProductLocationID string        `db:"product_location_id"` // the ID of the product-location pair to be scraped
 	Repeat            bool          `db:"repeat"`              // whether or not to schedule another task after completion
 	Interval          time.Duration `db:"interval"`            // the duration between repetitions of the task, will be added to the current time when the schedule repeats
+	StoreID           string        `db:"store_id"`            // the retailer's ID of the store to scrape prices and availability for, empty for the default store
+	ZIPCode           string        `db:"zip_code"`            // the ZIP code to scrape prices and availability for, empty for the default ZIP code
+}
+
+// Store returns the store the task is to be scraped at.
+func (st ScrapeTask) Store() StoreContext {
+	return StoreContext{StoreID: st.StoreID, ZIPCode: st.ZIPCode}
+}
+
+// Next returns the next repetition of a repeating task, scheduled an interval after
+// `now`.
+func (st ScrapeTask) Next(now time.Time) ScrapeTask {
+	return ScrapeTask{
+		CreatedAt:         now,
+		ScheduledFor:      now.Add(st.Interval),
+		ProductLocationID: st.ProductLocationID,
+		Repeat:            st.Repeat,
+		Interval:          st.Interval,
+		StoreID:           st.StoreID,
+		ZIPCode:           st.ZIPCode,
+	}
 }
 
 // A CrawlTask represents a job for crawling related products from an origin product.
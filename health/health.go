@@ -0,0 +1,150 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// checkTimeout is the maximum amount of time a single check may take before it fails.
+const checkTimeout = 3 * time.Second
+
+const (
+	// StatusOK means a check passed.
+	StatusOK = "ok"
+	// StatusFail means a check failed.
+	StatusFail = "fail"
+)
+
+// A Check reports on the state of a single component, returning an error describing
+// why the component is not ready, or nil if it is.
+type Check func(ctx context.Context) error
+
+// A CheckResult is the outcome of a single Check.
+type CheckResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`           // "ok" or "fail"
+	Reason string `json:"reason,omitempty"` // why the check failed
+}
+
+// A Report is the response body of the readiness endpoint.
+type Report struct {
+	Status string        `json:"status"` // "ok" if every check passed, otherwise "fail"
+	Checks []CheckResult `json:"checks"`
+}
+
+// A Checker runs a list of named Checks to determine readiness.
+type Checker struct {
+	mutex  *sync.RWMutex
+	names  []string
+	checks map[string]Check
+}
+
+// NewChecker creates and returns a *Checker with no checks.
+func NewChecker() *Checker {
+	return &Checker{
+		mutex:  &sync.RWMutex{},
+		names:  []string{},
+		checks: map[string]Check{},
+	}
+}
+
+// Register adds a named check to the Checker, replacing any check with the same name.
+func (c *Checker) Register(name string, check Check) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok := c.checks[name]; !ok {
+		c.names = append(c.names, name)
+	}
+
+	c.checks[name] = check
+}
+
+// Run runs every check concurrently and returns a Report.
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mutex.RLock()
+	names := append([]string{}, c.names...)
+	checks := make([]Check, len(names))
+	for i, name := range names {
+		checks[i] = c.checks[name]
+	}
+	c.mutex.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	results := make([]CheckResult, len(names))
+	wg := &sync.WaitGroup{}
+
+	for i := range names {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			results[i] = CheckResult{Name: names[i], Status: StatusOK}
+			if err := runCheck(ctx, checks[i]); err != nil {
+				results[i].Status = StatusFail
+				results[i].Reason = err.Error()
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: results}
+	for _, result := range results {
+		if result.Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+
+	return report
+}
+
+// runCheck runs a single check, failing it if the context expires first.
+func runCheck(ctx context.Context, check Check) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// LivenessHandler returns an http.Handler which always reports that the process is up.
+func (c *Checker) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, Report{Status: StatusOK, Checks: []CheckResult{}})
+	})
+}
+
+// ReadinessHandler returns an http.Handler which runs every check, responding with
+// 200 if all of them pass and 503 otherwise.
+func (c *Checker) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Run(r.Context())
+
+		code := http.StatusOK
+		if report.Status != StatusOK {
+			code = http.StatusServiceUnavailable
+		}
+
+		writeJSON(w, code, report)
+	})
+}
+
+// writeJSON writes a JSON response with the supplied status code.
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
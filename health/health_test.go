@@ -0,0 +1,42 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bfoody/Walmart-Scraper/health"
+)
+
+// TestReadinessHandler makes sure a failing check makes the readiness endpoint
+// unavailable and reports the reason.
+func TestReadinessHandler(t *testing.T) {
+	checker := health.NewChecker()
+	checker.Register("database", func(ctx context.Context) error { return nil })
+
+	rec := httptest.NewRecorder()
+	checker.ReadinessHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	checker.Register("clients", func(ctx context.Context) error { return errors.New("no clients available") })
+
+	rec = httptest.NewRecorder()
+	checker.ReadinessHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+
+	report := health.Report{}
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Checks) != 2 || report.Checks[1].Name != "clients" || report.Checks[1].Reason != "no clients available" {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
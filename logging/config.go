@@ -0,0 +1,20 @@
+package logging
+
+const (
+	// FormatConsole writes human-readable log lines.
+	FormatConsole = "console"
+	// FormatJSON writes one JSON object per log line.
+	FormatJSON = "json"
+)
+
+// A Config contains logging options, meant to be nested in a service's config.
+type Config struct {
+	Format          string `env:"SCR_LOG_FORMAT" yaml:"format" default:"console" validate:"oneof=console json"`
+	Level           string `env:"SCR_LOG_LEVEL" yaml:"level" default:"debug"`                  // the level of the root logger and default level of components
+	ComponentLevels string `env:"SCR_LOG_COMPONENT_LEVELS" yaml:"component_levels" default:""` // per-component overrides, eg. "supervisor=info,walmart=warn"
+	Sampling        bool   `env:"SCR_LOG_SAMPLING" yaml:"sampling" default:"false"`            // whether to sample repeated log lines
+	File            string `env:"SCR_LOG_FILE" yaml:"file" default:""`                         // a file to log to instead of stderr, rotated automatically
+	FileMaxSize     int    `env:"SCR_LOG_FILE_MAX_SIZE_MB" yaml:"file_max_size_mb" default:"100" validate:"min=1"`
+	FileMaxBackups  int    `env:"SCR_LOG_FILE_MAX_BACKUPS" yaml:"file_max_backups" default:"5" validate:"min=0"`
+	FileMaxAge      int    `env:"SCR_LOG_FILE_MAX_AGE_DAYS" yaml:"file_max_age_days" default:"28" validate:"min=0"`
+}
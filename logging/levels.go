@@ -0,0 +1,185 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// RootComponent is the name of the root logger's level.
+const RootComponent = "root"
+
+// Loggers holds the root logger and a child logger for each component, each with
+// a level that can be changed independently at runtime.
+type Loggers struct {
+	base      *zap.Logger
+	root      *zap.Logger
+	defaults  zapcore.Level            // the level of components without an override
+	overrides map[string]zapcore.Level // levels configured for specific components
+	mutex     *sync.Mutex
+	levels    map[string]zap.AtomicLevel
+	loggers   map[string]*zap.Logger
+}
+
+// newLoggers creates and returns a *Loggers from a base logger which accepts every level.
+func newLoggers(base *zap.Logger, rootLevel zapcore.Level, overrides map[string]zapcore.Level) *Loggers {
+	level := zap.NewAtomicLevelAt(rootLevel)
+
+	return &Loggers{
+		base:      base,
+		root:      base.WithOptions(zap.WrapCore(filterLevel(level))),
+		defaults:  rootLevel,
+		overrides: overrides,
+		mutex:     &sync.Mutex{},
+		levels:    map[string]zap.AtomicLevel{RootComponent: level},
+		loggers:   map[string]*zap.Logger{},
+	}
+}
+
+// Logger returns the root logger.
+func (l *Loggers) Logger() *zap.Logger {
+	return l.root
+}
+
+// Component returns the named child logger for a component, eg. "supervisor",
+// creating it on first use.
+func (l *Loggers) Component(name string) *zap.Logger {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if logger, ok := l.loggers[name]; ok {
+		return logger
+	}
+
+	levelValue, ok := l.overrides[name]
+	if !ok {
+		levelValue = l.defaults
+	}
+
+	level := zap.NewAtomicLevelAt(levelValue)
+	logger := l.base.WithOptions(zap.WrapCore(filterLevel(level))).Named(name)
+
+	l.levels[name] = level
+	l.loggers[name] = logger
+
+	return logger
+}
+
+// SetLevel changes the level of a component, or of the root logger if the component
+// is "root".
+func (l *Loggers) SetLevel(component string, levelName string) error {
+	level, err := parseLevel(levelName)
+	if err != nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	atomicLevel, ok := l.levels[component]
+	if !ok {
+		return fmt.Errorf("unknown logging component %q", component)
+	}
+
+	atomicLevel.SetLevel(level)
+
+	return nil
+}
+
+// Levels returns the current level of every component.
+func (l *Loggers) Levels() map[string]string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	levels := map[string]string{}
+	for name, level := range l.levels {
+		levels[name] = level.String()
+	}
+
+	return levels
+}
+
+// Handler returns an http.Handler which lists component levels on GET and changes
+// a level on PUT, eg. `curl -X PUT "localhost:9090/loglevel?component=walmart&level=debug"`.
+func (l *Loggers) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			component := r.URL.Query().Get("component")
+			if component == "" {
+				component = RootComponent
+			}
+
+			level := r.URL.Query().Get("level")
+			if err := l.SetLevel(component, level); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			l.root.Info("log level changed", zap.String("component", component), zap.String("level", level))
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		levels := l.Levels()
+		names := make([]string, 0, len(levels))
+		for name := range levels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		type componentLevel struct {
+			Component string `json:"component"`
+			Level     string `json:"level"`
+		}
+
+		body := []componentLevel{}
+		for _, name := range names {
+			body = append(body, componentLevel{name, levels[name]})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	})
+}
+
+// filterLevel returns a function which wraps a zapcore.Core so that it only accepts
+// entries enabled by `level`.
+func filterLevel(level zap.AtomicLevel) func(core zapcore.Core) zapcore.Core {
+	return func(core zapcore.Core) zapcore.Core {
+		return &levelFilterCore{core, level}
+	}
+}
+
+// A levelFilterCore wraps a zapcore.Core and drops entries below a changeable level.
+type levelFilterCore struct {
+	zapcore.Core
+	level zap.AtomicLevel
+}
+
+// Enabled returns true if the entry's level is enabled by both the filter and the
+// wrapped core.
+func (c *levelFilterCore) Enabled(level zapcore.Level) bool {
+	return c.level.Enabled(level) && c.Core.Enabled(level)
+}
+
+// With adds structured context to the wrapped core.
+func (c *levelFilterCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelFilterCore{c.Core.With(fields), c.level}
+}
+
+// Check adds the core to the checked entry if the entry's level is enabled.
+func (c *levelFilterCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.level.Enabled(entry.Level) {
+		return checked
+	}
+
+	return c.Core.Check(entry, checked)
+}
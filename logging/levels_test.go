@@ -0,0 +1,41 @@
+package logging
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// TestComponentLevels makes sure component levels can be changed independently.
+func TestComponentLevels(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	loggers := newLoggers(zap.New(core), zapcore.InfoLevel, map[string]zapcore.Level{
+		"walmart": zapcore.WarnLevel,
+	})
+
+	loggers.Component("supervisor").Debug("dropped")
+	loggers.Component("supervisor").Info("kept")
+	loggers.Component("walmart").Info("dropped")
+
+	if err := loggers.SetLevel("walmart", "debug"); err != nil {
+		t.Fatal(err)
+	}
+	loggers.Component("walmart").Debug("kept")
+	loggers.Logger().Debug("dropped")
+
+	if err := loggers.SetLevel("crawler", "debug"); err == nil {
+		t.Error("expected an error setting the level of an unknown component")
+	}
+
+	for _, entry := range logs.All() {
+		if entry.Message != "kept" {
+			t.Errorf("unexpected log entry %q from %s", entry.Message, entry.LoggerName)
+		}
+	}
+
+	if logs.Len() != 2 {
+		t.Errorf("expected 2 log entries, got %d", logs.Len())
+	}
+}
@@ -1,9 +1,112 @@
 package logging
 
-import "go.uber.org/zap"
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
 
-// Configure creates and configures a new `zap` logger and returns it.
-func Configure() (*zap.Logger, error) {
-	// TODO: Add necessary configuration to the zap instance.
-	return zap.NewDevelopment()
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Configure creates and configures a new set of `zap` loggers using the supplied
+// config and returns it.
+func Configure(cfg *Config) (*Loggers, error) {
+	encoder, err := newEncoder(cfg.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	sink, err := newSink(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// The base core accepts every level, each logger filters with its own level.
+	core := zapcore.NewCore(encoder, sink, zapcore.DebugLevel)
+
+	if cfg.Sampling {
+		core = zapcore.NewSamplerWithOptions(core, time.Second, 100, 100)
+	}
+
+	rootLevel, err := parseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	overrides, err := parseComponentLevels(cfg.ComponentLevels)
+	if err != nil {
+		return nil, err
+	}
+
+	return newLoggers(zap.New(core, zap.AddCaller()), rootLevel, overrides), nil
+}
+
+// newEncoder creates a zapcore.Encoder for the supplied format.
+func newEncoder(format string) (zapcore.Encoder, error) {
+	switch format {
+	case FormatConsole, "":
+		encoderConfig := zap.NewDevelopmentEncoderConfig()
+		return zapcore.NewConsoleEncoder(encoderConfig), nil
+	case FormatJSON:
+		encoderConfig := zap.NewProductionEncoderConfig()
+		encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+		return zapcore.NewJSONEncoder(encoderConfig), nil
+	}
+
+	return nil, fmt.Errorf("unknown log format %q", format)
+}
+
+// newSink creates the zapcore.WriteSyncer logs are written to, either stderr or a
+// rotated log file.
+func newSink(cfg *Config) (zapcore.WriteSyncer, error) {
+	if cfg.File == "" {
+		return zapcore.Lock(os.Stderr), nil
+	}
+
+	return zapcore.AddSync(&lumberjack.Logger{
+		Filename:   cfg.File,
+		MaxSize:    cfg.FileMaxSize,
+		MaxBackups: cfg.FileMaxBackups,
+		MaxAge:     cfg.FileMaxAge,
+	}), nil
+}
+
+// parseLevel parses a level name such as "debug" or "warn".
+func parseLevel(level string) (zapcore.Level, error) {
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return l, fmt.Errorf("invalid log level %q", level)
+	}
+
+	return l, nil
+}
+
+// parseComponentLevels parses a list of component level overrides formatted like
+// "supervisor=info,walmart=warn".
+func parseComponentLevels(levels string) (map[string]zapcore.Level, error) {
+	overrides := map[string]zapcore.Level{}
+
+	for _, pair := range strings.Split(levels, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid component log level %q, expected component=level", pair)
+		}
+
+		level, err := parseLevel(parts[1])
+		if err != nil {
+			return nil, err
+		}
+
+		overrides[parts[0]] = level
+	}
+
+	return overrides, nil
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/bfoody/Walmart-Scraper/services/client/internal/api"
 	"github.com/bfoody/Walmart-Scraper/services/client/internal/api/walmart"
+	"go.uber.org/zap"
 )
 
 // exit prints a message and exits the process.
@@ -25,8 +27,13 @@ func main() {
 		exit("usage: apitest <type> <args...>")
 	}
 
+	log, err := zap.NewDevelopment()
+	if err != nil {
+		exit(err.Error())
+	}
+
 	http := api.NewHTTPClient()
-	client := walmart.NewClient(http)
+	client := walmart.NewClient(http, log)
 
 	action := args[0]
 	switch action {
@@ -46,7 +53,7 @@ func main() {
 		}
 
 		for i := 0; i < num; i++ {
-			item, err := client.GetItemDetails("onn-32-Class-HD-720P-Roku-Smart-LED-TV-100012589", "314022535")
+			item, err := client.GetItemDetails(context.Background(), "onn-32-Class-HD-720P-Roku-Smart-LED-TV-100012589", "314022535")
 			if err != nil {
 				exit(err.Error())
 			}
@@ -55,7 +62,7 @@ func main() {
 			time.Sleep(time.Duration(interval) * time.Millisecond)
 		}
 	case "get-product-once":
-		item, err := client.GetItemDetails("onn-32-Class-HD-720P-Roku-Smart-LED-TV-100012589", "314022535")
+		item, err := client.GetItemDetails(context.Background(), "onn-32-Class-HD-720P-Roku-Smart-LED-TV-100012589", "314022535")
 		if err != nil {
 			exit(err.Error())
 		}
@@ -78,7 +85,21 @@ func main() {
 			exit("err: proxy list file does not exist")
 		}
 
-		proxies := strings.Split(string(file), "\n")
+		proxies := []string{}
+		for _, line := range strings.Split(string(file), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				proxies = append(proxies, line)
+			}
+		}
+
+		pool, err := api.NewProxyPool(proxies, api.DefaultProxyPoolOptions(), log)
+		if err != nil {
+			exit(err.Error())
+		}
+
+		if pool.Len() == 0 {
+			exit("err: proxy list file is empty")
+		}
 
 		wg := &sync.WaitGroup{}
 
@@ -86,11 +107,14 @@ func main() {
 			wg.Add(1)
 
 			go func(i int) {
-				http := api.NewHTTPClient()
-				http.SetProxy(proxies[i%len(proxies)])
-				client := walmart.NewClient(http)
+				proxy, err := pool.Select("")
+				if err != nil {
+					exit(err.Error())
+				}
+
+				client := walmart.NewClient(proxy.HTTP, log)
 
-				item, err := client.GetItemDetails("onn-32-Class-HD-720P-Roku-Smart-LED-TV-100012589", "314022535")
+				item, err := client.GetItemDetails(context.Background(), "onn-32-Class-HD-720P-Roku-Smart-LED-TV-100012589", "314022535")
 				if err != nil {
 					exit(err.Error())
 				}
@@ -102,6 +126,10 @@ func main() {
 		}
 
 		wg.Wait()
+
+		for _, stats := range pool.Stats() {
+			fmt.Printf("proxy %s: %+v\n", stats.Name, stats)
+		}
 	default:
 		exit("usage: apitest <type> <args...>")
 	}
@@ -1,24 +1,48 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 
 	"syscall"
 
+	"github.com/bfoody/Walmart-Scraper/admin"
 	"github.com/bfoody/Walmart-Scraper/communication"
+	"github.com/bfoody/Walmart-Scraper/health"
 	"github.com/bfoody/Walmart-Scraper/identity"
 	"github.com/bfoody/Walmart-Scraper/logging"
+	"github.com/bfoody/Walmart-Scraper/services/client"
 	"github.com/bfoody/Walmart-Scraper/services/client/internal/receiver"
+	"github.com/bfoody/Walmart-Scraper/tracing"
+	"github.com/bfoody/Walmart-Scraper/utils/config"
 	"github.com/bfoody/Walmart-Scraper/utils/uuid"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
 )
 
 func main() {
+	cfg, err := client.LoadConfig(os.Args[1:])
+	if err != nil {
+		fmt.Println("Error loading config: ", err)
+		os.Exit(1)
+	}
+
 	// Initialize logging.
-	log, err := logging.Configure()
+	loggers, err := logging.Configure(&cfg.Logging)
 	if err != nil {
 		fmt.Println("Error initializing logging: ", err)
+		os.Exit(1)
+	}
+	log := loggers.Logger()
+	log.Debug("loaded config:\n" + config.Dump(cfg))
+
+	shutdownTracing, err := tracing.Configure("client", cfg.TracingExporter, cfg.TracingEndpoint)
+	if err != nil {
+		log.Fatal("unable to configure tracing", zap.Error(err))
 	}
 
 	// TODO: move all this stuff into another function
@@ -26,15 +50,17 @@ func main() {
 	id := uuid.Generate()
 	identity := identity.NewClient(id)
 
-	conn, err := communication.ConnectAMQP("amqp://localhost:5672")
+	conn, err := communication.ConnectAMQP(cfg.AMQPURL)
 	if err != nil {
 		log.Fatal(err.Error())
 	}
 
-	q := "test"
-	e := communication.NewQueueConnection(conn, q)
+	e := communication.NewQueueConnection(conn, cfg.AMQPExchange)
 
-	receiver := receiver.New(identity, log, e)
+	receiver, err := receiver.New(identity, loggers, e, cfg)
+	if err != nil {
+		log.Fatal("unable to create receiver", zap.Error(err))
+	}
 
 	err = e.Consume()
 	if err != nil {
@@ -46,6 +72,42 @@ func main() {
 		log.Fatal(err.Error())
 	}
 
+	// Reload settings on SIGHUP or config, .env or proxy file change.
+	configFile, err := client.ConfigFilePath(os.Args[1:])
+	if err != nil {
+		log.Fatal("unable to resolve config file", zap.Error(err))
+	}
+
+	reloader := config.NewReloader(cfg, func() (interface{}, error) {
+		return client.LoadConfig(os.Args[1:])
+	}, []string{configFile, config.DotEnvFile, cfg.ProxyFile}, loggers.Component("config"))
+	reloader.Subscribe(func(c interface{}) {
+		receiver.ApplyConfig(c.(*client.Config))
+	})
+	reloader.Start()
+
+	checker := health.NewChecker()
+	checker.Register("amqp", e.Check)
+	checker.Register("hub", receiver.CheckHub)
+
+	adminServer := admin.NewServer(cfg.AdminAddr, log)
+	adminServer.Handle("/metrics", promhttp.Handler())
+	adminServer.Handle("/healthz", checker.LivenessHandler())
+	adminServer.Handle("/readyz", checker.ReadinessHandler())
+	adminServer.Handle("/loglevel", loggers.Handler())
+	adminServer.Handle("/proxies", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(receiver.ProxyStats())
+	}))
+	adminServer.Handle("/circuits", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(receiver.Circuits())
+	}))
+	err = adminServer.Start()
+	if err != nil {
+		log.Fatal("error starting admin server", zap.Error(err))
+	}
+
 	e.SendMessage(communication.StatusUpdate{
 		FanoutPacket:     communication.FanoutPacket{SenderID: identity.ID},
 		AvailableForWork: true,
@@ -59,10 +121,14 @@ func main() {
 	signal.Notify(s, syscall.SIGTERM)
 	go func() {
 		<-s
+		reloader.Shutdown()
 		err = receiver.Shutdown()
 		if err != nil {
 			log.Fatal(err.Error())
 		}
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.Error("error flushing traces", zap.Error(err))
+		}
 		os.Exit(0)
 	}()
 
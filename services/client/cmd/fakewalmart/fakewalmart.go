@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/fakewalmart"
+	"github.com/bfoody/Walmart-Scraper/utils/config"
+	"go.uber.org/zap"
+)
+
+func main() {
+	cfg := fakewalmart.Config{}
+	err := config.Load(&cfg, config.Options{Args: os.Args[1:]})
+	if err != nil {
+		fmt.Println("Error loading config: ", err)
+		os.Exit(1)
+	}
+
+	log, err := zap.NewDevelopment()
+	if err != nil {
+		fmt.Println("Error initializing logging: ", err)
+		os.Exit(1)
+	}
+	log.Debug("loaded config:\n" + config.Dump(&cfg))
+
+	catalogue := fakewalmart.NewCatalogue(cfg.Items, cfg.Seed)
+	server := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           fakewalmart.NewServer(catalogue, cfg, log),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	first := catalogue.Item(0)
+	log.Info("fake walmart listening", zap.String("addr", cfg.Addr), zap.Int("items", catalogue.Len()), zap.String("firstItem", fmt.Sprintf("/ip/%s/%s", first.Slug, first.ID)))
+
+	if err := server.ListenAndServe(); err != nil {
+		log.Fatal("fake walmart stopped", zap.Error(err))
+	}
+}
@@ -0,0 +1,100 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bfoody/Walmart-Scraper/logging"
+	"github.com/bfoody/Walmart-Scraper/utils/config"
+)
+
+// A Config contains the client's connection, scraping and observability options,
+// loaded from a config file, environment variables and flags. The rate limit,
+// proxies and circuit breaker thresholds are reloaded on SIGHUP or config file change.
+type Config struct {
+	AMQPURL              string         `env:"SCR_AMQP_URL" yaml:"amqp_url" flag:"amqp-url" default:"amqp://localhost:5672" secret:"true" validate:"nonempty" usage:"the URL of the AMQP server"`
+	AMQPExchange         string         `env:"SCR_AMQP_EXCHANGE" yaml:"amqp_exchange" flag:"amqp-exchange" default:"test" validate:"nonempty" usage:"the AMQP exchange to communicate with the hub on"`
+	Concurrency          int            `env:"SCR_CLIENT_CONCURRENCY" yaml:"concurrency" flag:"concurrency" default:"8" validate:"min=1" usage:"the maximum number of tasks to run at once"`
+	RateLimit            int            `env:"SCR_CLIENT_RATE_LIMIT" yaml:"rate_limit" flag:"rate-limit" default:"10" reload:"true" validate:"min=1" usage:"the maximum number of requests per second"`
+	Proxies              []string       `env:"SCR_CLIENT_PROXIES" yaml:"proxies" flag:"proxies" default:"" secret:"true" reload:"true" usage:"a comma-separated list of proxies to rotate between"`
+	ProxyFile            string         `env:"SCR_CLIENT_PROXY_FILE" yaml:"proxy_file" flag:"proxy-file" default:"" usage:"a file of proxies to rotate between, one per line"`
+	ProxyCooldownAfter   int            `env:"SCR_CLIENT_PROXY_COOLDOWN_AFTER" yaml:"proxy_cooldown_after" flag:"proxy-cooldown-after" default:"3" validate:"min=1" usage:"the number of consecutive failed requests through a proxy that rest it"`
+	ProxyCooldown        time.Duration  `env:"SCR_CLIENT_PROXY_COOLDOWN" yaml:"proxy_cooldown" flag:"proxy-cooldown" default:"1m" validate:"min=1s" usage:"how long a failing or blocked proxy rests for, doubling each time it fails again"`
+	ProxyQuarantineAfter int            `env:"SCR_CLIENT_PROXY_QUARANTINE_AFTER" yaml:"proxy_quarantine_after" flag:"proxy-quarantine-after" default:"3" validate:"min=1" usage:"the number of consecutive cooldowns that take a proxy out of rotation"`
+	ProxyQuarantine      time.Duration  `env:"SCR_CLIENT_PROXY_QUARANTINE" yaml:"proxy_quarantine" flag:"proxy-quarantine" default:"30m" validate:"min=1s" usage:"how long a proxy that keeps failing is taken out of rotation for"`
+	ProxySessionTTL      time.Duration  `env:"SCR_CLIENT_PROXY_SESSION_TTL" yaml:"proxy_session_ttl" flag:"proxy-session-ttl" default:"10m" usage:"how long a product's requests stick to the same proxy"`
+	BreakerThreshold     int            `env:"SCR_CLIENT_BREAKER_THRESHOLD" yaml:"breaker_threshold" flag:"breaker-threshold" default:"10" reload:"true" validate:"min=1" usage:"the number of consecutive failed requests to a host that open its circuit"`
+	BreakerOpenFor       time.Duration  `env:"SCR_CLIENT_BREAKER_OPEN_FOR" yaml:"breaker_open_for" flag:"breaker-open-for" default:"30s" reload:"true" validate:"min=1s" usage:"how long an open circuit fails requests to its host before probing it"`
+	BreakerProbes        int            `env:"SCR_CLIENT_BREAKER_PROBES" yaml:"breaker_probes" flag:"breaker-probes" default:"3" reload:"true" validate:"min=1" usage:"the number of successful probes that close a host's circuit"`
+	SpoolPath            string         `env:"SCR_CLIENT_SPOOL_PATH" yaml:"spool_path" flag:"spool-path" default:"client-spool.jsonl" usage:"the file results are spooled to while they can't be sent to the hub, empty to drop them instead"`
+	SpoolMaxEntries      int            `env:"SCR_CLIENT_SPOOL_MAX_ENTRIES" yaml:"spool_max_entries" flag:"spool-max-entries" default:"10000" validate:"min=1" usage:"the most results spooled, dropping the oldest beyond it"`
+	SpoolMaxMB           int            `env:"SCR_CLIENT_SPOOL_MAX_MB" yaml:"spool_max_mb" flag:"spool-max-mb" default:"64" validate:"min=1" usage:"the most megabytes of results spooled, dropping the oldest beyond it"`
+	SpoolMaxAge          time.Duration  `env:"SCR_CLIENT_SPOOL_MAX_AGE" yaml:"spool_max_age" flag:"spool-max-age" default:"24h" validate:"min=1m" usage:"how long spooled results are kept before being dropped"`
+	HubTimeout           time.Duration  `env:"SCR_CLIENT_HUB_TIMEOUT" yaml:"hub_timeout" flag:"hub-timeout" default:"15s" validate:"min=1s" usage:"how long without a heartbeat from the hub before results are spooled until a hub takes over"`
+	WalmartBaseURL       string         `env:"SCR_WALMART_BASE_URL" yaml:"walmart_base_url" flag:"walmart-base-url" default:"" usage:"the base URL of the Walmart site to scrape, empty for https://walmart.com"`
+	WalmartQuimbyURL     string         `env:"SCR_WALMART_QUIMBY_URL" yaml:"walmart_quimby_url" flag:"walmart-quimby-url" default:"" usage:"the base URL of Walmart's recommendation service, empty for https://quimby.mobile.walmart.com"`
+	AdminAddr            string         `env:"SCR_CLIENT_ADMIN_ADDR" yaml:"admin_addr" flag:"admin-addr" default:":9091" usage:"the address to serve /metrics, /healthz and /readyz on"`
+	TracingExporter      string         `env:"SCR_TRACING_EXPORTER" yaml:"tracing_exporter" flag:"tracing-exporter" default:"none" validate:"oneof=none stdout otlp" usage:"the tracing exporter to use: none, stdout or otlp"`
+	TracingEndpoint      string         `env:"SCR_TRACING_ENDPOINT" yaml:"tracing_endpoint" flag:"tracing-endpoint" default:"localhost:4317" usage:"the OTLP collector's gRPC endpoint"`
+	Logging              logging.Config `yaml:"logging"`
+}
+
+// configOptions returns the options to load the config with from `args`.
+func configOptions(args []string) config.Options {
+	return config.Options{
+		File: os.Getenv("SCR_CONFIG_FILE"),
+		Args: args,
+	}
+}
+
+// ConfigFilePath returns the path of the config file LoadConfig would read for
+// `args`, or "" if there is none.
+func ConfigFilePath(args []string) (string, error) {
+	return config.FilePath(&Config{}, configOptions(args))
+}
+
+// LoadConfig loads all config options into a *Config from the file named by
+// SCR_CONFIG_FILE (or the `-config` flag), environment variables and flags parsed
+// from `args`, then appends any proxies listed in the ProxyFile.
+func LoadConfig(args []string) (*Config, error) {
+	cfg := Config{}
+
+	err := config.Load(&cfg, configOptions(args))
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.ProxyFile != "" {
+		proxies, err := readProxyFile(cfg.ProxyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.Proxies = append(cfg.Proxies, proxies...)
+	}
+
+	return &cfg, nil
+}
+
+// readProxyFile reads a list of proxies from a file, one per line, skipping blank
+// lines and lines starting with "#".
+func readProxyFile(path string) ([]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	proxies := []string{}
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		proxies = append(proxies, line)
+	}
+
+	return proxies, nil
+}
@@ -0,0 +1,220 @@
+package cassette
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	httpConfig "github.com/bfoody/Walmart-Scraper/services/client/internal/http"
+	"gopkg.in/yaml.v2"
+)
+
+// A Mode is whether a Recorder replays or records responses.
+type Mode int
+
+const (
+	// ModeReplay replays responses from the cassette without sending requests.
+	ModeReplay Mode = iota
+	// ModeRecord sends requests and records their responses to the cassette.
+	ModeRecord
+)
+
+// ErrNoInteraction is returned when replaying a request that isn't on the cassette.
+var ErrNoInteraction = errors.New("no recorded interaction matches request")
+
+// A Cassette is a list of recorded HTTP interactions, saved as YAML.
+type Cassette struct {
+	Interactions []Interaction `yaml:"interactions"`
+}
+
+// An Interaction is a single recorded request and its response.
+type Interaction struct {
+	Request  Request  `yaml:"request"`
+	Response Response `yaml:"response"`
+}
+
+// A Request is the part of a recorded request used to match it.
+type Request struct {
+	Method string `yaml:"method"`
+	URL    string `yaml:"url"`
+}
+
+// A Response is a recorded response.
+type Response struct {
+	StatusCode int               `yaml:"status_code"`
+	Headers    map[string]string `yaml:"headers,omitempty"`
+	Body       string            `yaml:"body"`
+}
+
+// A Recorder is an http.RoundTripper which replays responses from a cassette file, or
+// records them to it, so that scrapers can be tested offline against real pages.
+type Recorder struct {
+	path        string
+	mode        Mode
+	transport   http.RoundTripper // the transport requests are sent with when recording
+	ignoreQuery []string          // query parameters ignored when matching requests
+	cassette    *Cassette
+	mutex       *sync.Mutex
+}
+
+// New creates and returns a new *Recorder for the cassette file at `path`, loading the
+// cassette when replaying. Requests are sent with `transport` when recording, or a
+// transport decoding compressed bodies if it is nil, so that cassettes are readable.
+func New(path string, mode Mode, transport http.RoundTripper) (*Recorder, error) {
+	if transport == nil {
+		transport = httpConfig.NewDecodingTransport(httpConfig.NewTransport())
+	}
+
+	r := &Recorder{
+		path:        path,
+		mode:        mode,
+		transport:   transport,
+		ignoreQuery: []string{},
+		cassette:    &Cassette{Interactions: []Interaction{}},
+		mutex:       &sync.Mutex{},
+	}
+
+	if mode == ModeReplay {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := yaml.Unmarshal(b, r.cassette); err != nil {
+			return nil, fmt.Errorf("error decoding cassette %s: %w", path, err)
+		}
+	}
+
+	return r, nil
+}
+
+// IgnoreQuery ignores query parameters when matching requests, for parameters which
+// change between requests, eg. random request IDs.
+func (r *Recorder) IgnoreQuery(params ...string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.ignoreQuery = append(r.ignoreQuery, params...)
+}
+
+// RoundTrip replays or records the response to a request.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	if r.mode == ModeRecord {
+		return r.record(req)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	key := r.matchKey(req.Method, req.URL)
+	for _, interaction := range r.cassette.Interactions {
+		u, err := url.Parse(interaction.Request.URL)
+		if err != nil {
+			continue
+		}
+
+		if r.matchKey(interaction.Request.Method, u) == key {
+			return interaction.Response.toHTTP(req), nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, req.Method, req.URL)
+}
+
+// record sends a request and records its response.
+func (r *Recorder) record(req *http.Request) (*http.Response, error) {
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := map[string]string{}
+	for _, key := range []string{"Content-Type", "Location"} {
+		if value := resp.Header.Get(key); value != "" {
+			headers[key] = value
+		}
+	}
+
+	response := Response{
+		StatusCode: resp.StatusCode,
+		Headers:    headers,
+		Body:       string(body),
+	}
+
+	r.mutex.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{
+		Request:  Request{Method: req.Method, URL: req.URL.String()},
+		Response: response,
+	})
+	r.mutex.Unlock()
+
+	return response.toHTTP(req), nil
+}
+
+// Save writes the recorded interactions to the cassette file, creating its directory
+// if needed. Nothing is written when replaying.
+func (r *Recorder) Save() error {
+	if r.mode != ModeRecord {
+		return nil
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	b, err := yaml.Marshal(r.cassette)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(r.path, b, 0644)
+}
+
+// matchKey returns the key requests are matched by, their method and URL without
+// ignored query parameters.
+func (r *Recorder) matchKey(method string, u *url.URL) string {
+	query := u.Query()
+	for _, param := range r.ignoreQuery {
+		query.Del(param)
+	}
+
+	stripped := *u
+	stripped.RawQuery = query.Encode()
+
+	return method + " " + stripped.String()
+}
+
+// toHTTP converts a recorded response to an *http.Response to a request.
+func (resp Response) toHTTP(req *http.Request) *http.Response {
+	header := http.Header{}
+	for key, value := range resp.Headers {
+		header.Set(key, value)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode)),
+		StatusCode:    resp.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewBufferString(resp.Body)),
+		ContentLength: int64(len(resp.Body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,65 @@
+package cassette_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/api/cassette"
+)
+
+// TestRecordAndReplay tests that recorded responses are replayed without sending
+// requests, ignoring the configured query parameters.
+func TestRecordAndReplay(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("recorded body"))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "cassette.yaml")
+
+	recorder, err := cassette.New(path, cassette.ModeRecord, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{Transport: recorder}
+	if _, err := client.Get(server.URL + "/item?id=1&reqId=a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := recorder.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	replayer, err := cassette.New(path, cassette.ModeReplay, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayer.IgnoreQuery("reqId")
+
+	client = &http.Client{Transport: replayer}
+	resp, err := client.Get(server.URL + "/item?id=1&reqId=b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusTeapot || string(body) != "recorded body" {
+		t.Errorf("unexpected replayed response %d %q", resp.StatusCode, body)
+	}
+
+	if requests != 1 {
+		t.Errorf("expected 1 request to be sent, got %d", requests)
+	}
+
+	if _, err := client.Get(server.URL + "/item?id=2"); !errors.Is(err, cassette.ErrNoInteraction) {
+		t.Errorf("expected ErrNoInteraction, got %v", err)
+	}
+}
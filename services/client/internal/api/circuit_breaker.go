@@ -0,0 +1,353 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// ErrCircuitOpen is returned, wrapped in a *CircuitOpenError, for requests to a host
+// whose circuit is open.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// The states of a host's circuit in a CircuitBreaker.
+const (
+	// CircuitClosed is a circuit letting requests through.
+	CircuitClosed = "closed"
+	// CircuitOpen is a circuit failing requests straight away after repeated failures.
+	CircuitOpen = "open"
+	// CircuitHalfOpen is a circuit letting a few probe requests through to find out
+	// whether the host has recovered.
+	CircuitHalfOpen = "half_open"
+)
+
+// circuitStateValues are the values of the CircuitState metric for each state.
+var circuitStateValues = map[string]float64{
+	CircuitClosed:   0,
+	CircuitOpen:     1,
+	CircuitHalfOpen: 2,
+}
+
+// CircuitBreakerOptions control when a CircuitBreaker opens and closes circuits.
+type CircuitBreakerOptions struct {
+	FailureThreshold int           // the number of consecutive failures that open a circuit
+	OpenFor          time.Duration // how long a circuit stays open before probing the host
+	Probes           int           // the number of successful probes that close a half open circuit
+}
+
+// DefaultCircuitBreakerOptions returns the default CircuitBreakerOptions.
+func DefaultCircuitBreakerOptions() CircuitBreakerOptions {
+	return CircuitBreakerOptions{
+		FailureThreshold: 10,
+		OpenFor:          30 * time.Second,
+		Probes:           3,
+	}
+}
+
+// A CircuitOpenError is returned for a request to a host whose circuit is open.
+type CircuitOpenError struct {
+	Host       string
+	Retailer   string
+	RetryAfter time.Duration // how long until the circuit lets requests through again
+}
+
+// Error prints the CircuitOpenError as a string.
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit open for %s, retry after %s", e.Host, e.RetryAfter)
+}
+
+// Unwrap returns ErrCircuitOpen, so that errors.Is(err, ErrCircuitOpen) matches.
+func (e *CircuitOpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
+
+// A Circuit is a snapshot of the state of a host's circuit.
+type Circuit struct {
+	Host       string
+	Retailer   string // the retailer last scraped from the host, if known
+	State      string
+	RetryAfter time.Duration // how long until an open circuit starts probing the host
+}
+
+// A circuit is the state of a single host in a CircuitBreaker.
+type circuit struct {
+	host      string
+	retailer  string
+	state     string
+	failures  int       // consecutive failures while closed
+	probes    int       // probes in flight while half open
+	successes int       // successful probes while half open
+	until     time.Time // when an open circuit starts probing the host
+	epoch     int       // incremented on every change of state
+}
+
+// A Permit is a request let through by a CircuitBreaker, whose outcome must be passed
+// to Record or Release.
+type Permit struct {
+	host  string
+	probe bool // whether the request probes a half open circuit
+	epoch int  // the circuit's epoch when the request was let through
+}
+
+// A CircuitBreaker fails requests to a host straight away after repeated failures,
+// so that clients don't make an outage and the risk of a ban worse by retrying.
+// After a while, a few probe requests are let through, closing the circuit again
+// if they succeed.
+type CircuitBreaker struct {
+	mutex    *sync.Mutex
+	options  CircuitBreakerOptions
+	circuits map[string]*circuit
+	onChange func(circuit Circuit)
+	now      func() time.Time
+	log      *zap.Logger
+}
+
+// NewCircuitBreaker creates and returns a new *CircuitBreaker.
+func NewCircuitBreaker(options CircuitBreakerOptions, logger *zap.Logger) *CircuitBreaker {
+	return &CircuitBreaker{
+		mutex:    &sync.Mutex{},
+		options:  options,
+		circuits: map[string]*circuit{},
+		now:      time.Now,
+		log:      logger,
+	}
+}
+
+// OnChange registers a function called whenever a circuit changes state. It is
+// called without the breaker's lock held, so it may call the breaker.
+func (b *CircuitBreaker) OnChange(onChange func(circuit Circuit)) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.onChange = onChange
+}
+
+// circuit returns the circuit of a host, creating a closed one if there is none.
+// Must be called with the mutex held.
+func (b *CircuitBreaker) circuit(host string) *circuit {
+	c, ok := b.circuits[host]
+	if !ok {
+		c = &circuit{host: host, state: CircuitClosed}
+		b.circuits[host] = c
+	}
+
+	return c
+}
+
+// Allow returns a *CircuitOpenError if a request to a host shouldn't be sent, or a
+// Permit if it may be, whose outcome must be passed to Record or Release. `retailer`
+// is the retailer being scraped, if known, to report with the circuit.
+func (b *CircuitBreaker) Allow(host string, retailer string) (Permit, error) {
+	b.mutex.Lock()
+	c := b.circuit(host)
+	if retailer != "" {
+		c.retailer = retailer
+	}
+
+	now := b.now()
+	changed := false
+	if c.state == CircuitOpen && !now.Before(c.until) {
+		b.transition(c, CircuitHalfOpen)
+		changed = true
+	}
+
+	permit := Permit{host: host, epoch: c.epoch}
+	var err error
+	switch c.state {
+	case CircuitOpen:
+		err = &CircuitOpenError{Host: host, Retailer: c.retailer, RetryAfter: c.until.Sub(now)}
+	case CircuitHalfOpen:
+		if c.probes >= b.options.Probes {
+			err = &CircuitOpenError{Host: host, Retailer: c.retailer}
+		} else {
+			c.probes++
+			permit.probe = true
+		}
+	}
+
+	b.unlock(c, changed)
+
+	return permit, err
+}
+
+// Record records the outcome of a request allowed by Allow, opening the host's
+// circuit after repeated failures or a failed probe, and closing it after enough
+// successful probes. Outcomes of requests let through before the circuit last changed
+// state are ignored, so that only probes count towards closing it.
+func (b *CircuitBreaker) Record(permit Permit, failed bool) {
+	b.mutex.Lock()
+	c := b.circuit(permit.host)
+	if permit.epoch != c.epoch {
+		b.mutex.Unlock()
+		return
+	}
+
+	changed := false
+	switch c.state {
+	case CircuitClosed:
+		if !failed {
+			c.failures = 0
+			break
+		}
+
+		c.failures++
+		if c.failures >= b.options.FailureThreshold {
+			b.open(c)
+			changed = true
+		}
+	case CircuitHalfOpen:
+		if !permit.probe {
+			break
+		}
+
+		c.probes--
+		if failed {
+			b.open(c)
+			changed = true
+			break
+		}
+
+		c.successes++
+		if c.successes >= b.options.Probes {
+			b.transition(c, CircuitClosed)
+			changed = true
+		}
+	}
+
+	b.unlock(c, changed)
+}
+
+// Release releases a request allowed by Allow which neither succeeded nor failed,
+// eg. because it was cancelled, letting another probe through in its place.
+func (b *CircuitBreaker) Release(permit Permit) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if c := b.circuit(permit.host); permit.probe && permit.epoch == c.epoch && c.probes > 0 {
+		c.probes--
+	}
+}
+
+// open opens a circuit. Must be called with the mutex held.
+func (b *CircuitBreaker) open(c *circuit) {
+	c.until = b.now().Add(b.options.OpenFor)
+	b.transition(c, CircuitOpen)
+
+	b.log.Warn("opening circuit", zap.String("host", c.host), zap.String("retailer", c.retailer), zap.Duration("for", b.options.OpenFor))
+}
+
+// transition moves a circuit to a new state, resetting its counters. Must be called
+// with the mutex held.
+func (b *CircuitBreaker) transition(c *circuit, state string) {
+	if state == CircuitClosed {
+		b.log.Info("closing circuit", zap.String("host", c.host), zap.String("retailer", c.retailer))
+	}
+
+	c.state = state
+	c.epoch++
+	c.failures = 0
+	c.probes = 0
+	c.successes = 0
+
+	metrics.CircuitState.WithLabelValues(c.host).Set(circuitStateValues[state])
+}
+
+// unlock releases the mutex, then calls the change handler with a snapshot of a
+// circuit if it changed state.
+func (b *CircuitBreaker) unlock(c *circuit, changed bool) {
+	snapshot := b.snapshot(c)
+	onChange := b.onChange
+	b.mutex.Unlock()
+
+	if changed && onChange != nil {
+		onChange(snapshot)
+	}
+}
+
+// snapshot returns a snapshot of a circuit. Must be called with the mutex held.
+func (b *CircuitBreaker) snapshot(c *circuit) Circuit {
+	circuit := Circuit{
+		Host:     c.host,
+		Retailer: c.retailer,
+		State:    c.state,
+	}
+	if c.state == CircuitOpen {
+		circuit.RetryAfter = c.until.Sub(b.now())
+	}
+
+	return circuit
+}
+
+// SetOptions replaces the breaker's options, taking effect from the next request.
+func (b *CircuitBreaker) SetOptions(options CircuitBreakerOptions) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.options = options
+}
+
+// Circuits returns snapshots of every circuit that isn't closed, sorted by host.
+func (b *CircuitBreaker) Circuits() []Circuit {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	circuits := []Circuit{}
+	for _, c := range b.circuits {
+		if c.state != CircuitClosed {
+			circuits = append(circuits, b.snapshot(c))
+		}
+	}
+
+	sort.Slice(circuits, func(i, j int) bool { return circuits[i].Host < circuits[j].Host })
+
+	return circuits
+}
+
+// degraded returns true if a response, or the lack of one, suggests its host is
+// degraded: the request failed, the host returned a server error, or it is rate
+// limiting clients. Proxy errors say nothing about the host, and must be excluded
+// with isProxyError first.
+func degraded(resp *http.Response, err error) bool {
+	if err != nil || resp == nil {
+		return true
+	}
+
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+}
+
+// isProxyError returns true if a request failed because of the proxy it was sent
+// through rather than its host: the proxy couldn't be reached, refused to connect to
+// the host, or asked for authentication.
+func isProxyError(resp *http.Response, err error) bool {
+	if err == nil {
+		return resp != nil && resp.StatusCode == http.StatusProxyAuthRequired
+	}
+
+	// Dial and CONNECT failures of proxied requests are wrapped in a "proxyconnect"
+	// *net.OpError by the transport.
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "proxyconnect"
+}
+
+// retailerKey is the context key of the retailer a request scrapes.
+type retailerKey struct{}
+
+// WithRetailer returns a copy of `ctx` recording the retailer requests sent with it
+// scrape, so that circuits can be reported with their retailer.
+func WithRetailer(ctx context.Context, retailer string) context.Context {
+	return context.WithValue(ctx, retailerKey{}, retailer)
+}
+
+// retailerFromContext returns the retailer recorded by WithRetailer, or "".
+func retailerFromContext(ctx context.Context) string {
+	retailer, _ := ctx.Value(retailerKey{}).(string)
+	return retailer
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// TestCircuitBreaker tests that a host's circuit opens after repeated failures, fails
+// requests while open, and closes after enough successful probes.
+func TestCircuitBreaker(t *testing.T) {
+	b := NewCircuitBreaker(CircuitBreakerOptions{FailureThreshold: 3, OpenFor: 30 * time.Second, Probes: 2}, zap.NewNop())
+	now := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+
+	changes := []string{}
+	b.OnChange(func(circuit Circuit) { changes = append(changes, circuit.State) })
+
+	// A slow request is let through before the circuit opens.
+	slow, err := b.Allow("www.walmart.com", "walmart")
+	if err != nil {
+		t.Fatalf("expected closed circuit to allow requests, got %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		permit, err := b.Allow("www.walmart.com", "walmart")
+		if err != nil {
+			t.Fatalf("expected closed circuit to allow requests, got %v", err)
+		}
+		b.Record(permit, true)
+	}
+
+	_, err = b.Allow("www.walmart.com", "")
+	circuitErr := &CircuitOpenError{}
+	if !errors.As(err, &circuitErr) || !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected open circuit to fail requests, got %v", err)
+	}
+	if circuitErr.Retailer != "walmart" || circuitErr.RetryAfter != 30*time.Second {
+		t.Errorf("expected error for walmart retrying after 30s, got %+v", circuitErr)
+	}
+
+	if _, err := b.Allow("quimby.mobile.walmart.com", ""); err != nil {
+		t.Errorf("expected hosts to have separate circuits, got %v", err)
+	}
+
+	// Once open for long enough, only as many probes as needed to close the circuit
+	// are let through.
+	now = now.Add(30 * time.Second)
+	probes := []Permit{}
+	for i := 0; i < 2; i++ {
+		permit, err := b.Allow("www.walmart.com", "")
+		if err != nil {
+			t.Fatalf("expected probe %d to be allowed, got %v", i+1, err)
+		}
+		probes = append(probes, permit)
+	}
+	if _, err := b.Allow("www.walmart.com", ""); err == nil {
+		t.Fatal("expected requests beyond the probes to fail")
+	}
+
+	// The slow request isn't a probe, so its outcome neither closes the circuit nor
+	// frees a probe.
+	b.Record(slow, false)
+	b.Release(slow)
+	if _, err := b.Allow("www.walmart.com", ""); err == nil {
+		t.Fatal("expected the slow request not to count as a probe")
+	}
+
+	for _, probe := range probes {
+		b.Record(probe, false)
+	}
+
+	if circuits := b.Circuits(); len(circuits) != 0 {
+		t.Errorf("expected every circuit to be closed, got %+v", circuits)
+	}
+
+	expected := []string{CircuitOpen, CircuitHalfOpen, CircuitClosed}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected changes %v, got %v", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("expected changes %v, got %v", expected, changes)
+		}
+	}
+}
+
+// TestIsProxyError tests that failures of a proxy aren't mistaken for failures of the
+// host requested through it.
+func TestIsProxyError(t *testing.T) {
+	// Nothing listens on the proxy's address once it is closed.
+	proxy := httptest.NewServer(http.NotFoundHandler())
+	proxy.Close()
+
+	c := NewHTTPClient()
+	if err := c.SetProxy(proxy.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := c.client.Get("http://www.walmart.com/")
+	if !isProxyError(nil, err) {
+		t.Errorf("expected unreachable proxy to be a proxy error, got %v", err)
+	}
+
+	if !isProxyError(&http.Response{StatusCode: http.StatusProxyAuthRequired}, nil) {
+		t.Error("expected 407 Proxy Authentication Required to be a proxy error")
+	}
+
+	if isProxyError(&http.Response{StatusCode: http.StatusBadGateway}, nil) || isProxyError(nil, errors.New("connection reset")) {
+		t.Error("expected other failures not to be proxy errors")
+	}
+}
@@ -1,9 +1,12 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 // HTTPError wraps a `net/http` error that occurs during a request.
@@ -16,6 +19,12 @@ func (e *HTTPError) Error() string {
 	return e.WrappedError.Error()
 }
 
+// Unwrap returns the wrapped error, so that errors.Is(err, context.Canceled) matches
+// cancelled requests.
+func (e *HTTPError) Unwrap() error {
+	return e.WrappedError
+}
+
 // IntoHTTPError takes an error and wraps it with a *HTTPError.
 func IntoHTTPError(err error) *HTTPError {
 	return &HTTPError{
@@ -36,11 +45,16 @@ func (e *APIError) Error() string {
 	return fmt.Sprintf("api error %s\n\t%s\n\tgot body: %s", e.Reference, e.Message, e.ResponseBody)
 }
 
+// Unwrap returns the originating error, so that errors.Is matches the sentinels below.
+func (e *APIError) Unwrap() error {
+	return e.WrappedError
+}
+
 // NewAPIError creates and returns an *APIError from an *http.Response, message, reference, and
 // wrapped error (or nil).
 func NewAPIError(res *http.Response, message string, reference string, wrappedErr error) *APIError {
 	body := ""
-	bodyB, err := ioutil.ReadAll(res.Body)
+	bodyB, err := ReadBody(res)
 	if err == nil {
 		body = string(bodyB)
 	}
@@ -52,3 +66,125 @@ func NewAPIError(res *http.Response, message string, reference string, wrappedEr
 		WrappedError: wrappedErr,
 	}
 }
+
+// ErrUnsupportedStore is returned by adapters asked to scrape a product at a store
+// when they can only scrape a website's default prices and availability.
+var ErrUnsupportedStore = errors.New("retailer doesn't support store contexts")
+
+// ErrExtractionFailed is returned by adapters when a page matches none of their
+// extraction strategies, eg. after the retailer changes its layout, which retrying
+// won't fix.
+var ErrExtractionFailed = errors.New("no extraction strategy matched the page")
+
+// The classes of response which aren't the page requested, matched with errors.Is
+// against a *ResponseError.
+var (
+	// ErrBlocked is a response blocking the request, eg. a CAPTCHA or robot check page.
+	ErrBlocked = errors.New("blocked by retailer")
+	// ErrRateLimited is a response asking for fewer requests, eg. 429 Too Many Requests.
+	ErrRateLimited = errors.New("rate limited by retailer")
+	// ErrNotFound is a response for a page which doesn't exist, eg. a discontinued item.
+	ErrNotFound = errors.New("page not found")
+	// ErrServerError is a response reporting an error on the retailer's side.
+	ErrServerError = errors.New("retailer server error")
+)
+
+// A BlockDetector returns true if a response, which otherwise looks OK, is a page
+// blocking the request, eg. a robot check served with a 200 status code. Block pages
+// differ between retailers, so each adapter supplies its own with WithBlockDetector.
+type BlockDetector func(res *http.Response, body []byte) bool
+
+// blockDetectorKey is the context key of the BlockDetector of a request.
+type blockDetectorKey struct{}
+
+// WithBlockDetector returns a copy of `ctx` classifying the responses to requests sent
+// with it as blocked when `detect` returns true.
+func WithBlockDetector(ctx context.Context, detect BlockDetector) context.Context {
+	return context.WithValue(ctx, blockDetectorKey{}, detect)
+}
+
+// A ResponseError is returned by an API client when a response isn't the page
+// requested, classifying why so that callers can decide whether and when to retry.
+type ResponseError struct {
+	Class      error         // the class of response, eg. ErrBlocked
+	Reference  string        // a reference for the class, eg. "blocked"
+	StatusCode int           // the response's status code
+	URL        string        // the URL of the response, after redirects
+	RetryAfter time.Duration // how long the retailer asked to wait before retrying, or 0
+}
+
+// Error prints the ResponseError as a string.
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("%s: status %d from %s", e.Class, e.StatusCode, e.URL)
+}
+
+// Unwrap returns the class of the ResponseError, so that errors.Is(err, ErrBlocked)
+// matches blocked responses.
+func (e *ResponseError) Unwrap() error {
+	return e.Class
+}
+
+// ClassifyResponse returns a *ResponseError if a response and its body are a block,
+// rate limit, missing page or server error instead of the page requested, or nil if
+// the response looks OK.
+func ClassifyResponse(res *http.Response, body []byte) error {
+	reference, class := classify(res, body)
+	if class == nil {
+		return nil
+	}
+
+	url := ""
+	if res.Request != nil {
+		url = res.Request.URL.String()
+	}
+
+	return &ResponseError{
+		Class:      class,
+		Reference:  reference,
+		StatusCode: res.StatusCode,
+		URL:        url,
+		RetryAfter: parseRetryAfter(res.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// classify returns the reference and class of a response, or a nil class if the
+// response looks OK.
+func classify(res *http.Response, body []byte) (string, error) {
+	switch {
+	case res.StatusCode == http.StatusTooManyRequests:
+		return "rate_limited", ErrRateLimited
+	case res.StatusCode == http.StatusForbidden:
+		return "blocked", ErrBlocked
+	case res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone:
+		return "not_found", ErrNotFound
+	case res.StatusCode >= 500:
+		return "server_error", ErrServerError
+	}
+
+	if res.Request != nil {
+		detect, ok := res.Request.Context().Value(blockDetectorKey{}).(BlockDetector)
+		if ok && detect(res, body) {
+			return "blocked", ErrBlocked
+		}
+	}
+
+	return "", nil
+}
+
+// parseRetryAfter parses a Retry-After header, either a number of seconds or an HTTP
+// date, returning 0 if it is blank or invalid.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if at, err := http.ParseTime(header); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+
+	return 0
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestClassifyResponse tests that blocks, rate limits, missing pages and server errors
+// are classified, and that OK pages aren't.
+func TestClassifyResponse(t *testing.T) {
+	tests := []struct {
+		status     int
+		header     http.Header
+		body       string
+		class      error
+		retryAfter time.Duration
+	}{
+		{http.StatusOK, nil, "<script id=\"item\">{}</script>", nil, 0},
+		{http.StatusForbidden, nil, "", ErrBlocked, 0},
+		{http.StatusTooManyRequests, http.Header{"Retry-After": {"30"}}, "", ErrRateLimited, 30 * time.Second},
+		{http.StatusNotFound, nil, "", ErrNotFound, 0},
+		{http.StatusServiceUnavailable, http.Header{"Retry-After": {"soon"}}, "", ErrServerError, 0},
+	}
+
+	for _, test := range tests {
+		resp := &http.Response{
+			StatusCode: test.status,
+			Header:     test.header,
+			Request:    httptest.NewRequest(http.MethodGet, "https://walmart.com/ip/item/1", nil),
+		}
+		if resp.Header == nil {
+			resp.Header = http.Header{}
+		}
+
+		err := ClassifyResponse(resp, []byte(test.body))
+		if test.class == nil {
+			if err != nil {
+				t.Errorf("%d: expected no error, got %s", test.status, err)
+			}
+			continue
+		}
+
+		responseErr := &ResponseError{}
+		if !errors.Is(err, test.class) || !errors.As(err, &responseErr) {
+			t.Errorf("%d: expected %s, got %v", test.status, test.class, err)
+			continue
+		}
+
+		if responseErr.RetryAfter != test.retryAfter {
+			t.Errorf("%d: expected retry after %s, got %s", test.status, test.retryAfter, responseErr.RetryAfter)
+		}
+	}
+
+	// Block pages served with a 200 status code are only detected by the request's
+	// BlockDetector.
+	blockPage := []byte("<title>Robot or human?</title>")
+	isBlockPage := func(res *http.Response, body []byte) bool {
+		return bytes.Contains(body, []byte("Robot or human?"))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "https://walmart.com/ip/item/1", nil)
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Request: req}
+	if err := ClassifyResponse(resp, blockPage); err != nil {
+		t.Errorf("expected no error without a block detector, got %s", err)
+	}
+
+	resp.Request = req.WithContext(WithBlockDetector(req.Context(), isBlockPage))
+	if err := ClassifyResponse(resp, blockPage); !errors.Is(err, ErrBlocked) {
+		t.Errorf("expected block page to be blocked, got %v", err)
+	}
+}
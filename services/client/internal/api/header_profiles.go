@@ -0,0 +1,152 @@
+package api
+
+import (
+	"math/rand"
+	"net/http"
+)
+
+// A HeaderProfile is a coherent set of headers sent by a real browser: its user agent,
+// the client hints matching it, and its accept headers. Their order isn't kept, since
+// net/http writes headers in its own order.
+type HeaderProfile struct {
+	Name    string
+	Headers map[string]string
+	// Navigation headers are sent when loading a page, and Fetch headers when calling
+	// an API.
+	Navigation map[string]string
+	Fetch      map[string]string
+}
+
+const (
+	acceptDocument = "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.9"
+	acceptFirefox  = "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8"
+	acceptSafari   = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+)
+
+// chromiumNavigation and chromiumFetch are the fetch metadata headers sent by Chromium
+// based browsers when loading a page and when a page calls an API.
+var (
+	chromiumNavigation = map[string]string{
+		"sec-fetch-site": "none",
+		"sec-fetch-mode": "navigate",
+		"sec-fetch-user": "?1",
+		"sec-fetch-dest": "document",
+	}
+	chromiumFetch = map[string]string{
+		"accept":         "*/*",
+		"sec-fetch-site": "same-origin",
+		"sec-fetch-mode": "cors",
+		"sec-fetch-dest": "empty",
+	}
+)
+
+// HeaderProfiles are the browsers requests are disguised as. Each session picks one
+// at random.
+var HeaderProfiles = []*HeaderProfile{
+	{
+		Name: "chrome-92-macos",
+		Headers: map[string]string{
+			"sec-ch-ua":                 `"Chromium";v="92", " Not A;Brand";v="99", "Google Chrome";v="92"`,
+			"sec-ch-ua-mobile":          "?0",
+			"upgrade-insecure-requests": "1",
+			"user-agent":                "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/92.0.4515.159 Safari/537.36",
+			"accept":                    acceptDocument,
+			"accept-encoding":           "gzip, deflate, br",
+			"accept-language":           "en-US,en;q=0.9",
+		},
+		Navigation: chromiumNavigation,
+		Fetch:      chromiumFetch,
+	},
+	{
+		Name: "chrome-93-windows",
+		Headers: map[string]string{
+			"sec-ch-ua":                 `"Google Chrome";v="93", " Not;A Brand";v="99", "Chromium";v="93"`,
+			"sec-ch-ua-mobile":          "?0",
+			"sec-ch-ua-platform":        `"Windows"`,
+			"upgrade-insecure-requests": "1",
+			"user-agent":                "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/93.0.4577.63 Safari/537.36",
+			"accept":                    acceptDocument,
+			"accept-encoding":           "gzip, deflate, br",
+			"accept-language":           "en-US,en;q=0.9",
+		},
+		Navigation: chromiumNavigation,
+		Fetch:      chromiumFetch,
+	},
+	{
+		Name: "edge-93-windows",
+		Headers: map[string]string{
+			"sec-ch-ua":                 `"Microsoft Edge";v="93", " Not;A Brand";v="99", "Chromium";v="93"`,
+			"sec-ch-ua-mobile":          "?0",
+			"sec-ch-ua-platform":        `"Windows"`,
+			"upgrade-insecure-requests": "1",
+			"user-agent":                "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/93.0.4577.63 Safari/537.36 Edg/93.0.961.38",
+			"accept":                    acceptDocument,
+			"accept-encoding":           "gzip, deflate, br",
+			"accept-language":           "en-US,en;q=0.9",
+		},
+		Navigation: chromiumNavigation,
+		Fetch:      chromiumFetch,
+	},
+	{
+		Name: "firefox-92-windows",
+		Headers: map[string]string{
+			"user-agent":                "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:92.0) Gecko/20100101 Firefox/92.0",
+			"accept":                    acceptFirefox,
+			"accept-language":           "en-US,en;q=0.5",
+			"accept-encoding":           "gzip, deflate, br",
+			"upgrade-insecure-requests": "1",
+		},
+		Navigation: map[string]string{
+			"sec-fetch-dest": "document",
+			"sec-fetch-mode": "navigate",
+			"sec-fetch-site": "none",
+			"sec-fetch-user": "?1",
+		},
+		Fetch: map[string]string{
+			"accept":         "*/*",
+			"sec-fetch-dest": "empty",
+			"sec-fetch-mode": "cors",
+			"sec-fetch-site": "same-origin",
+		},
+	},
+	{
+		// Safari doesn't send client hints or fetch metadata.
+		Name: "safari-14-macos",
+		Headers: map[string]string{
+			"accept":          acceptSafari,
+			"user-agent":      "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/14.1.2 Safari/605.1.15",
+			"accept-language": "en-us",
+			"accept-encoding": "gzip, deflate, br",
+		},
+	},
+}
+
+// randomHeaderProfile returns a random header profile other than `current`, if there
+// are others.
+func randomHeaderProfile(current *HeaderProfile) *HeaderProfile {
+	for {
+		profile := HeaderProfiles[rand.Intn(len(HeaderProfiles))]
+		if profile != current || len(HeaderProfiles) == 1 {
+			return profile
+		}
+	}
+}
+
+// apply sets the profile's headers on a request, with navigation headers when loading
+// a page or fetch headers when calling an API.
+func (p *HeaderProfile) apply(req *http.Request, navigate bool) {
+	extra := p.Fetch
+	if navigate {
+		extra = p.Navigation
+	}
+
+	for _, headers := range []map[string]string{p.Headers, extra} {
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+	}
+
+	if !navigate {
+		req.Header.Del("upgrade-insecure-requests")
+	}
+}
@@ -2,52 +2,230 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"net/http/cookiejar"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/bfoody/Walmart-Scraper/domain"
 	httpConfig "github.com/bfoody/Walmart-Scraper/services/client/internal/http"
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/metrics"
+	"golang.org/x/net/publicsuffix"
 )
 
 // HTTPClient wraps an http client and provides convenience methods for sending
-// GET and POST requests with simulated browser user agents.
+// GET and POST requests disguised as a browser session: every request in a session
+// sends the same header profile, and requests for the same store share a cookie jar.
+// A new session is started whenever a response is blocked.
 type HTTPClient struct {
-	client *http.Client
+	client  *http.Client
+	observe func(resp *http.Response, latency time.Duration, err error) // called after every request, eg. to score a proxy
+	mutex   *sync.Mutex
+	session *httpSession
+
+	maxBodySize int64           // the largest response body read, in bytes
+	breaker     *CircuitBreaker // fails requests to degraded hosts, if set
+}
+
+// An httpSession is the browser a client's requests are disguised as.
+type httpSession struct {
+	profile *HeaderProfile
+	jars    map[domain.StoreContext]http.CookieJar // the cookies of each store, so that one store's location cookies aren't sent for another
 }
 
 // NewHTTPClient creates and returns a new HTTPClient with a pre-configured
-// http.Client.
+// http.Client, starting a session with a random header profile.
 func NewHTTPClient() *HTTPClient {
-	return &HTTPClient{
-		client: httpConfig.NewClient(),
+	c := &HTTPClient{
+		client:      httpConfig.NewClient(),
+		mutex:       &sync.Mutex{},
+		maxBodySize: DefaultMaxBodySize,
+	}
+
+	c.NewSession()
+
+	return c
+}
+
+// NewSession starts a new session with a different header profile and no cookies, eg.
+// after the previous one is blocked.
+func (c *HTTPClient) NewSession() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var current *HeaderProfile
+	if c.session != nil {
+		current = c.session.profile
+	}
+
+	c.session = &httpSession{
+		profile: randomHeaderProfile(current),
+		jars:    map[domain.StoreContext]http.CookieJar{},
 	}
 }
 
-// User agent of Chrome 89 running on macOS 11.3.
-var simulatedHeaders = map[string]string{
-	"authority":                         "www.walmart.com",
-	"cache-control":                     "max-age=0",
-	"accept":                            "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.9",
-	"service-worker-navigation-preload": "true",
-	"User-Agent":                        "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/92.0.4515.159 Safari/537.36",
-	"sec-ch-ua":                         "\"Google Chrome\";v=\"92\", \"Chromium\";v=\"92\", \";Not A Brand\";v=\"99\"",
-	"sec-ch-ua-mobile":                  "?0",
-	"sec-fetch-dest":                    "document",
-	"sec-fetch-mode":                    "navigate",
-	"sec-fetch-site":                    "none",
-	"sec-fetch-user":                    "?1",
+// Profile returns the name of the header profile of the client's current session.
+func (c *HTTPClient) Profile() string {
+	return c.currentSession().profile.Name
+}
+
+// currentSession returns the client's current session.
+func (c *HTTPClient) currentSession() *httpSession {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.session
+}
+
+// jar returns the cookie jar of a store in the client's current session, creating an
+// empty one if it has none.
+func (c *HTTPClient) jar(store domain.StoreContext) http.CookieJar {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	jar, ok := c.session.jars[store]
+	if !ok {
+		// cookiejar.New only fails with invalid options.
+		jar, _ = cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+		c.session.jars[store] = jar
+	}
+
+	return jar
+}
+
+// storeKey is the context key of the store a request scrapes.
+type storeKey struct{}
+
+// WithStore returns a copy of `ctx` recording the store requests sent with it scrape,
+// so that they only share cookies with requests for the same store.
+func WithStore(ctx context.Context, store domain.StoreContext) context.Context {
+	return context.WithValue(ctx, storeKey{}, store)
+}
+
+// storeFromContext returns the store recorded by WithStore, or the default store.
+func storeFromContext(ctx context.Context) domain.StoreContext {
+	store, _ := ctx.Value(storeKey{}).(domain.StoreContext)
+	return store
+}
+
+// DefaultMaxBodySize is the largest response body read by default, in bytes. Item
+// pages are a few hundred kilobytes, so anything much larger is likely a trap or a
+// misbehaving proxy.
+const DefaultMaxBodySize = 10 << 20
+
+// ErrBodyTooLarge is returned when reading a response body larger than the client's
+// maximum body size.
+var ErrBodyTooLarge = errors.New("response body too large")
+
+// A limitedBody is a response body that fails with ErrBodyTooLarge after `remaining`
+// bytes.
+type limitedBody struct {
+	body      io.ReadCloser
+	remaining int64
+}
+
+// Read implements io.Reader.
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, ErrBodyTooLarge
+	}
+
+	// Read one byte past the limit to tell a body of exactly the limit from a larger
+	// one.
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+
+	n, err := b.body.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n + int(b.remaining), ErrBodyTooLarge
+	}
+
+	return n, err
+}
+
+// Close implements io.Closer.
+func (b *limitedBody) Close() error {
+	return b.body.Close()
+}
+
+// ReadBody reads and closes a response body. It doesn't limit the body's size itself:
+// an HTTPClient fails requests whose responses have bodies larger than its maximum
+// body size with ErrBodyTooLarge before returning them.
+func ReadBody(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// SetCircuitBreaker sets the circuit breaker requests are checked against and
+// recorded to. Clients sharing a breaker share the state of each host.
+func (c *HTTPClient) SetCircuitBreaker(breaker *CircuitBreaker) {
+	c.breaker = breaker
+}
+
+// SetMaxBodySize sets the largest response body read, in bytes.
+func (c *HTTPClient) SetMaxBodySize(size int64) {
+	c.maxBodySize = size
 }
 
-// addSimulatedHeaders adds various HTTP headers to a request in order to simulate
-// a human visiting the site with a browser. This lowers the chance of CAPTCHA traps
-// and IP blocks.
-func addSimulatedHeaders(req *http.Request) {
-	// Iterate simulated headers map and set each header.
-	for key, value := range simulatedHeaders {
-		req.Header.Set(key, value)
+// finishResponse records the status code of a response to a request sent at `start`,
+// or "error" if the request failed, to metrics, and limits the size of its body. The
+// response's body is read into memory so that it can be classified, starting a new
+// session if it is blocked and passing it to the client's observer, if any, and an
+// error is returned if it can't be read. Requests cancelled by their context aren't
+// observed, as they say nothing about the proxy they were sent through.
+func (c *HTTPClient) finishResponse(req *http.Request, start time.Time, resp *http.Response, err error) error {
+	code := "error"
+	if err == nil && resp != nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+
+	metrics.HTTPResponses.WithLabelValues(req.URL.Host, code).Inc()
+
+	if err != nil {
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		if c.observe != nil && req.Context().Err() == nil {
+			c.observe(resp, time.Since(start), err)
+		}
+
+		return err
+	}
+
+	resp.Body = &limitedBody{body: resp.Body, remaining: c.maxBodySize}
+
+	body, err := ReadBody(resp)
+	if err != nil {
+		if c.observe != nil && req.Context().Err() == nil {
+			c.observe(resp, time.Since(start), err)
+		}
+
+		return err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	classification := ClassifyResponse(resp, body)
+	if OutcomeOf(resp, classification) == ProxyBlocked {
+		c.NewSession()
+	}
+
+	if c.observe != nil {
+		c.observe(resp, time.Since(start), classification)
 	}
+
+	return nil
 }
 
 // SetProxy sets the HTTP client's proxy using a URL.
@@ -61,51 +239,100 @@ func (c *HTTPClient) SetProxy(urlStr string) error {
 		return err
 	}
 
-	c.client.Transport = &http.Transport{Proxy: http.ProxyURL(proxy)}
+	transport := httpConfig.NewTransport()
+	transport.Proxy = http.ProxyURL(proxy)
+	c.client.Transport = httpConfig.NewDecodingTransport(transport)
 
 	return nil
 }
 
+// SetTransport sets the transport requests are sent with, eg. a cassette.Recorder in
+// tests.
+func (c *HTTPClient) SetTransport(transport http.RoundTripper) {
+	c.client.Transport = transport
+}
+
 // Get sends an HTTP GET request to the specified URL, returning an
-// *http.Response and an *HTTPError wrapping the http error on failure.
-func (c *HTTPClient) Get(url string) (*http.Response, error) {
-	req, err := http.NewRequest("GET", url, nil)
+// *http.Response and an *HTTPError wrapping the http error on failure. The request
+// is aborted if `ctx` is cancelled. The response's body must be closed, eg. by
+// reading it with ReadBody.
+func (c *HTTPClient) Get(ctx context.Context, url string) (*http.Response, error) {
+	return c.GetWithCookies(ctx, url, nil)
+}
+
+// GetWithCookies sends an HTTP GET request to the specified URL like Get, adding the
+// supplied cookies to the request.
+func (c *HTTPClient) GetWithCookies(ctx context.Context, url string, cookies []*http.Cookie) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, IntoHTTPError(err)
 	}
 
-	// Add simulated headers to simulate human browsing.
-	addSimulatedHeaders(req)
+	// Send the session's browser headers to simulate human browsing. This lowers the
+	// chance of CAPTCHA traps and IP blocks.
+	c.currentSession().profile.apply(req, true)
 
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return resp, IntoHTTPError(err)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
 	}
 
-	return resp, nil
+	return c.do(req)
 }
 
 // Post sends an HTTP POST request to the specified URL with the specified body, returning an
-// *http.Response and an *HTTPError wrapping the http error on failure.
-func (c *HTTPClient) Post(url string, contentType string, body io.Reader) (*http.Response, error) {
-	resp, err := c.client.Post(url, contentType, body)
+// *http.Response and an *HTTPError wrapping the http error on failure. The request
+// is aborted if `ctx` is cancelled.
+func (c *HTTPClient) Post(ctx context.Context, url string, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
 	if err != nil {
-		return resp, IntoHTTPError(err)
+		return nil, IntoHTTPError(err)
 	}
 
-	return resp, nil
+	// POST requests are sent by pages calling APIs rather than by navigation.
+	c.currentSession().profile.apply(req, false)
+	req.Header.Set("Content-Type", contentType)
+
+	return c.do(req)
 }
 
 // PostJSON sends an HTTP POST request to the specified URL, marshalling the body into JSON, and returning
 // an *http.Response and an *HTTPError wrapping the http error on failure.
-func (c *HTTPClient) PostJSON(url string, body interface{}) (*http.Response, error) {
+func (c *HTTPClient) PostJSON(ctx context.Context, url string, body interface{}) (*http.Response, error) {
 	// TODO: better error handling here
 	b := bytes.NewBuffer(nil)
 	json.NewEncoder(b).Encode(body)
 
-	resp, err := c.client.Post(url, "application/json", b)
-	if err != nil {
-		return resp, IntoHTTPError(err)
+	return c.Post(ctx, url, "application/json", b)
+}
+
+// do sends a request, returning nil and an *HTTPError on failure, or wrapping a
+// *CircuitOpenError if the host's circuit is open.
+func (c *HTTPClient) do(req *http.Request) (*http.Response, error) {
+	var permit Permit
+	if c.breaker != nil {
+		var err error
+		permit, err = c.breaker.Allow(req.URL.Host, retailerFromContext(req.Context()))
+		if err != nil {
+			return nil, IntoHTTPError(err)
+		}
+	}
+
+	// Requests are sent with the cookies of their store in the current session.
+	client := *c.client
+	client.Jar = c.jar(storeFromContext(req.Context()))
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if c.breaker != nil {
+		if req.Context().Err() != nil || isProxyError(resp, err) {
+			c.breaker.Release(permit)
+		} else {
+			c.breaker.Record(permit, degraded(resp, err))
+		}
+	}
+
+	if err := c.finishResponse(req, start, resp, err); err != nil {
+		return nil, IntoHTTPError(err)
 	}
 
 	return resp, nil
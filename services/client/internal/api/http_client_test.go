@@ -0,0 +1,151 @@
+package api
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/bfoody/Walmart-Scraper/domain"
+)
+
+// TestHTTPClientSession tests that requests send their session's header profile and
+// cookies, and that a new session starts with a different profile and no cookies.
+func TestHTTPClientSession(t *testing.T) {
+	requests := []*http.Request{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		http.SetCookie(w, &http.Cookie{Name: "vtc", Value: "visitor", Path: "/"})
+	}))
+	t.Cleanup(server.Close)
+
+	c := NewHTTPClient()
+	profile := c.currentSession().profile
+
+	for _, send := range []func() (*http.Response, error){
+		func() (*http.Response, error) { return c.Get(context.Background(), server.URL+"/ip/item/1") },
+		func() (*http.Response, error) {
+			return c.PostJSON(context.Background(), server.URL+"/api", map[string]string{})
+		},
+	} {
+		resp, err := send()
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	for _, req := range requests {
+		if ua := req.Header.Get("User-Agent"); ua != profile.Headers["user-agent"] {
+			t.Errorf("%s %s: expected the profile's user agent, got %q", req.Method, req.URL.Path, ua)
+		}
+	}
+
+	if _, err := requests[1].Cookie("vtc"); err != nil {
+		t.Error("expected the session's cookies to be sent")
+	}
+	if requests[1].Header.Get("Content-Type") != "application/json" || requests[1].Header.Get("Upgrade-Insecure-Requests") != "" {
+		t.Errorf("expected API request headers, got %v", requests[1].Header)
+	}
+
+	c.NewSession()
+	if c.currentSession().profile == profile {
+		t.Error("expected a new session to use a different profile")
+	}
+
+	resp, err := c.Get(context.Background(), server.URL+"/ip/item/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if _, err := requests[2].Cookie("vtc"); err == nil {
+		t.Error("expected a new session to start without cookies")
+	}
+
+	// Requests for another store don't share cookies.
+	store := domain.StoreContext{StoreID: "5260"}
+	resp, err = c.Get(WithStore(context.Background(), store), server.URL+"/ip/item/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if _, err := requests[3].Cookie("vtc"); err == nil {
+		t.Error("expected another store's request not to send the default store's cookies")
+	}
+}
+
+// TestHTTPClientBlocked tests that a new session starts when a response is blocked,
+// whether or not the client sends requests through a proxy.
+func TestHTTPClientBlocked(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	t.Cleanup(server.Close)
+
+	c := NewHTTPClient()
+	session := c.currentSession()
+
+	resp, err := c.Get(context.Background(), server.URL+"/ip/item/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if c.currentSession() == session {
+		t.Error("expected a blocked response to start a new session")
+	}
+}
+
+// TestHTTPClientBodies tests that compressed bodies are decoded, large bodies are cut
+// off, and requests are aborted when their context is cancelled.
+func TestHTTPClientBodies(t *testing.T) {
+	page := strings.Repeat("<p>item</p>", 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/gzip":
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			gz.Write([]byte(page))
+			gz.Close()
+		case "/br":
+			w.Header().Set("Content-Encoding", "br")
+			br := brotli.NewWriter(w)
+			br.Write([]byte(page))
+			br.Close()
+		default:
+			w.Write([]byte(page))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	c := NewHTTPClient()
+	for _, path := range []string{"/gzip", "/br", "/plain"} {
+		resp, err := c.Get(context.Background(), server.URL+path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, err := ReadBody(resp)
+		if err != nil || string(body) != page {
+			t.Errorf("%s: expected the decoded page, got %q (%v)", path, body, err)
+		}
+	}
+
+	// Bodies are read as they are received, so that blocks can be detected.
+	c.SetMaxBodySize(int64(len(page)) - 1)
+	if _, err := c.Get(context.Background(), server.URL+"/br"); !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("expected the body to be too large, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Get(ctx, server.URL+"/plain"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the request to be cancelled, got %v", err)
+	}
+}
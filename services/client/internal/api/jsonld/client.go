@@ -0,0 +1,207 @@
+package jsonld
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/antchfx/htmlquery"
+	"github.com/bfoody/Walmart-Scraper/domain"
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/api"
+	"go.uber.org/zap"
+)
+
+// The Client is the adapter for locations with the "jsonld" retailer key.
+var _ api.Retailer = (*Client)(nil)
+
+// A Client scrapes products from any website that describes its product pages with
+// schema.org Product JSON-LD, as many shops do for search engines. Products are
+// identified by the path of their page.
+type Client struct {
+	client  *api.HTTPClient
+	baseURL string // the base URL of the website, eg. "https://shop.example.com"
+	log     *zap.Logger
+}
+
+// NewClient creates and returns a new JSON-LD Client for the website at `baseURL`.
+func NewClient(client *api.HTTPClient, baseURL string, logger *zap.Logger) *Client {
+	return &Client{
+		client:  client,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		log:     logger,
+	}
+}
+
+// NewRetailerFactory returns an api.RetailerFactory creating Clients for each
+// location's base URL, which log to `logger`.
+func NewRetailerFactory(logger *zap.Logger) api.RetailerFactory {
+	return func(client *api.HTTPClient, location domain.Location) api.Retailer {
+		return NewClient(client, location.BaseURL, logger)
+	}
+}
+
+// FetchProduct scrapes the current info and details of a single product from its page.
+// JSON-LD pages have no store context, so api.ErrUnsupportedStore is returned for any
+// store.
+func (c *Client) FetchProduct(ctx context.Context, productLocation *domain.ProductLocation, store domain.StoreContext) (*api.ProductPage, error) {
+	if !store.IsZero() {
+		return nil, api.ErrUnsupportedStore
+	}
+
+	product, err := c.getProduct(ctx, c.productURL(productLocation))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(product.Offers) < 1 {
+		return nil, &api.APIError{Message: "product has no offers", Reference: "parse_error"}
+	}
+
+	offer := product.Offers[0]
+	status := availabilityStatus(offer.Availability)
+
+	// The first offer is the one shown by default.
+	offers := []domain.Offer{}
+	for i, o := range product.Offers {
+		s := availabilityStatus(o.Availability)
+		offers = append(offers, domain.Offer{
+			SellerName:         string(o.Seller),
+			Price:              float32(o.Price),
+			AvailabilityStatus: s,
+			InStock:            s == "IN_STOCK",
+			BuyBox:             i == 0,
+		})
+	}
+
+	return &api.ProductPage{
+		Info: domain.ProductInfo{
+			ID:                 "",         // will be filled in by database service
+			CreatedAt:          time.Now(), // will be filled in by database service
+			ProductID:          productLocation.ProductID,
+			ProductLocationID:  productLocation.ID,
+			Price:              float32(offer.Price),
+			AvailabilityStatus: status,
+			InStock:            status == "IN_STOCK",
+			SellerName:         string(offer.Seller),
+			Rating:             float32(product.AggregateRating.RatingValue),
+			ReviewCount:        int(product.AggregateRating.ReviewCount),
+			ExtractionStrategy: StrategyJSONLD,
+		},
+		Product: domain.Product{
+			ID:           "",
+			CommonName:   "",
+			Brand:        string(product.Brand),
+			Manufacturer: string(product.Manufacturer),
+			UPC:          product.gtin(),
+			ImageURLs:    []string(product.Image),
+		},
+		Offers:   offers,
+		Variants: []domain.ProductLocation{},
+	}, nil
+}
+
+// FetchRelated scrapes the products listed as related or similar to a single product.
+func (c *Client) FetchRelated(ctx context.Context, productLocation *domain.ProductLocation) ([]domain.ProductLocation, error) {
+	product, err := c.getProduct(ctx, c.productURL(productLocation))
+	if err != nil {
+		return nil, err
+	}
+
+	pl := []domain.ProductLocation{}
+	for _, related := range append(product.IsRelatedTo, product.IsSimilarTo...) {
+		slug, localID, err := c.ParseProductURL(related.URL)
+		if err != nil {
+			c.log.Debug("skipping related product with invalid url", zap.String("url", related.URL), zap.Error(err))
+			continue
+		}
+
+		pl = append(pl, domain.ProductLocation{
+			ID:         "",
+			Name:       related.Name,
+			ProductID:  "",
+			LocationID: "",
+			URL:        c.CanonicalURL(slug, localID),
+			LocalID:    localID,
+			Slug:       slug,
+			CategoryID: "",
+			Category:   string(related.Category),
+		})
+	}
+
+	return pl, nil
+}
+
+// ParseProductURL uses the path of a product page as its slug and local ID, resolving
+// relative URLs against the website's base URL.
+func (c *Client) ParseProductURL(rawURL string) (string, string, error) {
+	base, err := url.Parse(c.baseURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	u, err := base.Parse(rawURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	if u.Host != base.Host {
+		return "", "", fmt.Errorf("url %s is not on %s", rawURL, base.Host)
+	}
+
+	path := strings.Trim(u.Path, "/")
+	if path == "" {
+		return "", "", errors.New("url has no path")
+	}
+
+	return path, path, nil
+}
+
+// CanonicalURL returns the URL of a product page from its path.
+func (c *Client) CanonicalURL(slug string, localID string) string {
+	return fmt.Sprintf("%s/%s", c.baseURL, localID)
+}
+
+// productURL returns the URL of a product's page, preferring its stored URL.
+func (c *Client) productURL(productLocation *domain.ProductLocation) string {
+	if productLocation.URL != "" {
+		return productLocation.URL
+	}
+
+	return c.CanonicalURL(productLocation.Slug, productLocation.LocalID)
+}
+
+// getProduct fetches a page and decodes the first schema.org Product found in its
+// JSON-LD scripts.
+func (c *Client) getProduct(ctx context.Context, url string) (*product, error) {
+	resp, err := c.client.Get(ctx, url)
+	if err != nil {
+		// Return the HTTPError.
+		return nil, err
+	}
+
+	c.log.Debug("fetched product page", zap.String("url", url), zap.Int("status", resp.StatusCode))
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, api.NewAPIError(resp, fmt.Sprintf("page returned status %d", resp.StatusCode), "server_error", nil)
+	}
+
+	body, err := api.ReadBody(resp)
+	if err != nil {
+		return nil, api.NewAPIError(resp, "failed to read response body", "io_error", err)
+	}
+
+	doc, err := htmlquery.Parse(strings.NewReader(string(body)))
+	if err != nil {
+		return nil, &api.APIError{ResponseBody: string(body), Message: "failed to parse html", Reference: "html_parse_error", WrappedError: err}
+	}
+
+	if p := findPageProduct(doc); p != nil {
+		return p, nil
+	}
+
+	return nil, &api.APIError{ResponseBody: string(body), Message: "no schema.org Product found in json-ld", Reference: "deserialization_error"}
+}
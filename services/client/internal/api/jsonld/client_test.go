@@ -0,0 +1,112 @@
+package jsonld_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bfoody/Walmart-Scraper/domain"
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/api"
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/api/jsonld"
+	"go.uber.org/zap"
+)
+
+// newTestClient serves the HTML fixtures in testdata and returns a Client for them.
+func newTestClient(t *testing.T) (*jsonld.Client, string) {
+	server := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	t.Cleanup(server.Close)
+
+	return jsonld.NewClient(api.NewHTTPClient(), server.URL, zap.NewNop()), server.URL
+}
+
+// TestFetchProduct tests scraping prices and availability from JSON-LD in @graph and
+// array form.
+func TestFetchProduct(t *testing.T) {
+	c, _ := newTestClient(t)
+
+	tests := []struct {
+		path    string
+		price   float32
+		status  string
+		inStock bool
+	}{
+		{"products/desk-lamp.html", 34.99, "IN_STOCK", true},
+		{"products/floor-lamp.html", 89.5, "OUT_OF_STOCK", false},
+	}
+
+	for _, test := range tests {
+		page, err := c.FetchProduct(context.Background(), &domain.ProductLocation{ID: "pl", ProductID: "p", LocalID: test.path}, domain.StoreContext{})
+		if err != nil {
+			t.Fatalf("%s: %s", test.path, err)
+		}
+
+		pi := page.Info
+
+		if pi.Price != test.price || pi.AvailabilityStatus != test.status || pi.InStock != test.inStock {
+			t.Errorf("%s: unexpected product info %+v", test.path, pi)
+		}
+
+		if pi.ProductLocationID != "pl" || pi.ProductID != "p" {
+			t.Errorf("%s: expected ids to be copied from the ProductLocation, got %+v", test.path, pi)
+		}
+	}
+
+	_, err := c.FetchProduct(context.Background(), &domain.ProductLocation{LocalID: "products/no-product.html"}, domain.StoreContext{})
+	if err == nil {
+		t.Error("expected an error for a page without a product")
+	}
+
+	_, err = c.FetchProduct(context.Background(), &domain.ProductLocation{LocalID: "products/desk-lamp.html"}, domain.StoreContext{ZIPCode: "72712"})
+	if !errors.Is(err, api.ErrUnsupportedStore) {
+		t.Errorf("expected stores to be unsupported, got %v", err)
+	}
+}
+
+// TestFetchProductDetails tests scraping the brand, GTIN, images, rating and seller of
+// a product.
+func TestFetchProductDetails(t *testing.T) {
+	c, _ := newTestClient(t)
+
+	page, err := c.FetchProduct(context.Background(), &domain.ProductLocation{LocalID: "products/desk-lamp.html"}, domain.StoreContext{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := page.Product
+	if p.Brand != "Lumen & Co." || p.UPC != "0012345678905" {
+		t.Errorf("unexpected product details %+v", p)
+	}
+
+	if len(p.ImageURLs) != 2 || p.ImageURLs[1] != "https://shop.example.com/images/desk-lamp-side.jpg" {
+		t.Errorf("unexpected images %v", p.ImageURLs)
+	}
+
+	if page.Info.Rating != 4.6 || page.Info.ReviewCount != 128 || page.Info.SellerName != "Example Shop" {
+		t.Errorf("unexpected product info %+v", page.Info)
+	}
+}
+
+// TestFetchRelated tests scraping related and similar products, skipping ones on
+// other websites.
+func TestFetchRelated(t *testing.T) {
+	c, baseURL := newTestClient(t)
+
+	related, err := c.FetchRelated(context.Background(), &domain.ProductLocation{LocalID: "products/desk-lamp.html"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(related) != 2 {
+		t.Fatalf("expected 2 related products, got %+v", related)
+	}
+
+	if related[0].Name != "LED Bulb 2-Pack" || related[0].LocalID != "products/led-bulbs" || related[0].URL != baseURL+"/products/led-bulbs" || related[0].Category != "Lighting/Bulbs" {
+		t.Errorf("unexpected related product %+v", related[0])
+	}
+
+	if related[1].Name != "Chrome Desk Lamp" {
+		t.Errorf("unexpected similar product %+v", related[1])
+	}
+}
@@ -0,0 +1,67 @@
+package jsonld
+
+import (
+	"github.com/antchfx/htmlquery"
+	"golang.org/x/net/html"
+)
+
+// StrategyJSONLD is the extraction strategy recorded on infos scraped from JSON-LD.
+const StrategyJSONLD = "json_ld"
+
+// ProductData describes the product found in a page's JSON-LD, for adapters falling
+// back to JSON-LD when their own parsing fails.
+type ProductData struct {
+	Name               string   // the name of the product
+	Category           string   // the product's category, if given
+	Brand              string   // the product's brand
+	Manufacturer       string   // the product's manufacturer
+	GTIN               string   // the first GTIN given, eg. a UPC
+	ImageURLs          []string // the URLs of the product's images
+	Price              float32  // the price of the first offer
+	AvailabilityStatus string   // the availability of the first offer, eg. "IN_STOCK"
+	SellerName         string   // the seller of the first offer
+	Rating             float32  // the average rating
+	ReviewCount        int      // the number of reviews
+}
+
+// FindProductData finds the first schema.org Product with an offer in the JSON-LD
+// scripts of a parsed page, returning nil if there is none.
+func FindProductData(doc *html.Node) *ProductData {
+	p := findPageProduct(doc)
+	if p == nil || len(p.Offers) < 1 {
+		return nil
+	}
+
+	offer := p.Offers[0]
+
+	return &ProductData{
+		Name:               p.Name,
+		Category:           string(p.Category),
+		Brand:              string(p.Brand),
+		Manufacturer:       string(p.Manufacturer),
+		GTIN:               p.gtin(),
+		ImageURLs:          []string(p.Image),
+		Price:              float32(offer.Price),
+		AvailabilityStatus: availabilityStatus(offer.Availability),
+		SellerName:         string(offer.Seller),
+		Rating:             float32(p.AggregateRating.RatingValue),
+		ReviewCount:        int(p.AggregateRating.ReviewCount),
+	}
+}
+
+// findPageProduct decodes the first schema.org Product found in the JSON-LD scripts of
+// a parsed page, returning nil if there is none.
+func findPageProduct(doc *html.Node) *product {
+	scripts, err := htmlquery.QueryAll(doc, "//script[@type=\"application/ld+json\"]")
+	if err != nil {
+		return nil
+	}
+
+	for _, script := range scripts {
+		if p := findProduct([]byte(htmlquery.InnerText(script))); p != nil {
+			return p
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,274 @@
+package jsonld
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// A product is the subset of a schema.org Product used by the Client.
+type product struct {
+	Name            string          `json:"name"`
+	SKU             string          `json:"sku"`
+	GTIN            string          `json:"gtin"`
+	GTIN8           string          `json:"gtin8"`
+	GTIN12          string          `json:"gtin12"`
+	GTIN13          string          `json:"gtin13"`
+	GTIN14          string          `json:"gtin14"`
+	Brand           thingName       `json:"brand"`
+	Manufacturer    thingName       `json:"manufacturer"`
+	Category        thingName       `json:"category"`
+	Image           imageList       `json:"image"`
+	AggregateRating aggregateRating `json:"aggregateRating"`
+	Offers          offerList       `json:"offers"`
+	IsRelatedTo     productList     `json:"isRelatedTo"`
+	IsSimilarTo     productList     `json:"isSimilarTo"`
+	URL             string          `json:"url"`
+}
+
+// gtin returns the first of the product's GTINs that is set, or "" if there are none.
+func (p *product) gtin() string {
+	for _, gtin := range []string{p.GTIN12, p.GTIN13, p.GTIN14, p.GTIN8, p.GTIN} {
+		if gtin != "" {
+			return gtin
+		}
+	}
+
+	return ""
+}
+
+// An aggregateRating is the subset of a schema.org AggregateRating used by the Client.
+type aggregateRating struct {
+	RatingValue number `json:"ratingValue"`
+	ReviewCount number `json:"reviewCount"`
+}
+
+// An offer is the subset of a schema.org Offer or AggregateOffer used by the Client.
+type offer struct {
+	Price        number    `json:"price"`
+	LowPrice     number    `json:"lowPrice"` // set instead of Price by AggregateOffers
+	Availability string    `json:"availability"`
+	Seller       thingName `json:"seller"`
+}
+
+// An offerList decodes either a single offer or an array of offers.
+type offerList []offer
+
+// UnmarshalJSON decodes a single offer or an array of offers.
+func (o *offerList) UnmarshalJSON(b []byte) error {
+	var offers []offer
+	if err := unmarshalOneOrMany(b, &offers, func() error {
+		single := offer{}
+		err := json.Unmarshal(b, &single)
+		offers = []offer{single}
+		return err
+	}); err != nil {
+		return err
+	}
+
+	for i := range offers {
+		if offers[i].Price == 0 {
+			offers[i].Price = offers[i].LowPrice
+		}
+	}
+
+	*o = offers
+	return nil
+}
+
+// A productList decodes either a single product or an array of products.
+type productList []product
+
+// UnmarshalJSON decodes a single product or an array of products.
+func (p *productList) UnmarshalJSON(b []byte) error {
+	var products []product
+	err := unmarshalOneOrMany(b, &products, func() error {
+		single := product{}
+		err := json.Unmarshal(b, &single)
+		products = []product{single}
+		return err
+	})
+
+	*p = products
+	return err
+}
+
+// unmarshalOneOrMany decodes a JSON array into `many`, or calls `one` to decode a
+// single value.
+func unmarshalOneOrMany(b []byte, many interface{}, one func() error) error {
+	if strings.HasPrefix(strings.TrimSpace(string(b)), "[") {
+		return json.Unmarshal(b, many)
+	}
+
+	return one()
+}
+
+// A thingName decodes a value given as either a plain string or a Thing with a name,
+// eg. a category, brand or seller.
+type thingName string
+
+// UnmarshalJSON decodes a string or the name of an object.
+func (t *thingName) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		*t = thingName(name)
+		return nil
+	}
+
+	thing := struct {
+		Name string `json:"name"`
+	}{}
+	if err := json.Unmarshal(b, &thing); err != nil {
+		return err
+	}
+
+	*t = thingName(thing.Name)
+	return nil
+}
+
+// An imageList decodes images given as a URL, an ImageObject or an array of either.
+type imageList []string
+
+// UnmarshalJSON decodes one or many URLs or ImageObjects.
+func (i *imageList) UnmarshalJSON(b []byte) error {
+	var images []json.RawMessage
+	if err := unmarshalOneOrMany(b, &images, func() error {
+		images = []json.RawMessage{b}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	urls := []string{}
+	for _, image := range images {
+		var url string
+		if err := json.Unmarshal(image, &url); err == nil {
+			urls = append(urls, url)
+			continue
+		}
+
+		object := struct {
+			URL        string `json:"url"`
+			ContentURL string `json:"contentUrl"`
+		}{}
+		if err := json.Unmarshal(image, &object); err != nil {
+			return err
+		}
+
+		if object.URL == "" {
+			object.URL = object.ContentURL
+		}
+		if object.URL != "" {
+			urls = append(urls, object.URL)
+		}
+	}
+
+	*i = urls
+	return nil
+}
+
+// A number decodes prices given as either JSON numbers or strings, eg. "19.99".
+type number float64
+
+// UnmarshalJSON decodes a number or numeric string.
+func (n *number) UnmarshalJSON(b []byte) error {
+	str := strings.Trim(string(b), "\"")
+	if str == "" || str == "null" {
+		*n = 0
+		return nil
+	}
+
+	f, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return err
+	}
+
+	*n = number(f)
+	return nil
+}
+
+// findProduct finds the first schema.org Product in a JSON-LD document, which may be
+// a single object, an array of objects or an object with a "@graph".
+func findProduct(data []byte) *product {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil
+	}
+
+	for _, node := range nodes(doc) {
+		if !hasType(node["@type"], "Product") {
+			continue
+		}
+
+		b, err := json.Marshal(node)
+		if err != nil {
+			continue
+		}
+
+		p := product{}
+		if err := json.Unmarshal(b, &p); err != nil {
+			continue
+		}
+
+		return &p
+	}
+
+	return nil
+}
+
+// nodes flattens a decoded JSON-LD document into its top-level objects.
+func nodes(doc interface{}) []map[string]interface{} {
+	found := []map[string]interface{}{}
+
+	switch d := doc.(type) {
+	case []interface{}:
+		for _, item := range d {
+			found = append(found, nodes(item)...)
+		}
+	case map[string]interface{}:
+		if graph, ok := d["@graph"]; ok {
+			found = append(found, nodes(graph)...)
+		}
+
+		found = append(found, d)
+	}
+
+	return found
+}
+
+// hasType returns true if a JSON-LD "@type" value, a string or array of strings, is
+// or contains `typ`.
+func hasType(value interface{}, typ string) bool {
+	switch v := value.(type) {
+	case string:
+		return v == typ || v == "https://schema.org/"+typ || v == "http://schema.org/"+typ
+	case []interface{}:
+		for _, item := range v {
+			if hasType(item, typ) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// availabilityStatus converts a schema.org ItemAvailability, eg.
+// "https://schema.org/InStock", to the status format used by ProductInfo, eg. "IN_STOCK".
+func availabilityStatus(availability string) string {
+	name := availability[strings.LastIndex(availability, "/")+1:]
+	if name == "" {
+		return "UNKNOWN"
+	}
+
+	var sb strings.Builder
+	for i, r := range name {
+		if i > 0 && r >= 'A' && r <= 'Z' {
+			sb.WriteRune('_')
+		}
+
+		sb.WriteRune(r)
+	}
+
+	return strings.ToUpper(sb.String())
+}
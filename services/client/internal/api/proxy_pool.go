@@ -0,0 +1,494 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// A ProxyOutcome is the outcome of a request sent through a proxy, reported to a
+// ProxyPool to score the proxy's health.
+type ProxyOutcome int
+
+const (
+	// ProxySuccess is a request the proxy delivered a response to.
+	ProxySuccess ProxyOutcome = iota
+	// ProxyFailure is a request that failed in the proxy or timed out.
+	ProxyFailure
+	// ProxyBlocked is a request the retailer blocked, eg. with a CAPTCHA page.
+	ProxyBlocked
+)
+
+// String returns the outcome's metric label.
+func (o ProxyOutcome) String() string {
+	switch o {
+	case ProxySuccess:
+		return "success"
+	case ProxyBlocked:
+		return "blocked"
+	default:
+		return "failure"
+	}
+}
+
+// The states of a proxy in a ProxyPool.
+const (
+	// ProxyHealthy is a proxy that can be selected.
+	ProxyHealthy = "healthy"
+	// ProxyCoolingDown is a proxy resting after repeated failures or a block.
+	ProxyCoolingDown = "cooldown"
+	// ProxyQuarantined is a proxy taken out of rotation after repeated cooldowns.
+	ProxyQuarantined = "quarantined"
+)
+
+// ErrNoProxyAvailable is returned by ProxyPool.Select when every proxy in the pool is
+// quarantined.
+var ErrNoProxyAvailable = errors.New("no proxy available")
+
+// proxyStateValues are the values of the ProxyState metric for each state.
+var proxyStateValues = map[string]float64{
+	ProxyHealthy:     0,
+	ProxyCoolingDown: 1,
+	ProxyQuarantined: 2,
+}
+
+// ProxyPoolOptions control when a ProxyPool rests proxies.
+type ProxyPoolOptions struct {
+	CooldownAfter   int           // the number of consecutive failures that start a cooldown
+	Cooldown        time.Duration // how long a proxy cools down for, doubling with each consecutive cooldown
+	QuarantineAfter int           // the number of consecutive cooldowns that quarantine a proxy
+	Quarantine      time.Duration // how long a proxy is quarantined for
+	SessionTTL      time.Duration // how long a session sticks to its proxy after its last request
+}
+
+// DefaultProxyPoolOptions returns the default ProxyPoolOptions.
+func DefaultProxyPoolOptions() ProxyPoolOptions {
+	return ProxyPoolOptions{
+		CooldownAfter:   3,
+		Cooldown:        time.Minute,
+		QuarantineAfter: 3,
+		Quarantine:      30 * time.Minute,
+		SessionTTL:      10 * time.Minute,
+	}
+}
+
+// ewmaWeight is the weight of the latest request in a proxy's moving averages.
+const ewmaWeight = 0.2
+
+// A Proxy is a proxy in a ProxyPool with an HTTPClient sending requests through it.
+type Proxy struct {
+	URL  string      // the proxy's URL, which may contain credentials
+	Name string      // the proxy's host, safe to log and use as a metric label
+	HTTP *HTTPClient // a client sending requests through the proxy
+
+	requests    int
+	successes   int
+	failures    int
+	blocks      int
+	successRate float64       // the moving average of successful requests
+	latency     time.Duration // the moving average latency of successful requests
+	consecutive int           // the number of failures since the last success
+	cooldowns   int           // the number of cooldowns since the last success
+	state       string
+	until       time.Time // when a cooldown or quarantine ends
+}
+
+// ProxyStats are a snapshot of a proxy's health.
+type ProxyStats struct {
+	Name        string
+	State       string
+	Profile     string // the header profile of the proxy's browser session
+	Requests    int
+	Successes   int
+	Failures    int
+	Blocks      int
+	SuccessRate float64
+	Latency     time.Duration
+	Score       float64
+	Until       time.Time // when a cooldown or quarantine ends
+}
+
+// score returns a proxy's health from 0 to 1, favouring reliable, fast proxies.
+func (p *Proxy) score() float64 {
+	return p.successRate / (1 + p.latency.Seconds())
+}
+
+// proxySession is the proxy a session sticks to.
+type proxySession struct {
+	proxy    *Proxy
+	lastUsed time.Time
+}
+
+// A ProxyPool selects a proxy for each request, rotating between them in proportion
+// to their health score. Proxies that keep failing or are blocked cool down, and
+// proxies that keep cooling down are quarantined. Sessions, eg. the scrape of a
+// single product, stick to the same proxy while it stays healthy.
+type ProxyPool struct {
+	proxies  []*Proxy
+	sessions map[string]*proxySession
+	options  ProxyPoolOptions
+	rng      *rand.Rand
+	now      func() time.Time
+	mutex    *sync.Mutex
+	log      *zap.Logger
+}
+
+// NewProxyPool creates and returns a new *ProxyPool of the supplied proxy URLs.
+func NewProxyPool(proxies []string, options ProxyPoolOptions, logger *zap.Logger) (*ProxyPool, error) {
+	p := &ProxyPool{
+		proxies:  []*Proxy{},
+		sessions: map[string]*proxySession{},
+		options:  options,
+		rng:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		now:      time.Now,
+		mutex:    &sync.Mutex{},
+		log:      logger,
+	}
+
+	if err := p.SetProxies(proxies); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// SetProxies replaces the pool's proxies, keeping the health of proxies already in
+// the pool.
+func (p *ProxyPool) SetProxies(proxies []string) error {
+	existing := map[string]*Proxy{}
+	p.mutex.Lock()
+	for _, proxy := range p.proxies {
+		existing[proxy.URL] = proxy
+	}
+	p.mutex.Unlock()
+
+	updated := []*Proxy{}
+	for _, urlStr := range proxies {
+		if proxy, ok := existing[urlStr]; ok {
+			updated = append(updated, proxy)
+			delete(existing, urlStr)
+			continue
+		}
+
+		client := NewHTTPClient()
+		if err := client.SetProxy(urlStr); err != nil {
+			return fmt.Errorf("invalid proxy %q: %w", urlStr, err)
+		}
+
+		proxy := &Proxy{
+			URL:         urlStr,
+			Name:        proxyName(urlStr),
+			HTTP:        client,
+			successRate: 1,
+			state:       ProxyHealthy,
+		}
+
+		// Score the proxy on every request sent through it.
+		client.observe = func(resp *http.Response, latency time.Duration, err error) {
+			p.Report(proxy, latency, OutcomeOf(resp, err))
+		}
+
+		updated = append(updated, proxy)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.proxies = updated
+	for session, s := range p.sessions {
+		if _, removed := existing[s.proxy.URL]; removed {
+			delete(p.sessions, session)
+		}
+	}
+
+	for _, proxy := range existing {
+		metrics.ProxyScore.DeleteLabelValues(proxy.Name)
+		metrics.ProxyState.DeleteLabelValues(proxy.Name)
+	}
+	for _, proxy := range updated {
+		p.recordState(proxy)
+	}
+
+	return nil
+}
+
+// Proxies returns the proxies in the pool.
+func (p *ProxyPool) Proxies() []*Proxy {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return append([]*Proxy{}, p.proxies...)
+}
+
+// Len returns the number of proxies in the pool.
+func (p *ProxyPool) Len() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return len(p.proxies)
+}
+
+// Select returns the proxy to send a session's next request through, or nil if the
+// pool is empty. A session keeps its proxy while the proxy is healthy, and requests
+// without a session ("") get a proxy chosen at random weighted by health. When every
+// proxy is resting, the one whose cooldown ends soonest is returned, and
+// ErrNoProxyAvailable if every proxy is quarantined.
+func (p *ProxyPool) Select(session string) (*Proxy, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if len(p.proxies) == 0 {
+		return nil, nil
+	}
+
+	now := p.now()
+	p.expireSessions(now)
+
+	if s, ok := p.sessions[session]; ok && p.available(s.proxy, now) {
+		s.lastUsed = now
+		return s.proxy, nil
+	}
+
+	proxy, err := p.choose(now)
+	if err != nil {
+		return nil, err
+	}
+
+	if session != "" {
+		p.sessions[session] = &proxySession{proxy, now}
+	}
+
+	return proxy, nil
+}
+
+// choose picks a proxy at random weighted by health score from the available
+// proxies.
+func (p *ProxyPool) choose(now time.Time) (*Proxy, error) {
+	candidates := []*Proxy{}
+	total := 0.0
+	for _, proxy := range p.proxies {
+		if p.available(proxy, now) {
+			candidates = append(candidates, proxy)
+			total += weight(proxy)
+		}
+	}
+
+	if len(candidates) == 0 {
+		// Every proxy is resting, so use the one whose cooldown ends soonest. Quarantined
+		// proxies are never used.
+		var soonest *Proxy
+		for _, proxy := range p.proxies {
+			if proxy.state == ProxyCoolingDown && (soonest == nil || proxy.until.Before(soonest.until)) {
+				soonest = proxy
+			}
+		}
+
+		if soonest == nil {
+			return nil, ErrNoProxyAvailable
+		}
+
+		return soonest, nil
+	}
+
+	r := p.rng.Float64() * total
+	for _, proxy := range candidates {
+		r -= weight(proxy)
+		if r < 0 {
+			return proxy, nil
+		}
+	}
+
+	return candidates[len(candidates)-1], nil
+}
+
+// weight returns a proxy's chance of being chosen relative to other proxies. Even the
+// least healthy proxies are chosen occasionally so that they can recover.
+func weight(proxy *Proxy) float64 {
+	if score := proxy.score(); score > 0.01 {
+		return score
+	}
+
+	return 0.01
+}
+
+// available returns true if a proxy can be selected, ending its cooldown or
+// quarantine if it is over. Must be called with the mutex held.
+func (p *ProxyPool) available(proxy *Proxy, now time.Time) bool {
+	if proxy.state != ProxyHealthy && !now.Before(proxy.until) {
+		p.log.Info("proxy back in rotation", zap.String("proxy", proxy.Name), zap.String("after", proxy.state))
+
+		proxy.state = ProxyHealthy
+		p.recordState(proxy)
+	}
+
+	return proxy.state == ProxyHealthy
+}
+
+// expireSessions forgets sessions which haven't sent a request in the session TTL.
+// Must be called with the mutex held.
+func (p *ProxyPool) expireSessions(now time.Time) {
+	for session, s := range p.sessions {
+		if now.Sub(s.lastUsed) > p.options.SessionTTL {
+			delete(p.sessions, session)
+		}
+	}
+}
+
+// Report records the outcome and latency of a request sent through a proxy, resting
+// the proxy if it keeps failing or was blocked. Sessions on a resting proxy move to
+// another proxy on their next request.
+func (p *ProxyPool) Report(proxy *Proxy, latency time.Duration, outcome ProxyOutcome) {
+	if proxy == nil {
+		return
+	}
+
+	metrics.ProxyRequests.WithLabelValues(proxy.Name, outcome.String()).Inc()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	proxy.requests++
+
+	switch outcome {
+	case ProxySuccess:
+		metrics.ProxyLatency.WithLabelValues(proxy.Name).Observe(latency.Seconds())
+
+		proxy.successes++
+		proxy.successRate = ewma(proxy.successRate, 1)
+		if proxy.latency == 0 {
+			proxy.latency = latency
+		} else {
+			proxy.latency = time.Duration(ewma(float64(proxy.latency), float64(latency)))
+		}
+		proxy.consecutive = 0
+		proxy.cooldowns = 0
+	case ProxyBlocked:
+		proxy.blocks++
+		proxy.successRate = ewma(proxy.successRate, 0)
+
+		// Blocked proxies rest immediately, as further requests are likely to be blocked
+		// too.
+		p.rest(proxy)
+	default:
+		proxy.failures++
+		proxy.successRate = ewma(proxy.successRate, 0)
+		proxy.consecutive++
+
+		if proxy.consecutive >= p.options.CooldownAfter {
+			p.rest(proxy)
+		}
+	}
+
+	p.recordState(proxy)
+}
+
+// OutcomeOf returns the outcome of a request for its proxy's health from its response
+// and the transport or classification error: whether the proxy failed to deliver a
+// response, the retailer blocked or rate limited it, or it succeeded. Failures include
+// the 407 and gateway errors returned by failing proxies.
+func OutcomeOf(resp *http.Response, err error) ProxyOutcome {
+	if resp == nil {
+		return ProxyFailure
+	}
+
+	if errors.Is(err, ErrBlocked) || errors.Is(err, ErrRateLimited) {
+		return ProxyBlocked
+	}
+
+	switch resp.StatusCode {
+	case http.StatusProxyAuthRequired, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return ProxyFailure
+	}
+
+	return ProxySuccess
+}
+
+// rest cools a proxy down, or quarantines it if it has cooled down too many times in
+// a row. Must be called with the mutex held.
+func (p *ProxyPool) rest(proxy *Proxy) {
+	if proxy.state != ProxyHealthy {
+		return
+	}
+
+	proxy.cooldowns++
+	proxy.consecutive = 0
+
+	if proxy.cooldowns >= p.options.QuarantineAfter {
+		proxy.state = ProxyQuarantined
+		proxy.until = p.now().Add(p.options.Quarantine)
+		proxy.cooldowns = 0
+
+		p.log.Warn("quarantining proxy", zap.String("proxy", proxy.Name), zap.Duration("for", p.options.Quarantine))
+		return
+	}
+
+	cooldown := p.options.Cooldown << uint(proxy.cooldowns-1)
+	proxy.state = ProxyCoolingDown
+	proxy.until = p.now().Add(cooldown)
+
+	p.log.Info("cooling down proxy", zap.String("proxy", proxy.Name), zap.Duration("for", cooldown))
+}
+
+// recordState records a proxy's score and state to metrics. Must be called with the
+// mutex held.
+func (p *ProxyPool) recordState(proxy *Proxy) {
+	metrics.ProxyScore.WithLabelValues(proxy.Name).Set(proxy.score())
+	metrics.ProxyState.WithLabelValues(proxy.Name).Set(proxyStateValues[proxy.state])
+}
+
+// Stats returns a snapshot of the health of every proxy in the pool.
+func (p *ProxyPool) Stats() []ProxyStats {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	stats := []ProxyStats{}
+	for _, proxy := range p.proxies {
+		s := ProxyStats{
+			Name:        proxy.Name,
+			State:       proxy.state,
+			Profile:     proxy.HTTP.Profile(),
+			Requests:    proxy.requests,
+			Successes:   proxy.successes,
+			Failures:    proxy.failures,
+			Blocks:      proxy.blocks,
+			SuccessRate: proxy.successRate,
+			Latency:     proxy.latency,
+			Score:       proxy.score(),
+		}
+		if proxy.state != ProxyHealthy {
+			s.Until = proxy.until
+		}
+
+		stats = append(stats, s)
+	}
+
+	return stats
+}
+
+// ewma returns a moving average updated with a new value.
+func ewma(average, value float64) float64 {
+	return average*(1-ewmaWeight) + value*ewmaWeight
+}
+
+// proxyName returns a proxy's host and port without credentials, eg.
+// "user:pass@10.0.0.1:8080" becomes "10.0.0.1:8080".
+func proxyName(urlStr string) string {
+	if !strings.Contains(urlStr, "://") {
+		urlStr = "http://" + urlStr
+	}
+
+	u, err := url.Parse(urlStr)
+	if err != nil || u.Host == "" {
+		return "invalid"
+	}
+
+	return u.Host
+}
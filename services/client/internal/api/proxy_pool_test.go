@@ -0,0 +1,184 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// newTestPool creates a pool of proxies with a clock controlled by the returned
+// function.
+func newTestPool(t *testing.T, proxies ...string) (*ProxyPool, func(time.Duration)) {
+	pool, err := NewProxyPool(proxies, DefaultProxyPoolOptions(), zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+	pool.now = func() time.Time { return now }
+
+	return pool, func(d time.Duration) { now = now.Add(d) }
+}
+
+// selectProxy selects a proxy for a session, failing the test if none is available.
+func selectProxy(t *testing.T, pool *ProxyPool, session string) *Proxy {
+	proxy, err := pool.Select(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return proxy
+}
+
+// TestProxyPoolSessions tests that sessions stick to a proxy until it is blocked.
+func TestProxyPoolSessions(t *testing.T) {
+	pool, _ := newTestPool(t, "10.0.0.1:8080", "10.0.0.2:8080", "10.0.0.3:8080")
+
+	proxy := selectProxy(t, pool, "product")
+	for i := 0; i < 20; i++ {
+		if selectProxy(t, pool, "product") != proxy {
+			t.Fatal("expected session to stick to its proxy")
+		}
+	}
+
+	pool.Report(proxy, time.Second, ProxyBlocked)
+	if selectProxy(t, pool, "product") == proxy {
+		t.Error("expected session to move off a blocked proxy")
+	}
+}
+
+// TestProxyPoolCooldown tests that proxies cool down after repeated failures, are
+// quarantined after repeated cooldowns, and return to rotation afterwards.
+func TestProxyPoolCooldown(t *testing.T) {
+	pool, advance := newTestPool(t, "user:pass@10.0.0.1:8080", "10.0.0.2:8080")
+	bad := pool.Proxies()[0]
+	if bad.Name != "10.0.0.1:8080" {
+		t.Errorf("expected name without credentials, got %q", bad.Name)
+	}
+
+	for i := 0; i < 3; i++ {
+		pool.Report(bad, 0, ProxyFailure)
+	}
+
+	if state := pool.Stats()[0].State; state != ProxyCoolingDown {
+		t.Fatalf("expected proxy to cool down, got %s", state)
+	}
+
+	for i := 0; i < 20; i++ {
+		if selectProxy(t, pool, "") == bad {
+			t.Fatal("expected cooling down proxy not to be selected")
+		}
+	}
+
+	// Each further block doubles the cooldown, until the proxy is quarantined.
+	advance(time.Minute)
+	selectProxy(t, pool, "")
+	pool.Report(bad, 0, ProxyBlocked)
+	advance(2 * time.Minute)
+	selectProxy(t, pool, "")
+	pool.Report(bad, 0, ProxyBlocked)
+
+	stats := pool.Stats()[0]
+	if stats.State != ProxyQuarantined || stats.Blocks != 2 || stats.Failures != 3 {
+		t.Fatalf("expected proxy to be quarantined, got %+v", stats)
+	}
+
+	advance(30 * time.Minute)
+	selectProxy(t, pool, "")
+	if state := pool.Stats()[0].State; state != ProxyHealthy {
+		t.Errorf("expected proxy back in rotation, got %s", state)
+	}
+}
+
+// TestProxyPoolQuarantined tests that quarantined proxies are never selected, even
+// when every proxy is resting, and that the thresholds for resting proxies are
+// configurable.
+func TestProxyPoolQuarantined(t *testing.T) {
+	options := DefaultProxyPoolOptions()
+	options.CooldownAfter = 1
+	options.QuarantineAfter = 1
+	pool, err := NewProxyPool([]string{"10.0.0.1:8080", "10.0.0.2:8080"}, options, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, second := pool.Proxies()[0], pool.Proxies()[1]
+	pool.Report(first, 0, ProxyFailure)
+	if state := pool.Stats()[0].State; state != ProxyQuarantined {
+		t.Fatalf("expected a single cooldown to quarantine the proxy, got %s", state)
+	}
+
+	if proxy := selectProxy(t, pool, ""); proxy != second {
+		t.Errorf("expected the healthy proxy, got %s", proxy.Name)
+	}
+
+	pool.Report(second, 0, ProxyFailure)
+	if _, err := pool.Select(""); !errors.Is(err, ErrNoProxyAvailable) {
+		t.Errorf("expected no proxy to be available, got %v", err)
+	}
+}
+
+// TestProxyPoolScoring tests that unhealthy proxies are selected less often.
+func TestProxyPoolScoring(t *testing.T) {
+	pool, _ := newTestPool(t, "10.0.0.1:8080", "10.0.0.2:8080")
+	fast, slow := pool.Proxies()[0], pool.Proxies()[1]
+
+	for i := 0; i < 10; i++ {
+		pool.Report(fast, 100*time.Millisecond, ProxySuccess)
+		pool.Report(slow, 5*time.Second, ProxySuccess)
+	}
+
+	selected := map[*Proxy]int{}
+	for i := 0; i < 1000; i++ {
+		selected[selectProxy(t, pool, "")]++
+	}
+
+	if selected[fast] <= selected[slow] {
+		t.Errorf("expected the fast proxy to be favoured, got %d fast and %d slow", selected[fast], selected[slow])
+	}
+}
+
+// TestOutcomeOf tests that blocks are told apart from proxy failures.
+func TestOutcomeOf(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/forbidden":
+			w.WriteHeader(http.StatusForbidden)
+		case "/busy":
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "/gateway":
+			w.WriteHeader(http.StatusBadGateway)
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	tests := map[string]ProxyOutcome{
+		"/forbidden": ProxyBlocked,
+		"/busy":      ProxyBlocked,
+		"/gateway":   ProxyFailure,
+		"/missing":   ProxySuccess,
+		"/ip/item/2": ProxySuccess,
+	}
+
+	for path, expected := range tests {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if outcome := OutcomeOf(resp, ClassifyResponse(resp, nil)); outcome != expected {
+			t.Errorf("%s: expected %s, got %s", path, expected, outcome)
+		}
+	}
+
+	if outcome := OutcomeOf(nil, http.ErrHandlerTimeout); outcome != ProxyFailure {
+		t.Errorf("expected failed request to be a failure, got %s", outcome)
+	}
+}
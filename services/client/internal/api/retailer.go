@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/bfoody/Walmart-Scraper/domain"
+)
+
+// A Retailer scrapes products from a single retailer's website.
+type Retailer interface {
+	// FetchProduct scrapes the current info and details of a single product at a store,
+	// recording the store on the returned info. Adapters which can't scrape a store
+	// return ErrUnsupportedStore for any but the zero StoreContext.
+	FetchProduct(ctx context.Context, productLocation *domain.ProductLocation, store domain.StoreContext) (*ProductPage, error)
+	// FetchRelated scrapes the products related to a single product, returning them as
+	// ProductLocations without IDs.
+	FetchRelated(ctx context.Context, productLocation *domain.ProductLocation) ([]domain.ProductLocation, error)
+	// ParseProductURL extracts the slug and local ID of a product from its URL.
+	ParseProductURL(rawURL string) (slug string, localID string, err error)
+	// CanonicalURL returns the URL of a product's page from its slug and local ID.
+	CanonicalURL(slug string, localID string) string
+}
+
+// A ProductPage is returned when calling FetchProduct, contains everything scraped
+// from a single product's page.
+type ProductPage struct {
+	Info     domain.ProductInfo       // the product's current info, without an ID
+	Product  domain.Product           // details describing the product, without an ID or CommonName
+	Offers   []domain.Offer           // every seller's offer for the product, without IDs
+	Variants []domain.ProductLocation // the product's other variants, eg. sizes or colors, without IDs
+}
+
+// A Discoverer is a Retailer which can also list the products found by a search or on
+// a category page, for retailers supporting discovery.
+type Discoverer interface {
+	Retailer
+	// Discover scrapes a single page, starting from 1, of the products found by a
+	// discovery of `kind` ("search" or "browse"), returning them as ProductLocations
+	// without IDs along with the number of pages available.
+	Discover(ctx context.Context, kind string, query string, page int) (products []domain.ProductLocation, totalPages int, err error)
+}
+
+// A RetailerFactory creates a Retailer for a location, sending requests with the
+// supplied HTTPClient.
+type RetailerFactory func(client *HTTPClient, location domain.Location) Retailer
+
+// A Registry creates and caches the Retailer for each location, using the factory
+// registered for the location's retailer key.
+type Registry struct {
+	client    *HTTPClient
+	factories map[string]RetailerFactory
+	retailers map[string]Retailer // the Retailer for each location, by location ID
+	mutex     *sync.Mutex
+}
+
+// NewRegistry creates and returns a new *Registry whose Retailers send requests with
+// the supplied HTTPClient.
+func NewRegistry(client *HTTPClient) *Registry {
+	return &Registry{
+		client:    client,
+		factories: map[string]RetailerFactory{},
+		retailers: map[string]Retailer{},
+		mutex:     &sync.Mutex{},
+	}
+}
+
+// Register registers the factory for locations with the retailer key, eg. "walmart".
+func (r *Registry) Register(retailer string, factory RetailerFactory) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.factories[retailer] = factory
+}
+
+// ForLocation returns the Retailer for a location, returning an error if no factory
+// is registered for the location's retailer key.
+func (r *Registry) ForLocation(location domain.Location) (Retailer, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if retailer, ok := r.retailers[location.ID]; ok {
+		return retailer, nil
+	}
+
+	factory, ok := r.factories[location.Retailer]
+	if !ok {
+		return nil, fmt.Errorf("no retailer adapter registered for %q", location.Retailer)
+	}
+
+	retailer := factory(r.client, location)
+	r.retailers[location.ID] = retailer
+
+	return retailer, nil
+}
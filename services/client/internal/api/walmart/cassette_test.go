@@ -0,0 +1,133 @@
+package walmart_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/api"
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/api/cassette"
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/api/walmart"
+	"go.uber.org/zap"
+)
+
+var (
+	record = flag.Bool("record", false, "record cassettes from walmart.com instead of replaying them")
+	update = flag.Bool("update", false, "update golden files with the scraped output")
+)
+
+// handWrittenCassettes are the cassettes of responses walmart.com can't be made to
+// return on demand, eg. a block page, which are replayed even with the -record flag.
+var handWrittenCassettes = map[string]bool{
+	"blocked":   true,
+	"not-found": true,
+}
+
+// useCassette returns an *api.HTTPClient replaying the cassette testdata/cassettes/<name>.yaml,
+// or recording it if the -record flag is set and it isn't hand-written.
+func useCassette(t *testing.T, name string) *api.HTTPClient {
+	mode := cassette.ModeReplay
+	if *record && !handWrittenCassettes[name] {
+		mode = cassette.ModeRecord
+	}
+
+	recorder, err := cassette.New(filepath.Join("testdata", "cassettes", name+".yaml"), mode, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Recommendation requests contain a random request ID.
+	recorder.IgnoreQuery("p13n")
+
+	t.Cleanup(func() {
+		if err := recorder.Save(); err != nil {
+			t.Errorf("error saving cassette %s: %s", name, err)
+		}
+	})
+
+	client := api.NewHTTPClient()
+	client.SetTransport(recorder)
+
+	return client
+}
+
+// assertGolden compares scraped output, or the reference of the error returned instead,
+// to the golden file testdata/golden/<name>.json, rewriting it if the -update flag is
+// set.
+func assertGolden(t *testing.T, name string, output interface{}, err error) {
+	if err != nil {
+		apiErr := &api.APIError{}
+		responseErr := &api.ResponseError{}
+		if errors.As(err, &responseErr) {
+			output = map[string]string{"error": responseErr.Reference}
+		} else if errors.As(err, &apiErr) {
+			output = map[string]string{"error": apiErr.Reference}
+		} else {
+			t.Fatalf("%s: unexpected error %s", name, err)
+		}
+	}
+
+	actual, err := json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join("testdata", "golden", name+".json")
+	if *update {
+		if err := ioutil.WriteFile(path, append(actual, '\n'), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(expected) != string(actual)+"\n" {
+		t.Errorf("%s: output doesn't match golden file %s, got:\n%s", name, path, actual)
+	}
+}
+
+// TestCassettes tests GetItemDetails and GetItemRelatedItems against recorded responses,
+// comparing their output to golden files. Refresh both with `make cassettes`.
+func TestCassettes(t *testing.T) {
+	tests := []struct {
+		name     string
+		cassette string
+		run      func(c *walmart.Client) (interface{}, error)
+	}{
+		{"item-page", "item-page", func(c *walmart.Client) (interface{}, error) {
+			return c.GetItemDetails(context.Background(), "onn-32-Class-HD-720P-Roku-Smart-LED-TV-100012589", "314022535")
+		}},
+		{"recommendations", "recommendations", func(c *walmart.Client) (interface{}, error) {
+			item, err := c.GetItemDetails(context.Background(), "onn-32-Class-HD-720P-Roku-Smart-LED-TV-100012589", "314022535")
+			if err != nil {
+				return nil, err
+			}
+
+			items, err := c.GetItemRelatedItems(context.Background(), item.ID, item.CategoryID, item.Category, item.Name, "")
+			sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+
+			return items, err
+		}},
+		{"blocked", "blocked", func(c *walmart.Client) (interface{}, error) {
+			return c.GetItemDetails(context.Background(), "onn-32-Class-HD-720P-Roku-Smart-LED-TV-100012589", "314022535")
+		}},
+		{"not-found", "not-found", func(c *walmart.Client) (interface{}, error) {
+			return c.GetItemDetails(context.Background(), "Discontinued-Item", "100000001")
+		}},
+	}
+
+	for _, test := range tests {
+		c := walmart.NewClient(useCassette(t, test.cassette), zap.NewNop())
+		output, err := test.run(c)
+		assertGolden(t, test.name, output, err)
+	}
+}
@@ -1,48 +1,118 @@
 package walmart
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
-	"io/ioutil"
+	"errors"
+	"fmt"
+	"net/http"
 	"regexp"
 	"strings"
 
 	"github.com/antchfx/htmlquery"
+	"github.com/bfoody/Walmart-Scraper/domain"
 	"github.com/bfoody/Walmart-Scraper/services/client/internal/api"
+	"go.uber.org/zap"
+	"golang.org/x/net/html"
 )
 
+// WalmartSellerID is the seller ID of offers sold by Walmart itself rather than a
+// marketplace seller.
+const WalmartSellerID = "F55CDC31AB754BB68FE0B39041159D63"
+
+// blockPageMarkers are found in the robot check pages served to blocked requests,
+// which may be served with a 200 status code.
+var blockPageMarkers = [][]byte{
+	[]byte("px-captcha"),
+	[]byte("Robot or human?"),
+	[]byte("g-recaptcha"),
+}
+
+// IsBlockPage is the api.BlockDetector of Walmart, detecting the robot check page
+// blocked requests are redirected to.
+func IsBlockPage(res *http.Response, body []byte) bool {
+	if res.Request != nil && res.Request.URL.Path == "/blocked" {
+		return true
+	}
+
+	for _, marker := range blockPageMarkers {
+		if bytes.Contains(body, marker) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// A Client scrapes product information from Walmart.
 type Client struct {
-	client *api.HTTPClient
+	client    *api.HTTPClient
+	endpoints Endpoints
+	log       *zap.Logger
+}
+
+// NewClient creates and returns a new Walmart API Client scraping walmart.com.
+func NewClient(client *api.HTTPClient, logger *zap.Logger) *Client {
+	return NewClientWithEndpoints(client, NewEndpoints("", ""), logger)
 }
 
-// NewClient creates and returns a new Walmart API Client.
-func NewClient(client *api.HTTPClient) *Client {
+// NewClientWithEndpoints creates and returns a new Walmart API Client scraping the
+// supplied endpoints, eg. a fake Walmart server.
+func NewClientWithEndpoints(client *api.HTTPClient, endpoints Endpoints, logger *zap.Logger) *Client {
 	return &Client{
-		client,
+		client:    client,
+		endpoints: endpoints,
+		log:       logger,
 	}
 }
 
-// GetItemDetails scrapes the details page for a single item.
-func (c *Client) GetItemDetails(itemSlug, itemID string) (*ItemDetails, error) {
+// GetItemDetails scrapes the details page for a single item at the default store.
+func (c *Client) GetItemDetails(ctx context.Context, itemSlug, itemID string) (*ItemDetails, error) {
+	return c.GetItemDetailsAt(ctx, itemSlug, itemID, domain.StoreContext{})
+}
+
+// GetItemDetailsAt scrapes the details page for a single item, with the prices and
+// availability of a store or ZIP code.
+func (c *Client) GetItemDetailsAt(ctx context.Context, itemSlug, itemID string, store domain.StoreContext) (*ItemDetails, error) {
 	// Fetch the item page.
-	resp, err := c.client.Get(ItemDetailsPage(itemSlug, itemID))
+	url := c.endpoints.ItemDetailsPage(itemSlug, itemID)
+	resp, err := c.client.GetWithCookies(api.WithBlockDetector(ctx, IsBlockPage), url, storeCookies(store))
 	if err != nil {
 		// Return the HTTPError.
 		return nil, err
 	}
 
-	// Read the HTML body.
-	body, err := ioutil.ReadAll(resp.Body)
+	c.log.Debug("fetched item page", zap.String("url", url), zap.Int("status", resp.StatusCode))
+
+	// Read the HTML body, closing it.
+	body, err := api.ReadBody(resp)
 	if err != nil {
 		return nil, api.NewAPIError(resp, "failed to read response body", "io_error", err)
 	}
 
+	// Robot checks and missing items aren't item pages, so don't try to parse them.
+	if err := api.ClassifyResponse(resp, body); err != nil {
+		return nil, err
+	}
+
 	// Parse the HTML with htmlquery.
-	html := string(body)
-	doc, err := htmlquery.Parse(strings.NewReader(html))
+	doc, err := htmlquery.Parse(strings.NewReader(string(body)))
 	if err != nil {
 		return nil, api.NewAPIError(resp, "failed to parse html", "html_parse_error", err)
 	}
 
+	item, err := c.extractItem(doc, itemSlug, itemID)
+	if err != nil {
+		return nil, api.NewAPIError(resp, "failed to extract item from page", "deserialization_error", err)
+	}
+
+	return item, nil
+}
+
+// extractItemScript extracts an item's details from the `item` JSON script of the
+// legacy item page layout.
+func (c *Client) extractItemScript(doc *html.Node, itemSlug, itemID string) (*ItemDetails, error) {
 	// Match the `item` JSON in the webpage with this type.
 	type queryType struct {
 		Item struct {
@@ -64,63 +134,234 @@ func (c *Client) GetItemDetails(itemSlug, itemID string) (*ItemDetails, error) {
 				} `json:"midasContext"`
 				BuyBox struct {
 					Products []struct {
+						USItemID           string `json:"usItemId"`
+						ProductName        string `json:"productName"`
+						CanonicalURL       string `json:"canonicalUrl"`
 						AvailabilityStatus string `json:"availabilityStatus"`
 						PickUpMethod       string `json:"pickUpMethod"`
+						SellerID           string `json:"sellerId"`
+						SellerDisplayName  string `json:"sellerDisplayName"`
+						UPC                string `json:"upc"`
+						PriceMap           struct {
+							Price         float32 `json:"price"`
+							WasPrice      float32 `json:"wasPrice"`
+							ListPrice     float32 `json:"listPrice"`
+							UnitPrice     float32 `json:"unitPrice"`
+							UnitOfMeasure string  `json:"unitOfMeasure"`
+						} `json:"priceMap"`
+						ShippingOptions []struct {
+							ShipMethod string `json:"shipMethod"`
+						} `json:"shippingOptions"`
+						Images []struct {
+							Type string `json:"type"`
+							URL  string `json:"url"`
+						} `json:"images"`
+						Variants []struct {
+							Name  string `json:"name"`
+							Value string `json:"value"`
+						} `json:"variants"`
+						Offers []struct {
+							SellerID           string  `json:"sellerId"`
+							SellerDisplayName  string  `json:"sellerDisplayName"`
+							Price              float32 `json:"price"`
+							AvailabilityStatus string  `json:"availabilityStatus"`
+						} `json:"offers"`
 					} `json:"products"`
 				} `json:"buyBox"`
+				Reviews map[string]struct {
+					AverageOverallRating float32 `json:"averageOverallRating"`
+					TotalReviewCount     int     `json:"totalReviewCount"`
+				} `json:"reviews"`
 			} `json:"product"`
 			Query string `json:"query"`
 		}
 	}
 
 	// Find the JSON payload inside the script tag with the ID of item.
-	name, err := htmlquery.Query(doc, "//script[@id=\"item\"]")
-	if err != nil || name == nil {
-		return nil, api.NewAPIError(resp, "failed to find `name` element", "deserialization_error", err)
+	script := htmlquery.FindOne(doc, "//script[@id=\"item\"]")
+	if script == nil {
+		return nil, errNoMatch
 	}
 
-	jsonStr := htmlquery.InnerText(name)
-
 	// Decode the JSON value into the struct.
 	query := queryType{}
-	err = json.NewDecoder(strings.NewReader(jsonStr)).Decode(&query)
+	err := json.NewDecoder(strings.NewReader(htmlquery.InnerText(script))).Decode(&query)
 	if err != nil {
-		return nil, api.NewAPIError(resp, "failed to decode item json payload", "deserialization_error", err)
+		return nil, fmt.Errorf("failed to decode item json payload: %w", err)
 	}
 
 	if len(query.Item.Product.BuyBox.Products) < 1 {
-		return nil, api.NewAPIError(resp, "item.product.buyBox.products array empty", "parse_error", nil)
+		return nil, errors.New("item.product.buyBox.products array empty")
+	}
+
+	midas := query.Item.Product.MidasContext
+
+	// The buy box lists every variant of the item, eg. each size or color, with the
+	// item itself usually first.
+	products := query.Item.Product.BuyBox.Products
+	buyBox := products[0]
+	for _, product := range products {
+		if product.USItemID == itemID {
+			buyBox = product
+		}
+	}
+
+	variants := []ItemDetails{}
+	for _, product := range products {
+		if product.USItemID == "" || product.USItemID == buyBox.USItemID {
+			continue
+		}
+
+		matches := ItemURLRegex.FindStringSubmatch(product.CanonicalURL)
+		if matches == nil {
+			c.log.Debug("skipping variant with invalid url", zap.String("url", product.CanonicalURL))
+			continue
+		}
+
+		variant := []string{}
+		for _, v := range product.Variants {
+			variant = append(variant, fmt.Sprintf("%s: %s", v.Name, v.Value))
+		}
+
+		variants = append(variants, ItemDetails{
+			ID:                 product.USItemID,
+			Slug:               matches[1],
+			Name:               product.ProductName,
+			Category:           midas.CategoryPathName,
+			CategoryID:         midas.CategoryPathID,
+			Price:              product.PriceMap.Price,
+			AvailabilityStatus: product.AvailabilityStatus,
+			InStock:            product.AvailabilityStatus == "IN_STOCK",
+			Variant:            strings.Join(variant, ", "),
+		})
+	}
+
+	variant := []string{}
+	for _, v := range buyBox.Variants {
+		variant = append(variant, fmt.Sprintf("%s: %s", v.Name, v.Value))
+	}
+
+	// Items sold by several marketplace sellers list each seller's offer, otherwise the
+	// buy box is the only offer.
+	offers := []ItemOffer{}
+	buyBoxFound := false
+	for _, offer := range buyBox.Offers {
+		isBuyBox := !buyBoxFound && offer.SellerID == buyBox.SellerID
+		buyBoxFound = buyBoxFound || isBuyBox
+
+		offers = append(offers, ItemOffer{
+			SellerID:           offer.SellerID,
+			SellerName:         offer.SellerDisplayName,
+			ThirdPartySeller:   isThirdPartySeller(offer.SellerID),
+			Price:              offer.Price,
+			AvailabilityStatus: offer.AvailabilityStatus,
+			InStock:            offer.AvailabilityStatus == "IN_STOCK",
+			BuyBox:             isBuyBox,
+		})
+	}
+	if len(offers) == 0 {
+		offers = append(offers, buyBoxOffer(buyBox.SellerID, buyBox.SellerDisplayName, midas.Price, buyBox.AvailabilityStatus))
+	}
+
+	// The list price is the price before a rollback, which is only set for discounted
+	// items.
+	listPrice := buyBox.PriceMap.WasPrice
+	if listPrice == 0 {
+		listPrice = buyBox.PriceMap.ListPrice
+	}
+	if listPrice <= midas.Price {
+		listPrice = 0
+	}
+
+	shippingOptions := []string{}
+	for _, option := range buyBox.ShippingOptions {
+		shippingOptions = append(shippingOptions, option.ShipMethod)
+	}
+
+	imageURLs := []string{}
+	for _, image := range buyBox.Images {
+		if image.Type == "PRIMARY" {
+			imageURLs = append([]string{image.URL}, imageURLs...)
+		} else {
+			imageURLs = append(imageURLs, image.URL)
+		}
+	}
+
+	reviews, ok := query.Item.Product.Reviews[itemID]
+	if !ok {
+		// Reviews may be keyed by the product ID instead, which isn't otherwise known.
+		for _, r := range query.Item.Product.Reviews {
+			reviews = r
+			break
+		}
 	}
 
 	return &ItemDetails{
 		ID:                 itemID,
 		Slug:               itemSlug,
-		Name:               query.Item.Product.MidasContext.Query,
-		Category:           query.Item.Product.MidasContext.CategoryPathName,
-		CategoryID:         query.Item.Product.MidasContext.CategoryPathID,
-		Price:              query.Item.Product.MidasContext.Price,
-		AvailabilityStatus: query.Item.Product.BuyBox.Products[0].AvailabilityStatus,
-		InStock:            query.Item.Product.BuyBox.Products[0].AvailabilityStatus == "IN_STOCK",
+		Name:               midas.Query,
+		Category:           midas.CategoryPathName,
+		CategoryID:         midas.CategoryPathID,
+		Price:              midas.Price,
+		AvailabilityStatus: buyBox.AvailabilityStatus,
+		InStock:            buyBox.AvailabilityStatus == "IN_STOCK",
+		Brand:              midas.Brand,
+		Manufacturer:       midas.Manufacturer,
+		UPC:                buyBox.UPC,
+		ImageURLs:          imageURLs,
+		ListPrice:          listPrice,
+		UnitPrice:          buyBox.PriceMap.UnitPrice,
+		UnitOfMeasure:      buyBox.PriceMap.UnitOfMeasure,
+		SellerID:           buyBox.SellerID,
+		SellerName:         buyBox.SellerDisplayName,
+		ThirdPartySeller:   isThirdPartySeller(buyBox.SellerID),
+		Rating:             reviews.AverageOverallRating,
+		ReviewCount:        reviews.TotalReviewCount,
+		FreeShipping:       midas.FreeShipping,
+		InStore:            midas.InStore,
+		Online:             midas.Online,
+		Preorder:           midas.Preorder,
+		ShippingOptions:    shippingOptions,
+		Variant:            strings.Join(variant, ", "),
+		Variants:           variants,
+		Offers:             offers,
 	}, nil
 }
 
+// isThirdPartySeller returns true if a seller ID belongs to a marketplace seller rather
+// than Walmart.
+func isThirdPartySeller(sellerID string) bool {
+	return sellerID != "" && sellerID != WalmartSellerID
+}
+
 var SlugRegex = regexp.MustCompile("\\/ip\\/(.{1,})\\/")
 
 // GetItemRelatedItems scrapes related items for a specific item, returning an array of items.
-func (c *Client) GetItemRelatedItems(itemID, categoryID, categoryPath, itemName string) ([]ItemDetails, error) {
+// The ZIP code defaults to DefaultZIPCode if empty.
+func (c *Client) GetItemRelatedItems(ctx context.Context, itemID, categoryID, categoryPath, itemName, zipCode string) ([]ItemDetails, error) {
+	if zipCode == "" {
+		zipCode = DefaultZIPCode
+	}
+
 	// Fetch the item page.
-	resp, err := c.client.Get(ItemRecommendations(itemID, categoryID, categoryPath, itemName))
+	resp, err := c.client.Get(api.WithBlockDetector(ctx, IsBlockPage), c.endpoints.ItemRecommendations(itemID, categoryID, categoryPath, itemName, zipCode))
 	if err != nil {
 		// Return the HTTPError.
 		return nil, err
 	}
 
-	// Read the HTML body.
-	body, err := ioutil.ReadAll(resp.Body)
+	c.log.Debug("fetched item recommendations", zap.String("itemId", itemID), zap.Int("status", resp.StatusCode))
+
+	// Read the HTML body, closing it.
+	body, err := api.ReadBody(resp)
 	if err != nil {
 		return nil, api.NewAPIError(resp, "failed to read response body", "io_error", err)
 	}
 
+	if err := api.ClassifyResponse(resp, body); err != nil {
+		return nil, err
+	}
+
 	jsonStr := string(body)
 
 	type queryType struct {
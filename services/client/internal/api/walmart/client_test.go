@@ -1,20 +1,34 @@
 package walmart_test
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/bfoody/Walmart-Scraper/services/client/internal/api"
 	"github.com/bfoody/Walmart-Scraper/services/client/internal/api/walmart"
+	"go.uber.org/zap"
 )
 
 const (
 	testItemName = "onn. 32\" Class HD (720P) Roku Smart LED TV (100012589)"
 )
 
+// serveFixture serves a fixture from testdata at every path, returning the server's URL.
+func serveFixture(t *testing.T, fixture string) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "testdata/"+fixture)
+	}))
+	t.Cleanup(server.Close)
+
+	return server.URL
+}
+
 // TestGetItemDetails tests the GetItemDetails scraping method.
 func TestGetItemDetails(t *testing.T) {
-	c := walmart.NewClient(api.NewHTTPClient())
-	item, err := c.GetItemDetails("onn-32-Class-HD-720P-Roku-Smart-LED-TV-100012589", "314022535")
+	c := walmart.NewClient(useCassette(t, "item-page"), zap.NewNop())
+	item, err := c.GetItemDetails(context.Background(), "onn-32-Class-HD-720P-Roku-Smart-LED-TV-100012589", "314022535")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -26,8 +40,8 @@ func TestGetItemDetails(t *testing.T) {
 
 // TestGetItemRecommendations tests the GetItemRelatedItems scraping method.
 func TestGetItemRecommendations(t *testing.T) {
-	c := walmart.NewClient(api.NewHTTPClient())
-	item, err := c.GetItemDetails("onn-32-Class-HD-720P-Roku-Smart-LED-TV-100012589", "314022535")
+	c := walmart.NewClient(useCassette(t, "recommendations"), zap.NewNop())
+	item, err := c.GetItemDetails(context.Background(), "onn-32-Class-HD-720P-Roku-Smart-LED-TV-100012589", "314022535")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -36,7 +50,7 @@ func TestGetItemRecommendations(t *testing.T) {
 		t.Errorf("expected item.Name == %s, got %s", testItemName, item.Name)
 	}
 
-	items, err := c.GetItemRelatedItems(item.ID, item.CategoryID, item.Category, item.Name)
+	items, err := c.GetItemRelatedItems(context.Background(), item.ID, item.CategoryID, item.Category, item.Name, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -45,3 +59,77 @@ func TestGetItemRecommendations(t *testing.T) {
 		t.Error("`items` array is empty")
 	}
 }
+
+// TestGetItemDetailsFields tests scraping the seller, pricing, rating and product
+// details from an item page.
+func TestGetItemDetailsFields(t *testing.T) {
+	serverURL := serveFixture(t, "item.html")
+
+	c := walmart.NewClientWithEndpoints(api.NewHTTPClient(), walmart.NewEndpoints(serverURL, serverURL), zap.NewNop())
+	item, err := c.GetItemDetails(context.Background(), "Great-Value-Whole-Vitamin-D-Milk-1-Gallon-128-fl-oz", "10450114")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if item.Brand != "Great Value" || item.Manufacturer != "Walmart Stores, Inc." || item.UPC != "078742351865" {
+		t.Errorf("unexpected product details %+v", item)
+	}
+
+	if item.Price != 2.98 || item.ListPrice != 3.24 || item.UnitPrice != 2.3 || item.UnitOfMeasure != "fl oz" {
+		t.Errorf("unexpected pricing %+v", item)
+	}
+
+	if item.SellerName != "Walmart.com" || item.ThirdPartySeller {
+		t.Errorf("expected item to be sold by Walmart, got %+v", item)
+	}
+
+	if item.Rating != 4.4 || item.ReviewCount != 1877 {
+		t.Errorf("unexpected rating %+v", item)
+	}
+
+	if !item.InStore || !item.Online || item.FreeShipping || len(item.ShippingOptions) != 2 {
+		t.Errorf("unexpected fulfillment %+v", item)
+	}
+
+	if len(item.ImageURLs) != 2 || item.ImageURLs[0] != "https://i5.walmartimages.com/asr/milk-front.jpeg" {
+		t.Errorf("expected the primary image first, got %v", item.ImageURLs)
+	}
+}
+
+// TestGetItemDetailsVariantsAndOffers tests scraping an item's other variants and
+// every seller's offer from its buy box.
+func TestGetItemDetailsVariantsAndOffers(t *testing.T) {
+	serverURL := serveFixture(t, "item.html")
+
+	c := walmart.NewClientWithEndpoints(api.NewHTTPClient(), walmart.NewEndpoints(serverURL, serverURL), zap.NewNop())
+	item, err := c.GetItemDetails(context.Background(), "Great-Value-Whole-Vitamin-D-Milk-1-Gallon-128-fl-oz", "10450114")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if item.Variant != "Size: 1 Gallon" {
+		t.Errorf("expected the item's own variant, got %q", item.Variant)
+	}
+
+	if len(item.Variants) != 1 {
+		t.Fatalf("expected 1 other variant, got %+v", item.Variants)
+	}
+
+	variant := item.Variants[0]
+	if variant.ID != "10450115" || variant.Slug != "Great-Value-Whole-Vitamin-D-Milk-Half-Gallon-64-fl-oz" || variant.Variant != "Size: Half Gallon" || variant.Price != 1.98 || variant.InStock {
+		t.Errorf("unexpected variant %+v", variant)
+	}
+
+	if len(item.Offers) != 2 {
+		t.Fatalf("expected 2 offers, got %+v", item.Offers)
+	}
+
+	marketplace, buyBox := item.Offers[0], item.Offers[1]
+	if marketplace.SellerName != "Dairy Direct" || !marketplace.ThirdPartySeller || marketplace.BuyBox || marketplace.Price != 4.5 {
+		t.Errorf("unexpected marketplace offer %+v", marketplace)
+	}
+
+	if buyBox.SellerName != "Walmart.com" || buyBox.ThirdPartySeller || !buyBox.BuyBox || buyBox.Price != 2.98 {
+		t.Errorf("unexpected buy box offer %+v", buyBox)
+	}
+}
@@ -4,32 +4,71 @@ import (
 	"fmt"
 	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/bfoody/Walmart-Scraper/utils/uuid"
 )
 
-// WalmartAPIBase is the base URL of the Walmart site
+// WalmartAPIBase is the default base URL of the Walmart site
 // to which endpoints are appended.
 const WalmartAPIBase = "https://walmart.com"
 
-// QuimbyAPIBase is the base URL of Walmart's quimby service,
+// DefaultZIPCode is the ZIP code recommendations are requested for when none is given.
+const DefaultZIPCode = "94066"
+
+// QuimbyAPIBase is the default base URL of Walmart's quimby service,
 // which provides recommendations.
 const QuimbyAPIBase = "https://quimby.mobile.walmart.com"
 
-var (
-	// ItemDetailsPage returns the endpoint for viewing a single item's
-	// details.
-	ItemDetailsPage = func(itemSlug string, itemID string) string {
-		return fmt.Sprintf("%s/ip/%s/%s", WalmartAPIBase, itemSlug, itemID)
+// Endpoints builds the URLs scraped by a Client from the base URLs of the Walmart
+// site and quimby service, which can point at a fake server for testing.
+type Endpoints struct {
+	Base   string // the base URL of the Walmart site, eg. WalmartAPIBase
+	Quimby string // the base URL of the quimby service, eg. QuimbyAPIBase
+}
+
+// NewEndpoints creates and returns Endpoints for the supplied base URLs, using the
+// default base URL for each one that is empty.
+func NewEndpoints(base, quimby string) Endpoints {
+	if base == "" {
+		base = WalmartAPIBase
 	}
-	// ItemRecommendations returns the endpoint for getting recommended items
-	// for a single item.
-	ItemRecommendations = func(itemID, categoryID, categoryPath, itemName string) string {
-		payload := fmt.Sprintf(`{"reqId":"%s","pageId":"%s","catId":"%s","itemInfo":{"primaryCategoryPath":%s,"productName":%s,"itemAvailabilityStatus":"IN_STOCK","itemOfferType":"ONLINE_AND_STORE","isPrimaryOfferPUTEligible":true,"walledGarden":"false","verticalId":"standard"},"userReqInfo":{"referer":""},"userClientInfo":{"deviceType":"desktop","callType":"CLIENT"}}`, uuid.Generate(), itemID, categoryID, strconv.Quote(categoryPath), strconv.Quote(itemName))
 
-		return fmt.Sprintf("%s/tempo?tenant=Walmart.com&channel=WWW&pageType=ItemPage&enrich=athenaunified,iro&item=%s&location={%%22zipCode%%22:%%2294066%%22,%%22isZipLocated%%22:false}&wm_site_mode=0&p13ncluster=&targeting={%%22nextDayStatus%%22:%%22notEligible%%22}&p13n=%s", QuimbyAPIBase, itemID, url.QueryEscape(payload))
+	if quimby == "" {
+		quimby = QuimbyAPIBase
 	}
-)
+
+	return Endpoints{
+		Base:   strings.TrimSuffix(base, "/"),
+		Quimby: strings.TrimSuffix(quimby, "/"),
+	}
+}
+
+// ItemDetailsPage returns the endpoint for viewing a single item's
+// details.
+func (e Endpoints) ItemDetailsPage(itemSlug string, itemID string) string {
+	return fmt.Sprintf("%s/ip/%s/%s", e.Base, itemSlug, itemID)
+}
+
+// SearchPage returns the endpoint for a page of search results for a query,
+// starting from page 1.
+func (e Endpoints) SearchPage(query string, page int) string {
+	return fmt.Sprintf("%s/search?q=%s&page=%d", e.Base, url.QueryEscape(query), page)
+}
+
+// BrowsePage returns the endpoint for a page of a category's listing, starting
+// from page 1.
+func (e Endpoints) BrowsePage(categoryID string, page int) string {
+	return fmt.Sprintf("%s/browse/%s?page=%d", e.Base, url.PathEscape(categoryID), page)
+}
+
+// ItemRecommendations returns the endpoint for getting recommended items
+// for a single item in the area of a ZIP code.
+func (e Endpoints) ItemRecommendations(itemID, categoryID, categoryPath, itemName, zipCode string) string {
+	payload := fmt.Sprintf(`{"reqId":"%s","pageId":"%s","catId":"%s","itemInfo":{"primaryCategoryPath":%s,"productName":%s,"itemAvailabilityStatus":"IN_STOCK","itemOfferType":"ONLINE_AND_STORE","isPrimaryOfferPUTEligible":true,"walledGarden":"false","verticalId":"standard"},"userReqInfo":{"referer":""},"userClientInfo":{"deviceType":"desktop","callType":"CLIENT"}}`, uuid.Generate(), itemID, categoryID, strconv.Quote(categoryPath), strconv.Quote(itemName))
+
+	return fmt.Sprintf("%s/tempo?tenant=Walmart.com&channel=WWW&pageType=ItemPage&enrich=athenaunified,iro&item=%s&location={%%22zipCode%%22:%%22%s%%22,%%22isZipLocated%%22:false}&wm_site_mode=0&p13ncluster=&targeting={%%22nextDayStatus%%22:%%22notEligible%%22}&p13n=%s", e.Quimby, itemID, url.QueryEscape(zipCode), url.QueryEscape(payload))
+}
 
 // url requires ?p13n=%7B%22reqId%22%3A%22920f6fff-007-17b1a44c348981%22%2C%22pageId%22%3A%22314022535%22%2C%22catId%22%3A%220%3A3944%3A1060825%3A447913%22%2C%22itemInfo%22%3A%7B%22primaryCategoryPath%22%3A%22Home%20Page%2FElectronics%2FTV%20%26%20Video%2FAll%20TVs%22%2C%22productName%22%3A%22onn.%2032%5C%22%20Class%20HD%20(720P)%20Roku%20Smart%20LED%20TV%20(100012589)%22%2C%22itemAvailabilityStatus%22%3A%22IN_STOCK%22%2C%22itemOfferType%22%3A%22ONLINE_AND_STORE%22%2C%22isPrimaryOfferPUTEligible%22%3Atrue%2C%22walledGarden%22%3A%22false%22%2C%22verticalId%22%3A%22standard%22%7D%2C%22userReqInfo%22%3A%7B%22referer%22%3A%22%22%7D%2C%22userClientInfo%22%3A%7B%22deviceType%22%3A%22desktop%22%2C%22callType%22%3A%22CLIENT%22%7D%7D
 // reverse engineer ^
@@ -0,0 +1,280 @@
+package walmart
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/antchfx/htmlquery"
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/api"
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/api/jsonld"
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/metrics"
+	"go.uber.org/zap"
+	"golang.org/x/net/html"
+)
+
+// The strategies used to extract an item's details from its page, tagged on each
+// ItemDetails scraped by GetItemDetails.
+const (
+	// StrategyItemScript extracts the `item` JSON script of the legacy page layout.
+	StrategyItemScript = "item_script"
+	// StrategyNextData extracts the `__NEXT_DATA__` JSON script of the Next.js page layout.
+	StrategyNextData = "next_data"
+	// StrategyJSONLD extracts the schema.org Product JSON-LD used by search engines.
+	StrategyJSONLD = jsonld.StrategyJSONLD
+	// StrategyMicrodata extracts schema.org microdata attributes from the page's HTML.
+	StrategyMicrodata = "microdata"
+)
+
+// errNoMatch is returned by an extractor when the page doesn't contain the data it
+// looks for.
+var errNoMatch = errors.New("no match")
+
+// An itemExtractor extracts an item's details from a parsed item page using a single
+// strategy.
+type itemExtractor struct {
+	strategy string
+	extract  func(c *Client, doc *html.Node, itemSlug, itemID string) (*ItemDetails, error)
+}
+
+// itemExtractors are tried in order until one extracts the item, the first being the
+// primary strategy. Later strategies find less of the item's details.
+var itemExtractors = []itemExtractor{
+	{StrategyItemScript, (*Client).extractItemScript},
+	{StrategyNextData, (*Client).extractNextData},
+	{StrategyJSONLD, (*Client).extractJSONLD},
+	{StrategyMicrodata, (*Client).extractMicrodata},
+}
+
+// extractItem extracts an item's details with the first strategy that succeeds,
+// tagging the details with the strategy.
+func (c *Client) extractItem(doc *html.Node, itemSlug, itemID string) (*ItemDetails, error) {
+	failures := []string{}
+
+	for i, extractor := range itemExtractors {
+		item, err := extractor.extract(c, doc, itemSlug, itemID)
+		if err != nil {
+			if i == 0 {
+				metrics.PrimaryExtractorMisses.Inc()
+				c.log.Warn("primary extraction strategy failed, the item page layout may have changed", zap.String("strategy", extractor.strategy), zap.String("itemId", itemID), zap.Error(err))
+			}
+
+			failures = append(failures, fmt.Sprintf("%s: %s", extractor.strategy, err))
+			continue
+		}
+
+		metrics.ItemExtractions.WithLabelValues(extractor.strategy).Inc()
+
+		item.Strategy = extractor.strategy
+		return item, nil
+	}
+
+	return nil, fmt.Errorf("%w (%s)", api.ErrExtractionFailed, strings.Join(failures, "; "))
+}
+
+// extractNextData extracts an item's details from the `__NEXT_DATA__` JSON script of
+// the Next.js page layout.
+func (c *Client) extractNextData(doc *html.Node, itemSlug, itemID string) (*ItemDetails, error) {
+	script := htmlquery.FindOne(doc, "//script[@id=\"__NEXT_DATA__\"]")
+	if script == nil {
+		return nil, errNoMatch
+	}
+
+	// Match the page's `__NEXT_DATA__` JSON with this type.
+	type queryType struct {
+		Props struct {
+			PageProps struct {
+				InitialData struct {
+					Data struct {
+						Product *struct {
+							USItemID           string  `json:"usItemId"`
+							Name               string  `json:"name"`
+							Brand              string  `json:"brand"`
+							ManufacturerName   string  `json:"manufacturerName"`
+							UPC                string  `json:"upc"`
+							AvailabilityStatus string  `json:"availabilityStatus"`
+							SellerID           string  `json:"sellerId"`
+							SellerDisplayName  string  `json:"sellerDisplayName"`
+							AverageRating      float32 `json:"averageRating"`
+							NumberOfReviews    int     `json:"numberOfReviews"`
+							Category           struct {
+								CategoryPathID string `json:"categoryPathId"`
+								Path           []struct {
+									Name string `json:"name"`
+								} `json:"path"`
+							} `json:"category"`
+							PriceInfo struct {
+								CurrentPrice struct {
+									Price float32 `json:"price"`
+								} `json:"currentPrice"`
+								WasPrice struct {
+									Price float32 `json:"price"`
+								} `json:"wasPrice"`
+								UnitPrice struct {
+									Price float32 `json:"price"`
+								} `json:"unitPrice"`
+							} `json:"priceInfo"`
+							ImageInfo struct {
+								AllImages []struct {
+									URL string `json:"url"`
+								} `json:"allImages"`
+							} `json:"imageInfo"`
+						} `json:"product"`
+					} `json:"data"`
+				} `json:"initialData"`
+			} `json:"pageProps"`
+		} `json:"props"`
+	}
+
+	query := queryType{}
+	err := json.NewDecoder(strings.NewReader(htmlquery.InnerText(script))).Decode(&query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode next data json payload: %w", err)
+	}
+
+	// Search and browse pages share the script without a product.
+	product := query.Props.PageProps.InitialData.Data.Product
+	if product == nil {
+		return nil, errNoMatch
+	}
+
+	category := []string{}
+	for _, node := range product.Category.Path {
+		category = append(category, node.Name)
+	}
+
+	imageURLs := []string{}
+	for _, image := range product.ImageInfo.AllImages {
+		imageURLs = append(imageURLs, image.URL)
+	}
+
+	price := product.PriceInfo.CurrentPrice.Price
+	listPrice := product.PriceInfo.WasPrice.Price
+	if listPrice <= price {
+		listPrice = 0
+	}
+
+	return &ItemDetails{
+		ID:                 itemID,
+		Slug:               itemSlug,
+		Name:               product.Name,
+		Category:           strings.Join(category, "/"),
+		CategoryID:         product.Category.CategoryPathID,
+		Price:              price,
+		AvailabilityStatus: product.AvailabilityStatus,
+		InStock:            product.AvailabilityStatus == "IN_STOCK",
+		Brand:              product.Brand,
+		Manufacturer:       product.ManufacturerName,
+		UPC:                product.UPC,
+		ImageURLs:          imageURLs,
+		ListPrice:          listPrice,
+		UnitPrice:          product.PriceInfo.UnitPrice.Price,
+		SellerID:           product.SellerID,
+		SellerName:         product.SellerDisplayName,
+		ThirdPartySeller:   isThirdPartySeller(product.SellerID),
+		Rating:             product.AverageRating,
+		ReviewCount:        product.NumberOfReviews,
+		ShippingOptions:    []string{},
+		Variants:           []ItemDetails{},
+		Offers:             []ItemOffer{buyBoxOffer(product.SellerID, product.SellerDisplayName, price, product.AvailabilityStatus)},
+	}, nil
+}
+
+// extractJSONLD extracts an item's details from the page's schema.org Product JSON-LD.
+func (c *Client) extractJSONLD(doc *html.Node, itemSlug, itemID string) (*ItemDetails, error) {
+	product := jsonld.FindProductData(doc)
+	if product == nil {
+		return nil, errNoMatch
+	}
+
+	return &ItemDetails{
+		ID:                 itemID,
+		Slug:               itemSlug,
+		Name:               product.Name,
+		Category:           product.Category,
+		Price:              product.Price,
+		AvailabilityStatus: product.AvailabilityStatus,
+		InStock:            product.AvailabilityStatus == "IN_STOCK",
+		Brand:              product.Brand,
+		Manufacturer:       product.Manufacturer,
+		UPC:                product.GTIN,
+		ImageURLs:          product.ImageURLs,
+		SellerName:         product.SellerName,
+		Rating:             product.Rating,
+		ReviewCount:        product.ReviewCount,
+		ShippingOptions:    []string{},
+		Variants:           []ItemDetails{},
+		Offers:             []ItemOffer{buyBoxOffer("", product.SellerName, product.Price, product.AvailabilityStatus)},
+	}, nil
+}
+
+// extractMicrodata extracts an item's name, price and availability from schema.org
+// microdata attributes, falling back to the page's heading for the name.
+func (c *Client) extractMicrodata(doc *html.Node, itemSlug, itemID string) (*ItemDetails, error) {
+	priceNode := htmlquery.FindOne(doc, "//*[@itemprop=\"price\"]")
+	if priceNode == nil {
+		return nil, errNoMatch
+	}
+
+	priceStr := htmlquery.SelectAttr(priceNode, "content")
+	if priceStr == "" {
+		priceStr = htmlquery.InnerText(priceNode)
+	}
+
+	price, err := strconv.ParseFloat(strings.TrimPrefix(strings.TrimSpace(priceStr), "$"), 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse price %q: %w", priceStr, err)
+	}
+
+	name := ""
+	if node := htmlquery.FindOne(doc, "//*[@itemprop=\"name\"]"); node != nil {
+		name = strings.TrimSpace(htmlquery.InnerText(node))
+	} else if node := htmlquery.FindOne(doc, "//h1"); node != nil {
+		name = strings.TrimSpace(htmlquery.InnerText(node))
+	}
+
+	// Availability is a link or meta tag to a schema.org ItemAvailability, eg.
+	// "https://schema.org/InStock".
+	status := "UNKNOWN"
+	if node := htmlquery.FindOne(doc, "//*[@itemprop=\"availability\"]"); node != nil {
+		availability := htmlquery.SelectAttr(node, "href")
+		if availability == "" {
+			availability = htmlquery.SelectAttr(node, "content")
+		}
+
+		if strings.HasSuffix(availability, "InStock") {
+			status = "IN_STOCK"
+		} else if strings.HasSuffix(availability, "OutOfStock") {
+			status = "OUT_OF_STOCK"
+		}
+	}
+
+	return &ItemDetails{
+		ID:                 itemID,
+		Slug:               itemSlug,
+		Name:               name,
+		Price:              float32(price),
+		AvailabilityStatus: status,
+		InStock:            status == "IN_STOCK",
+		ImageURLs:          []string{},
+		ShippingOptions:    []string{},
+		Variants:           []ItemDetails{},
+		Offers:             []ItemOffer{buyBoxOffer("", "", float32(price), status)},
+	}, nil
+}
+
+// buyBoxOffer returns the offer shown by default, for pages which don't list every
+// seller's offer.
+func buyBoxOffer(sellerID, sellerName string, price float32, availabilityStatus string) ItemOffer {
+	return ItemOffer{
+		SellerID:           sellerID,
+		SellerName:         sellerName,
+		ThirdPartySeller:   isThirdPartySeller(sellerID),
+		Price:              price,
+		AvailabilityStatus: availabilityStatus,
+		InStock:            availabilityStatus == "IN_STOCK",
+		BuyBox:             true,
+	}
+}
@@ -0,0 +1,65 @@
+package walmart_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/api"
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/api/walmart"
+	"go.uber.org/zap"
+)
+
+// TestGetItemDetailsStrategies tests that item pages are extracted by the first
+// strategy matching their layout, and that the strategy is recorded.
+func TestGetItemDetailsStrategies(t *testing.T) {
+	tests := []struct {
+		fixture  string
+		strategy string
+		inStock  bool
+		brand    string
+	}{
+		{"item.html", walmart.StrategyItemScript, true, "Great Value"},
+		{"item-next-data.html", walmart.StrategyNextData, true, "Great Value"},
+		{"item-json-ld.html", walmart.StrategyJSONLD, true, "Great Value"},
+		{"item-microdata.html", walmart.StrategyMicrodata, false, ""},
+	}
+
+	for _, test := range tests {
+		serverURL := serveFixture(t, test.fixture)
+
+		c := walmart.NewClientWithEndpoints(api.NewHTTPClient(), walmart.NewEndpoints(serverURL, serverURL), zap.NewNop())
+		item, err := c.GetItemDetails(context.Background(), "Great-Value-Whole-Vitamin-D-Milk-1-Gallon-128-fl-oz", "10450114")
+		if err != nil {
+			t.Errorf("%s: %s", test.fixture, err)
+			continue
+		}
+
+		if item.Strategy != test.strategy {
+			t.Errorf("%s: expected strategy %s, got %s", test.fixture, test.strategy, item.Strategy)
+		}
+
+		if item.Price != 2.98 || item.InStock != test.inStock || item.Brand != test.brand {
+			t.Errorf("%s: unexpected item %+v", test.fixture, item)
+		}
+
+		if len(item.Offers) != 1 && test.strategy != walmart.StrategyItemScript {
+			t.Errorf("%s: expected a single buy box offer, got %+v", test.fixture, item.Offers)
+		}
+	}
+}
+
+// TestGetItemDetailsUnknownLayout tests that a page matching no strategy is rejected.
+func TestGetItemDetailsUnknownLayout(t *testing.T) {
+	serverURL := serveFixture(t, "unknown-layout.html")
+
+	c := walmart.NewClientWithEndpoints(api.NewHTTPClient(), walmart.NewEndpoints(serverURL, serverURL), zap.NewNop())
+	_, err := c.GetItemDetails(context.Background(), "Great-Value-Whole-Vitamin-D-Milk-1-Gallon-128-fl-oz", "10450114")
+	if apiErr, ok := err.(*api.APIError); !ok || apiErr.Reference != "deserialization_error" {
+		t.Errorf("expected a deserialization_error, got %v", err)
+	}
+
+	if !errors.Is(err, api.ErrExtractionFailed) {
+		t.Errorf("expected the error to match ErrExtractionFailed, got %v", err)
+	}
+}
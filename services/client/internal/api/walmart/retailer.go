@@ -0,0 +1,184 @@
+package walmart
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/bfoody/Walmart-Scraper/domain"
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/api"
+	"go.uber.org/zap"
+)
+
+// The Client is the adapter for locations with the "walmart" retailer key, which
+// supports discovery.
+var _ api.Discoverer = (*Client)(nil)
+
+// ItemURLRegex matches the slug and item ID in the path of an item page.
+var ItemURLRegex = regexp.MustCompile("\\/ip\\/(.{1,})\\/(\\d+)")
+
+// NewRetailerFactory returns an api.RetailerFactory creating Clients which scrape the
+// supplied endpoints and log to `logger`.
+func NewRetailerFactory(endpoints Endpoints, logger *zap.Logger) api.RetailerFactory {
+	return func(client *api.HTTPClient, location domain.Location) api.Retailer {
+		return NewClientWithEndpoints(client, endpoints, logger)
+	}
+}
+
+// FetchProduct scrapes the current info and details of a single product at a store.
+func (c *Client) FetchProduct(ctx context.Context, productLocation *domain.ProductLocation, store domain.StoreContext) (*api.ProductPage, error) {
+	id, err := c.GetItemDetailsAt(ctx, productLocation.Slug, productLocation.LocalID, store)
+	if err != nil {
+		return nil, err
+	}
+
+	offers := []domain.Offer{}
+	for _, offer := range id.Offers {
+		offers = append(offers, itemOfferToOffer(offer))
+	}
+
+	variants := []domain.ProductLocation{}
+	for _, variant := range id.Variants {
+		variants = append(variants, itemDetailsToProductLocation(c.endpoints, variant))
+	}
+
+	return &api.ProductPage{
+		Info:     itemDetailsToProductInfo(productLocation.ID, productLocation.ProductID, store, *id),
+		Product:  itemDetailsToProduct(*id),
+		Offers:   offers,
+		Variants: variants,
+	}, nil
+}
+
+// FetchRelated scrapes the recommendations for a single product.
+func (c *Client) FetchRelated(ctx context.Context, productLocation *domain.ProductLocation) ([]domain.ProductLocation, error) {
+	items, err := c.GetItemRelatedItems(ctx, productLocation.LocalID, productLocation.CategoryID, productLocation.Category, productLocation.Name, "")
+	if err != nil {
+		return nil, err
+	}
+
+	pl := []domain.ProductLocation{}
+	for _, item := range items {
+		pl = append(pl, itemDetailsToProductLocation(c.endpoints, item))
+	}
+
+	return pl, nil
+}
+
+// Discover scrapes a single page of search results for a query, or of a category's
+// listing by its browse ID.
+func (c *Client) Discover(ctx context.Context, kind string, query string, page int) ([]domain.ProductLocation, int, error) {
+	var results *SearchResults
+	var err error
+
+	switch kind {
+	case domain.DiscoveryKindSearch:
+		results, err = c.Search(ctx, query, page)
+	case domain.DiscoveryKindBrowse:
+		results, err = c.Browse(ctx, query, page)
+	default:
+		return nil, 0, fmt.Errorf("unknown discovery kind %q", kind)
+	}
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	pl := []domain.ProductLocation{}
+	for _, item := range results.Items {
+		pl = append(pl, itemDetailsToProductLocation(c.endpoints, item))
+	}
+
+	return pl, results.TotalPages, nil
+}
+
+// ParseProductURL extracts the slug and item ID from an item page URL,
+// eg. https://www.walmart.com/ip/onn-32-Class-HD-720P-Roku-Smart-LED-TV-100012589/314022535.
+func (c *Client) ParseProductURL(rawURL string) (string, string, error) {
+	matches := ItemURLRegex.FindStringSubmatch(rawURL)
+	if matches == nil {
+		return "", "", errors.New("not a walmart item url, expected https://www.walmart.com/ip/<slug>/<item id>")
+	}
+
+	return matches[1], matches[2], nil
+}
+
+// CanonicalURL returns the URL of an item page.
+func (c *Client) CanonicalURL(slug string, localID string) string {
+	return c.endpoints.ItemDetailsPage(slug, localID)
+}
+
+// itemDetailsToProductInfo converts an ItemDetails to a ProductInfo.
+func itemDetailsToProductInfo(productLocationID string, productID string, store domain.StoreContext, id ItemDetails) domain.ProductInfo {
+	return domain.ProductInfo{
+		ID:                 "",         // will be filled in by database service
+		CreatedAt:          time.Now(), // will be filled in by database service
+		ProductID:          productID,
+		ProductLocationID:  productLocationID,
+		Price:              id.Price,
+		ListPrice:          id.ListPrice,
+		UnitPrice:          id.UnitPrice,
+		UnitOfMeasure:      id.UnitOfMeasure,
+		AvailabilityStatus: id.AvailabilityStatus,
+		InStock:            id.InStock,
+		SellerID:           id.SellerID,
+		SellerName:         id.SellerName,
+		ThirdPartySeller:   id.ThirdPartySeller,
+		Rating:             id.Rating,
+		ReviewCount:        id.ReviewCount,
+		FreeShipping:       id.FreeShipping,
+		InStore:            id.InStore,
+		Online:             id.Online,
+		Preorder:           id.Preorder,
+		ShippingOptions:    id.ShippingOptions,
+		StoreID:            store.StoreID,
+		ZIPCode:            store.ZIPCode,
+		ExtractionStrategy: id.Strategy,
+	}
+}
+
+// itemDetailsToProduct converts an ItemDetails to the details of a Product.
+func itemDetailsToProduct(id ItemDetails) domain.Product {
+	return domain.Product{
+		ID:           "",
+		CommonName:   "",
+		Brand:        id.Brand,
+		Manufacturer: id.Manufacturer,
+		UPC:          id.UPC,
+		ImageURLs:    id.ImageURLs,
+	}
+}
+
+// itemDetailsToProductLocation converts an ItemDetails to a ProductLocation, with the
+// URL of its item page at `endpoints`.
+func itemDetailsToProductLocation(endpoints Endpoints, id ItemDetails) domain.ProductLocation {
+	return domain.ProductLocation{
+		ID:         "",
+		Name:       id.Name,
+		ProductID:  "",
+		LocationID: "",
+		URL:        endpoints.ItemDetailsPage(id.Slug, id.ID),
+		LocalID:    id.ID,
+		Slug:       id.Slug,
+		CategoryID: id.CategoryID,
+		Category:   id.Category,
+		Variant:    id.Variant,
+	}
+}
+
+// itemOfferToOffer converts an ItemOffer to an Offer.
+func itemOfferToOffer(io ItemOffer) domain.Offer {
+	return domain.Offer{
+		ID:                 "", // will be filled in by database service
+		ProductInfoID:      "", // will be filled in by database service
+		SellerID:           io.SellerID,
+		SellerName:         io.SellerName,
+		ThirdPartySeller:   io.ThirdPartySeller,
+		Price:              io.Price,
+		AvailabilityStatus: io.AvailabilityStatus,
+		InStock:            io.InStock,
+		BuyBox:             io.BuyBox,
+	}
+}
@@ -0,0 +1,145 @@
+package walmart
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/antchfx/htmlquery"
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/api"
+	"go.uber.org/zap"
+)
+
+// Search scrapes a single page of search results for a query, starting from page 1.
+func (c *Client) Search(ctx context.Context, query string, page int) (*SearchResults, error) {
+	return c.getResultsPage(ctx, c.endpoints.SearchPage(query, page), page)
+}
+
+// Browse scrapes a single page of a category's listing, starting from page 1. The
+// category ID is the one used in browse URLs, eg. "3944_1060825_447913".
+func (c *Client) Browse(ctx context.Context, categoryID string, page int) (*SearchResults, error) {
+	return c.getResultsPage(ctx, c.endpoints.BrowsePage(categoryID, page), page)
+}
+
+// getResultsPage scrapes the items listed on a search or browse page, which share the
+// same layout.
+func (c *Client) getResultsPage(ctx context.Context, url string, page int) (*SearchResults, error) {
+	resp, err := c.client.Get(api.WithBlockDetector(ctx, IsBlockPage), url)
+	if err != nil {
+		// Return the HTTPError.
+		return nil, err
+	}
+
+	c.log.Debug("fetched results page", zap.String("url", url), zap.Int("status", resp.StatusCode))
+
+	// Read the HTML body, closing it.
+	body, err := api.ReadBody(resp)
+	if err != nil {
+		return nil, api.NewAPIError(resp, "failed to read response body", "io_error", err)
+	}
+
+	if err := api.ClassifyResponse(resp, body); err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &api.APIError{ResponseBody: string(body), Message: "results page returned non-200 status code", Reference: "server_error"}
+	}
+
+	// Parse the HTML with htmlquery.
+	doc, err := htmlquery.Parse(strings.NewReader(string(body)))
+	if err != nil {
+		return nil, api.NewAPIError(resp, "failed to parse html", "html_parse_error", err)
+	}
+
+	// Match the page's `__NEXT_DATA__` JSON with this type.
+	type queryType struct {
+		Props struct {
+			PageProps struct {
+				InitialData struct {
+					SearchResult struct {
+						ItemStacks []struct {
+							Items []struct {
+								Typename     string  `json:"__typename"`
+								USItemID     string  `json:"usItemId"`
+								Name         string  `json:"name"`
+								CanonicalURL string  `json:"canonicalUrl"`
+								Price        float32 `json:"price"`
+								PriceInfo    struct {
+									CurrentPrice struct {
+										Price float32 `json:"price"`
+									} `json:"currentPrice"`
+								} `json:"priceInfo"`
+								AvailabilityStatusV2 struct {
+									Value string `json:"value"`
+								} `json:"availabilityStatusV2"`
+							} `json:"items"`
+						} `json:"itemStacks"`
+						PaginationV2 struct {
+							MaxPage int `json:"maxPage"`
+						} `json:"paginationV2"`
+					} `json:"searchResult"`
+				} `json:"initialData"`
+			} `json:"pageProps"`
+		} `json:"props"`
+	}
+
+	// Find the JSON payload inside the script tag with the ID of __NEXT_DATA__.
+	script, err := htmlquery.Query(doc, "//script[@id=\"__NEXT_DATA__\"]")
+	if err != nil || script == nil {
+		return nil, api.NewAPIError(resp, "failed to find `__NEXT_DATA__` element", "deserialization_error", err)
+	}
+
+	// Decode the JSON value into the struct.
+	query := queryType{}
+	err = json.NewDecoder(strings.NewReader(htmlquery.InnerText(script))).Decode(&query)
+	if err != nil {
+		return nil, api.NewAPIError(resp, "failed to decode results json payload", "deserialization_error", err)
+	}
+
+	result := query.Props.PageProps.InitialData.SearchResult
+
+	items := []ItemDetails{}
+	for _, stack := range result.ItemStacks {
+		for _, item := range stack.Items {
+			// Skip ads and other tiles mixed into the results.
+			if item.Typename != "Product" || item.USItemID == "" {
+				continue
+			}
+
+			matches := ItemURLRegex.FindStringSubmatch(item.CanonicalURL)
+			if matches == nil {
+				c.log.Debug("skipping result with invalid url", zap.String("url", item.CanonicalURL))
+				continue
+			}
+
+			price := item.PriceInfo.CurrentPrice.Price
+			if price == 0 {
+				price = item.Price
+			}
+
+			items = append(items, ItemDetails{
+				ID:                 item.USItemID,
+				Slug:               matches[1],
+				Name:               item.Name,
+				Category:           "",
+				CategoryID:         "",
+				Price:              price,
+				AvailabilityStatus: item.AvailabilityStatusV2.Value,
+				InStock:            item.AvailabilityStatusV2.Value == "IN_STOCK",
+			})
+		}
+	}
+
+	totalPages := result.PaginationV2.MaxPage
+	if totalPages < page {
+		totalPages = page
+	}
+
+	return &SearchResults{
+		Items:      items,
+		Page:       page,
+		TotalPages: totalPages,
+	}, nil
+}
@@ -0,0 +1,75 @@
+package walmart_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bfoody/Walmart-Scraper/domain"
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/api"
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/api/walmart"
+	"go.uber.org/zap"
+)
+
+// newResultsClient returns a Client scraping a server which responds to every request
+// with a fixture from testdata.
+func newResultsClient(t *testing.T, fixture string) *walmart.Client {
+	serverURL := serveFixture(t, fixture)
+
+	return walmart.NewClientWithEndpoints(api.NewHTTPClient(), walmart.NewEndpoints(serverURL, serverURL), zap.NewNop())
+}
+
+// TestSearch tests scraping items and pagination from a search results page, skipping
+// ads and tiles without items.
+func TestSearch(t *testing.T) {
+	c := newResultsClient(t, "search.html")
+	results, err := c.Search(context.Background(), "desk lamp", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if results.Page != 2 || results.TotalPages != 3 {
+		t.Errorf("expected page 2 of 3, got page %d of %d", results.Page, results.TotalPages)
+	}
+
+	if len(results.Items) != 2 {
+		t.Fatalf("expected 2 items, got %+v", results.Items)
+	}
+
+	first := results.Items[0]
+	if first.ID != "107358371" || first.Slug != "Mainstays-LED-Desk-Lamp-with-USB-Port-Black" || first.Price != 14.88 || !first.InStock {
+		t.Errorf("unexpected first item %+v", first)
+	}
+
+	second := results.Items[1]
+	if second.Price != 29.97 || second.AvailabilityStatus != "OUT_OF_STOCK" || second.InStock {
+		t.Errorf("unexpected second item %+v", second)
+	}
+}
+
+// TestDiscover tests discovering ProductLocations by browsing a category, and that
+// pages without results are rejected.
+func TestDiscover(t *testing.T) {
+	c := newResultsClient(t, "search.html")
+	products, totalPages, err := c.Discover(context.Background(), domain.DiscoveryKindBrowse, "3944_1060825", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if totalPages != 3 || len(products) != 2 {
+		t.Fatalf("expected 2 products of 3 pages, got %d pages of %+v", totalPages, products)
+	}
+
+	if products[1].LocalID != "55108346" || products[1].URL != c.CanonicalURL("Better-Homes-Gardens-Swing-Arm-Desk-Lamp-Brass", "55108346") {
+		t.Errorf("unexpected product location %+v", products[1])
+	}
+
+	if _, _, err := c.Discover(context.Background(), "unknown", "lamps", 1); err == nil {
+		t.Error("expected an error for an unknown discovery kind")
+	}
+
+	c = newResultsClient(t, "no-results.html")
+
+	if _, _, err := c.Discover(context.Background(), domain.DiscoveryKindSearch, "lamps", 1); err == nil {
+		t.Error("expected an error for a page without results")
+	}
+}
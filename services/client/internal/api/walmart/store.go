@@ -0,0 +1,30 @@
+package walmart
+
+import (
+	"net/http"
+
+	"github.com/bfoody/Walmart-Scraper/domain"
+)
+
+// storeCookies returns the cookies Walmart's site uses to remember a visitor's chosen
+// store and ZIP code, which set the prices and pickup availability shown on item pages.
+// No cookies are returned for an empty StoreContext.
+func storeCookies(store domain.StoreContext) []*http.Cookie {
+	if store.IsZero() {
+		return nil
+	}
+
+	cookies := []*http.Cookie{
+		{Name: "hasLocData", Value: "1"},
+	}
+
+	if store.StoreID != "" {
+		cookies = append(cookies, &http.Cookie{Name: "assortmentStoreId", Value: store.StoreID})
+	}
+
+	if store.ZIPCode != "" {
+		cookies = append(cookies, &http.Cookie{Name: "location-data", Value: store.ZIPCode})
+	}
+
+	return cookies
+}
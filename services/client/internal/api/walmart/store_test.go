@@ -0,0 +1,42 @@
+package walmart_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bfoody/Walmart-Scraper/domain"
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/api"
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/api/walmart"
+	"go.uber.org/zap"
+)
+
+// TestFetchProductAtStore tests that item pages are requested with the store's
+// location cookies and that the store is recorded on the scraped info.
+func TestFetchProductAtStore(t *testing.T) {
+	cookies := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, cookie := range r.Cookies() {
+			cookies[cookie.Name] = cookie.Value
+		}
+
+		http.ServeFile(w, r, "testdata/item.html")
+	}))
+	t.Cleanup(server.Close)
+
+	c := walmart.NewClientWithEndpoints(api.NewHTTPClient(), walmart.NewEndpoints(server.URL, server.URL), zap.NewNop())
+	store := domain.StoreContext{StoreID: "5435", ZIPCode: "72712"}
+	page, err := c.FetchProduct(context.Background(), &domain.ProductLocation{Slug: "milk", LocalID: "10450114"}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cookies["assortmentStoreId"] != "5435" || cookies["location-data"] != "72712" {
+		t.Errorf("expected store cookies, got %v", cookies)
+	}
+
+	if page.Info.StoreID != "5435" || page.Info.ZIPCode != "72712" {
+		t.Errorf("expected the store to be recorded, got %+v", page.Info)
+	}
+}
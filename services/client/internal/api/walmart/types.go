@@ -11,4 +11,49 @@ type ItemDetails struct {
 	Price              float32 // the current price of the item in USD
 	AvailabilityStatus string  // the availability of the item, eg. "IN_STOCK"
 	InStock            bool    // whether or not the item is in stock (AvailabilityStatus but as a boolean)
+
+	// The following are only scraped by GetItemDetails, which also sets Variant for
+	// variants.
+	Brand            string   // the item's brand
+	Manufacturer     string   // the item's manufacturer
+	UPC              string   // the item's UPC
+	ImageURLs        []string // the URLs of the item's images, primary image first
+	ListPrice        float32  // the price before a rollback or sale in USD, 0 if it isn't discounted
+	UnitPrice        float32  // the price per unit of measure in USD, 0 if not shown
+	UnitOfMeasure    string   // the unit UnitPrice is given in, eg. "oz"
+	SellerID         string   // the ID of the seller of the buy box offer
+	SellerName       string   // the display name of the seller of the buy box offer
+	ThirdPartySeller bool     // whether or not the offer is sold by a marketplace seller instead of Walmart
+	Rating           float32  // the average customer rating, out of 5
+	ReviewCount      int      // the number of customer reviews
+	FreeShipping     bool     // whether or not the item ships for free
+	InStore          bool     // whether or not the item is sold in stores
+	Online           bool     // whether or not the item is sold online
+	Preorder         bool     // whether or not the item is only available for preorder
+	ShippingOptions  []string // the shipping methods offered, eg. "STANDARD"
+
+	Variant  string        // the attributes distinguishing the item from its other variants, eg. "Color: Black, Size: L"
+	Variants []ItemDetails // the item's other variants, with only their IDs, names, prices and availability
+	Offers   []ItemOffer   // every seller's offer for the item, including the buy box
+
+	Strategy string // the strategy the details were extracted with, eg. StrategyItemScript
+}
+
+// An ItemOffer is a single seller's offer for an item.
+type ItemOffer struct {
+	SellerID           string  // the ID of the seller
+	SellerName         string  // the display name of the seller
+	ThirdPartySeller   bool    // whether or not the seller is a marketplace seller instead of Walmart
+	Price              float32 // the offer's price in USD
+	AvailabilityStatus string  // the availability of the offer, eg. "IN_STOCK"
+	InStock            bool    // whether or not the offer is in stock (AvailabilityStatus but as a boolean)
+	BuyBox             bool    // whether or not the offer is the one shown by default
+}
+
+// A SearchResults is returned when calling Search or Browse, contains a single page
+// of the items listed.
+type SearchResults struct {
+	Items      []ItemDetails // the items on the page, without a CategoryID
+	Page       int           // the page number, starting from 1
+	TotalPages int           // the number of pages of results available
 }
@@ -0,0 +1,166 @@
+package fakewalmart
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// FirstItemID is the ID of the first item in every Catalogue, later items counting up
+// from it.
+const FirstItemID = 100000000
+
+// A Category is a category of the synthetic catalogue.
+type Category struct {
+	ID   string // the category path ID, eg. "0:3944:1060825"
+	Path string // the category path, eg. "Electronics/TV & Video/All TVs"
+}
+
+// categories are the categories items are spread across.
+var categories = []Category{
+	{"0:3944:1060825", "Electronics/TV & Video/All TVs"},
+	{"0:3944:1089430", "Electronics/Audio/Headphones"},
+	{"0:976759:976782", "Food/Beverages/Coffee"},
+	{"0:976759:976787", "Food/Snacks, Cookies & Chips/Chips"},
+	{"0:4044:623679", "Home/Kitchen & Dining/Cookware"},
+	{"0:1085666:1228424", "Personal Care/Oral Care/Toothpaste"},
+}
+
+var brands = []string{"onn.", "Great Value", "Mainstays", "Equate", "Hyper Tough", "Better Homes & Gardens"}
+
+var adjectives = []string{"Classic", "Deluxe", "Compact", "Ultra", "Everyday", "Premium", "Family Size", "Portable"}
+
+var nouns = map[string][]string{
+	"0:3944:1060825":    {"32\" HD Smart TV", "43\" 4K Smart TV", "55\" 4K Roku TV"},
+	"0:3944:1089430":    {"Wireless Earbuds", "Over-Ear Headphones", "Bluetooth Speaker"},
+	"0:976759:976782":   {"Ground Coffee", "Whole Bean Coffee", "Coffee Pods"},
+	"0:976759:976787":   {"Potato Chips", "Tortilla Chips", "Pretzels"},
+	"0:4044:623679":     {"Nonstick Skillet", "Stock Pot", "Cookware Set"},
+	"0:1085666:1228424": {"Whitening Toothpaste", "Sensitive Toothpaste", "Kids Toothpaste"},
+}
+
+// An Item is an item in the synthetic catalogue, with the price and availability it
+// has before any simulated changes.
+type Item struct {
+	ID        string
+	Slug      string
+	Name      string
+	Brand     string
+	UPC       string
+	Category  Category
+	BasePrice float32
+	Rating    float32
+	Reviews   int
+}
+
+// A Catalogue is a deterministic synthetic catalogue of items, the same for every
+// size and seed.
+type Catalogue struct {
+	items []Item
+	index map[string]int // item IDs to their index in items
+}
+
+// NewCatalogue generates and returns a *Catalogue of `size` items from `seed`.
+func NewCatalogue(size int, seed int64) *Catalogue {
+	rng := rand.New(rand.NewSource(seed))
+
+	c := &Catalogue{
+		items: make([]Item, 0, size),
+		index: map[string]int{},
+	}
+
+	for i := 0; i < size; i++ {
+		category := categories[rng.Intn(len(categories))]
+		brand := brands[rng.Intn(len(brands))]
+		names := nouns[category.ID]
+		name := fmt.Sprintf("%s %s %s", brand, adjectives[rng.Intn(len(adjectives))], names[rng.Intn(len(names))])
+		id := strconv.Itoa(FirstItemID + i)
+
+		c.index[id] = i
+		c.items = append(c.items, Item{
+			ID:        id,
+			Slug:      slugify(name),
+			Name:      name,
+			Brand:     brand,
+			UPC:       fmt.Sprintf("%012d", rng.Int63n(1e12)),
+			Category:  category,
+			BasePrice: float32(rng.Intn(20000)+199) / 100,
+			Rating:    float32(rng.Intn(41)+10) / 10,
+			Reviews:   rng.Intn(5000),
+		})
+	}
+
+	return c
+}
+
+// Len returns the number of items in the catalogue.
+func (c *Catalogue) Len() int {
+	return len(c.items)
+}
+
+// Item returns the item at index `i`, wrapping around the catalogue.
+func (c *Catalogue) Item(i int) Item {
+	return c.items[i%len(c.items)]
+}
+
+// Get returns the item with an ID, or false if there is none.
+func (c *Catalogue) Get(id string) (Item, bool) {
+	i, ok := c.index[id]
+	if !ok {
+		return Item{}, false
+	}
+
+	return c.items[i], true
+}
+
+// Related returns up to `n` other items in the same category as an item.
+func (c *Catalogue) Related(item Item, n int) []Item {
+	related := []Item{}
+
+	start := c.index[item.ID]
+	for i := 1; i < len(c.items) && len(related) < n; i++ {
+		other := c.Item(start + i)
+		if other.Category.ID == item.Category.ID {
+			related = append(related, other)
+		}
+	}
+
+	return related
+}
+
+// Search returns every item whose name contains a query, ignoring case.
+func (c *Catalogue) Search(query string) []Item {
+	query = strings.ToLower(query)
+
+	items := []Item{}
+	for _, item := range c.items {
+		if strings.Contains(strings.ToLower(item.Name), query) {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// InCategory returns every item in a category.
+func (c *Catalogue) InCategory(categoryID string) []Item {
+	items := []Item{}
+	for _, item := range c.items {
+		if item.Category.ID == categoryID {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// slugify converts an item name into the slug used in its URL, eg.
+// "onn. 32\" HD Smart TV" into "onn-32-HD-Smart-TV".
+func slugify(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	})
+
+	return strings.Join(words, "-")
+}
@@ -0,0 +1,387 @@
+package fakewalmart
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/api/walmart"
+	"go.uber.org/zap"
+)
+
+// Config is the config of a fake Walmart server, loaded by `fakewalmart`.
+type Config struct {
+	Addr          string        `env:"SCR_FAKEWALMART_ADDR" yaml:"addr" flag:"addr" default:":8090" validate:"nonempty" usage:"the address to serve the fake Walmart site on"`
+	Items         int           `env:"SCR_FAKEWALMART_ITEMS" yaml:"items" flag:"items" default:"1000" validate:"min=1" usage:"the number of items in the synthetic catalogue"`
+	Seed          int64         `env:"SCR_FAKEWALMART_SEED" yaml:"seed" flag:"seed" default:"1" usage:"the seed the catalogue is generated from"`
+	PageSize      int           `env:"SCR_FAKEWALMART_PAGE_SIZE" yaml:"page_size" flag:"page-size" default:"40" validate:"min=1" usage:"the number of items on each search or browse page"`
+	PriceDrift    float64       `env:"SCR_FAKEWALMART_PRICE_DRIFT" yaml:"price_drift" flag:"price-drift" default:"0.1" validate:"min=0,max=1" usage:"the most an item's price drifts from its base price, as a fraction of it"`
+	PriceInterval time.Duration `env:"SCR_FAKEWALMART_PRICE_INTERVAL" yaml:"price_interval" flag:"price-interval" default:"10m" validate:"min=1s" usage:"how often prices and availability change"`
+	StockOutRate  float64       `env:"SCR_FAKEWALMART_STOCK_OUT_RATE" yaml:"stock_out_rate" flag:"stock-out-rate" default:"0.05" validate:"min=0,max=1" usage:"the fraction of items out of stock in each price interval"`
+	Latency       time.Duration `env:"SCR_FAKEWALMART_LATENCY" yaml:"latency" flag:"latency" default:"0s" usage:"the delay before responding to each request"`
+	Jitter        time.Duration `env:"SCR_FAKEWALMART_JITTER" yaml:"jitter" flag:"jitter" default:"0s" usage:"the most added to the latency at random"`
+	RateLimitRate float64       `env:"SCR_FAKEWALMART_RATE_LIMIT_RATE" yaml:"rate_limit_rate" flag:"rate-limit-rate" default:"0" validate:"min=0,max=1" usage:"the fraction of requests answered with 429 Too Many Requests"`
+	CaptchaRate   float64       `env:"SCR_FAKEWALMART_CAPTCHA_RATE" yaml:"captcha_rate" flag:"captcha-rate" default:"0" validate:"min=0,max=1" usage:"the fraction of requests redirected to a CAPTCHA page"`
+}
+
+// A Server is an http.Handler which imitates the parts of the Walmart site and its
+// quimby recommendation service scraped by the walmart package, serving a synthetic
+// Catalogue. Prices and availability change every price interval, and requests can be
+// delayed, rate limited or blocked at random, so that clients can be load tested and
+// developed without touching the real site.
+type Server struct {
+	catalogue *Catalogue
+	config    Config
+	mux       *http.ServeMux
+	rng       *rand.Rand
+	rngMutex  *sync.Mutex
+	now       func() time.Time
+	log       *zap.Logger
+}
+
+// NewServer creates and returns a new *Server serving a catalogue.
+func NewServer(catalogue *Catalogue, config Config, logger *zap.Logger) *Server {
+	s := &Server{
+		catalogue: catalogue,
+		config:    config,
+		mux:       http.NewServeMux(),
+		rng:       rand.New(rand.NewSource(config.Seed)),
+		rngMutex:  &sync.Mutex{},
+		now:       time.Now,
+		log:       logger,
+	}
+
+	s.mux.HandleFunc("/ip/", s.handleItemPage)
+	s.mux.HandleFunc("/tempo", s.handleRecommendations)
+	s.mux.HandleFunc("/search", s.handleSearch)
+	s.mux.HandleFunc("/browse/", s.handleBrowse)
+	s.mux.HandleFunc("/blocked", s.handleBlocked)
+
+	return s
+}
+
+// ServeHTTP simulates latency, rate limiting and blocking, then serves the request.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if delay := s.delay(); delay > 0 {
+		time.Sleep(delay)
+	}
+
+	// The CAPTCHA page itself is never rate limited or blocked.
+	if r.URL.Path != "/blocked" {
+		if s.chance(s.config.RateLimitRate) {
+			s.log.Debug("rate limiting request", zap.String("url", r.URL.String()))
+
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+
+		if s.chance(s.config.CaptchaRate) {
+			s.log.Debug("blocking request", zap.String("url", r.URL.String()))
+
+			target := base64.StdEncoding.EncodeToString([]byte(r.URL.RequestURI()))
+			http.Redirect(w, r, "/blocked?url="+target+"&g=b", http.StatusTemporaryRedirect)
+			return
+		}
+	}
+
+	s.mux.ServeHTTP(w, r)
+}
+
+// delay returns how long to wait before responding to a request.
+func (s *Server) delay() time.Duration {
+	if s.config.Jitter <= 0 {
+		return s.config.Latency
+	}
+
+	s.rngMutex.Lock()
+	defer s.rngMutex.Unlock()
+
+	return s.config.Latency + time.Duration(s.rng.Int63n(int64(s.config.Jitter)))
+}
+
+// chance returns true with a probability of `rate`.
+func (s *Server) chance(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+
+	s.rngMutex.Lock()
+	defer s.rngMutex.Unlock()
+
+	return s.rng.Float64() < rate
+}
+
+// An itemState is an item's price and availability during one price interval.
+type itemState struct {
+	Price              float32
+	AvailabilityStatus string
+}
+
+// state returns an item's current price and availability, which only change between
+// price intervals and are the same for every Server with the same config.
+func (s *Server) state(item Item) itemState {
+	interval := s.now().UnixNano() / int64(s.config.PriceInterval)
+
+	drift := (s.random(item.ID, interval, "price")*2 - 1) * s.config.PriceDrift
+	price := float32(int(float64(item.BasePrice)*(1+drift)*100+0.5)) / 100
+
+	status := "IN_STOCK"
+	if s.random(item.ID, interval, "stock") < s.config.StockOutRate {
+		status = "OUT_OF_STOCK"
+	}
+
+	return itemState{price, status}
+}
+
+// random returns a number in [0, 1) determined by the seed, an item, a price interval
+// and a salt.
+func (s *Server) random(itemID string, interval int64, salt string) float64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d/%s/%d/%s", s.config.Seed, itemID, interval, salt)
+
+	return float64(h.Sum64()>>11) / (1 << 53)
+}
+
+// handleItemPage serves an item page in the legacy layout, with the item's details in
+// the `item` JSON script.
+func (s *Server) handleItemPage(w http.ResponseWriter, r *http.Request) {
+	// Paths are /ip/<slug>/<id>, the slug being ignored like on the real site.
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	item, ok := s.catalogue.Get(parts[len(parts)-1])
+	if len(parts) != 3 || !ok {
+		s.writeHTML(w, http.StatusNotFound, "Page not found", "<h1>This page could not be found.</h1>")
+		return
+	}
+
+	state := s.state(item)
+
+	type priceMap struct {
+		Price float32 `json:"price"`
+	}
+
+	type product struct {
+		USItemID           string   `json:"usItemId"`
+		ProductName        string   `json:"productName"`
+		CanonicalURL       string   `json:"canonicalUrl"`
+		AvailabilityStatus string   `json:"availabilityStatus"`
+		SellerID           string   `json:"sellerId"`
+		SellerDisplayName  string   `json:"sellerDisplayName"`
+		UPC                string   `json:"upc"`
+		PriceMap           priceMap `json:"priceMap"`
+	}
+
+	type review struct {
+		AverageOverallRating float32 `json:"averageOverallRating"`
+		TotalReviewCount     int     `json:"totalReviewCount"`
+	}
+
+	payload := map[string]interface{}{
+		"item": map[string]interface{}{
+			"product": map[string]interface{}{
+				"midasContext": map[string]interface{}{
+					"brand":            item.Brand,
+					"categoryPathId":   item.Category.ID,
+					"categoryPathName": item.Category.Path,
+					"itemId":           item.ID,
+					"manufacturer":     item.Brand,
+					"online":           true,
+					"price":            state.Price,
+					"query":            item.Name,
+				},
+				"buyBox": map[string]interface{}{
+					"products": []product{{
+						USItemID:           item.ID,
+						ProductName:        item.Name,
+						CanonicalURL:       itemURL(item),
+						AvailabilityStatus: state.AvailabilityStatus,
+						SellerID:           walmart.WalmartSellerID,
+						SellerDisplayName:  "Walmart.com",
+						UPC:                item.UPC,
+						PriceMap:           priceMap{state.Price},
+					}},
+				},
+				"reviews": map[string]review{
+					item.ID: {item.Rating, item.Reviews},
+				},
+			},
+			"query": item.Name,
+		},
+	}
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	body := fmt.Sprintf("<h1>%s</h1>\n<script id=\"item\" type=\"application/json\">%s</script>", html.EscapeString(item.Name), b)
+	s.writeHTML(w, http.StatusOK, item.Name, body)
+}
+
+// handleRecommendations serves quimby's recommendations for the item in the `item`
+// query parameter, which are the other items in its category.
+func (s *Server) handleRecommendations(w http.ResponseWriter, r *http.Request) {
+	item, ok := s.catalogue.Get(r.URL.Query().Get("item"))
+	if !ok {
+		s.writeJSON(w, map[string]interface{}{"StatusCode": 404, "Modules": []interface{}{}})
+		return
+	}
+
+	type product struct {
+		ID struct {
+			ProductID string `json:"productId"`
+		}
+		Price struct {
+			CurrentPrice float32
+		}
+		ProductName        string
+		ProductURL         string `json:"productUrl"`
+		Category           string
+		AvailabilityStatus string
+	}
+
+	products := []product{}
+	for _, related := range s.catalogue.Related(item, 12) {
+		state := s.state(related)
+
+		p := product{
+			ProductName:        related.Name,
+			ProductURL:         itemURL(related),
+			Category:           related.Category.Path,
+			AvailabilityStatus: state.AvailabilityStatus,
+		}
+		p.ID.ProductID = related.ID
+		p.Price.CurrentPrice = state.Price
+
+		products = append(products, p)
+	}
+
+	s.writeJSON(w, map[string]interface{}{
+		"StatusCode": 200,
+		"Modules": []interface{}{
+			map[string]interface{}{
+				"Name": "SimilarItems",
+				"Configs": map[string]interface{}{
+					"ad": map[string]interface{}{
+						"Title":    "Similar items you might like",
+						"Products": products,
+					},
+				},
+			},
+		},
+	})
+}
+
+// handleSearch serves a page of items matching the `q` query parameter.
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	s.writeResults(w, r, s.catalogue.Search(r.URL.Query().Get("q")))
+}
+
+// handleBrowse serves a page of a category's items.
+func (s *Server) handleBrowse(w http.ResponseWriter, r *http.Request) {
+	s.writeResults(w, r, s.catalogue.InCategory(strings.TrimPrefix(r.URL.Path, "/browse/")))
+}
+
+// writeResults writes the page in the `page` query parameter of search or browse
+// results, with the results in the `__NEXT_DATA__` JSON script.
+func (s *Server) writeResults(w http.ResponseWriter, r *http.Request, items []Item) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	maxPage := (len(items) + s.config.PageSize - 1) / s.config.PageSize
+	if maxPage < 1 {
+		maxPage = 1
+	}
+
+	type result struct {
+		Typename             string  `json:"__typename"`
+		USItemID             string  `json:"usItemId"`
+		Name                 string  `json:"name"`
+		CanonicalURL         string  `json:"canonicalUrl"`
+		Price                float32 `json:"price"`
+		AvailabilityStatusV2 struct {
+			Value string `json:"value"`
+		} `json:"availabilityStatusV2"`
+	}
+
+	results := []result{}
+	for i := (page - 1) * s.config.PageSize; i < len(items) && i < page*s.config.PageSize; i++ {
+		state := s.state(items[i])
+
+		res := result{
+			Typename:     "Product",
+			USItemID:     items[i].ID,
+			Name:         items[i].Name,
+			CanonicalURL: itemURL(items[i]),
+			Price:        state.Price,
+		}
+		res.AvailabilityStatusV2.Value = state.AvailabilityStatus
+
+		results = append(results, res)
+	}
+
+	payload := map[string]interface{}{
+		"props": map[string]interface{}{
+			"pageProps": map[string]interface{}{
+				"initialData": map[string]interface{}{
+					"searchResult": map[string]interface{}{
+						"itemStacks":   []interface{}{map[string]interface{}{"items": results}},
+						"paginationV2": map[string]interface{}{"maxPage": maxPage},
+					},
+				},
+			},
+		},
+	}
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.writeHTML(w, http.StatusOK, "Search results", fmt.Sprintf("<script id=\"__NEXT_DATA__\" type=\"application/json\">%s</script>", b))
+}
+
+// handleBlocked serves the CAPTCHA page blocked requests are redirected to.
+func (s *Server) handleBlocked(w http.ResponseWriter, r *http.Request) {
+	body := `<div class="re-captcha">
+  <h1>Robot or human?</h1>
+  <p>Activate and hold the button to confirm that you&#8217;re human. Thank You!</p>
+  <div id="px-captcha"></div>
+</div>`
+
+	s.writeHTML(w, http.StatusOK, "Robot or human?", body)
+}
+
+// writeHTML writes an HTML page with a title and body.
+func (s *Server) writeHTML(w http.ResponseWriter, status int, title string, body string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n</head>\n<body>\n%s\n</body>\n</html>\n", html.EscapeString(title), body)
+}
+
+// writeJSON writes a JSON response.
+func (s *Server) writeJSON(w http.ResponseWriter, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(payload); err != nil {
+		s.log.Error("unable to write response", zap.Error(err))
+	}
+}
+
+// itemURL returns the path of an item's page.
+func itemURL(item Item) string {
+	return fmt.Sprintf("/ip/%s/%s", item.Slug, item.ID)
+}
@@ -0,0 +1,115 @@
+package fakewalmart
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/api"
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/api/walmart"
+	"go.uber.org/zap"
+)
+
+// newTestServer starts a fake Walmart server with a small catalogue and returns it
+// with a walmart.Client scraping it.
+func newTestServer(t *testing.T, config Config) (*Server, *walmart.Client) {
+	config.Items = 50
+	config.Seed = 1
+	config.PageSize = 10
+	config.PriceInterval = time.Minute
+
+	s := NewServer(NewCatalogue(config.Items, config.Seed), config, zap.NewNop())
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+
+	return s, walmart.NewClientWithEndpoints(api.NewHTTPClient(), walmart.NewEndpoints(server.URL, server.URL), zap.NewNop())
+}
+
+// TestScrapeFakeWalmart tests that the walmart package can scrape items,
+// recommendations and search results from the fake server.
+func TestScrapeFakeWalmart(t *testing.T) {
+	s, c := newTestServer(t, Config{PriceDrift: 0.1})
+	item := s.catalogue.Item(0)
+
+	details, err := c.GetItemDetails(context.Background(), item.Slug, item.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if details.Name != item.Name || details.Category != item.Category.Path || details.Strategy != walmart.StrategyItemScript {
+		t.Errorf("expected %+v, got %+v", item, details)
+	}
+
+	if details.Price < item.BasePrice*0.89 || details.Price > item.BasePrice*1.11 {
+		t.Errorf("expected price near %.2f, got %.2f", item.BasePrice, details.Price)
+	}
+
+	related, err := c.GetItemRelatedItems(context.Background(), item.ID, item.Category.ID, item.Category.Path, item.Name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(related) == 0 {
+		t.Error("expected recommendations")
+	}
+
+	results, err := c.Browse(context.Background(), item.Category.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results.Items) == 0 || len(results.Items) > 10 {
+		t.Errorf("expected a page of up to 10 results, got %d", len(results.Items))
+	}
+}
+
+// TestPriceChanges tests that prices and availability only change between price
+// intervals.
+func TestPriceChanges(t *testing.T) {
+	s, _ := newTestServer(t, Config{PriceDrift: 0.5, StockOutRate: 0.5})
+
+	start := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return start }
+
+	before := []itemState{}
+	for i := 0; i < s.catalogue.Len(); i++ {
+		before = append(before, s.state(s.catalogue.Item(i)))
+	}
+
+	s.now = func() time.Time { return start.Add(30 * time.Second) }
+	for i, state := range before {
+		if s.state(s.catalogue.Item(i)) != state {
+			t.Fatalf("expected item %d to be unchanged within an interval", i)
+		}
+	}
+
+	s.now = func() time.Time { return start.Add(time.Minute) }
+	changed := 0
+	for i, state := range before {
+		if s.state(s.catalogue.Item(i)) != state {
+			changed++
+		}
+	}
+
+	if changed == 0 {
+		t.Error("expected items to change in the next interval")
+	}
+}
+
+// TestFailures tests that requests are rate limited and blocked at their configured
+// rates.
+func TestFailures(t *testing.T) {
+	_, c := newTestServer(t, Config{RateLimitRate: 1})
+	if _, err := c.GetItemDetails(context.Background(), "item", "100000000"); err == nil {
+		t.Error("expected rate limited request to fail")
+	}
+
+	s, _ := newTestServer(t, Config{CaptchaRate: 1})
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ip/item/100000000", nil))
+	if rec.Code != http.StatusTemporaryRedirect {
+		t.Errorf("expected redirect to the CAPTCHA page, got %d", rec.Code)
+	}
+}
@@ -1,13 +1,118 @@
 package http
 
 import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net"
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/andybalholm/brotli"
 )
 
 // NewClient creates and returns a new HTTP client.
 func NewClient() *http.Client {
 	return &http.Client{
-		Timeout: 10 * time.Second,
+		Timeout:   10 * time.Second,
+		Transport: NewDecodingTransport(NewTransport()),
+	}
+}
+
+// NewTransport creates and returns a new HTTP transport with connection timeouts and
+// idle connection pool sizes suited to scraping a few hosts, with HTTP/2 enabled.
+func NewTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+	}
+}
+
+// A DecodingTransport decodes gzip, deflate and brotli response bodies. Go's transport
+// only decodes gzip, and only when it asked for it itself, while requests disguised
+// as browsers ask for all three.
+type DecodingTransport struct {
+	base http.RoundTripper
+}
+
+// NewDecodingTransport creates and returns a *DecodingTransport sending requests with
+// `base`.
+func NewDecodingTransport(base http.RoundTripper) *DecodingTransport {
+	return &DecodingTransport{base: base}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *DecodingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
 	}
+
+	var decoded io.Reader
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "gzip":
+		decoded, err = gzip.NewReader(resp.Body)
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	case "deflate":
+		decoded, err = newDeflateReader(resp.Body)
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	case "br":
+		decoded = brotli.NewReader(resp.Body)
+	default:
+		return resp, nil
+	}
+
+	resp.Body = &decodedBody{Reader: decoded, body: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+
+	return resp, nil
+}
+
+// newDeflateReader returns a reader decoding a deflate body, which is zlib-wrapped as
+// the HTTP spec says, or raw deflate as sent by some servers.
+func newDeflateReader(body io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(body)
+
+	// A zlib header names the deflate method in its low bits and is a multiple of 31.
+	header, err := br.Peek(2)
+	if err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+
+	return flate.NewReader(br), nil
+}
+
+// A decodedBody reads a decoded response body, closing the original body.
+type decodedBody struct {
+	io.Reader
+	body io.ReadCloser
+}
+
+// Close implements io.Closer.
+func (b *decodedBody) Close() error {
+	return b.body.Close()
 }
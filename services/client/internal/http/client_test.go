@@ -0,0 +1,55 @@
+package http
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestDecodingTransportDeflate tests that deflate bodies are decoded whether they are
+// zlib-wrapped, as the HTTP spec says, or raw.
+func TestDecodingTransportDeflate(t *testing.T) {
+	const page = "<html><body>Great Value Whole Vitamin D Milk</body></html>"
+
+	tests := []struct {
+		name     string
+		compress func(w io.Writer) io.WriteCloser
+	}{
+		{"zlib", func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }},
+		{"raw", func(w io.Writer) io.WriteCloser {
+			fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+			return fw
+		}},
+	}
+
+	for _, test := range tests {
+		var body bytes.Buffer
+		w := test.compress(&body)
+		w.Write([]byte(page))
+		w.Close()
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", "deflate")
+			w.Write(body.Bytes())
+		}))
+
+		c := &http.Client{Transport: NewDecodingTransport(http.DefaultTransport)}
+		resp, err := c.Get(server.URL)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		decoded, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		server.Close()
+
+		if err != nil || string(decoded) != page {
+			t.Errorf("%s: expected the page, got %q (%v)", test.name, decoded, err)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "client"
+
+const (
+	// KindInfo labels metrics for product info scrapes.
+	KindInfo = "info"
+	// KindCrawl labels metrics for recommendation crawls.
+	KindCrawl = "crawl"
+	// KindDiscovery labels metrics for search and category page discoveries.
+	KindDiscovery = "discovery"
+
+	// OutcomeSuccess labels a scrape that succeeded.
+	OutcomeSuccess = "success"
+	// OutcomeFailure labels a scrape that failed after all retries.
+	OutcomeFailure = "failure"
+)
+
+var (
+	// ScrapeDuration observes the total time taken by a scrape, including retries.
+	ScrapeDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "scrape_duration_seconds",
+		Help:      "Total time taken by a scrape, including retries.",
+		Buckets:   []float64{0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"kind", "outcome"})
+
+	// ScrapeRetries counts failed scrape attempts that were retried.
+	ScrapeRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "scrape_retries_total",
+		Help:      "Number of failed scrape attempts that were retried.",
+	}, []string{"kind"})
+
+	// HTTPResponses counts HTTP responses by host and status code. Requests that fail
+	// without a response are counted with the code "error".
+	HTTPResponses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_responses_total",
+		Help:      "Number of HTTP responses by host and status code.",
+	}, []string{"host", "code"})
+
+	// ParseErrors counts API errors by their reference, eg. "deserialization_error".
+	ParseErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "parse_errors_total",
+		Help:      "Number of API errors by reference.",
+	}, []string{"reference"})
+
+	// ResponseErrors counts responses which weren't the page requested by their
+	// classification, eg. "blocked" or "rate_limited".
+	ResponseErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "response_errors_total",
+		Help:      "Number of responses which weren't the page requested by classification.",
+	}, []string{"reference"})
+
+	// ItemExtractions counts item pages parsed by each extraction strategy, eg.
+	// "item_script".
+	ItemExtractions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "item_extractions_total",
+		Help:      "Number of item pages parsed by each extraction strategy.",
+	}, []string{"strategy"})
+
+	// PrimaryExtractorMisses counts item pages the primary extraction strategy failed
+	// to parse, which usually means the retailer changed its page layout.
+	PrimaryExtractorMisses = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "primary_extractor_misses_total",
+		Help:      "Number of item pages the primary extraction strategy failed to parse.",
+	})
+
+	// RateLimiterWait observes the time spent waiting on the rate limiter.
+	RateLimiterWait = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rate_limiter_wait_seconds",
+		Help:      "Time spent waiting on the rate limiter before a scrape.",
+		Buckets:   []float64{0.001, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 5},
+	})
+
+	// ProxyRequests counts requests sent through each proxy by outcome, eg. "blocked".
+	ProxyRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "proxy_requests_total",
+		Help:      "Number of requests sent through each proxy by outcome.",
+	}, []string{"proxy", "outcome"})
+
+	// ProxyLatency observes the latency of successful requests through each proxy.
+	ProxyLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "proxy_latency_seconds",
+		Help:      "Latency of successful requests sent through each proxy.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"proxy"})
+
+	// ProxyScore is the health score of each proxy, from 0 to 1.
+	ProxyScore = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "proxy_score",
+		Help:      "Health score of each proxy, from 0 to 1.",
+	}, []string{"proxy"})
+
+	// ProxyState is the state of each proxy: 0 if healthy, 1 if cooling down and 2 if
+	// quarantined.
+	ProxyState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "proxy_state",
+		Help:      "State of each proxy: 0 if healthy, 1 if cooling down and 2 if quarantined.",
+	}, []string{"proxy"})
+
+	// SpoolEntries is the number of messages waiting in the spool to be sent to the hub.
+	SpoolEntries = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "spool_entries",
+		Help:      "Number of messages waiting in the spool to be sent to the hub.",
+	})
+
+	// SpoolDropped counts spooled messages dropped before they could be sent, by
+	// reason: "expired" or "full".
+	SpoolDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "spool_dropped_total",
+		Help:      "Number of spooled messages dropped before they could be sent, by reason.",
+	}, []string{"reason"})
+
+	// CircuitState is the state of each host's circuit: 0 if closed, 1 if open and 2 if
+	// half open.
+	CircuitState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "circuit_state",
+		Help:      "State of each host's circuit: 0 if closed, 1 if open and 2 if half open.",
+	}, []string{"host"})
+)
@@ -1,11 +1,24 @@
 package receiver
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/bfoody/Walmart-Scraper/communication"
+	"github.com/bfoody/Walmart-Scraper/domain"
 	"github.com/bfoody/Walmart-Scraper/identity"
+	"github.com/bfoody/Walmart-Scraper/logging"
+	"github.com/bfoody/Walmart-Scraper/services/client"
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/api"
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/api/walmart"
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/spool"
+	"github.com/bfoody/Walmart-Scraper/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -14,38 +27,103 @@ const (
 	ReasonShuttingDown = "SHUTTING_DOWN"
 )
 
+// spoolReplayInterval is how often spooled results are retried while the hub or
+// broker is unreachable.
+const spoolReplayInterval = 30 * time.Second
+
 // A Receiver processes and responds to messages from the hub server.
 type Receiver struct {
 	identity                 *identity.Server
 	heartbeats               chan communication.Heartbeat
 	newHubIdentities         chan identity.Server
 	hub                      *identity.Server // the hub that the client is currently connected to
+	lastHeartbeat            time.Time        // when the hub last sent a heartbeat, guarded by hubMutex
+	shuttingDown             bool             // whether the client has started shutting down, guarded by hubMutex
+	hubTimeout               time.Duration    // how long without a heartbeat before the hub is considered unreachable
+	hubMutex                 *sync.RWMutex
 	conn                     *communication.QueueConnection
 	taskService              *TaskService
 	hubWelcomes              chan communication.HubWelcome
 	taskFulfillmentRequests  chan communication.TaskFulfillmentRequest
 	crawlFulfillmentRequests chan communication.CrawlFulfillmentRequest
+	discoveryRequests        chan communication.DiscoveryFulfillmentRequest
 	shutdown                 chan int
 	shutdownWg               *sync.WaitGroup
+	ctx                      context.Context    // the parent of every task's context, cancelled on shutdown
+	cancel                   context.CancelFunc // cancels ctx, aborting tasks in progress
+	slots                    chan struct{}      // limits the number of tasks and crawls running at once
+	spool                    *spool.Spool       // results waiting to be sent to the hub, or nil if they are dropped
 	log                      *zap.Logger
 }
 
-// New creates and returns a new *Receiver.
-func New(_identity *identity.Server, logger *zap.Logger, conn *communication.QueueConnection) *Receiver {
-	return &Receiver{
+// New creates and returns a new *Receiver, configured using the supplied client
+// config.
+func New(_identity *identity.Server, loggers *logging.Loggers, conn *communication.QueueConnection, config *client.Config) (*Receiver, error) {
+	logger := loggers.Component("receiver")
+
+	proxyOptions := api.DefaultProxyPoolOptions()
+	proxyOptions.CooldownAfter = config.ProxyCooldownAfter
+	proxyOptions.Cooldown = config.ProxyCooldown
+	proxyOptions.QuarantineAfter = config.ProxyQuarantineAfter
+	proxyOptions.Quarantine = config.ProxyQuarantine
+	proxyOptions.SessionTTL = config.ProxySessionTTL
+
+	taskService, err := NewTaskService(logger, loggers.Component("walmart"), config.RateLimit, config.Proxies, proxyOptions, circuitBreakerOptions(config), walmart.NewEndpoints(config.WalmartBaseURL, config.WalmartQuimbyURL))
+	if err != nil {
+		return nil, err
+	}
+
+	var resultSpool *spool.Spool
+	if config.SpoolPath != "" {
+		resultSpool, err = spool.Open(config.SpoolPath, spool.Options{
+			MaxEntries: config.SpoolMaxEntries,
+			MaxBytes:   int64(config.SpoolMaxMB) << 20,
+			MaxAge:     config.SpoolMaxAge,
+		}, loggers.Component("spool"))
+		if err != nil {
+			return nil, fmt.Errorf("error opening spool: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r := &Receiver{
 		identity:                 _identity,
 		heartbeats:               make(chan communication.Heartbeat),
 		newHubIdentities:         make(chan identity.Server, 4),
 		hub:                      nil,
+		hubMutex:                 &sync.RWMutex{},
+		hubTimeout:               config.HubTimeout,
 		conn:                     conn,
-		taskService:              NewTaskService(logger),
+		taskService:              taskService,
 		hubWelcomes:              make(chan communication.HubWelcome, 4),
 		taskFulfillmentRequests:  make(chan communication.TaskFulfillmentRequest, 4),
 		crawlFulfillmentRequests: make(chan communication.CrawlFulfillmentRequest, 4),
+		discoveryRequests:        make(chan communication.DiscoveryFulfillmentRequest, 4),
 		shutdown:                 make(chan int),
 		shutdownWg:               &sync.WaitGroup{},
+		ctx:                      ctx,
+		cancel:                   cancel,
+		slots:                    make(chan struct{}, config.Concurrency),
+		spool:                    resultSpool,
 		log:                      logger,
 	}
+
+	// Tell hubs which retailers' hosts are degraded, so that they pause dispatching.
+	taskService.OnCircuitChange(func(circuit api.Circuit) {
+		r.sendStatusUpdate()
+	})
+
+	return r, nil
+}
+
+// circuitBreakerOptions returns the circuit breaker options in a client config.
+func circuitBreakerOptions(config *client.Config) api.CircuitBreakerOptions {
+	return api.CircuitBreakerOptions{
+		FailureThreshold: config.BreakerThreshold,
+		OpenFor:          config.BreakerOpenFor,
+		Probes:           config.BreakerProbes,
+	}
 }
 
 // Start starts the Receiver and enters the main loop in a Goroutine.
@@ -54,12 +132,84 @@ func (r *Receiver) Start() error {
 	r.conn.RegisterHeartbeatHandler(r.pipeHeartbeat)
 	r.conn.RegisterTaskFulfillmentRequest(r.pipeTaskFulfillmentRequest)
 	r.conn.RegisterCrawlFulfillmentRequestHandler(r.pipeCrawlFulfillmentRequest)
+	r.conn.RegisterDiscoveryFulfillmentRequestHandler(r.pipeDiscoveryFulfillmentRequest)
 
 	go r.loop()
 	return nil
 }
 
+// ApplyConfig applies the reloadable settings of a reloaded client config, without
+// interrupting tasks in progress.
+func (r *Receiver) ApplyConfig(config *client.Config) {
+	r.taskService.SetRateLimit(config.RateLimit)
+	r.taskService.SetCircuitBreakerOptions(circuitBreakerOptions(config))
+	if err := r.taskService.SetProxies(config.Proxies); err != nil {
+		r.log.Error("couldn't apply new proxies, keeping current proxies", zap.Error(err))
+		return
+	}
+
+	r.log.Info("applied new settings", zap.Int("rateLimit", config.RateLimit), zap.Int("proxies", len(config.Proxies)))
+}
+
+// ProxyStats returns a snapshot of the health of every proxy.
+func (r *Receiver) ProxyStats() []api.ProxyStats {
+	return r.taskService.ProxyStats()
+}
+
+// Circuits returns a snapshot of every host's circuit which isn't closed.
+func (r *Receiver) Circuits() []api.Circuit {
+	return r.taskService.Circuits()
+}
+
+// sendStatusUpdate tells the current hub that the client is available for work, along
+// with the circuits it has open. Nothing is sent before the client is welcomed by a
+// hub or once it has started shutting down.
+func (r *Receiver) sendStatusUpdate() {
+	// The lock is held while sending so that the update can't race with shutting down.
+	r.hubMutex.RLock()
+	defer r.hubMutex.RUnlock()
+
+	if r.hub == nil || r.shuttingDown {
+		return
+	}
+
+	circuits := []communication.Circuit{}
+	for _, circuit := range r.taskService.Circuits() {
+		circuits = append(circuits, communication.Circuit{
+			Host:       circuit.Host,
+			Retailer:   circuit.Retailer,
+			State:      circuit.State,
+			RetryAfter: circuit.RetryAfter,
+		})
+	}
+
+	err := r.conn.SendMessage(communication.StatusUpdate{
+		FanoutPacket:     communication.FanoutPacket{SenderID: r.identity.ID},
+		ReceiverID:       r.hub.ID,
+		AvailableForWork: true,
+		OpenCircuits:     circuits,
+	})
+	if err != nil {
+		r.log.Error("couldn't send StatusUpdate", zap.Error(err))
+	}
+}
+
+// CheckHub returns an error if the Receiver has not been welcomed by a hub yet, for
+// use as a health check.
+func (r *Receiver) CheckHub(ctx context.Context) error {
+	if r.hubID() == "" {
+		return errors.New("not attached to a hub")
+	}
+
+	return nil
+}
+
+// Shutdown notifies the hub that the Receiver is going away and stops the main loop.
 func (r *Receiver) Shutdown() error {
+	r.hubMutex.Lock()
+	r.shuttingDown = true
+	r.hubMutex.Unlock()
+
 	r.shutdownWg.Add(1)
 	r.shutdown <- 1
 
@@ -87,9 +237,23 @@ func (r *Receiver) pipeCrawlFulfillmentRequest(cfr *communication.CrawlFulfillme
 	r.crawlFulfillmentRequests <- *cfr
 }
 
+// pipeDiscoveryFulfillmentRequest pipes a DiscoveryFulfillmentRequest into the receiver.
+func (r *Receiver) pipeDiscoveryFulfillmentRequest(dfr *communication.DiscoveryFulfillmentRequest) {
+	r.discoveryRequests <- *dfr
+}
+
 func (r *Receiver) loop() {
+	replayTicker := time.NewTicker(spoolReplayInterval)
+	defer replayTicker.Stop()
+	hubTicker := time.NewTicker(r.hubTimeout / 4)
+	defer hubTicker.Stop()
+
 	for {
 		select {
+		case <-replayTicker.C:
+			go r.replaySpool()
+		case <-hubTicker.C:
+			r.expireHub()
 		case hw := <-r.hubWelcomes:
 			r.handleHubWelcome(&hw)
 		case hub := <-r.newHubIdentities:
@@ -100,6 +264,8 @@ func (r *Receiver) loop() {
 			r.handleTaskFulfillmentRequest(&tfr)
 		case cfr := <-r.crawlFulfillmentRequests:
 			r.handleCrawlFulfillmentRequest(&cfr)
+		case dfr := <-r.discoveryRequests:
+			r.handleDiscoveryFulfillmentRequest(&dfr)
 		case <-r.shutdown:
 			r.cleanup()
 			return
@@ -117,6 +283,19 @@ func (r *Receiver) handleHeartbeat(hb *communication.Heartbeat) {
 		return
 	}
 
+	r.hubMutex.Lock()
+	hub := r.hub
+	if hub != nil && hub.ID == hb.SenderID {
+		r.lastHeartbeat = time.Now()
+	}
+	r.hubMutex.Unlock()
+
+	// A hub heartbeating the client still has it registered, so it takes over if the
+	// previous hub was lost.
+	if hub == nil {
+		r.switchHub(identity.NewHub(hb.SenderID))
+	}
+
 	message := communication.Heartbeat{
 		SingleReceiverPacket: communication.SingleReceiverPacket{
 			SenderID:   r.identity.ID,
@@ -138,8 +317,12 @@ func (r *Receiver) handleTaskFulfillmentRequest(tfr *communication.TaskFulfillme
 		return
 	}
 
-	// TODO: possibly implement a thread pool for this?
-	go r.runTask(tfr)
+	go func() {
+		r.acquireSlot()
+		defer r.releaseSlot()
+
+		r.runTask(tfr)
+	}()
 }
 
 func (r *Receiver) handleCrawlFulfillmentRequest(cfr *communication.CrawlFulfillmentRequest) {
@@ -148,12 +331,48 @@ func (r *Receiver) handleCrawlFulfillmentRequest(cfr *communication.CrawlFulfill
 		return
 	}
 
-	// TODO: possibly implement a thread pool for this?
-	go r.runCrawl(cfr)
+	go func() {
+		r.acquireSlot()
+		defer r.releaseSlot()
+
+		r.runCrawl(cfr)
+	}()
+}
+
+func (r *Receiver) handleDiscoveryFulfillmentRequest(dfr *communication.DiscoveryFulfillmentRequest) {
+	// TODO: check receiver ID in a better way
+	if dfr.ReceiverID != r.identity.ID {
+		return
+	}
+
+	go func() {
+		r.acquireSlot()
+		defer r.releaseSlot()
+
+		r.runDiscovery(dfr)
+	}()
+}
+
+// acquireSlot blocks until fewer than the configured number of tasks are running.
+func (r *Receiver) acquireSlot() {
+	r.slots <- struct{}{}
+}
+
+// releaseSlot frees a slot taken by acquireSlot.
+func (r *Receiver) releaseSlot() {
+	<-r.slots
 }
 
 func (r *Receiver) runTask(tfr *communication.TaskFulfillmentRequest) {
-	pi, err := r.taskService.FetchProductInfo(&tfr.ProductLocation)
+	ctx, span := tracer.Start(tracing.Extract(r.ctx, tfr.TraceContext), "Receiver.runTask", trace.WithAttributes(
+		attribute.String("task.id", tfr.TaskID),
+		attribute.String("hub.id", tfr.SenderID),
+	))
+	var err error
+	defer func() { tracing.End(span, err) }()
+
+	location := locationOrDefault(tfr.Location)
+	page, err := r.taskService.FetchProductInfo(ctx, &tfr.ProductLocation, location, tfr.Store)
 	if err != nil {
 		r.log.Error(
 			"couldn't fetch product info, rescheduling to next interval",
@@ -161,31 +380,75 @@ func (r *Receiver) runTask(tfr *communication.TaskFulfillmentRequest) {
 			zap.Error(err),
 		)
 
+		r.sendTaskFailed(tfr, location, err)
 		return
 	}
 
+	hubID := r.hubID()
 	ir := communication.InfoRetrieved{
 		SingleReceiverPacket: communication.SingleReceiverPacket{
-			SenderID:   r.identity.ID,
-			ReceiverID: r.hub.ID,
+			SenderID:     r.identity.ID,
+			ReceiverID:   hubID,
+			TraceContext: tracing.Inject(ctx),
 		},
 		TaskID:      tfr.TaskID,
-		ProductInfo: *pi,
+		ProductInfo: page.Info,
+		Product:     page.Product,
+		Offers:      page.Offers,
+		Variants:    page.Variants,
+		Retailer:    location.Retailer,
 	}
 
-	err = r.conn.SendMessage(ir)
+	err = r.sendResult(hubID, "info:"+tfr.TaskID, "infoRetrieved", ir)
 	if err != nil {
 		r.log.Error(
 			"couldn't send InfoRetrieved message to hub",
 			zap.String("productLocationId", tfr.ProductLocation.ID),
-			zap.String("hubId", r.hub.ID),
+			zap.String("hubId", hubID),
+			zap.Error(err),
+		)
+	}
+}
+
+// sendTaskFailed tells the hub that a task failed and why, so that it can slow down
+// if the retailer is blocking or rate limiting clients.
+func (r *Receiver) sendTaskFailed(tfr *communication.TaskFulfillmentRequest, location domain.Location, err error) {
+	hubID := r.hubID()
+	tf := communication.TaskFailed{
+		SingleReceiverPacket: communication.SingleReceiverPacket{
+			SenderID:   r.identity.ID,
+			ReceiverID: hubID,
+		},
+		TaskID:            tfr.TaskID,
+		ProductLocationID: tfr.ProductLocation.ID,
+		Retailer:          location.Retailer,
+		Reason:            "error",
+	}
+
+	var responseErr *api.ResponseError
+	var circuitErr *api.CircuitOpenError
+	if errors.As(err, &responseErr) {
+		tf.Reason = responseErr.Reference
+		tf.RetryAfter = responseErr.RetryAfter
+	} else if errors.As(err, &circuitErr) {
+		tf.Reason = "circuit_open"
+		tf.RetryAfter = circuitErr.RetryAfter
+	} else if errors.Is(err, api.ErrUnsupportedStore) {
+		tf.Reason = "unsupported_store"
+	}
+
+	if err := r.conn.SendMessage(tf); err != nil {
+		r.log.Error(
+			"couldn't send TaskFailed message to hub",
+			zap.String("productLocationId", tfr.ProductLocation.ID),
+			zap.String("hubId", hubID),
 			zap.Error(err),
 		)
 	}
 }
 
 func (r *Receiver) runCrawl(cfr *communication.CrawlFulfillmentRequest) {
-	id, err := r.taskService.FetchProductRecommendations(&cfr.ProductLocation)
+	id, err := r.taskService.FetchProductRecommendations(r.ctx, &cfr.ProductLocation, locationOrDefault(cfr.Location))
 	if err != nil {
 		r.log.Error(
 			"couldn't fetch product recommendations, rescheduling to next interval",
@@ -196,47 +459,219 @@ func (r *Receiver) runCrawl(cfr *communication.CrawlFulfillmentRequest) {
 		return
 	}
 
+	hubID := r.hubID()
 	ir := communication.CrawlRetrieved{
 		SingleReceiverPacket: communication.SingleReceiverPacket{
 			SenderID:   r.identity.ID,
-			ReceiverID: r.hub.ID,
+			ReceiverID: hubID,
 		},
 		ProductLocationID: cfr.ProductLocation.ID,
 		Recommendations:   id,
 	}
 
-	err = r.conn.SendMessage(ir)
+	err = r.sendResult(hubID, "crawl:"+cfr.ProductLocation.ID, "crawlRetrieved", ir)
 	if err != nil {
 		r.log.Error(
 			"couldn't send CrawlRetrieved message to hub",
 			zap.String("productLocationId", cfr.ProductLocation.ID),
-			zap.String("hubId", r.hub.ID),
+			zap.String("hubId", hubID),
+			zap.Error(err),
+		)
+	}
+}
+
+func (r *Receiver) runDiscovery(dfr *communication.DiscoveryFulfillmentRequest) {
+	products, err := r.taskService.DiscoverProducts(r.ctx, dfr.Kind, dfr.Query, dfr.MaxPages, locationOrDefault(dfr.Location))
+	if err != nil {
+		r.log.Error(
+			"couldn't discover products, rescheduling to next interval",
+			zap.String("discoveryTaskId", dfr.DiscoveryTaskID),
+			zap.Error(err),
+		)
+
+		return
+	}
+
+	hubID := r.hubID()
+	dr := communication.DiscoveryRetrieved{
+		SingleReceiverPacket: communication.SingleReceiverPacket{
+			SenderID:   r.identity.ID,
+			ReceiverID: hubID,
+		},
+		DiscoveryTaskID: dfr.DiscoveryTaskID,
+		Products:        products,
+	}
+
+	err = r.conn.SendMessage(dr)
+	if err != nil {
+		r.log.Error(
+			"couldn't send DiscoveryRetrieved message to hub",
+			zap.String("discoveryTaskId", dfr.DiscoveryTaskID),
+			zap.String("hubId", hubID),
 			zap.Error(err),
 		)
 	}
 }
 
+// locationOrDefault returns the location sent by the hub, or the Walmart location if the
+// hub predates locations being sent with requests.
+func locationOrDefault(location domain.Location) domain.Location {
+	if location.Retailer == "" {
+		location.Retailer = domain.RetailerWalmart
+	}
+
+	return location
+}
+
 // switchHub switches the client to communicate with the specified hub identity.
 func (r *Receiver) switchHub(hub *identity.Server) {
 	r.log.Info(fmt.Sprintf("switching hub to hub %s", hub.ID))
+
+	r.hubMutex.Lock()
 	r.hub = hub
+	r.lastHeartbeat = time.Now()
+	r.hubMutex.Unlock()
+
+	// Send any results spooled while there was no hub to send them to.
+	go r.replaySpool()
 }
 
-// cleanup prepares the Receiver for shutdown and notifies
+// expireHub forgets the current hub once it has gone longer than the hub timeout
+// without a heartbeat, so that results are spooled rather than published to nobody,
+// then asks the other hubs to welcome the client.
+func (r *Receiver) expireHub() {
+	r.hubMutex.Lock()
+	if r.hub == nil || r.shuttingDown || time.Since(r.lastHeartbeat) < r.hubTimeout {
+		r.hubMutex.Unlock()
+		return
+	}
+
+	hubID := r.hub.ID
+	r.hub = nil
+	r.hubMutex.Unlock()
+
+	r.log.Warn("hub stopped sending heartbeats, spooling results until a hub takes over", zap.String("hubId", hubID), zap.Duration("timeout", r.hubTimeout))
+
+	err := r.conn.SendMessage(communication.StatusUpdate{
+		FanoutPacket:     communication.FanoutPacket{SenderID: r.identity.ID},
+		AvailableForWork: true,
+	})
+	if err != nil {
+		r.log.Error("couldn't send StatusUpdate", zap.Error(err))
+	}
+}
+
+// hubID returns the ID of the hub the client is currently connected to, or "" if it
+// hasn't been welcomed by one.
+func (r *Receiver) hubID() string {
+	r.hubMutex.RLock()
+	defer r.hubMutex.RUnlock()
+
+	if r.hub == nil {
+		return ""
+	}
+
+	return r.hub.ID
+}
+
+// sendResult sends a scrape's result to the hub with ID `hubID`. If there is no hub, it
+// can't be sent, or earlier results are still spooled, it is spooled under `key` to be
+// replayed in order later. An error is only returned if the result is dropped.
+func (r *Receiver) sendResult(hubID string, key string, typeName string, message interface{}) error {
+	if r.spool == nil {
+		return r.conn.SendMessage(message)
+	}
+
+	// Publishing succeeds even when no hub is listening, so results are spooled
+	// whenever the client has no live hub.
+	var err error
+	if hubID == "" {
+		err = r.spool.Add(key, typeName, message)
+	} else {
+		err = r.spool.Send(key, typeName, message, func() error {
+			return r.conn.SendMessage(message)
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("error spooling result: %w", err)
+	}
+
+	return nil
+}
+
+// replaySpool sends the spooled results to the current hub, in order, until one
+// can't be sent.
+func (r *Receiver) replaySpool() {
+	if r.spool == nil {
+		return
+	}
+
+	hubID := r.hubID()
+	if hubID == "" {
+		return
+	}
+
+	sent, err := r.spool.Replay(func(entry *spool.Entry) error {
+		return r.sendSpooled(entry, hubID)
+	})
+	if sent > 0 {
+		r.log.Info("sent spooled results to hub", zap.Int("sent", sent), zap.Int("remaining", r.spool.Len()), zap.String("hubId", hubID))
+	}
+	if err != nil {
+		r.log.Debug("couldn't send spooled results to hub", zap.Int("remaining", r.spool.Len()), zap.Error(err))
+	}
+}
+
+// sendSpooled sends a spooled result to a hub, which may not be the hub it was
+// scraped for. Results which can't be decoded are dropped.
+func (r *Receiver) sendSpooled(entry *spool.Entry, hubID string) error {
+	var err error
+	switch entry.Type {
+	case "infoRetrieved":
+		ir := communication.InfoRetrieved{}
+		if err = json.Unmarshal(entry.Message, &ir); err == nil {
+			ir.ReceiverID = hubID
+			return r.conn.SendMessage(ir)
+		}
+	case "crawlRetrieved":
+		cr := communication.CrawlRetrieved{}
+		if err = json.Unmarshal(entry.Message, &cr); err == nil {
+			cr.ReceiverID = hubID
+			return r.conn.SendMessage(cr)
+		}
+	default:
+		err = fmt.Errorf("unknown message type %q", entry.Type)
+	}
+
+	r.log.Error("dropping spooled result that can't be decoded", zap.String("key", entry.Key), zap.Error(err))
+
+	return nil
+}
+
+// cleanup prepares the Receiver for shutdown, aborting tasks in progress, and notifies
 // the hub that the client is going away.
 func (r *Receiver) cleanup() {
 	defer r.shutdownWg.Done()
 
+	r.cancel()
+
+	if r.spool != nil {
+		if err := r.spool.Close(); err != nil {
+			r.log.Error("error closing spool", zap.Error(err))
+		}
+	}
+
+	hubID := r.hubID()
 	err := r.conn.SendMessage(communication.GoingAway{
 		SingleReceiverPacket: communication.SingleReceiverPacket{
 			SenderID:   r.identity.ID,
-			ReceiverID: r.hub.ID,
+			ReceiverID: hubID,
 		},
 		Reason: ReasonShuttingDown,
 	})
 	if err != nil {
 		r.log.Error(
-			fmt.Sprintf("error sending GoingAway to hub %s", r.hub.ID),
+			fmt.Sprintf("error sending GoingAway to hub %s", hubID),
 			zap.Error(err),
 		)
 	}
@@ -1,12 +1,21 @@
 package receiver
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"reflect"
+	"sync"
 	"time"
 
 	"github.com/bfoody/Walmart-Scraper/domain"
 	"github.com/bfoody/Walmart-Scraper/services/client/internal/api"
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/api/jsonld"
 	"github.com/bfoody/Walmart-Scraper/services/client/internal/api/walmart"
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/metrics"
+	"github.com/bfoody/Walmart-Scraper/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/ratelimit"
 	"go.uber.org/zap"
 )
@@ -14,92 +23,492 @@ import (
 // MaxTries defines the maximum number of attempts to fetch info.
 const MaxTries = 50
 
+// MaxThrottledTries defines the maximum number of attempts the retailer may block or
+// rate limit before giving up, so that the hub can slow down instead.
+const MaxThrottledTries = 5
+
+const (
+	// retryDelay is the time between attempts after most errors.
+	retryDelay = 1 * time.Second
+	// blockedDelay is the time between attempts after being blocked without any
+	// proxies to rotate to.
+	blockedDelay = 30 * time.Second
+	// rateLimitedDelay is the time between attempts after being rate limited, if the
+	// retailer doesn't say how long to wait.
+	rateLimitedDelay = 10 * time.Second
+	// maxRateLimitedDelay is the most time waited between attempts after being rate
+	// limited.
+	maxRateLimitedDelay = 1 * time.Minute
+)
+
+var tracer = tracing.Tracer("github.com/bfoody/Walmart-Scraper/services/client/internal/receiver")
+
 // A TaskService provides methods for executing tasks.
 type TaskService struct {
-	client *walmart.Client
-	log    *zap.Logger
-	rl     ratelimit.Limiter
+	pool          *api.ProxyPool               // the proxies requests are sent through, if any
+	registries    map[*api.Proxy]*api.Registry // a registry of retailer adapters for each proxy in the pool
+	direct        *api.Registry                // the registry used when there are no proxies
+	breaker       *api.CircuitBreaker          // fails requests to degraded hosts, shared by every adapter
+	log           *zap.Logger
+	clientLogger  *zap.Logger
+	rl            ratelimit.Limiter
+	rateLimit     int
+	proxies       []string
+	endpoints     walmart.Endpoints // the endpoints scraped by Walmart adapters
+	settingsMutex *sync.RWMutex     // guards the registries and rate limiter, which can be replaced at runtime
+}
+
+// NewTaskService creates and returns a *TaskService with retailer adapters for each of
+// the supplied proxies, or a single set of direct adapters if there are none, which
+// log to `clientLogger`. Proxies are rested according to `proxyOptions`, circuits are
+// opened according to `breakerOptions`, requests are limited to `rateLimit` per
+// second, and Walmart adapters scrape `endpoints`.
+func NewTaskService(logger *zap.Logger, clientLogger *zap.Logger, rateLimit int, proxies []string, proxyOptions api.ProxyPoolOptions, breakerOptions api.CircuitBreakerOptions, endpoints walmart.Endpoints) (*TaskService, error) {
+	pool, err := api.NewProxyPool(nil, proxyOptions, logger.Named("proxies"))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &TaskService{
+		pool:          pool,
+		registries:    map[*api.Proxy]*api.Registry{},
+		breaker:       api.NewCircuitBreaker(breakerOptions, logger.Named("breaker")),
+		log:           logger,
+		clientLogger:  clientLogger,
+		endpoints:     endpoints,
+		settingsMutex: &sync.RWMutex{},
+	}
+	s.direct = s.newRegistry(api.NewHTTPClient())
+
+	if err := s.SetProxies(proxies); err != nil {
+		return nil, err
+	}
+	s.SetRateLimit(rateLimit)
+
+	return s, nil
 }
 
-// NewTaskService creates and returns a *TaskService with the provided Walmart client.
-func NewTaskService(logger *zap.Logger) *TaskService {
-	http := api.NewHTTPClient()
-	client := walmart.NewClient(http)
+// SetRateLimit replaces the ratelimiter with one allowing `rateLimit` operations per
+// second. Operations already waiting on the old ratelimiter are unaffected.
+func (s *TaskService) SetRateLimit(rateLimit int) {
+	s.settingsMutex.Lock()
+	defer s.settingsMutex.Unlock()
 
-	return &TaskService{
-		client: client,
-		log:    logger,
-		rl:     ratelimit.New(10),
+	if s.rl != nil && rateLimit == s.rateLimit {
+		return
 	}
+
+	s.rl = ratelimit.New(rateLimit)
+	s.rateLimit = rateLimit
 }
 
-// FetchProductInfo fetches the info for a single product from the API and returns it as a *ProductInfo.
-func (s *TaskService) FetchProductInfo(productLocation *domain.ProductLocation) (*domain.ProductInfo, error) {
-	// Wait until ratelimiter allows new operations.
-	s.rl.Take()
+// SetProxies replaces the proxies in the pool, keeping the adapters and health of
+// proxies which are still listed. Requests are sent directly if there are none, and
+// requests already in progress finish using their old adapter.
+func (s *TaskService) SetProxies(proxies []string) error {
+	s.settingsMutex.Lock()
+	defer s.settingsMutex.Unlock()
+
+	if s.proxies != nil && reflect.DeepEqual(proxies, s.proxies) {
+		return nil
+	}
+
+	if err := s.pool.SetProxies(proxies); err != nil {
+		return err
+	}
+
+	registries := map[*api.Proxy]*api.Registry{}
+	for _, proxy := range s.pool.Proxies() {
+		registry, ok := s.registries[proxy]
+		if !ok {
+			registry = s.newRegistry(proxy.HTTP)
+		}
+
+		registries[proxy] = registry
+	}
+
+	s.registries = registries
+	s.proxies = proxies
+
+	return nil
+}
+
+// ProxyStats returns a snapshot of the health of every proxy.
+func (s *TaskService) ProxyStats() []api.ProxyStats {
+	return s.pool.Stats()
+}
+
+// Circuits returns a snapshot of every host's circuit which isn't closed.
+func (s *TaskService) Circuits() []api.Circuit {
+	return s.breaker.Circuits()
+}
+
+// OnCircuitChange registers a function called whenever a host's circuit opens or
+// closes.
+func (s *TaskService) OnCircuitChange(onChange func(circuit api.Circuit)) {
+	s.breaker.OnChange(onChange)
+}
+
+// SetCircuitBreakerOptions replaces the options circuits are opened and closed with.
+func (s *TaskService) SetCircuitBreakerOptions(options api.CircuitBreakerOptions) {
+	s.breaker.SetOptions(options)
+}
+
+// newRegistry creates a registry of every retailer adapter, sending requests with the
+// supplied HTTPClient.
+func (s *TaskService) newRegistry(http *api.HTTPClient) *api.Registry {
+	http.SetCircuitBreaker(s.breaker)
+
+	registry := api.NewRegistry(http)
+	registry.Register(domain.RetailerWalmart, walmart.NewRetailerFactory(s.endpoints, s.clientLogger))
+	registry.Register(domain.RetailerJSONLD, jsonld.NewRetailerFactory(s.clientLogger))
+
+	return registry
+}
+
+// retailer returns the adapter to use for a session's next request to a location,
+// sending it through the proxy chosen by the pool. Sessions, eg. the scrape of a
+// single product, stick to one proxy while it stays healthy.
+func (s *TaskService) retailer(location domain.Location, session string) (api.Retailer, error) {
+	s.settingsMutex.RLock()
+	defer s.settingsMutex.RUnlock()
+
+	proxy, err := s.pool.Select(session)
+	if err != nil {
+		return nil, err
+	}
+
+	if proxy == nil {
+		return s.direct.ForLocation(location)
+	}
+
+	return s.registries[proxy].ForLocation(location)
+}
+
+// waitForRateLimit blocks until the ratelimiter allows new operations, recording
+// the time spent waiting.
+func (s *TaskService) waitForRateLimit() {
+	s.settingsMutex.RLock()
+	rl := s.rl
+	s.settingsMutex.RUnlock()
+
+	start := time.Now()
+	rl.Take()
+	metrics.RateLimiterWait.Observe(time.Since(start).Seconds())
+}
+
+// A retryPolicy decides whether and when to retry a failed scrape attempt from the
+// classification of its error.
+type retryPolicy struct {
+	proxies   bool // whether blocked attempts can be retried through another proxy
+	throttled int  // the number of attempts blocked or rate limited so far
+}
+
+// next returns how long to wait before the next attempt after an error, or false if
+// it shouldn't be retried. Missing pages, unsupported stores, pages no extraction
+// strategy matches and hosts with open circuits are never retried. Blocked attempts
+// are retried straight away through another proxy, or after blockedDelay without
+// proxies, rate limited attempts wait as long as the retailer asked, and attempts stop
+// after MaxThrottledTries blocks or rate limits.
+func (p *retryPolicy) next(err error) (time.Duration, bool) {
+	// Fail fast while a host is degraded, rather than making it worse. The hub requeues
+	// the task for when the circuit probes the host again.
+	if errors.Is(err, api.ErrCircuitOpen) {
+		return 0, false
+	}
+
+	if errors.Is(err, api.ErrUnsupportedStore) || errors.Is(err, api.ErrExtractionFailed) {
+		return 0, false
+	}
+
+	var responseErr *api.ResponseError
+	if !errors.As(err, &responseErr) {
+		return retryDelay, true
+	}
+
+	switch responseErr.Class {
+	case api.ErrNotFound:
+		return 0, false
+	case api.ErrBlocked:
+		p.throttled++
+		if p.proxies {
+			return 0, p.throttled < MaxThrottledTries
+		}
+
+		return blockedDelay, p.throttled < MaxThrottledTries
+	case api.ErrRateLimited:
+		p.throttled++
+
+		delay := responseErr.RetryAfter
+		if delay == 0 {
+			delay = rateLimitedDelay
+		} else if delay > maxRateLimitedDelay {
+			delay = maxRateLimitedDelay
+		}
+
+		return delay, p.throttled < MaxThrottledTries
+	default:
+		return retryDelay, true
+	}
+}
+
+// sleep waits for `d`, returning early with the context's error if it is cancelled.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
-	var id *walmart.ItemDetails
+// newRetryPolicy returns the retryPolicy for a scrape.
+func (s *TaskService) newRetryPolicy() *retryPolicy {
+	return &retryPolicy{proxies: s.pool.Len() > 1}
+}
+
+// recordAttemptError records a failed scrape attempt to metrics.
+func recordAttemptError(kind string, err error) {
+	var apiErr *api.APIError
+	if errors.As(err, &apiErr) {
+		metrics.ParseErrors.WithLabelValues(apiErr.Reference).Inc()
+	}
+
+	var responseErr *api.ResponseError
+	if errors.As(err, &responseErr) {
+		metrics.ResponseErrors.WithLabelValues(responseErr.Reference).Inc()
+	}
+}
+
+// recordScrape records the duration and outcome of a scrape to metrics.
+func recordScrape(kind string, start time.Time, err error) {
+	outcome := metrics.OutcomeSuccess
+	if err != nil {
+		outcome = metrics.OutcomeFailure
+	}
+
+	metrics.ScrapeDuration.WithLabelValues(kind, outcome).Observe(time.Since(start).Seconds())
+}
+
+// FetchProductInfo fetches the info and details of a single product with the adapter
+// for its location and returns them as a *ProductPage.
+func (s *TaskService) FetchProductInfo(ctx context.Context, productLocation *domain.ProductLocation, location domain.Location, store domain.StoreContext) (*api.ProductPage, error) {
+	ctx, span := tracer.Start(ctx, "TaskService.FetchProductInfo", trace.WithAttributes(
+		attribute.String("productLocation.id", productLocation.ID),
+		attribute.String("location.retailer", location.Retailer),
+		attribute.String("store.id", store.StoreID),
+		attribute.String("store.zipCode", store.ZIPCode),
+	))
+
+	var page *api.ProductPage
 	var err error
+	defer func() { tracing.End(span, err) }()
+
+	// Wait until ratelimiter allows new operations.
+	_, waitSpan := tracer.Start(ctx, "TaskService.waitForRateLimit")
+	s.waitForRateLimit()
+	waitSpan.End()
+
+	start := time.Now()
+	policy := s.newRetryPolicy()
 
 	for i := 0; i < MaxTries; i++ {
-		id, err = s.client.GetItemDetails(productLocation.Slug, productLocation.LocalID)
+		var retailer api.Retailer
+		retailer, err = s.retailer(location, "info:"+productLocation.ID)
+		if err != nil {
+			// Retrying won't help without an adapter or a proxy.
+			break
+		}
+
+		attemptCtx, attemptSpan := tracer.Start(ctx, "Retailer.FetchProduct", trace.WithAttributes(
+			attribute.Int("attempt", i+1),
+		))
+		page, err = retailer.FetchProduct(api.WithStore(api.WithRetailer(attemptCtx, location.Retailer), store), productLocation, store)
+		tracing.End(attemptSpan, err)
 		if err != nil {
+			recordAttemptError(metrics.KindInfo, err)
+
+			delay, retry := policy.next(err)
+			if !retry || i == MaxTries-1 {
+				s.log.Error("error fetching product info, giving up", zap.Int("attempt", i+1), zap.String("productLocationID", productLocation.ID), zap.Error(err))
+				break
+			}
+			metrics.ScrapeRetries.WithLabelValues(metrics.KindInfo).Inc()
+
 			s.log.Error(
-				"error fetching product info, retrying in 1 second",
+				"error fetching product info, retrying",
 				zap.Int("attempt", i+1),
+				zap.Duration("in", delay),
 				zap.String("productLocationID", productLocation.ID),
 				zap.Error(err),
 			)
-			time.Sleep(1 * time.Second)
+			if err = sleep(ctx, delay); err != nil {
+				break
+			}
 			continue
 		}
 
 		break
 	}
 
+	recordScrape(metrics.KindInfo, start, err)
+
 	if err != nil {
 		return nil, err
 	}
 
-	pi := itemDetailsToProductInfo(productLocation.ID, productLocation.ProductID, *id)
-
-	return &pi, nil
+	return page, nil
 }
 
-// FetchProductRecommendations fetches the recommendations for a single product from the API and returns it as a []ProductLocation.
-func (s *TaskService) FetchProductRecommendations(productLocation *domain.ProductLocation) ([]domain.ProductLocation, error) {
+// FetchProductRecommendations fetches the recommendations for a single product with the
+// adapter for its location and returns them as a []ProductLocation.
+func (s *TaskService) FetchProductRecommendations(ctx context.Context, productLocation *domain.ProductLocation, location domain.Location) ([]domain.ProductLocation, error) {
 	// Wait until ratelimiter allows new operations.
-	s.rl.Take()
+	s.waitForRateLimit()
 
-	var id []walmart.ItemDetails
+	start := time.Now()
+
+	var pl []domain.ProductLocation
 	var err error
+	policy := s.newRetryPolicy()
 
 	for i := 0; i < MaxTries; i++ {
-		id, err = s.client.GetItemRelatedItems(productLocation.LocalID, productLocation.CategoryID, productLocation.Category, productLocation.Name)
+		var retailer api.Retailer
+		retailer, err = s.retailer(location, "crawl:"+productLocation.ID)
+		if err != nil {
+			// Retrying won't help without an adapter or a proxy.
+			break
+		}
+
+		pl, err = retailer.FetchRelated(api.WithRetailer(ctx, location.Retailer), productLocation)
 		if err != nil {
+			recordAttemptError(metrics.KindCrawl, err)
+
+			delay, retry := policy.next(err)
+			if !retry || i == MaxTries-1 {
+				s.log.Error("error fetching product recs, giving up", zap.Int("attempt", i+1), zap.String("productLocationID", productLocation.ID), zap.Error(err))
+				break
+			}
+			metrics.ScrapeRetries.WithLabelValues(metrics.KindCrawl).Inc()
+
 			s.log.Error(
-				"error fetching product recs, retrying in 1 second",
+				"error fetching product recs, retrying",
 				zap.Int("attempt", i+1),
+				zap.Duration("in", delay),
 				zap.String("productLocationID", productLocation.ID),
 				zap.Error(err),
 			)
-			time.Sleep(1 * time.Second)
+			if err = sleep(ctx, delay); err != nil {
+				break
+			}
 			continue
 		}
 
 		break
 	}
 
+	recordScrape(metrics.KindCrawl, start, err)
+
 	if err != nil {
 		return nil, err
 	}
 
+	s.log.Debug("fetched product recommendations", zap.String("productLocationID", productLocation.ID), zap.Int("count", len(pl)))
+
+	return pl, nil
+}
+
+// DiscoverProducts scrapes up to `maxPages` pages of the products found by a search or
+// on a category page of a location, returning them as a []ProductLocation without
+// duplicates. An error is returned if the location's retailer doesn't support discovery.
+func (s *TaskService) DiscoverProducts(ctx context.Context, kind string, query string, maxPages int, location domain.Location) ([]domain.ProductLocation, error) {
+	start := time.Now()
+
 	pl := []domain.ProductLocation{}
-	for _, i := range id {
-		pl = append(pl, itemDetailsToProductLocation(i))
+	seen := map[string]bool{}
+
+	var err error
+	for page, totalPages := 1, 1; page <= totalPages && page <= maxPages; page++ {
+		// Wait until ratelimiter allows new operations.
+		s.waitForRateLimit()
+
+		var products []domain.ProductLocation
+		products, totalPages, err = s.discoverPage(ctx, kind, query, page, location)
+		if err != nil {
+			break
+		}
+
+		for _, product := range products {
+			if seen[product.LocalID] {
+				continue
+			}
+
+			seen[product.LocalID] = true
+			pl = append(pl, product)
+		}
+	}
+
+	recordScrape(metrics.KindDiscovery, start, err)
+
+	if err != nil {
+		return nil, err
 	}
 
-	fmt.Println(pl)
+	s.log.Debug("discovered products", zap.String("kind", kind), zap.String("query", query), zap.Int("count", len(pl)))
 
 	return pl, nil
 }
+
+// discoverPage scrapes a single page of a discovery, retrying on failure.
+func (s *TaskService) discoverPage(ctx context.Context, kind string, query string, page int, location domain.Location) ([]domain.ProductLocation, int, error) {
+	var pl []domain.ProductLocation
+	var totalPages int
+	var err error
+	policy := s.newRetryPolicy()
+
+	for i := 0; i < MaxTries; i++ {
+		var retailer api.Retailer
+		retailer, err = s.retailer(location, fmt.Sprintf("discovery:%s:%s", kind, query))
+		if err != nil {
+			// Retrying won't help without an adapter or a proxy.
+			return nil, 0, err
+		}
+
+		discoverer, ok := retailer.(api.Discoverer)
+		if !ok {
+			return nil, 0, fmt.Errorf("retailer %q doesn't support discovery", location.Retailer)
+		}
+
+		pl, totalPages, err = discoverer.Discover(api.WithRetailer(ctx, location.Retailer), kind, query, page)
+		if err != nil {
+			recordAttemptError(metrics.KindDiscovery, err)
+
+			delay, retry := policy.next(err)
+			if !retry || i == MaxTries-1 {
+				s.log.Error("error discovering products, giving up", zap.Int("attempt", i+1), zap.String("query", query), zap.Int("page", page), zap.Error(err))
+				break
+			}
+			metrics.ScrapeRetries.WithLabelValues(metrics.KindDiscovery).Inc()
+
+			s.log.Error(
+				"error discovering products, retrying",
+				zap.Int("attempt", i+1),
+				zap.Duration("in", delay),
+				zap.String("query", query),
+				zap.Int("page", page),
+				zap.Error(err),
+			)
+			if err = sleep(ctx, delay); err != nil {
+				break
+			}
+			continue
+		}
+
+		break
+	}
+
+	return pl, totalPages, err
+}
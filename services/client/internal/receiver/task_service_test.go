@@ -0,0 +1,37 @@
+package receiver
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/api"
+)
+
+// TestRetryPolicyGivesUp tests that errors retrying can't fix stop the scrape after
+// the first attempt, while other errors are retried.
+func TestRetryPolicyGivesUp(t *testing.T) {
+	extractionErr := &api.APIError{
+		Message:      "failed to extract item from page",
+		Reference:    "deserialization_error",
+		WrappedError: fmt.Errorf("%w (item_script: no match)", api.ErrExtractionFailed),
+	}
+
+	tests := []struct {
+		err   error
+		retry bool
+	}{
+		{extractionErr, false},
+		{api.ErrUnsupportedStore, false},
+		{&api.ResponseError{Class: api.ErrNotFound}, false},
+		{&api.ResponseError{Class: api.ErrServerError}, true},
+		{errors.New("connection reset"), true},
+	}
+
+	for _, test := range tests {
+		p := &retryPolicy{}
+		if _, retry := p.next(test.err); retry != test.retry {
+			t.Errorf("next(%v): expected retry %v, got %v", test.err, test.retry, retry)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package spool
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bfoody/Walmart-Scraper/services/client/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// maxLineSize is the longest spool file line read, in bytes.
+const maxLineSize = 16 << 20
+
+// Options limit the size of a Spool and how long it keeps messages.
+type Options struct {
+	MaxEntries int           // the most messages kept, dropping the oldest beyond it
+	MaxBytes   int64         // the most bytes of messages kept, dropping the oldest beyond it
+	MaxAge     time.Duration // how long messages are kept before being dropped
+}
+
+// An Entry is a message waiting in a Spool to be sent.
+type Entry struct {
+	Key       string          // deduplicates messages, eg. "info:<task ID>"
+	Type      string          // the message's type, eg. "infoRetrieved"
+	SpooledAt time.Time       // when the message was first spooled
+	Message   json.RawMessage // the message, encoded as JSON
+}
+
+// size returns the approximate size of an entry in the spool file.
+func (e *Entry) size() int64 {
+	return int64(len(e.Key) + len(e.Type) + len(e.Message) + 64)
+}
+
+// A Spool persists messages which couldn't be sent to an append-only file, so that
+// they can be replayed in order once they can be, even after a restart. Messages are
+// deduplicated by key, keeping the latest message in the place of the first.
+type Spool struct {
+	mutex   *sync.Mutex
+	path    string
+	file    *os.File
+	options Options
+	entries []*Entry
+	keys    map[string]*Entry
+	size    int64
+	now     func() time.Time
+	log     *zap.Logger
+}
+
+// Open opens the spool file at `path`, creating it if it doesn't exist, and loads the
+// messages in it.
+func Open(path string, options Options, logger *zap.Logger) (*Spool, error) {
+	s := &Spool{
+		mutex:   &sync.Mutex{},
+		path:    path,
+		options: options,
+		entries: []*Entry{},
+		keys:    map[string]*Entry{},
+		now:     time.Now,
+		log:     logger,
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	// Rewrite the file without duplicates, expired messages, or messages beyond the
+	// limits.
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.expire()
+	s.trim()
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// load reads the entries in the spool file, if it exists. Lines that can't be decoded,
+// eg. a line cut off by a crash, are skipped.
+func (s *Spool) load() error {
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, maxLineSize)
+	for scanner.Scan() {
+		entry := &Entry{}
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			s.log.Warn("skipping corrupt spool entry", zap.String("path", s.path), zap.Error(err))
+			continue
+		}
+
+		s.insert(entry)
+	}
+
+	return scanner.Err()
+}
+
+// insert adds an entry to the spool's index, replacing any entry with the same key in
+// place. Must be called with the mutex held.
+func (s *Spool) insert(entry *Entry) {
+	if existing, ok := s.keys[entry.Key]; ok {
+		s.size += entry.size() - existing.size()
+		existing.Type = entry.Type
+		existing.Message = entry.Message
+		return
+	}
+
+	s.entries = append(s.entries, entry)
+	s.keys[entry.Key] = entry
+	s.size += entry.size()
+}
+
+// Add spools a message under a key, replacing any message already spooled under it,
+// then drops the oldest messages if the spool is over its limits.
+func (s *Spool) Add(key string, typeName string, message interface{}) error {
+	b, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.add(&Entry{Key: key, Type: typeName, SpooledAt: s.now(), Message: b})
+}
+
+// Send sends a message with `send` if nothing is spooled, or spools it under a key
+// like Add if earlier messages are still spooled or it can't be sent, so that messages
+// are sent in order. The spool stays locked while sending, so that a message can't be
+// sent while earlier ones are being replayed.
+func (s *Spool) Send(key string, typeName string, message interface{}, send func() error) error {
+	b, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.entries) == 0 {
+		err := send()
+		if err == nil {
+			return nil
+		}
+
+		s.log.Warn("couldn't send message, spooling it", zap.String("key", key), zap.Error(err))
+	}
+
+	return s.add(&Entry{Key: key, Type: typeName, SpooledAt: s.now(), Message: b})
+}
+
+// add spools an entry, then drops the oldest messages if the spool is over its limits.
+// Must be called with the mutex held.
+func (s *Spool) add(entry *Entry) error {
+	if err := s.append(entry); err != nil {
+		return err
+	}
+
+	s.insert(entry)
+	s.trim()
+	metrics.SpoolEntries.Set(float64(len(s.entries)))
+
+	return nil
+}
+
+// append appends an entry to the spool file, opening it if it isn't open. Must be
+// called with the mutex held.
+func (s *Spool) append(entry *Entry) error {
+	if s.file == nil {
+		f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return err
+		}
+
+		s.file = f
+	}
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.file.Write(append(b, '\n'))
+	return err
+}
+
+// Len returns the number of messages in the spool.
+func (s *Spool) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.entries)
+}
+
+// Replay sends the spooled messages in order with `send`, removing those sent, until
+// one can't be sent. It returns the number of messages sent and the error of the
+// message that couldn't be, if any. Expired messages are dropped without being sent.
+func (s *Spool) Replay(send func(entry *Entry) error) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.entries) == 0 {
+		return 0, nil
+	}
+
+	s.expire()
+
+	sent := 0
+	var sendErr error
+	for _, entry := range s.entries {
+		if sendErr = send(entry); sendErr != nil {
+			break
+		}
+
+		sent++
+	}
+
+	for _, entry := range s.entries[:sent] {
+		delete(s.keys, entry.Key)
+		s.size -= entry.size()
+	}
+	s.entries = s.entries[sent:]
+
+	if sent > 0 {
+		if err := s.compact(); err != nil {
+			return sent, err
+		}
+	}
+
+	return sent, sendErr
+}
+
+// expire drops messages older than the maximum age. Must be called with the mutex
+// held.
+func (s *Spool) expire() {
+	if s.options.MaxAge <= 0 {
+		return
+	}
+
+	cutoff := s.now().Add(-s.options.MaxAge)
+	for len(s.entries) > 0 && s.entries[0].SpooledAt.Before(cutoff) {
+		s.drop("expired")
+	}
+}
+
+// trim drops the oldest messages while the spool is over its limits. Must be called
+// with the mutex held.
+func (s *Spool) trim() {
+	for len(s.entries) > 0 &&
+		((s.options.MaxEntries > 0 && len(s.entries) > s.options.MaxEntries) ||
+			(s.options.MaxBytes > 0 && s.size > s.options.MaxBytes)) {
+		s.drop("full")
+	}
+}
+
+// drop drops the oldest message. Must be called with the mutex held.
+func (s *Spool) drop(reason string) {
+	entry := s.entries[0]
+	s.entries = s.entries[1:]
+	delete(s.keys, entry.Key)
+	s.size -= entry.size()
+
+	metrics.SpoolDropped.WithLabelValues(reason).Inc()
+	s.log.Warn("dropping spooled message", zap.String("key", entry.Key), zap.String("reason", reason))
+}
+
+// compact rewrites the spool file with only the messages still in the spool, replacing
+// it atomically. Must be called with the mutex held.
+func (s *Spool) compact() error {
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	for _, entry := range s.entries {
+		b, err := json.Marshal(entry)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+
+		w.Write(append(b, '\n'))
+	}
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	metrics.SpoolEntries.Set(float64(len(s.entries)))
+
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// Close closes the spool file.
+func (s *Spool) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+
+	return err
+}
@@ -0,0 +1,141 @@
+package spool
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// message is a spooled test message.
+type message struct {
+	TaskID string
+	Price  float64
+}
+
+// keys returns the keys of the spooled messages, in order.
+func keys(s *Spool) []string {
+	keys := []string{}
+	for _, entry := range s.entries {
+		keys = append(keys, entry.Key)
+	}
+
+	return keys
+}
+
+// TestSpool tests that messages survive reopening the spool, are deduplicated by key,
+// and are replayed in order until one can't be sent.
+func TestSpool(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spool.jsonl")
+	s, err := Open(path, Options{}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range []message{{"1", 1}, {"2", 2}, {"1", 1.5}, {"3", 3}} {
+		if err := s.Add("info:"+m.TaskID, "infoRetrieved", m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+
+	s, err = Open(path, Options{}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := keys(s); len(got) != 3 || got[0] != "info:1" || got[1] != "info:2" || got[2] != "info:3" {
+		t.Fatalf("expected 3 messages in order, got %v", got)
+	}
+
+	errUnreachable := errors.New("hub unreachable")
+	sent := []string{}
+	n, err := s.Replay(func(entry *Entry) error {
+		if entry.Key == "info:3" {
+			return errUnreachable
+		}
+
+		sent = append(sent, string(entry.Message))
+		return nil
+	})
+	if n != 2 || !errors.Is(err, errUnreachable) {
+		t.Fatalf("expected 2 messages sent before the failure, got %d (%v)", n, err)
+	}
+	if sent[0] != `{"TaskID":"1","Price":1.5}` {
+		t.Errorf("expected the latest message for a key, got %s", sent[0])
+	}
+
+	s, err = Open(path, Options{}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := keys(s); len(got) != 1 || got[0] != "info:3" {
+		t.Errorf("expected only the unsent message to be kept, got %v", got)
+	}
+}
+
+// TestSpoolSend tests that messages are only sent directly while nothing is spooled,
+// and are spooled when they can't be sent.
+func TestSpoolSend(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "spool.jsonl"), Options{}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent := []string{}
+	send := func(m message) func() error {
+		return func() error {
+			if m.TaskID == "2" {
+				return errors.New("hub unreachable")
+			}
+
+			sent = append(sent, m.TaskID)
+			return nil
+		}
+	}
+
+	for _, m := range []message{{"1", 1}, {"2", 2}, {"3", 3}} {
+		if err := s.Send("info:"+m.TaskID, "infoRetrieved", m, send(m)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// "3" could have been sent, but mustn't overtake "2".
+	if len(sent) != 1 || sent[0] != "1" {
+		t.Errorf("expected only the first message to be sent, got %v", sent)
+	}
+
+	if got := keys(s); len(got) != 2 || got[0] != "info:2" || got[1] != "info:3" {
+		t.Errorf("expected the failed message and the one after it to be spooled, got %v", got)
+	}
+}
+
+// TestSpoolLimits tests that the oldest messages are dropped when the spool is full or
+// they expire.
+func TestSpoolLimits(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "spool.jsonl"), Options{MaxEntries: 2, MaxAge: time.Hour}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	for _, id := range []string{"1", "2", "3"} {
+		if err := s.Add("info:"+id, "infoRetrieved", message{TaskID: id}); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(40 * time.Minute)
+	}
+
+	if got := keys(s); len(got) != 2 || got[0] != "info:2" {
+		t.Fatalf("expected the oldest message to be dropped, got %v", got)
+	}
+
+	n, _ := s.Replay(func(entry *Entry) error { return nil })
+	if n != 1 || s.Len() != 0 {
+		t.Errorf("expected the expired message to be dropped and 1 sent, got %d sent and %d left", n, s.Len())
+	}
+}
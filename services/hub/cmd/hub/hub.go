@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
 
+	"github.com/bfoody/Walmart-Scraper/admin"
 	"github.com/bfoody/Walmart-Scraper/communication"
+	"github.com/bfoody/Walmart-Scraper/health"
 	"github.com/bfoody/Walmart-Scraper/identity"
 	"github.com/bfoody/Walmart-Scraper/logging"
 	"github.com/bfoody/Walmart-Scraper/services/hub"
@@ -14,20 +17,32 @@ import (
 	"github.com/bfoody/Walmart-Scraper/services/hub/internal/database/postgres"
 	"github.com/bfoody/Walmart-Scraper/services/hub/internal/service"
 	"github.com/bfoody/Walmart-Scraper/services/hub/internal/supervisor"
+	"github.com/bfoody/Walmart-Scraper/tracing"
+	configutil "github.com/bfoody/Walmart-Scraper/utils/config"
 	"github.com/bfoody/Walmart-Scraper/utils/uuid"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 )
 
 func main() {
+	config, err := hub.LoadConfig(os.Args[1:])
+	if err != nil {
+		fmt.Println("Error loading config: ", err)
+		os.Exit(1)
+	}
+
 	// Initialize logging.
-	log, err := logging.Configure()
+	loggers, err := logging.Configure(&config.Logging)
 	if err != nil {
 		fmt.Println("Error initializing logging: ", err)
+		os.Exit(1)
 	}
+	log := loggers.Logger()
+	log.Debug("loaded config:\n" + configutil.Dump(config))
 
-	config, err := hub.LoadConfig()
+	shutdownTracing, err := tracing.Configure("hub", config.TracingExporter, config.TracingEndpoint)
 	if err != nil {
-		log.Fatal("unable to load config", zap.Error(err))
+		log.Fatal("unable to configure tracing", zap.Error(err))
 	}
 
 	// TODO: move all this stuff into another function
@@ -47,13 +62,22 @@ func main() {
 		log.Fatal("error connecting to database", zap.Error(err))
 	}
 
+	locationRepository := database.NewLocationRepository(db)
 	productRepository := database.NewProductRepository(db)
 	productInfoRepository := database.NewProductInfoRepository(db)
 	productLocationRepository := database.NewProductLocationRepository(db)
 	scrapeTaskRepository := database.NewScrapeTaskRepository(db)
 	crawlTaskRepository := database.NewCrawlTaskRepository(db)
+	discoveryTaskRepository := database.NewDiscoveryTaskRepository(db)
+	unitOfWork := database.NewUnitOfWork(db)
 
-	service := service.NewService(productRepository, productInfoRepository, productLocationRepository, scrapeTaskRepository, crawlTaskRepository)
+	service := service.NewService(locationRepository, productRepository, productInfoRepository, productLocationRepository, scrapeTaskRepository, crawlTaskRepository, discoveryTaskRepository, unitOfWork)
+
+	// Refuse to start with products tracked under locations that can't be scraped.
+	err = service.CheckLocations()
+	if err != nil {
+		log.Fatal("invalid locations", zap.Error(err))
+	}
 
 	conn, err := communication.ConnectAMQP(config.AMQPURL)
 	if err != nil {
@@ -62,7 +86,7 @@ func main() {
 
 	e := communication.NewQueueConnection(conn, config.AMQPExchange)
 
-	supervisor := supervisor.New(identity, log, e, service)
+	supervisor := supervisor.New(identity, loggers, e, service, config)
 
 	err = e.Consume()
 	if err != nil {
@@ -74,6 +98,36 @@ func main() {
 		log.Fatal(err.Error())
 	}
 
+	// Reload settings on SIGHUP or config or .env file change.
+	configFile, err := hub.ConfigFilePath(os.Args[1:])
+	if err != nil {
+		log.Fatal("unable to resolve config file", zap.Error(err))
+	}
+
+	reloader := configutil.NewReloader(config, func() (interface{}, error) {
+		return hub.LoadConfig(os.Args[1:])
+	}, []string{configFile, configutil.DotEnvFile}, loggers.Component("config"))
+	reloader.Subscribe(func(cfg interface{}) {
+		supervisor.ApplyConfig(cfg.(*hub.Config))
+	})
+	reloader.Start()
+
+	checker := health.NewChecker()
+	checker.Register("database", db.PingContext)
+	checker.Register("amqp", e.Check)
+	checker.Register("taskmanager", supervisor.CheckTaskManager)
+	checker.Register("clients", supervisor.CheckClients)
+
+	adminServer := admin.NewServer(config.AdminAddr, log)
+	adminServer.Handle("/metrics", promhttp.Handler())
+	adminServer.Handle("/healthz", checker.LivenessHandler())
+	adminServer.Handle("/readyz", checker.ReadinessHandler())
+	adminServer.Handle("/loglevel", loggers.Handler())
+	err = adminServer.Start()
+	if err != nil {
+		log.Fatal("error starting admin server", zap.Error(err))
+	}
+
 	log.Info(fmt.Sprintf("hello world! hub initialized successfully as hub %s", identity.ID))
 
 	// Handle graceful shutdowns.
@@ -82,10 +136,14 @@ func main() {
 	signal.Notify(s, syscall.SIGTERM)
 	go func() {
 		<-s
+		reloader.Shutdown()
 		err = supervisor.Shutdown()
 		if err != nil {
 			log.Fatal(err.Error())
 		}
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.Error("error flushing traces", zap.Error(err))
+		}
 		os.Exit(0)
 	}()
 
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bfoody/Walmart-Scraper/communication"
+	"github.com/bfoody/Walmart-Scraper/domain"
+	"github.com/bfoody/Walmart-Scraper/services/hub"
+	"github.com/bfoody/Walmart-Scraper/utils/uuid"
+)
+
+// addProduct creates a Product, ProductLocation and ScrapeTask repeating every
+// `interval` for a product URL, under the location registered for the URL's host.
+func addProduct(service hub.Service, rawURL string, interval time.Duration) error {
+	location, err := findLocationForURL(service, rawURL)
+	if err != nil {
+		return err
+	}
+
+	slug, itemID, err := parseProductURL(location, rawURL)
+	if err != nil {
+		return err
+	}
+
+	name := strings.ReplaceAll(slug, "-", " ")
+
+	st, err := service.TrackProduct(context.Background(), domain.Product{
+		ID:         "",
+		CommonName: name,
+	}, domain.ProductLocation{
+		ID:         "",
+		Name:       name,
+		LocationID: location.ID,
+		URL:        canonicalProductURL(location, slug, itemID),
+		LocalID:    itemID,
+		Slug:       slug,
+	}, domain.ScrapeTask{
+		ID:           "",
+		Completed:    false,
+		CreatedAt:    time.Now(),
+		ScheduledFor: time.Now(),
+		Repeat:       true,
+		Interval:     interval,
+	})
+	if err != nil {
+		return fmt.Errorf("error saving product: %w", err)
+	}
+
+	if st == nil {
+		return fmt.Errorf("item %s is already tracked at location %s", itemID, location.ID)
+	}
+
+	fmt.Printf("added item %s: product location %s, task %s\n", itemID, st.ProductLocationID, st.ID)
+
+	return nil
+}
+
+// importProducts adds every product URL in a file, skipping blank lines and
+// lines starting with '#'.
+func importProducts(service hub.Service, path string, interval time.Duration) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	added, failed := 0, 0
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if err := addProduct(service, line, interval); err != nil {
+			fmt.Printf("failed to add %s: %s\n", line, err)
+			failed++
+			continue
+		}
+
+		added++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	fmt.Printf("imported %d products, %d failed\n", added, failed)
+
+	return nil
+}
+
+// listTasks prints the upcoming scrape tasks.
+func listTasks(service hub.Service, limitStr string) error {
+	limit, err := strconv.ParseUint(limitStr, 10, 16)
+	if err != nil {
+		return errors.New("limit not a number")
+	}
+
+	tasks, err := service.FetchUpcomingTasks(uint16(limit))
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSCHEDULED FOR\tPRODUCT LOCATION\tSTORE\tREPEAT\tINTERVAL")
+	for _, task := range tasks {
+		printTask(w, task)
+	}
+
+	return w.Flush()
+}
+
+// tailTasks polls for newly created scrape tasks and prints them until interrupted.
+func tailTasks(service hub.Service, intervalStr string) error {
+	interval, err := strconv.Atoi(intervalStr)
+	if err != nil || interval < 1 {
+		return errors.New("interval not a positive number")
+	}
+
+	since := time.Now()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSCHEDULED FOR\tPRODUCT LOCATION\tSTORE\tREPEAT\tINTERVAL")
+	w.Flush()
+
+	for {
+		time.Sleep(time.Duration(interval) * time.Second)
+
+		tasks, err := service.FetchTasksCreatedSince(since)
+		if err != nil {
+			return err
+		}
+
+		for _, task := range tasks {
+			printTask(w, task)
+			since = task.CreatedAt
+		}
+
+		w.Flush()
+	}
+}
+
+// printTask prints a single task as a row of a table.
+func printTask(w *tabwriter.Writer, task domain.ScrapeTask) {
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\t%s\n", task.ID, task.ScheduledFor.Format(time.RFC3339), task.ProductLocationID, storeLabel(task.StoreID, task.ZIPCode), task.Repeat, task.Interval)
+}
+
+// storeLabel describes a store context for printing, eg. "5435 (72712)".
+func storeLabel(storeID, zipCode string) string {
+	switch {
+	case storeID == "" && zipCode == "":
+		return "default"
+	case zipCode == "":
+		return storeID
+	case storeID == "":
+		return zipCode
+	default:
+		return fmt.Sprintf("%s (%s)", storeID, zipCode)
+	}
+}
+
+// showHistory prints every recorded price of a product.
+func showHistory(service hub.Service, productID string) error {
+	product, err := service.GetProductByID(productID)
+	if err != nil {
+		return fmt.Errorf("error finding product %s: %w", productID, err)
+	}
+
+	infos, err := service.GetPriceHistory(productID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s (%d observations)\n", product.CommonName, len(infos))
+	if product.Brand != "" || product.UPC != "" {
+		fmt.Printf("brand: %s, upc: %s\n", product.Brand, product.UPC)
+	}
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tPRICE\tLIST PRICE\tAVAILABILITY\tSELLER\tRATING\tREVIEWS\tSTORE\tPRODUCT LOCATION")
+	for _, info := range infos {
+		seller := info.SellerName
+		if info.ThirdPartySeller {
+			seller += " (marketplace)"
+		}
+
+		fmt.Fprintf(w, "%s\t%.2f\t%.2f\t%s\t%s\t%.1f\t%d\t%s\t%s\n", info.CreatedAt.Format(time.RFC3339), info.Price, info.ListPrice, info.AvailabilityStatus, seller, info.Rating, info.ReviewCount, storeLabel(info.StoreID, info.ZIPCode), info.ProductLocationID)
+	}
+
+	return w.Flush()
+}
+
+// trackStore creates a ScrapeTask repeating every `interval` for every location of a
+// product, scraping its prices and availability at a store or ZIP code. A store ID of
+// "-" scrapes by ZIP code only.
+func trackStore(service hub.Service, productID, storeID, zipCode string, interval time.Duration) error {
+	if storeID == "-" {
+		storeID = ""
+	}
+
+	if storeID == "" && zipCode == "" {
+		return errors.New("either a store ID or a ZIP code is required")
+	}
+
+	pls, err := service.GetProductLocationsByProductID(productID)
+	if err != nil {
+		return err
+	}
+
+	if len(pls) < 1 {
+		return fmt.Errorf("product %s has no product locations", productID)
+	}
+
+	for _, pl := range pls {
+		taskID, err := service.CreateTask(domain.ScrapeTask{
+			ID:                "",
+			Completed:         false,
+			CreatedAt:         time.Now(),
+			ScheduledFor:      time.Now(),
+			ProductLocationID: pl.ID,
+			Repeat:            true,
+			Interval:          interval,
+			StoreID:           storeID,
+			ZIPCode:           zipCode,
+		})
+		if err != nil {
+			return fmt.Errorf("error saving ScrapeTask: %w", err)
+		}
+
+		fmt.Printf("tracking product location %s at %s: task %s\n", pl.ID, storeLabel(storeID, zipCode), taskID)
+	}
+
+	return nil
+}
+
+// triggerCrawl asks a hub to crawl recommendations from every location of a product.
+// The hub is found by waiting for its heartbeats to clients, sent every
+// `heartbeatInterval`.
+func triggerCrawl(service hub.Service, conn *communication.QueueConnection, productID string, heartbeatInterval time.Duration) error {
+	pls, err := service.GetProductLocationsByProductID(productID)
+	if err != nil {
+		return err
+	}
+
+	if len(pls) < 1 {
+		return fmt.Errorf("product %s has no product locations", productID)
+	}
+
+	hubID, err := findHub(conn, 3*heartbeatInterval)
+	if err != nil {
+		return err
+	}
+
+	senderID := uuid.Generate()
+
+	for _, pl := range pls {
+		err := conn.SendMessage(communication.CrawlRequest{
+			SingleReceiverPacket: communication.SingleReceiverPacket{
+				SenderID:   senderID,
+				ReceiverID: hubID,
+			},
+			ProductLocationID: pl.ID,
+		})
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("requested crawl from product location %s on hub %s\n", pl.ID, hubID)
+	}
+
+	return nil
+}
+
+// findHub returns the ID of the first hub seen heartbeating a client within `timeout`.
+// Only hubs expect responses to their heartbeats, so clients' replies are ignored.
+func findHub(conn *communication.QueueConnection, timeout time.Duration) (string, error) {
+	found := make(chan string, 1)
+	conn.RegisterHeartbeatHandler(func(hb *communication.Heartbeat) {
+		if !hb.ResponseExpected {
+			return
+		}
+
+		select {
+		case found <- hb.SenderID:
+		default:
+		}
+	})
+
+	if err := conn.Consume(); err != nil {
+		return "", err
+	}
+
+	select {
+	case hubID := <-found:
+		return hubID, nil
+	case <-time.After(timeout):
+		return "", fmt.Errorf("no hub with connected clients found within %s", timeout)
+	}
+}
+
+// listLocations prints every registered location.
+func listLocations(service hub.Service) error {
+	locations, err := service.GetLocations()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tRETAILER\tBASE URL")
+	for _, location := range locations {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", location.ID, location.Name, location.Retailer, location.BaseURL)
+	}
+
+	return w.Flush()
+}
+
+// addLocation registers a new location scraped with the adapter for `retailer`.
+func addLocation(service hub.Service, name, retailer, baseURL string) error {
+	id, err := service.RegisterLocation(domain.Location{
+		ID:       "",
+		Name:     name,
+		Retailer: retailer,
+		BaseURL:  baseURL,
+	})
+	if err != nil {
+		return fmt.Errorf("error saving Location: %w", err)
+	}
+
+	fmt.Printf("added location %s\n", id)
+
+	return nil
+}
+
+// addDiscovery creates a DiscoveryTask repeating every `interval`, due to be run as soon
+// as a hub picks it up.
+func addDiscovery(service hub.Service, locationID, kind, query, maxPagesStr string, interval time.Duration) error {
+	maxPages, err := strconv.Atoi(maxPagesStr)
+	if err != nil || maxPages < 1 {
+		return errors.New("max pages not a positive number")
+	}
+
+	id, err := service.CreateDiscoveryTask(domain.DiscoveryTask{
+		ID:           "",
+		LocationID:   locationID,
+		Kind:         kind,
+		Query:        query,
+		MaxPages:     maxPages,
+		ScheduledFor: time.Now(),
+		Interval:     interval,
+	})
+	if err != nil {
+		return fmt.Errorf("error saving DiscoveryTask: %w", err)
+	}
+
+	fmt.Printf("added discovery task %s\n", id)
+
+	return nil
+}
+
+// listDiscoveries prints every discovery task.
+func listDiscoveries(service hub.Service) error {
+	tasks, err := service.GetDiscoveryTasks()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tLOCATION\tKIND\tQUERY\tMAX PAGES\tSCHEDULED FOR\tINTERVAL")
+	for _, task := range tasks {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", task.ID, task.LocationID, task.Kind, task.Query, task.MaxPages, task.ScheduledFor.Format(time.RFC3339), task.Interval)
+	}
+
+	return w.Flush()
+}
+
+// removeDiscovery deletes a discovery task.
+func removeDiscovery(service hub.Service, id string) error {
+	if _, err := service.GetDiscoveryTaskByID(id); err != nil {
+		return fmt.Errorf("error finding discovery task %s: %w", id, err)
+	}
+
+	if err := service.DeleteDiscoveryTask(id); err != nil {
+		return err
+	}
+
+	fmt.Printf("removed discovery task %s\n", id)
+
+	return nil
+}
+
+// dedupProducts merges product locations sharing a location and local ID, printing each
+// merge. If `dryRun` is true, the merges are printed without being made.
+func dedupProducts(service hub.Service, dryRun bool) error {
+	merges, err := service.MergeDuplicateProductLocations(context.Background(), dryRun)
+
+	verb := "merged"
+	if dryRun {
+		verb = "would merge"
+	}
+
+	duplicates := 0
+	for _, merge := range merges {
+		duplicates += len(merge.DuplicateIDs)
+		fmt.Printf("%s item %s at location %s: %s into %s\n", verb, merge.LocalID, merge.LocationID, strings.Join(merge.DuplicateIDs, ", "), merge.SurvivorID)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s %d duplicate product locations of %d products\n", verb, duplicates, len(merges))
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bfoody/Walmart-Scraper/communication"
+	"github.com/bfoody/Walmart-Scraper/services/hub"
+	"github.com/bfoody/Walmart-Scraper/services/hub/internal/database"
+	"github.com/bfoody/Walmart-Scraper/services/hub/internal/database/postgres"
+	"github.com/bfoody/Walmart-Scraper/services/hub/internal/service"
+)
+
+const usage = `usage: hubctl <command> <args...>
+
+commands:
+  add <product url>           start tracking a product by its URL on a registered location
+  import <file>               start tracking every product URL in a file, one per line
+  tasks [limit]               list upcoming scrape tasks
+  tail [interval seconds]     print scrape tasks as they are created
+  history <product id>        show the price history of a product
+  crawl <product id>          crawl recommendations from a product, on a hub with connected clients
+  track-store <product id> <store id|-> [zip code]
+                              also scrape a product's prices and availability at a store or ZIP code,
+                              eg. track-store <product id> - 72712 to scrape by ZIP code only
+  locations                   list registered locations
+  add-location <name> <retailer> <base url>
+                              register a location scraped with the adapter for <retailer>
+                              ("walmart" or "jsonld"), eg. add-location Walmart walmart https://www.walmart.com
+  discover <location id> <search|browse> <query> [max pages]
+                              track the products found by a search query or on a category page,
+                              repeating every SCR_DISCOVERY_INTERVAL
+  discoveries                 list discovery tasks
+  remove-discovery <id>       stop running a discovery task
+  dedup-products [dry-run]    merge products tracked more than once at a location, moving their
+                              history and tasks to one of them; run while the hub is stopped,
+                              before migration 000020 (see make migrate-dedup)`
+
+// exit prints a message and exits the process with the supplied code.
+func exit(code int, msg string) {
+	fmt.Println(msg)
+	os.Exit(code)
+}
+
+// connectService connects to the database and returns a hub.Service.
+func connectService(config *hub.Config) hub.Service {
+	db, err := postgres.Connect(postgres.ConnOptions{
+		Host:           config.DatabaseURL,
+		Port:           config.DatabasePort,
+		DBName:         config.DatabaseName,
+		Username:       config.DatabaseUsername,
+		Password:       config.DatabasePassword,
+		DisableSSLMode: true,
+	})
+	if err != nil {
+		exit(1, fmt.Sprintf("err: couldn't connect to database: %s", err))
+	}
+
+	return service.NewService(
+		database.NewLocationRepository(db),
+		database.NewProductRepository(db),
+		database.NewProductInfoRepository(db),
+		database.NewProductLocationRepository(db),
+		database.NewScrapeTaskRepository(db),
+		database.NewCrawlTaskRepository(db),
+		database.NewDiscoveryTaskRepository(db),
+		database.NewUnitOfWork(db),
+	)
+}
+
+// connectQueue connects to the message queue and returns a *communication.QueueConnection.
+func connectQueue(config *hub.Config) *communication.QueueConnection {
+	conn, err := communication.ConnectAMQP(config.AMQPURL)
+	if err != nil {
+		exit(1, fmt.Sprintf("err: couldn't connect to message queue: %s", err))
+	}
+
+	return communication.NewQueueConnection(conn, config.AMQPExchange)
+}
+
+func main() {
+	args := os.Args[1:]
+	if len(args) < 1 {
+		exit(1, usage)
+	}
+
+	config, err := hub.LoadConfig(nil)
+	if err != nil {
+		exit(1, fmt.Sprintf("err: unable to load config: %s", err))
+	}
+
+	action := args[0]
+	switch action {
+	case "add":
+		if len(args) < 2 {
+			exit(1, "usage: hubctl add <product url>")
+		}
+
+		err = addProduct(connectService(config), args[1], config.ScrapeInterval)
+	case "import":
+		if len(args) < 2 {
+			exit(1, "usage: hubctl import <file>")
+		}
+
+		err = importProducts(connectService(config), args[1], config.ScrapeInterval)
+	case "tasks":
+		limit := "25"
+		if len(args) > 1 {
+			limit = args[1]
+		}
+
+		err = listTasks(connectService(config), limit)
+	case "tail":
+		interval := "5"
+		if len(args) > 1 {
+			interval = args[1]
+		}
+
+		err = tailTasks(connectService(config), interval)
+	case "history":
+		if len(args) < 2 {
+			exit(1, "usage: hubctl history <product id>")
+		}
+
+		err = showHistory(connectService(config), args[1])
+	case "crawl":
+		if len(args) < 2 {
+			exit(1, "usage: hubctl crawl <product id>")
+		}
+
+		err = triggerCrawl(connectService(config), connectQueue(config), args[1], config.HeartbeatInterval)
+	case "track-store":
+		if len(args) < 3 {
+			exit(1, "usage: hubctl track-store <product id> <store id|-> [zip code]")
+		}
+
+		zipCode := ""
+		if len(args) > 3 {
+			zipCode = args[3]
+		}
+
+		err = trackStore(connectService(config), args[1], args[2], zipCode, config.ScrapeInterval)
+	case "locations":
+		err = listLocations(connectService(config))
+	case "add-location":
+		if len(args) < 4 {
+			exit(1, "usage: hubctl add-location <name> <retailer> <base url>")
+		}
+
+		err = addLocation(connectService(config), args[1], args[2], args[3])
+	case "discover":
+		if len(args) < 4 {
+			exit(1, "usage: hubctl discover <location id> <search|browse> <query> [max pages]")
+		}
+
+		maxPages := "5"
+		if len(args) > 4 {
+			maxPages = args[4]
+		}
+
+		err = addDiscovery(connectService(config), args[1], args[2], args[3], maxPages, config.DiscoveryInterval)
+	case "discoveries":
+		err = listDiscoveries(connectService(config))
+	case "remove-discovery":
+		if len(args) < 2 {
+			exit(1, "usage: hubctl remove-discovery <id>")
+		}
+
+		err = removeDiscovery(connectService(config), args[1])
+	case "dedup-products":
+		dryRun := len(args) > 1 && args[1] == "dry-run"
+
+		err = dedupProducts(connectService(config), dryRun)
+	default:
+		exit(1, usage)
+	}
+
+	if err != nil {
+		exit(1, fmt.Sprintf("err: %s", err))
+	}
+}
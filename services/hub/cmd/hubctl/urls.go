@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/bfoody/Walmart-Scraper/domain"
+	"github.com/bfoody/Walmart-Scraper/services/hub"
+)
+
+// productURLRegex matches the slug and item ID in the path of a Walmart item page,
+// in the same way as walmart.ItemURLRegex in the client.
+var productURLRegex = regexp.MustCompile("\\/ip\\/(.{1,})\\/(\\d+)")
+
+// parseProductURL extracts the slug and local ID from a product page URL in the same
+// way as the client's adapter for the location's retailer, eg. the Walmart adapter
+// parses https://www.walmart.com/ip/onn-32-Class-HD-720P-Roku-Smart-LED-TV-100012589/314022535.
+func parseProductURL(location *domain.Location, rawURL string) (slug string, localID string, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	switch location.Retailer {
+	case domain.RetailerWalmart:
+		matches := productURLRegex.FindStringSubmatch(u.Path)
+		if matches == nil {
+			return "", "", errors.New("not a walmart item url, expected https://www.walmart.com/ip/<slug>/<item id>")
+		}
+
+		return matches[1], matches[2], nil
+	case domain.RetailerJSONLD:
+		path := strings.Trim(u.Path, "/")
+		if path == "" {
+			return "", "", errors.New("product url has no path")
+		}
+
+		return path, path, nil
+	}
+
+	return "", "", fmt.Errorf("unknown retailer %q", location.Retailer)
+}
+
+// canonicalProductURL returns the URL the client scrapes for a slug and local ID on a
+// location's website.
+func canonicalProductURL(location *domain.Location, slug, localID string) string {
+	base := strings.TrimSuffix(location.BaseURL, "/")
+	if location.Retailer == domain.RetailerWalmart {
+		return fmt.Sprintf("%s/ip/%s/%s", base, slug, localID)
+	}
+
+	return fmt.Sprintf("%s/%s", base, localID)
+}
+
+// normalizeHost lowercases a host and strips any "www." prefix so that
+// "www.walmart.com" and "walmart.com" match.
+func normalizeHost(host string) string {
+	return strings.TrimPrefix(strings.ToLower(host), "www.")
+}
+
+// findLocationForURL finds the registered location whose base URL has the same host
+// as `rawURL`.
+func findLocationForURL(service hub.Service, rawURL string) (*domain.Location, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	locations, err := service.GetLocations()
+	if err != nil {
+		return nil, fmt.Errorf("error fetching locations: %w", err)
+	}
+
+	for _, location := range locations {
+		base, err := url.Parse(location.BaseURL)
+		if err != nil {
+			continue
+		}
+
+		if normalizeHost(base.Host) == normalizeHost(u.Host) {
+			return &location, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no location registered for %s, add one with `hubctl add-location`", u.Host)
+}
@@ -1,26 +1,59 @@
 package hub
 
-import "github.com/bfoody/Walmart-Scraper/utils/config"
+import (
+	"os"
+	"time"
 
-// A Config contains various credentials, etc loaded from environment
-// variables.
+	"github.com/bfoody/Walmart-Scraper/logging"
+	"github.com/bfoody/Walmart-Scraper/utils/config"
+)
+
+// A Config contains various credentials, etc loaded from a config file, environment
+// variables and flags.
 type Config struct {
-	Env              string `env:"SCR_ENV" default:"dev"` // "dev" or "prod"
-	DatabaseURL      string `env:"SCR_DATABASE_URL"`
-	DatabasePort     string `env:"SCR_DATABASE_PORT"`
-	DatabaseName     string `env:"SCR_DATABASE_NAME"`
-	DatabaseUsername string `env:"SCR_DATABASE_USERNAME"`
-	DatabasePassword string `env:"SCR_DATABASE_PASSWORD"`
-	AMQPURL          string `env:"SCR_AMQP_URL"`
-	AMQPExchange     string `env:"SCR_AMQP_EXCHANGE"`
+	Env              string         `env:"SCR_ENV" yaml:"env" default:"dev" validate:"oneof=dev prod"`
+	DatabaseURL      string         `env:"SCR_DATABASE_URL" yaml:"database_url" validate:"nonempty"`
+	DatabasePort     string         `env:"SCR_DATABASE_PORT" yaml:"database_port" validate:"nonempty"`
+	DatabaseName     string         `env:"SCR_DATABASE_NAME" yaml:"database_name" validate:"nonempty"`
+	DatabaseUsername string         `env:"SCR_DATABASE_USERNAME" yaml:"database_username"`
+	DatabasePassword string         `env:"SCR_DATABASE_PASSWORD" yaml:"database_password" secret:"true"`
+	AMQPURL          string         `env:"SCR_AMQP_URL" yaml:"amqp_url" secret:"true" validate:"nonempty"`
+	AMQPExchange     string         `env:"SCR_AMQP_EXCHANGE" yaml:"amqp_exchange" validate:"nonempty"`
+	AdminAddr        string         `env:"SCR_ADMIN_ADDR" yaml:"admin_addr" flag:"admin-addr" default:":9090" usage:"the address to serve /metrics, /healthz and /readyz on"`
+	TracingExporter  string         `env:"SCR_TRACING_EXPORTER" yaml:"tracing_exporter" flag:"tracing-exporter" default:"none" validate:"oneof=none stdout otlp" usage:"the tracing exporter to use: none, stdout or otlp"`
+	TracingEndpoint  string         `env:"SCR_TRACING_ENDPOINT" yaml:"tracing_endpoint" flag:"tracing-endpoint" default:"localhost:4317" usage:"the OTLP collector's gRPC endpoint"`
+	Logging          logging.Config `yaml:"logging"`
+
+	// DiscoveryInterval is the interval between runs of discovery tasks created by hubctl.
+	DiscoveryInterval time.Duration `env:"SCR_DISCOVERY_INTERVAL" yaml:"discovery_interval" default:"24h" validate:"min=1m"`
+
+	// Reloadable settings, applied on SIGHUP or config file change.
+	HeartbeatInterval time.Duration `env:"SCR_HEARTBEAT_INTERVAL" yaml:"heartbeat_interval" default:"3s" reload:"true" validate:"min=100ms"` // the interval between heartbeats sent to each client
+	ScrapeInterval    time.Duration `env:"SCR_SCRAPE_INTERVAL" yaml:"scrape_interval" default:"2m" reload:"true" validate:"min=1s"`          // the interval between scrapes for newly tracked products
+	DispatchRate      float64       `env:"SCR_DISPATCH_RATE" yaml:"dispatch_rate" default:"20" reload:"true" validate:"min=0.01"`            // the most tasks dispatched to each retailer per second
+}
+
+// configOptions returns the options to load the config with from `args`.
+func configOptions(args []string) config.Options {
+	return config.Options{
+		File: os.Getenv("SCR_CONFIG_FILE"),
+		Args: args,
+	}
+}
+
+// ConfigFilePath returns the path of the config file LoadConfig would read for
+// `args`, or "" if there is none.
+func ConfigFilePath(args []string) (string, error) {
+	return config.FilePath(&Config{}, configOptions(args))
 }
 
-// LoadConfig loads all config options from environment variables into
-// a *Config.
-func LoadConfig() (*Config, error) {
+// LoadConfig loads all config options into a *Config from the file named by
+// SCR_CONFIG_FILE (or the `-config` flag), environment variables and flags parsed
+// from `args`. `args` may be nil to skip flags.
+func LoadConfig(args []string) (*Config, error) {
 	cfg := Config{}
 
-	err := config.LoadConfigFromEnv(&cfg)
+	err := config.Load(&cfg, configOptions(args))
 	if err != nil {
 		return nil, err
 	}
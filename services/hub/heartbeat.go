@@ -2,6 +2,7 @@ package hub
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/bfoody/Walmart-Scraper/communication"
@@ -18,35 +19,37 @@ const (
 // A Heartbeater maintains a connection to a server and sends heartbeats,
 // reporting back on server failure.
 type Heartbeater struct {
-	sender      *identity.Server // the server sending heartbeats
-	receiver    *identity.Server // the server receiving heartbeats
-	interval    time.Duration    // the interval between heartbeats
-	serverDown  chan identity.Server
-	conn        *communication.QueueConnection
-	shutdown    chan int
-	timer       *time.Timer
-	log         *zap.Logger
-	beatsMissed uint8 // the number of heartbeats missed
+	sender        *identity.Server // the server sending heartbeats
+	receiver      *identity.Server // the server receiving heartbeats
+	interval      time.Duration    // the interval between heartbeats
+	intervalMutex *sync.RWMutex
+	serverDown    chan identity.Server
+	conn          *communication.QueueConnection
+	shutdown      chan int
+	timer         *time.Timer
+	log           *zap.Logger
+	beatsMissed   uint8 // the number of heartbeats missed
 }
 
 // NewHeartbeater creates and returns a new *Heartbeater.
 func NewHeartbeater(sender *identity.Server, receiver *identity.Server, interval time.Duration, serverDown chan identity.Server, conn *communication.QueueConnection, logger *zap.Logger) *Heartbeater {
 	return &Heartbeater{
-		sender:      sender,
-		receiver:    receiver,
-		interval:    interval,
-		serverDown:  serverDown,
-		conn:        conn,
-		shutdown:    make(chan int),
-		timer:       nil,
-		log:         logger,
-		beatsMissed: 0,
+		sender:        sender,
+		receiver:      receiver,
+		interval:      interval,
+		intervalMutex: &sync.RWMutex{},
+		serverDown:    serverDown,
+		conn:          conn,
+		shutdown:      make(chan int),
+		timer:         nil,
+		log:           logger,
+		beatsMissed:   0,
 	}
 }
 
 // Start starts the Heartbeater.
 func (h *Heartbeater) Start() error {
-	h.timer = time.NewTimer(h.interval)
+	h.timer = time.NewTimer(h.Interval())
 	go h.loop()
 
 	return nil
@@ -59,6 +62,23 @@ func (h *Heartbeater) Shutdown() error {
 	return nil
 }
 
+// Interval returns the interval between heartbeats.
+func (h *Heartbeater) Interval() time.Duration {
+	h.intervalMutex.RLock()
+	defer h.intervalMutex.RUnlock()
+
+	return h.interval
+}
+
+// SetInterval changes the interval between heartbeats, taking effect after the next
+// heartbeat.
+func (h *Heartbeater) SetInterval(interval time.Duration) {
+	h.intervalMutex.Lock()
+	defer h.intervalMutex.Unlock()
+
+	h.interval = interval
+}
+
 func (h *Heartbeater) loop() {
 	for {
 		select {
@@ -68,7 +88,7 @@ func (h *Heartbeater) loop() {
 			}
 			h.sendHeartbeat(true)
 			// Restart the timer.
-			h.timer.Reset(h.interval)
+			h.timer.Reset(h.Interval())
 		case <-h.shutdown:
 			h.timer.Stop()
 
@@ -0,0 +1,46 @@
+package database
+
+import (
+	"github.com/bfoody/Walmart-Scraper/domain"
+	"github.com/lib/pq"
+)
+
+// emptyIfNil returns an empty array in place of a nil one, which pq would otherwise
+// store as NULL in columns that don't allow it.
+func emptyIfNil(a []string) pq.StringArray {
+	if a == nil {
+		return pq.StringArray{}
+	}
+
+	return pq.StringArray(a)
+}
+
+// A productRow is a Product as stored in the database, scanning its image URLs from a
+// Postgres array.
+type productRow struct {
+	domain.Product
+	ImageURLs pq.StringArray `db:"image_urls"`
+}
+
+// product returns the row as a *domain.Product.
+func (r *productRow) product() *domain.Product {
+	product := r.Product
+	product.ImageURLs = []string(r.ImageURLs)
+
+	return &product
+}
+
+// A productInfoRow is a ProductInfo as stored in the database, scanning its shipping
+// options from a Postgres array.
+type productInfoRow struct {
+	domain.ProductInfo
+	ShippingOptions pq.StringArray `db:"shipping_options"`
+}
+
+// productInfo returns the row as a domain.ProductInfo.
+func (r *productInfoRow) productInfo() domain.ProductInfo {
+	productInfo := r.ProductInfo
+	productInfo.ShippingOptions = []string(r.ShippingOptions)
+
+	return productInfo
+}
@@ -0,0 +1,28 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// TestRowArrays makes sure array columns are scanned into the rows' pq.StringArray
+// fields, rather than the []string fields of the domain types they embed.
+func TestRowArrays(t *testing.T) {
+	mapper := sqlx.NewDb(nil, "postgres").Mapper
+
+	for _, test := range []struct {
+		row    interface{}
+		column string
+	}{
+		{productRow{}, "image_urls"},
+		{productInfoRow{}, "shipping_options"},
+	} {
+		typ := reflect.TypeOf(test.row)
+		field, ok := mapper.TypeMap(typ).Names[test.column]
+		if !ok || len(field.Index) != 1 {
+			t.Errorf("%s: expected %s to be scanned into the row's own field, got %+v", typ.Name(), test.column, field)
+		}
+	}
+}
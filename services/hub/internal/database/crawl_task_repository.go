@@ -9,7 +9,7 @@ import (
 // A CrawlTaskRepository provides methods for interacting with CrawlTasks in
 // the database.
 type CrawlTaskRepository struct {
-	db *sqlx.DB
+	db queryer
 }
 
 // NewCrawlTaskRepository creates and returns a *CrawlTaskRepository from the supplied
@@ -54,6 +54,22 @@ func (r *CrawlTaskRepository) InsertCrawlTask(crawlTask domain.CrawlTask) (strin
 	return id, nil
 }
 
+// MoveCrawlTasks moves all crawl tasks from a product location to another product
+// location, deleting completed ones if the other product location was already crawled.
+func (r *CrawlTaskRepository) MoveCrawlTasks(fromProductLocationID, toProductLocationID string) error {
+	_, err := r.db.Exec("DELETE FROM crawl_tasks WHERE origin_product_location_id=$1 AND completed=TRUE AND EXISTS (SELECT 1 FROM crawl_tasks WHERE origin_product_location_id=$2 AND completed=TRUE)", fromProductLocationID, toProductLocationID)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec("UPDATE crawl_tasks SET origin_product_location_id=$1 WHERE origin_product_location_id=$2", toProductLocationID, fromProductLocationID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // UpdateCrawlTask updates a single crawl task in the database by ID.
 func (r *CrawlTaskRepository) UpdateCrawlTask(crawlTask domain.CrawlTask) error {
 	_, err := r.db.Exec("UPDATE crawl_tasks SET completed=$1, created_at=$2, origin_product_location_id=$3 WHERE ID=$4", crawlTask.Completed, crawlTask.CreatedAt, crawlTask.OriginProductLocationID, crawlTask.ID)
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"time"
+
+	"github.com/bfoody/Walmart-Scraper/domain"
+	"github.com/bfoody/Walmart-Scraper/utils/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// A DiscoveryTaskRepository provides methods for interacting with DiscoveryTasks in
+// the database.
+type DiscoveryTaskRepository struct {
+	db queryer
+}
+
+// NewDiscoveryTaskRepository creates and returns a *DiscoveryTaskRepository from the
+// supplied database connection.
+func NewDiscoveryTaskRepository(db *sqlx.DB) *DiscoveryTaskRepository {
+	return &DiscoveryTaskRepository{
+		db,
+	}
+}
+
+// FindDiscoveryTaskByID finds a single discovery task by ID, returning an error if nothing is found.
+func (r *DiscoveryTaskRepository) FindDiscoveryTaskByID(id string) (*domain.DiscoveryTask, error) {
+	discoveryTask := &domain.DiscoveryTask{}
+	err := r.db.Get(discoveryTask, "SELECT * FROM discovery_tasks WHERE id=$1", id)
+	if err != nil {
+		return nil, err
+	}
+
+	return discoveryTask, nil
+}
+
+// FindDiscoveryTasks finds all discovery tasks ordered by when they are next to be run,
+// returning an empty array if nothing is found.
+func (r *DiscoveryTaskRepository) FindDiscoveryTasks() ([]domain.DiscoveryTask, error) {
+	discoveryTasks := []domain.DiscoveryTask{}
+	err := r.db.Select(&discoveryTasks, "SELECT * FROM discovery_tasks ORDER BY scheduled_for")
+	if err != nil {
+		return nil, err
+	}
+
+	return discoveryTasks, nil
+}
+
+// FindDueDiscoveryTasks finds discovery tasks scheduled for before the supplied time,
+// returning an empty array if nothing is found.
+func (r *DiscoveryTaskRepository) FindDueDiscoveryTasks(before time.Time) ([]domain.DiscoveryTask, error) {
+	discoveryTasks := []domain.DiscoveryTask{}
+	err := r.db.Select(&discoveryTasks, "SELECT * FROM discovery_tasks WHERE scheduled_for<=$1 ORDER BY scheduled_for", before)
+	if err != nil {
+		return nil, err
+	}
+
+	return discoveryTasks, nil
+}
+
+// InsertDiscoveryTask inserts a single discovery task into the database, returning the ID on success.
+func (r *DiscoveryTaskRepository) InsertDiscoveryTask(discoveryTask domain.DiscoveryTask) (string, error) {
+	id := uuid.Generate()
+	_, err := r.db.Exec("INSERT INTO discovery_tasks (id, created_at, location_id, kind, query, max_pages, scheduled_for, interval) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)", id, discoveryTask.CreatedAt, discoveryTask.LocationID, discoveryTask.Kind, discoveryTask.Query, discoveryTask.MaxPages, discoveryTask.ScheduledFor, discoveryTask.Interval)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// UpdateDiscoveryTask updates a single discovery task in the database by ID.
+func (r *DiscoveryTaskRepository) UpdateDiscoveryTask(discoveryTask domain.DiscoveryTask) error {
+	_, err := r.db.Exec("UPDATE discovery_tasks SET location_id=$1, kind=$2, query=$3, max_pages=$4, scheduled_for=$5, interval=$6 WHERE id=$7", discoveryTask.LocationID, discoveryTask.Kind, discoveryTask.Query, discoveryTask.MaxPages, discoveryTask.ScheduledFor, discoveryTask.Interval, discoveryTask.ID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteDiscoveryTask deletes a single discovery task by ID.
+func (r *DiscoveryTaskRepository) DeleteDiscoveryTask(id string) error {
+	_, err := r.db.Exec("DELETE FROM discovery_tasks WHERE id=$1", id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"github.com/bfoody/Walmart-Scraper/domain"
+	"github.com/bfoody/Walmart-Scraper/utils/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// A LocationRepository provides methods for interacting with Locations in the
+// database.
+type LocationRepository struct {
+	db queryer
+}
+
+// NewLocationRepository creates and returns a *LocationRepository with the supplied
+// database connection.
+func NewLocationRepository(db *sqlx.DB) *LocationRepository {
+	return &LocationRepository{db}
+}
+
+// FindLocationByID finds a single location by ID, returning an error if nothing is found.
+func (r *LocationRepository) FindLocationByID(id string) (*domain.Location, error) {
+	location := &domain.Location{}
+	err := r.db.Get(location, "SELECT * FROM locations WHERE id=$1", id)
+	if err != nil {
+		return nil, err
+	}
+
+	return location, nil
+}
+
+// FindLocations finds all locations ordered by name, returning an empty array if
+// nothing is found.
+func (r *LocationRepository) FindLocations() ([]domain.Location, error) {
+	locations := []domain.Location{}
+	err := r.db.Select(&locations, "SELECT * FROM locations ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+
+	return locations, nil
+}
+
+// FindMissingLocationIDs finds the IDs of locations referenced by product locations
+// that don't exist, returning an empty array if there are none.
+func (r *LocationRepository) FindMissingLocationIDs() ([]string, error) {
+	ids := []string{}
+	err := r.db.Select(&ids, "SELECT DISTINCT location_id FROM product_locations WHERE location_id NOT IN (SELECT id FROM locations)")
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// InsertLocation inserts a single location into the database, returning the ID on success.
+func (r *LocationRepository) InsertLocation(location domain.Location) (string, error) {
+	id := uuid.Generate()
+	_, err := r.db.Exec("INSERT INTO locations (id, name, retailer, base_url) VALUES ($1, $2, $3, $4)", id, location.Name, location.Retailer, location.BaseURL)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// UpdateLocation updates a single location in the database by ID.
+func (r *LocationRepository) UpdateLocation(location domain.Location) error {
+	_, err := r.db.Exec("UPDATE locations SET name=$1, retailer=$2, base_url=$3 WHERE id=$4", location.Name, location.Retailer, location.BaseURL, location.ID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteLocation deletes a single location by ID.
+func (r *LocationRepository) DeleteLocation(id string) error {
+	_, err := r.db.Exec("DELETE FROM locations WHERE id=$1", id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
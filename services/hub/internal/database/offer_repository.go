@@ -0,0 +1,53 @@
+package database
+
+import (
+	"github.com/bfoody/Walmart-Scraper/domain"
+	"github.com/bfoody/Walmart-Scraper/utils/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// An OfferRepository provides methods for interacting with Offers in the database.
+type OfferRepository struct {
+	db queryer
+}
+
+// NewOfferRepository creates and returns a *OfferRepository from the supplied database
+// connection.
+func NewOfferRepository(db *sqlx.DB) *OfferRepository {
+	return &OfferRepository{
+		db,
+	}
+}
+
+// FindOffersByProductInfoID finds all offers observed with a product info, buy box
+// first, returning an empty array if nothing is found.
+func (r *OfferRepository) FindOffersByProductInfoID(id string) ([]domain.Offer, error) {
+	offers := []domain.Offer{}
+	err := r.db.Select(&offers, "SELECT * FROM offers WHERE product_info_id=$1 ORDER BY buy_box DESC, price", id)
+	if err != nil {
+		return nil, err
+	}
+
+	return offers, nil
+}
+
+// InsertOffer inserts a single offer into the database, returning the ID on success.
+func (r *OfferRepository) InsertOffer(offer domain.Offer) (string, error) {
+	id := uuid.Generate()
+	_, err := r.db.Exec("INSERT INTO offers (id, product_info_id, seller_id, seller_name, third_party_seller, price, availability_status, in_stock, buy_box) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)", id, offer.ProductInfoID, offer.SellerID, offer.SellerName, offer.ThirdPartySeller, offer.Price, offer.AvailabilityStatus, offer.InStock, offer.BuyBox)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// DeleteOffersByProductInfoID deletes all offers observed with a product info.
+func (r *OfferRepository) DeleteOffersByProductInfoID(id string) error {
+	_, err := r.db.Exec("DELETE FROM offers WHERE product_info_id=$1", id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -9,7 +9,7 @@ import (
 // A ProductInfoRepository provides methods for interfacing with ProductInfos
 // stored in the database.
 type ProductInfoRepository struct {
-	db *sqlx.DB
+	db queryer
 }
 
 // NewProductInfoRepository creates and returns a *ProductInfoRepository with the supplied database connection.
@@ -21,19 +21,37 @@ func NewProductInfoRepository(db *sqlx.DB) *ProductInfoRepository {
 
 // FindProductInfoByID finds a single product info by ID, returning an error if nothing is found.
 func (r *ProductInfoRepository) FindProductInfoByID(id string) (*domain.ProductInfo, error) {
-	var productInfo *domain.ProductInfo
-	err := r.db.Get(productInfo, "SELECT * FROM product_infos WHERE id=$1", id)
+	row := &productInfoRow{}
+	err := r.db.Get(row, "SELECT * FROM product_infos WHERE id=$1", id)
 	if err != nil {
 		return nil, err
 	}
 
-	return productInfo, nil
+	productInfo := row.productInfo()
+	return &productInfo, nil
+}
+
+// FindProductInfosByProductID finds all product infos for a product, ordered from oldest
+// to newest, returning an empty array if nothing is found.
+func (r *ProductInfoRepository) FindProductInfosByProductID(id string) ([]domain.ProductInfo, error) {
+	rows := []productInfoRow{}
+	err := r.db.Select(&rows, "SELECT * FROM product_infos WHERE product_id=$1 ORDER BY created_at", id)
+	if err != nil {
+		return nil, err
+	}
+
+	productInfos := []domain.ProductInfo{}
+	for _, row := range rows {
+		productInfos = append(productInfos, row.productInfo())
+	}
+
+	return productInfos, nil
 }
 
 // InsertProductInfo inserts a single product into the database, returning the ID on success.
 func (r *ProductInfoRepository) InsertProductInfo(productInfo domain.ProductInfo) (string, error) {
 	id := uuid.Generate()
-	_, err := r.db.Exec("INSERT INTO product_infos (id, created_at, product_id, product_location_id, price, availability_status, in_stock) VALUES ($1, $2, $3, $4, $5, $6, $7)", id, productInfo.CreatedAt, productInfo.ProductID, productInfo.ProductLocationID, productInfo.Price, productInfo.AvailabilityStatus, productInfo.InStock)
+	_, err := r.db.Exec("INSERT INTO product_infos (id, created_at, product_id, product_location_id, price, list_price, unit_price, unit_of_measure, availability_status, in_stock, seller_id, seller_name, third_party_seller, rating, review_count, free_shipping, in_store, online, preorder, shipping_options, store_id, zip_code, extraction_strategy, task_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24)", id, productInfo.CreatedAt, productInfo.ProductID, productInfo.ProductLocationID, productInfo.Price, productInfo.ListPrice, productInfo.UnitPrice, productInfo.UnitOfMeasure, productInfo.AvailabilityStatus, productInfo.InStock, productInfo.SellerID, productInfo.SellerName, productInfo.ThirdPartySeller, productInfo.Rating, productInfo.ReviewCount, productInfo.FreeShipping, productInfo.InStore, productInfo.Online, productInfo.Preorder, emptyIfNil(productInfo.ShippingOptions), productInfo.StoreID, productInfo.ZIPCode, productInfo.ExtractionStrategy, productInfo.TaskID)
 	if err != nil {
 		return "", err
 	}
@@ -41,9 +59,20 @@ func (r *ProductInfoRepository) InsertProductInfo(productInfo domain.ProductInfo
 	return id, nil
 }
 
+// MoveProductInfos moves all product infos recorded for a product location to another
+// product location and its product.
+func (r *ProductInfoRepository) MoveProductInfos(fromProductLocationID, toProductLocationID, toProductID string) error {
+	_, err := r.db.Exec("UPDATE product_infos SET product_location_id=$1, product_id=$2 WHERE product_location_id=$3", toProductLocationID, toProductID, fromProductLocationID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // UpdateProductInfo updates a single product info in the database by ID.
 func (r *ProductInfoRepository) UpdateProductInfo(productInfo domain.ProductInfo) error {
-	_, err := r.db.Exec("UPDATE product_infos SET created_at=$1, product_id=$2, product_location_id=$3, price=$4, availability_status=$5, in_stock=$6 WHERE id=$7", productInfo.CreatedAt, productInfo.ProductID, productInfo.ProductLocationID, productInfo.Price, productInfo.AvailabilityStatus, productInfo.InStock, productInfo.ID)
+	_, err := r.db.Exec("UPDATE product_infos SET created_at=$1, product_id=$2, product_location_id=$3, price=$4, list_price=$5, unit_price=$6, unit_of_measure=$7, availability_status=$8, in_stock=$9, seller_id=$10, seller_name=$11, third_party_seller=$12, rating=$13, review_count=$14, free_shipping=$15, in_store=$16, online=$17, preorder=$18, shipping_options=$19, store_id=$20, zip_code=$21, extraction_strategy=$22, task_id=$23 WHERE id=$24", productInfo.CreatedAt, productInfo.ProductID, productInfo.ProductLocationID, productInfo.Price, productInfo.ListPrice, productInfo.UnitPrice, productInfo.UnitOfMeasure, productInfo.AvailabilityStatus, productInfo.InStock, productInfo.SellerID, productInfo.SellerName, productInfo.ThirdPartySeller, productInfo.Rating, productInfo.ReviewCount, productInfo.FreeShipping, productInfo.InStore, productInfo.Online, productInfo.Preorder, emptyIfNil(productInfo.ShippingOptions), productInfo.StoreID, productInfo.ZIPCode, productInfo.ExtractionStrategy, productInfo.TaskID, productInfo.ID)
 	if err != nil {
 		return err
 	}
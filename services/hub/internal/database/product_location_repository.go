@@ -9,7 +9,7 @@ import (
 // A ProductLocationRepository provides methods for interacting with ProductLocations in the
 // database.
 type ProductLocationRepository struct {
-	db *sqlx.DB
+	db queryer
 }
 
 // NewProductLocationRepository creates and returns a *ProductLocationRepository with the supplied
@@ -33,8 +33,8 @@ func (r *ProductLocationRepository) FindProductLocationByID(id string) (*domain.
 // FindProductLocationsByProductID finds multiple product locations by product ID,
 // returning an empty array if nothing is found.
 func (r *ProductLocationRepository) FindProductLocationsByProductID(id string) ([]domain.ProductLocation, error) {
-	var productLocations []domain.ProductLocation
-	err := r.db.Select(productLocations, "SELECT * FROM product_locations WHERE product_id=$1", id)
+	productLocations := []domain.ProductLocation{}
+	err := r.db.Select(&productLocations, "SELECT * FROM product_locations WHERE product_id=$1", id)
 	if err != nil {
 		return nil, err
 	}
@@ -45,8 +45,8 @@ func (r *ProductLocationRepository) FindProductLocationsByProductID(id string) (
 // FindProductLocationsByLocationID finds multiple product locations by location ID,
 // returning an empty array if nothing is found.
 func (r *ProductLocationRepository) FindProductLocationsByLocationID(id string) ([]domain.ProductLocation, error) {
-	var productLocations []domain.ProductLocation
-	err := r.db.Select(productLocations, "SELECT * FROM product_locations WHERE location_id=$1", id)
+	productLocations := []domain.ProductLocation{}
+	err := r.db.Select(&productLocations, "SELECT * FROM product_locations WHERE location_id=$1", id)
 	if err != nil {
 		return nil, err
 	}
@@ -57,7 +57,7 @@ func (r *ProductLocationRepository) FindProductLocationsByLocationID(id string)
 // FindProductLocationByProductAndLocationID finds a single product location by both a product
 // and location ID, returning an error if nothing is found.
 func (r *ProductLocationRepository) FindProductLocationByProductAndLocationID(productID, locationID string) (*domain.ProductLocation, error) {
-	var productLocation *domain.ProductLocation
+	productLocation := &domain.ProductLocation{}
 	err := r.db.Get(productLocation, "SELECT * FROM product_locations WHERE product_id=$1 AND location_id=$2", productID, locationID)
 	if err != nil {
 		return nil, err
@@ -66,11 +66,37 @@ func (r *ProductLocationRepository) FindProductLocationByProductAndLocationID(pr
 	return productLocation, nil
 }
 
+// FindProductLocationByLocalID finds a single product location by its location ID and
+// the ID used by the location for it, returning an error if nothing is found.
+func (r *ProductLocationRepository) FindProductLocationByLocalID(locationID, localID string) (*domain.ProductLocation, error) {
+	productLocation := &domain.ProductLocation{}
+	err := r.db.Get(productLocation, "SELECT * FROM product_locations WHERE location_id=$1 AND local_id=$2 LIMIT 1", locationID, localID)
+	if err != nil {
+		return nil, err
+	}
+
+	return productLocation, nil
+}
+
+// FindDuplicateProductLocations finds every product location sharing its location ID and
+// local ID with another, ordered by location ID and local ID, then by the number of
+// product infos recorded for them, most first, returning an empty array if there are
+// none.
+func (r *ProductLocationRepository) FindDuplicateProductLocations() ([]domain.ProductLocation, error) {
+	productLocations := []domain.ProductLocation{}
+	err := r.db.Select(&productLocations, "SELECT product_locations.* FROM product_locations JOIN (SELECT location_id, local_id FROM product_locations WHERE local_id IS NOT NULL GROUP BY location_id, local_id HAVING COUNT(*) > 1) duplicates ON product_locations.location_id=duplicates.location_id AND product_locations.local_id=duplicates.local_id ORDER BY product_locations.location_id, product_locations.local_id, (SELECT COUNT(*) FROM product_infos WHERE product_infos.product_location_id=product_locations.id) DESC, product_locations.id")
+	if err != nil {
+		return nil, err
+	}
+
+	return productLocations, nil
+}
+
 // InsertProductLocation inserts a single product location into the database,
 // returning the ID on success.
 func (r *ProductLocationRepository) InsertProductLocation(productLocation domain.ProductLocation) (string, error) {
 	id := uuid.Generate()
-	_, err := r.db.Exec("INSERT INTO product_locations (id, name, location_id, product_id, local_id, url, slug, category_id, category) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)", id, productLocation.Name, productLocation.LocationID, productLocation.ProductID, productLocation.LocalID, productLocation.URL, productLocation.Slug, productLocation.CategoryID, productLocation.Category)
+	_, err := r.db.Exec("INSERT INTO product_locations (id, name, location_id, product_id, local_id, url, slug, category_id, category, variant) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)", id, productLocation.Name, productLocation.LocationID, productLocation.ProductID, productLocation.LocalID, productLocation.URL, productLocation.Slug, productLocation.CategoryID, productLocation.Category, productLocation.Variant)
 	if err != nil {
 		return "", err
 	}
@@ -78,9 +104,26 @@ func (r *ProductLocationRepository) InsertProductLocation(productLocation domain
 	return id, nil
 }
 
+// UpsertProductLocation inserts a single product location into the database, or updates
+// the details of the product location with the same location ID and local ID if there
+// is one, keeping its product and any details that are empty in `productLocation`. It
+// returns the ID of the product location and whether it was inserted.
+func (r *ProductLocationRepository) UpsertProductLocation(productLocation domain.ProductLocation) (string, bool, error) {
+	var result struct {
+		ID       string `db:"id"`
+		Inserted bool   `db:"inserted"`
+	}
+	err := r.db.Get(&result, "INSERT INTO product_locations (id, name, location_id, product_id, local_id, url, slug, category_id, category, variant) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) ON CONFLICT (location_id, local_id) DO UPDATE SET name=COALESCE(NULLIF(EXCLUDED.name, ''), product_locations.name), url=COALESCE(NULLIF(EXCLUDED.url, ''), product_locations.url), slug=COALESCE(NULLIF(EXCLUDED.slug, ''), product_locations.slug), category_id=COALESCE(NULLIF(EXCLUDED.category_id, ''), product_locations.category_id), category=COALESCE(NULLIF(EXCLUDED.category, ''), product_locations.category), variant=COALESCE(NULLIF(EXCLUDED.variant, ''), product_locations.variant) RETURNING id, (xmax = 0) AS inserted", uuid.Generate(), productLocation.Name, productLocation.LocationID, productLocation.ProductID, productLocation.LocalID, productLocation.URL, productLocation.Slug, productLocation.CategoryID, productLocation.Category, productLocation.Variant)
+	if err != nil {
+		return "", false, err
+	}
+
+	return result.ID, result.Inserted, nil
+}
+
 // UpdateProductLocation updates a single product location in the database by ID.
 func (r *ProductLocationRepository) UpdateProductLocation(productLocation domain.ProductLocation) error {
-	_, err := r.db.Exec("UPDATE product_locations SET location_id=$1, url=$2, slug=$3, category=$4 WHERE id=$5", productLocation.LocationID, productLocation.URL, productLocation.Slug, productLocation.Category, productLocation.ID)
+	_, err := r.db.Exec("UPDATE product_locations SET location_id=$1, url=$2, slug=$3, category=$4, variant=$5 WHERE id=$6", productLocation.LocationID, productLocation.URL, productLocation.Slug, productLocation.Category, productLocation.Variant, productLocation.ID)
 	if err != nil {
 		return err
 	}
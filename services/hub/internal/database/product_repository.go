@@ -9,7 +9,7 @@ import (
 // A ProductRepository provides methods for interacting with Products in the
 // database.
 type ProductRepository struct {
-	db *sqlx.DB
+	db queryer
 }
 
 // NewProductRepository creates and returns a *ProductRepository with the supplied
@@ -19,20 +19,21 @@ func NewProductRepository(db *sqlx.DB) *ProductRepository {
 }
 
 // FindProductByID finds a single product by ID, returning an error if nothing is found.
+// A product that isn't a variant has a NULL parent_id, read as an empty ParentID.
 func (r *ProductRepository) FindProductByID(id string) (*domain.Product, error) {
-	var product *domain.Product
-	err := r.db.Get(product, "SELECT * FROM products WHERE id=$1", id)
+	row := &productRow{}
+	err := r.db.Get(row, "SELECT id, common_name, brand, manufacturer, upc, image_urls, COALESCE(parent_id::text, '') AS parent_id FROM products WHERE id=$1", id)
 	if err != nil {
 		return nil, err
 	}
 
-	return product, nil
+	return row.product(), nil
 }
 
 // InsertProduct inserts a single product into the database, returning the ID on success.
 func (r *ProductRepository) InsertProduct(product domain.Product) (string, error) {
 	id := uuid.Generate()
-	_, err := r.db.Exec("INSERT INTO products (id, common_name) VALUES ($1, $2)", id, product.CommonName)
+	_, err := r.db.Exec("INSERT INTO products (id, common_name, brand, manufacturer, upc, image_urls, parent_id) VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, '')::uuid)", id, product.CommonName, product.Brand, product.Manufacturer, product.UPC, emptyIfNil(product.ImageURLs), product.ParentID)
 	if err != nil {
 		return "", err
 	}
@@ -42,7 +43,19 @@ func (r *ProductRepository) InsertProduct(product domain.Product) (string, error
 
 // UpdateProduct updates a single product in the database by ID.
 func (r *ProductRepository) UpdateProduct(product domain.Product) error {
-	_, err := r.db.Exec("UPDATE products SET common_name = $1 WHERE id = $2", product.CommonName, product.ID)
+	_, err := r.db.Exec("UPDATE products SET common_name = $1, brand = $2, manufacturer = $3, upc = $4, image_urls = $5, parent_id = NULLIF($6, '')::uuid WHERE id = $7", product.CommonName, product.Brand, product.Manufacturer, product.UPC, emptyIfNil(product.ImageURLs), product.ParentID, product.ID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// MoveProductVariants makes all variants of a product variants of another product.
+// The parameters are cast to UUIDs so that it also works before migration 000021, when
+// dedup-products runs.
+func (r *ProductRepository) MoveProductVariants(fromParentID, toParentID string) error {
+	_, err := r.db.Exec("UPDATE products SET parent_id=$1 WHERE parent_id=$2 AND id<>$1::uuid", toParentID, fromParentID)
 	if err != nil {
 		return err
 	}
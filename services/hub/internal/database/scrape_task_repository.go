@@ -2,6 +2,7 @@ package database
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/bfoody/Walmart-Scraper/domain"
 	"github.com/bfoody/Walmart-Scraper/utils/uuid"
@@ -11,7 +12,7 @@ import (
 // A ScrapeTaskRepository provides methods for interacting with ScrapeTasks in
 // the database.
 type ScrapeTaskRepository struct {
-	db *sqlx.DB
+	db queryer
 }
 
 // NewScrapeTaskRepository creates and returns a *ScrapeTaskRepository from the supplied
@@ -45,6 +46,18 @@ func (r *ScrapeTaskRepository) FindUpcomingScrapeTasks(limit uint16) ([]domain.S
 	return scrapeTasks, nil
 }
 
+// FindScrapeTasksCreatedSince finds scrape tasks created after the supplied time, ordered
+// by creation time, returning a blank array if nothing is found.
+func (r *ScrapeTaskRepository) FindScrapeTasksCreatedSince(since time.Time) ([]domain.ScrapeTask, error) {
+	scrapeTasks := []domain.ScrapeTask{}
+	err := r.db.Select(&scrapeTasks, "SELECT * FROM scrape_tasks WHERE created_at>$1 ORDER BY created_at", since)
+	if err != nil {
+		return nil, err
+	}
+
+	return scrapeTasks, nil
+}
+
 // FindScrapeTasksByProductLocationID finds scrape tasks by ProductLocationID, returning a
 // blank array if nothing is found.
 func (r *ScrapeTaskRepository) FindScrapeTasksByProductLocationID(id string) ([]domain.ScrapeTask, error) {
@@ -84,7 +97,7 @@ func (r *ScrapeTaskRepository) FindScrapeTasksByLocationID(id string) ([]domain.
 // InsertScrapeTask inserts a single scrape task into the database, returning the ID on success.
 func (r *ScrapeTaskRepository) InsertScrapeTask(scrapeTask domain.ScrapeTask) (string, error) {
 	id := uuid.Generate()
-	_, err := r.db.Exec("INSERT INTO scrape_tasks (id, completed, created_at, scheduled_for, product_location_id, repeat, interval) VALUES ($1, $2, $3, $4, $5, $6, $7)", id, scrapeTask.Completed, scrapeTask.CreatedAt, scrapeTask.ScheduledFor, scrapeTask.ProductLocationID, scrapeTask.Repeat, scrapeTask.Interval)
+	_, err := r.db.Exec("INSERT INTO scrape_tasks (id, completed, created_at, scheduled_for, product_location_id, repeat, interval, store_id, zip_code) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)", id, scrapeTask.Completed, scrapeTask.CreatedAt, scrapeTask.ScheduledFor, scrapeTask.ProductLocationID, scrapeTask.Repeat, scrapeTask.Interval, scrapeTask.StoreID, scrapeTask.ZIPCode)
 	if err != nil {
 		return "", err
 	}
@@ -92,9 +105,31 @@ func (r *ScrapeTaskRepository) InsertScrapeTask(scrapeTask domain.ScrapeTask) (s
 	return id, nil
 }
 
+// MoveScrapeTasks moves all scrape tasks for a product location to another product
+// location.
+func (r *ScrapeTaskRepository) MoveScrapeTasks(fromProductLocationID, toProductLocationID string) error {
+	_, err := r.db.Exec("UPDATE scrape_tasks SET product_location_id=$1 WHERE product_location_id=$2", toProductLocationID, fromProductLocationID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteDuplicateScrapeTasks deletes the pending scrape tasks for a product location
+// scheduled after another pending task for the same store, keeping the earliest.
+func (r *ScrapeTaskRepository) DeleteDuplicateScrapeTasks(productLocationID string) error {
+	_, err := r.db.Exec("DELETE FROM scrape_tasks WHERE product_location_id=$1 AND completed=FALSE AND id NOT IN (SELECT DISTINCT ON (store_id, zip_code) id FROM scrape_tasks WHERE product_location_id=$1 AND completed=FALSE ORDER BY store_id, zip_code, scheduled_for)", productLocationID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // UpdateScrapeTask updates a single scrape task in the database by ID.
 func (r *ScrapeTaskRepository) UpdateScrapeTask(scrapeTask domain.ScrapeTask) error {
-	_, err := r.db.Exec("UPDATE scrape_tasks SET completed=$1, created_at=$2, scheduled_for=$3, product_location_id=$4, repeat=$5, interval=$6 WHERE id=$7", scrapeTask.Completed, scrapeTask.CreatedAt, scrapeTask.ScheduledFor, scrapeTask.ProductLocationID, scrapeTask.Repeat, scrapeTask.Interval, scrapeTask.ID)
+	_, err := r.db.Exec("UPDATE scrape_tasks SET completed=$1, created_at=$2, scheduled_for=$3, product_location_id=$4, repeat=$5, interval=$6, store_id=$7, zip_code=$8 WHERE id=$9", scrapeTask.Completed, scrapeTask.CreatedAt, scrapeTask.ScheduledFor, scrapeTask.ProductLocationID, scrapeTask.Repeat, scrapeTask.Interval, scrapeTask.StoreID, scrapeTask.ZIPCode, scrapeTask.ID)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/bfoody/Walmart-Scraper/services/hub"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	// maxTransactionAttempts is the most times a unit of work is attempted when its
+	// transaction fails to serialize.
+	maxTransactionAttempts = 5
+	// transactionRetryDelay is the delay before the first retry of a unit of work, which
+	// doubles with each retry.
+	transactionRetryDelay = 10 * time.Millisecond
+)
+
+// A queryer runs queries on either a database connection or a transaction, so that
+// repositories can be used in both.
+type queryer interface {
+	Get(dest interface{}, query string, args ...interface{}) error
+	Select(dest interface{}, query string, args ...interface{}) error
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// A UnitOfWork runs operations across multiple repositories in a single serializable
+// transaction.
+type UnitOfWork struct {
+	db *sqlx.DB
+}
+
+// NewUnitOfWork creates and returns a *UnitOfWork from the supplied database connection.
+func NewUnitOfWork(db *sqlx.DB) *UnitOfWork {
+	return &UnitOfWork{
+		db,
+	}
+}
+
+// Do calls `fn` with repositories running in a single transaction, committing it if
+// `fn` returns nil and rolling it back otherwise. If the transaction fails to serialize
+// with a concurrent one, it is retried, calling `fn` again. The transaction is rolled
+// back if `ctx` is done before it is committed.
+func (u *UnitOfWork) Do(ctx context.Context, fn func(repositories hub.Repositories) error) error {
+	return retrySerializationFailures(ctx, func() error {
+		return u.do(ctx, fn)
+	})
+}
+
+// do runs a single attempt of a unit of work.
+func (u *UnitOfWork) do(ctx context.Context, fn func(repositories hub.Repositories) error) error {
+	tx, err := u.db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+
+	if err := fn(newRepositories(tx)); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// newRepositories returns repositories running queries with the supplied connection or
+// transaction.
+func newRepositories(db queryer) hub.Repositories {
+	return hub.Repositories{
+		Locations:        &LocationRepository{db},
+		Products:         &ProductRepository{db},
+		ProductInfos:     &ProductInfoRepository{db},
+		ProductLocations: &ProductLocationRepository{db},
+		ScrapeTasks:      &ScrapeTaskRepository{db},
+		CrawlTasks:       &CrawlTaskRepository{db},
+		DiscoveryTasks:   &DiscoveryTaskRepository{db},
+		Offers:           &OfferRepository{db},
+	}
+}
+
+// retrySerializationFailures calls `fn` until it doesn't fail to serialize, up to
+// maxTransactionAttempts times, backing off between attempts.
+func retrySerializationFailures(ctx context.Context, fn func() error) error {
+	delay := transactionRetryDelay
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= maxTransactionAttempts || !isSerializationFailure(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+	}
+}
+
+// isSerializationFailure returns true if a transaction failed because it couldn't be
+// serialized with, or deadlocked on, a concurrent one, in which case it can be retried.
+func isSerializationFailure(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+
+	return pqErr.Code == "40001" || pqErr.Code == "40P01"
+}
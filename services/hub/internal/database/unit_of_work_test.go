@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestRetrySerializationFailures(t *testing.T) {
+	serializationFailure := fmt.Errorf("error committing: %w", &pq.Error{Code: "40001"})
+
+	attempts := 0
+	err := retrySerializationFailures(context.Background(), func() error {
+		attempts++
+		if attempts < 3 {
+			return serializationFailure
+		}
+
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Fatalf("expected success after 3 attempts, got %v after %d", err, attempts)
+	}
+
+	attempts = 0
+	err = retrySerializationFailures(context.Background(), func() error {
+		attempts++
+		return serializationFailure
+	})
+	if !errors.Is(err, serializationFailure) || attempts != maxTransactionAttempts {
+		t.Fatalf("expected to give up after %d attempts, got %v after %d", maxTransactionAttempts, err, attempts)
+	}
+
+	// Other errors, such as constraint violations, aren't retried.
+	attempts = 0
+	uniqueViolation := &pq.Error{Code: "23505"}
+	err = retrySerializationFailures(context.Background(), func() error {
+		attempts++
+		return uniqueViolation
+	})
+	if err != uniqueViolation || attempts != 1 {
+		t.Fatalf("expected no retries of other errors, got %v after %d attempts", err, attempts)
+	}
+
+	// A cancelled context stops retries.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	attempts = 0
+	err = retrySerializationFailures(ctx, func() error {
+		attempts++
+		return serializationFailure
+	})
+	if !errors.Is(err, serializationFailure) || attempts != 1 {
+		t.Fatalf("expected no retries once the context is done, got %v after %d attempts", err, attempts)
+	}
+}
@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "hub"
+
+var (
+	// ConnectedClients is the number of clients currently registered with the Supervisor.
+	ConnectedClients = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "connected_clients",
+		Help:      "Number of clients currently registered with the supervisor.",
+	})
+
+	// QueueDepth is the number of tasks in the TaskManager's queue.
+	QueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "task_queue_depth",
+		Help:      "Number of tasks in the task manager's queue.",
+	})
+
+	// TasksDispatched counts scrape tasks sent to clients.
+	TasksDispatched = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tasks_dispatched_total",
+		Help:      "Number of scrape tasks sent to clients.",
+	})
+
+	// TasksCompleted counts scrape tasks whose results were saved.
+	TasksCompleted = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tasks_completed_total",
+		Help:      "Number of scrape tasks whose results were saved.",
+	})
+
+	// DuplicateResults counts results received for scrape tasks that were already
+	// completed, which are ignored.
+	DuplicateResults = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "duplicate_results_total",
+		Help:      "Number of results received for scrape tasks that were already completed.",
+	})
+
+	// TasksFailed counts tasks clients gave up on by reason, eg. "blocked".
+	TasksFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tasks_failed_total",
+		Help:      "Number of tasks clients gave up on by reason.",
+	}, []string{"reason"})
+
+	// DispatchRate is the current dispatch rate of each retailer, in tasks per second,
+	// which is lowered while clients are blocked or rate limited.
+	DispatchRate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "dispatch_rate",
+		Help:      "Current dispatch rate of each retailer in tasks per second.",
+	}, []string{"retailer"})
+
+	// TasksExpired counts dispatched scrape tasks that never received a result.
+	TasksExpired = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tasks_expired_total",
+		Help:      "Number of dispatched scrape tasks that never received a result.",
+	})
+
+	// InfoRetrievedLatency observes the time between dispatching a task and saving its result.
+	InfoRetrievedLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "info_retrieved_latency_seconds",
+		Help:      "Time between dispatching a scrape task and saving its result.",
+		Buckets:   []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	})
+
+	// DBErrors counts failed database operations, labeled by operation.
+	DBErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_errors_total",
+		Help:      "Number of failed database operations.",
+	}, []string{"operation"})
+
+	// CrawlDiscoveries counts new products discovered by crawling.
+	CrawlDiscoveries = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "crawl_discoveries_total",
+		Help:      "Number of new products discovered by crawling.",
+	})
+
+	// DiscoveriesDispatched counts discovery tasks sent to clients.
+	DiscoveriesDispatched = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "discoveries_dispatched_total",
+		Help:      "Number of discovery tasks sent to clients.",
+	})
+
+	// DiscoveredProducts counts new products discovered by searches and category pages.
+	DiscoveredProducts = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "discovered_products_total",
+		Help:      "Number of new products discovered by searches and category pages.",
+	})
+
+	// TrackedVariants counts new product variants discovered on product pages.
+	TrackedVariants = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tracked_variants_total",
+		Help:      "Number of new product variants discovered on product pages.",
+	})
+)
@@ -1,36 +1,53 @@
 package service
 
 import (
+	"context"
+	"database/sql"
 	"errors"
+	"fmt"
+	"reflect"
+	"strings"
 	"time"
 
 	"github.com/bfoody/Walmart-Scraper/domain"
 	"github.com/bfoody/Walmart-Scraper/services/hub"
 )
 
+// errProductTracked rolls back tracking a product found to be tracked already.
+var errProductTracked = errors.New("product already tracked")
+
 // A Service handles storage and retrieval of Product information, as well as tasks.
 type Service struct {
+	locationRepository        hub.LocationRepository
 	productRepository         hub.ProductRepository
 	productInfoRepository     hub.ProductInfoRepository
 	productLocationRepository hub.ProductLocationRepository
 	scrapeTaskRepository      hub.ScrapeTaskRepository
 	crawlTaskRepository       hub.CrawlTaskRepository
+	discoveryTaskRepository   hub.DiscoveryTaskRepository
+	unitOfWork                hub.UnitOfWork
 }
 
 // NewService creates and returns a *Service with the provided dependencies.
 func NewService(
+	locationRepository hub.LocationRepository,
 	productRepository hub.ProductRepository,
 	productInfoRepository hub.ProductInfoRepository,
 	productLocationRepository hub.ProductLocationRepository,
 	scrapeTaskRepository hub.ScrapeTaskRepository,
 	crawlTaskRepository hub.CrawlTaskRepository,
+	discoveryTaskRepository hub.DiscoveryTaskRepository,
+	unitOfWork hub.UnitOfWork,
 ) *Service {
 	return &Service{
+		locationRepository,
 		productRepository,
 		productInfoRepository,
 		productLocationRepository,
 		scrapeTaskRepository,
 		crawlTaskRepository,
+		discoveryTaskRepository,
+		unitOfWork,
 	}
 }
 
@@ -44,93 +61,383 @@ func (s *Service) FetchUpcomingTasks(limit uint16) ([]domain.ScrapeTask, error)
 	return s.scrapeTaskRepository.FindUpcomingScrapeTasks(limit)
 }
 
+// FetchTasksCreatedSince fetches all tasks created after the supplied time.
+func (s *Service) FetchTasksCreatedSince(since time.Time) ([]domain.ScrapeTask, error) {
+	return s.scrapeTaskRepository.FindScrapeTasksCreatedSince(since)
+}
+
+// GetProductByID gets a single Product using the ID.
+func (s *Service) GetProductByID(id string) (*domain.Product, error) {
+	return s.productRepository.FindProductByID(id)
+}
+
 // GetProductLocationByID gets a single ProductLocation using the ID.
 func (s *Service) GetProductLocationByID(id string) (*domain.ProductLocation, error) {
 	return s.productLocationRepository.FindProductLocationByID(id)
 }
 
-// ResolveTask marks the task with the provided ID as completed.
-func (s *Service) ResolveTask(id string, newCallback func(st domain.ScrapeTask)) error {
-	st, err := s.scrapeTaskRepository.FindScrapeTaskByID(id)
-	if err != nil {
-		return err
-	}
+// GetProductLocationsByProductID gets all ProductLocations for a single Product.
+func (s *Service) GetProductLocationsByProductID(productID string) ([]domain.ProductLocation, error) {
+	return s.productLocationRepository.FindProductLocationsByProductID(productID)
+}
 
-	st.Completed = true
+// GetProductLocationByLocalID gets a single ProductLocation using its Location's ID and
+// the ID used by the Location for it.
+func (s *Service) GetProductLocationByLocalID(locationID, localID string) (*domain.ProductLocation, error) {
+	return s.productLocationRepository.FindProductLocationByLocalID(locationID, localID)
+}
 
-	err = s.scrapeTaskRepository.UpdateScrapeTask(*st)
-	if err != nil {
-		return err
-	}
+// GetPriceHistory gets all ProductInfos recorded for a single Product, oldest first.
+func (s *Service) GetPriceHistory(productID string) ([]domain.ProductInfo, error) {
+	return s.productInfoRepository.FindProductInfosByProductID(productID)
+}
 
-	// If repeat is disabled, exit without rescheduling.
-	if !st.Repeat {
-		return nil
-	}
+// CompleteTask saves the ProductInfo and Offers retrieved for a task, marks it as
+// completed and schedules its next repetition atomically, calling `newCallback` with
+// the next task, if any. Offers missing a required field are dropped rather than
+// failing the task. It returns the ID of the ProductInfo, or hub.ErrTaskCompleted
+// without saving anything if the task was already completed.
+func (s *Service) CompleteTask(ctx context.Context, id string, productInfo domain.ProductInfo, offers []domain.Offer, newCallback func(st domain.ScrapeTask)) (string, error) {
+	productInfo.CreatedAt = time.Now()
+	productInfo.TaskID = id
 
-	newSt := domain.ScrapeTask{
-		ID:                "",
-		Completed:         false,
-		CreatedAt:         time.Now(),
-		ScheduledFor:      time.Now().Add(st.Interval),
-		ProductLocationID: st.ProductLocationID,
-		Repeat:            st.Repeat,
-		Interval:          st.Interval,
+	if err := validateProductInfo(productInfo); err != nil {
+		return "", err
 	}
 
-	_, err = s.scrapeTaskRepository.InsertScrapeTask(newSt)
+	var productInfoID string
+	var next *domain.ScrapeTask
+	err := s.unitOfWork.Do(ctx, func(repositories hub.Repositories) error {
+		next = nil
+
+		st, err := repositories.ScrapeTasks.FindScrapeTaskByID(id)
+		if err != nil {
+			return err
+		}
+
+		if st.Completed {
+			return hub.ErrTaskCompleted
+		}
+
+		productInfoID, err = repositories.ProductInfos.InsertProductInfo(productInfo)
+		if err != nil {
+			return err
+		}
+
+		for _, offer := range offers {
+			if validateOffer(offer) != nil {
+				continue
+			}
+
+			offer.ProductInfoID = productInfoID
+
+			if _, err := repositories.Offers.InsertOffer(offer); err != nil {
+				return err
+			}
+		}
+
+		st.Completed = true
+
+		err = repositories.ScrapeTasks.UpdateScrapeTask(*st)
+		if err != nil {
+			return err
+		}
+
+		// If repeat is disabled, exit without rescheduling.
+		if !st.Repeat {
+			return nil
+		}
+
+		task := st.Next(time.Now())
+		task.ID, err = repositories.ScrapeTasks.InsertScrapeTask(task)
+		if err != nil {
+			return err
+		}
+
+		next = &task
+
+		return nil
+	})
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	newCallback(newSt)
+	if next != nil {
+		newCallback(*next)
+	}
 
-	return nil
+	return productInfoID, nil
 }
 
 // SaveProductInfo saves a new ProductInfo to the database, returning the ID on success.
 func (s *Service) SaveProductInfo(productInfo domain.ProductInfo) (string, error) {
 	productInfo.CreatedAt = time.Now()
 
+	if err := validateProductInfo(productInfo); err != nil {
+		return "", err
+	}
+
+	return s.productInfoRepository.InsertProductInfo(productInfo)
+}
+
+// validateProductInfo returns an error if a ProductInfo is missing a required field.
+func validateProductInfo(productInfo domain.ProductInfo) error {
 	if productInfo.ProductID == "" {
-		return "", errors.New("ProductID must not be null")
+		return errors.New("ProductID must not be null")
 	}
 
 	if productInfo.ProductLocationID == "" {
-		return "", errors.New("ProductLocationID must not be null")
+		return errors.New("ProductLocationID must not be null")
 	}
 
 	if productInfo.AvailabilityStatus == "" {
-		return "", errors.New("AvailabilityStatus must not be null")
+		return errors.New("AvailabilityStatus must not be null")
 	}
 
-	return s.productInfoRepository.InsertProductInfo(productInfo)
+	return nil
+}
+
+// validateOffer returns an error if an Offer is missing a required field.
+func validateOffer(offer domain.Offer) error {
+	if offer.AvailabilityStatus == "" {
+		return errors.New("AvailabilityStatus must not be null")
+	}
+
+	return nil
 }
 
 // SaveProduct saves a new Product to the database, returning the ID on success.
 func (s *Service) SaveProduct(product domain.Product) (string, error) {
-	if product.CommonName == "" {
-		return "", errors.New("CommonName must not be null")
+	if err := validateProduct(product); err != nil {
+		return "", err
 	}
 
 	return s.productRepository.InsertProduct(product)
 }
 
-// SaveProductLocation saves a ProductLocation to the database.
+// validateProduct returns an error if a Product is missing a required field.
+func validateProduct(product domain.Product) error {
+	if product.CommonName == "" {
+		return errors.New("CommonName must not be null")
+	}
+
+	return nil
+}
+
+// UpdateProductDetails fills in the details of a Product, such as its brand and UPC,
+// from those scraped along with its info, keeping its name. Details that weren't
+// scraped are left unchanged.
+func (s *Service) UpdateProductDetails(productID string, details domain.Product) error {
+	product, err := s.productRepository.FindProductByID(productID)
+	if err != nil {
+		return err
+	}
+
+	updated := *product
+	if details.Brand != "" {
+		updated.Brand = details.Brand
+	}
+
+	if details.Manufacturer != "" {
+		updated.Manufacturer = details.Manufacturer
+	}
+
+	if details.UPC != "" {
+		updated.UPC = details.UPC
+	}
+
+	if len(details.ImageURLs) > 0 {
+		updated.ImageURLs = details.ImageURLs
+	}
+
+	if reflect.DeepEqual(updated, *product) {
+		return nil
+	}
+
+	return s.productRepository.UpdateProduct(updated)
+}
+
+// TrackProduct saves a Product found at a Location along with its ProductLocation and
+// a ScrapeTask for it atomically, returning the saved ScrapeTask, or nil if the
+// product is already tracked at the Location. The IDs linking them are filled in.
+func (s *Service) TrackProduct(ctx context.Context, product domain.Product, productLocation domain.ProductLocation, scrapeTask domain.ScrapeTask) (*domain.ScrapeTask, error) {
+	if err := validateProduct(product); err != nil {
+		return nil, err
+	}
+
+	var tracked *domain.ScrapeTask
+	err := s.unitOfWork.Do(ctx, func(repositories hub.Repositories) error {
+		tracked = nil
+
+		_, err := repositories.ProductLocations.FindProductLocationByLocalID(productLocation.LocationID, productLocation.LocalID)
+		if err == nil {
+			return nil
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		pl := productLocation
+		pl.ProductID, err = repositories.Products.InsertProduct(product)
+		if err != nil {
+			return err
+		}
+
+		if err := validateProductLocation(pl); err != nil {
+			return err
+		}
+
+		st := scrapeTask
+		var inserted bool
+		st.ProductLocationID, inserted, err = repositories.ProductLocations.UpsertProductLocation(pl)
+		if err != nil {
+			return err
+		}
+
+		if !inserted {
+			// Tracked concurrently, roll back the product.
+			return errProductTracked
+		}
+
+		st.ID, err = repositories.ScrapeTasks.InsertScrapeTask(st)
+		if err != nil {
+			return err
+		}
+
+		tracked = &st
+
+		return nil
+	})
+	if errors.Is(err, errProductTracked) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return tracked, nil
+}
+
+// SaveProductLocation saves a ProductLocation to the database, or updates the details
+// of the ProductLocation with the same Location and local ID if there is one, returning
+// the ID on success.
 func (s *Service) SaveProductLocation(productLocation domain.ProductLocation) (string, error) {
+	if err := validateProductLocation(productLocation); err != nil {
+		return "", err
+	}
+
+	id, _, err := s.productLocationRepository.UpsertProductLocation(productLocation)
+	return id, err
+}
+
+// MergeDuplicateProductLocations merges ProductLocations sharing their Location and
+// local ID into the one with the most ProductInfos, moving their ProductInfos,
+// ScrapeTasks and CrawlTasks to it, and returns the merges. Each product is merged in
+// its own transaction, so merges made before an error are kept. If `dryRun` is true,
+// the merges are returned without being made.
+func (s *Service) MergeDuplicateProductLocations(ctx context.Context, dryRun bool) ([]hub.ProductLocationMerge, error) {
+	duplicates, err := s.productLocationRepository.FindDuplicateProductLocations()
+	if err != nil {
+		return nil, err
+	}
+
+	merges := []hub.ProductLocationMerge{}
+	for i := 0; i < len(duplicates); {
+		// Duplicates are grouped by location and local ID, the survivor first.
+		survivor := duplicates[i]
+		group := []domain.ProductLocation{}
+		for i++; i < len(duplicates) && duplicates[i].LocationID == survivor.LocationID && duplicates[i].LocalID == survivor.LocalID; i++ {
+			group = append(group, duplicates[i])
+		}
+
+		merge := hub.ProductLocationMerge{
+			LocationID:   survivor.LocationID,
+			LocalID:      survivor.LocalID,
+			SurvivorID:   survivor.ID,
+			DuplicateIDs: []string{},
+		}
+		for _, duplicate := range group {
+			merge.DuplicateIDs = append(merge.DuplicateIDs, duplicate.ID)
+		}
+
+		if !dryRun {
+			err := s.unitOfWork.Do(ctx, func(repositories hub.Repositories) error {
+				for _, duplicate := range group {
+					if err := mergeProductLocation(repositories, survivor, duplicate); err != nil {
+						return err
+					}
+				}
+
+				// Each duplicate came with its own repeating tasks.
+				return repositories.ScrapeTasks.DeleteDuplicateScrapeTasks(survivor.ID)
+			})
+			if err != nil {
+				return merges, fmt.Errorf("error merging product %s at location %s: %w", survivor.LocalID, survivor.LocationID, err)
+			}
+		}
+
+		merges = append(merges, merge)
+	}
+
+	return merges, nil
+}
+
+// mergeProductLocation moves everything referencing a duplicate ProductLocation to its
+// survivor within a unit of work, then deletes the duplicate, along with its Product if
+// nothing else uses it.
+func mergeProductLocation(repositories hub.Repositories, survivor, duplicate domain.ProductLocation) error {
+	if err := repositories.ProductInfos.MoveProductInfos(duplicate.ID, survivor.ID, survivor.ProductID); err != nil {
+		return err
+	}
+
+	if err := repositories.ScrapeTasks.MoveScrapeTasks(duplicate.ID, survivor.ID); err != nil {
+		return err
+	}
+
+	if err := repositories.CrawlTasks.MoveCrawlTasks(duplicate.ID, survivor.ID); err != nil {
+		return err
+	}
+
+	if err := repositories.ProductLocations.DeleteProductLocation(duplicate.ID); err != nil {
+		return err
+	}
+
+	if duplicate.ProductID == survivor.ProductID {
+		return nil
+	}
+
+	if err := repositories.Products.MoveProductVariants(duplicate.ProductID, survivor.ProductID); err != nil {
+		return err
+	}
+
+	remaining, err := repositories.ProductLocations.FindProductLocationsByProductID(duplicate.ProductID)
+	if err != nil {
+		return err
+	}
+
+	if len(remaining) > 0 {
+		// Still tracked at another location.
+		return nil
+	}
+
+	return repositories.Products.DeleteProduct(duplicate.ProductID)
+}
+
+// validateProductLocation returns an error if a ProductLocation is missing a required
+// field.
+func validateProductLocation(productLocation domain.ProductLocation) error {
 	if productLocation.LocalID == "" {
-		return "", errors.New("LocalID must not be null")
+		return errors.New("LocalID must not be null")
 	}
 
 	if productLocation.LocationID == "" {
-		return "", errors.New("LocationID must not be null")
+		return errors.New("LocationID must not be null")
 	}
 
 	if productLocation.ProductID == "" {
-		return "", errors.New("ProductID must not be null")
+		return errors.New("ProductID must not be null")
 	}
 
-	return s.productLocationRepository.InsertProductLocation(productLocation)
+	return nil
 }
 
 // IsCrawled returns true if an item was already crawled.
@@ -148,3 +455,126 @@ func (s *Service) SaveCrawlTask(productLocationId string) (string, error) {
 		OriginProductLocationID: productLocationId,
 	})
 }
+
+// RegisterLocation saves a new Location to the database, returning the ID on success.
+func (s *Service) RegisterLocation(location domain.Location) (string, error) {
+	if location.Name == "" {
+		return "", errors.New("Name must not be null")
+	}
+
+	if !domain.IsKnownRetailer(location.Retailer) {
+		return "", fmt.Errorf("unknown retailer %q", location.Retailer)
+	}
+
+	if location.BaseURL == "" {
+		return "", errors.New("BaseURL must not be null")
+	}
+
+	return s.locationRepository.InsertLocation(location)
+}
+
+// GetLocationByID gets a single Location using the ID.
+func (s *Service) GetLocationByID(id string) (*domain.Location, error) {
+	return s.locationRepository.FindLocationByID(id)
+}
+
+// GetLocations gets all registered Locations.
+func (s *Service) GetLocations() ([]domain.Location, error) {
+	return s.locationRepository.FindLocations()
+}
+
+// CheckLocations returns an error if any ProductLocations reference a Location that
+// doesn't exist, or any Location uses an unknown retailer.
+func (s *Service) CheckLocations() error {
+	missing, err := s.locationRepository.FindMissingLocationIDs()
+	if err != nil {
+		return err
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("product locations reference missing locations: %s", strings.Join(missing, ", "))
+	}
+
+	locations, err := s.locationRepository.FindLocations()
+	if err != nil {
+		return err
+	}
+
+	for _, location := range locations {
+		if !domain.IsKnownRetailer(location.Retailer) {
+			return fmt.Errorf("location %s (%s) uses unknown retailer %q", location.ID, location.Name, location.Retailer)
+		}
+	}
+
+	return nil
+}
+
+// CreateDiscoveryTask creates a new discovery task using the provided object,
+// returning the ID on success.
+func (s *Service) CreateDiscoveryTask(discoveryTask domain.DiscoveryTask) (string, error) {
+	if !domain.IsDiscoveryKind(discoveryTask.Kind) {
+		return "", fmt.Errorf("unknown discovery kind %q", discoveryTask.Kind)
+	}
+
+	if discoveryTask.Query == "" {
+		return "", errors.New("Query must not be null")
+	}
+
+	if discoveryTask.MaxPages < 1 {
+		return "", errors.New("MaxPages must be at least 1")
+	}
+
+	if discoveryTask.Interval <= 0 {
+		return "", errors.New("Interval must be positive")
+	}
+
+	location, err := s.locationRepository.FindLocationByID(discoveryTask.LocationID)
+	if err != nil {
+		return "", fmt.Errorf("error finding location %s: %w", discoveryTask.LocationID, err)
+	}
+
+	if !domain.CanDiscover(location.Retailer) {
+		return "", fmt.Errorf("location %s uses retailer %q, which doesn't support discovery", location.ID, location.Retailer)
+	}
+
+	discoveryTask.CreatedAt = time.Now()
+
+	return s.discoveryTaskRepository.InsertDiscoveryTask(discoveryTask)
+}
+
+// GetDiscoveryTaskByID gets a single DiscoveryTask using the ID.
+func (s *Service) GetDiscoveryTaskByID(id string) (*domain.DiscoveryTask, error) {
+	return s.discoveryTaskRepository.FindDiscoveryTaskByID(id)
+}
+
+// GetDiscoveryTasks gets all DiscoveryTasks, ordered by when they are next to be run.
+func (s *Service) GetDiscoveryTasks() ([]domain.DiscoveryTask, error) {
+	return s.discoveryTaskRepository.FindDiscoveryTasks()
+}
+
+// FetchDueDiscoveryTasks fetches the DiscoveryTasks due to be run, scheduling each
+// of them for their next run.
+func (s *Service) FetchDueDiscoveryTasks() ([]domain.DiscoveryTask, error) {
+	now := time.Now()
+
+	due, err := s.discoveryTaskRepository.FindDueDiscoveryTasks(now)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dt := range due {
+		dt.ScheduledFor = now.Add(dt.Interval)
+
+		err := s.discoveryTaskRepository.UpdateDiscoveryTask(dt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return due, nil
+}
+
+// DeleteDiscoveryTask deletes a single DiscoveryTask using the ID.
+func (s *Service) DeleteDiscoveryTask(id string) error {
+	return s.discoveryTaskRepository.DeleteDiscoveryTask(id)
+}
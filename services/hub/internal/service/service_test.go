@@ -0,0 +1,448 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/bfoody/Walmart-Scraper/domain"
+	"github.com/bfoody/Walmart-Scraper/services/hub"
+)
+
+// A memoryStore holds the rows of the fake repositories.
+type memoryStore struct {
+	lastID           int
+	products         map[string]domain.Product
+	productLocations map[string]domain.ProductLocation
+	productInfos     map[string]domain.ProductInfo
+	offers           map[string]domain.Offer
+	scrapeTasks      map[string]domain.ScrapeTask
+	crawlTasks       map[string]domain.CrawlTask
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		products:         map[string]domain.Product{},
+		productLocations: map[string]domain.ProductLocation{},
+		productInfos:     map[string]domain.ProductInfo{},
+		offers:           map[string]domain.Offer{},
+		scrapeTasks:      map[string]domain.ScrapeTask{},
+		crawlTasks:       map[string]domain.CrawlTask{},
+	}
+}
+
+func (m *memoryStore) id(prefix string) string {
+	m.lastID++
+	return fmt.Sprintf("%s-%d", prefix, m.lastID)
+}
+
+// repositories returns fake repositories backed by the store.
+func (m *memoryStore) repositories() hub.Repositories {
+	return hub.Repositories{
+		Products:         &memoryProducts{store: m},
+		ProductLocations: &memoryProductLocations{store: m},
+		ProductInfos:     &memoryProductInfos{store: m},
+		ScrapeTasks:      &memoryScrapeTasks{store: m},
+		CrawlTasks:       &memoryCrawlTasks{store: m},
+		Offers:           &memoryOffers{store: m},
+	}
+}
+
+// service returns a Service backed by the store, whose unit of work runs straight
+// through the same repositories.
+func (m *memoryStore) service() *Service {
+	r := m.repositories()
+	return NewService(nil, r.Products, r.ProductInfos, r.ProductLocations, r.ScrapeTasks, r.CrawlTasks, nil, passThroughUnitOfWork{r})
+}
+
+// passThroughUnitOfWork runs units of work directly on its repositories.
+type passThroughUnitOfWork struct {
+	repositories hub.Repositories
+}
+
+func (u passThroughUnitOfWork) Do(ctx context.Context, fn func(repositories hub.Repositories) error) error {
+	return fn(u.repositories)
+}
+
+type memoryProducts struct {
+	hub.ProductRepository
+	store *memoryStore
+}
+
+func (r *memoryProducts) MoveProductVariants(fromParentID, toParentID string) error {
+	for id, product := range r.store.products {
+		if product.ParentID == fromParentID && id != toParentID {
+			product.ParentID = toParentID
+			r.store.products[id] = product
+		}
+	}
+
+	return nil
+}
+
+func (r *memoryProducts) DeleteProduct(id string) error {
+	delete(r.store.products, id)
+	return nil
+}
+
+type memoryProductLocations struct {
+	hub.ProductLocationRepository
+	store *memoryStore
+}
+
+func (r *memoryProductLocations) FindProductLocationsByProductID(id string) ([]domain.ProductLocation, error) {
+	productLocations := []domain.ProductLocation{}
+	for _, pl := range r.store.productLocations {
+		if pl.ProductID == id {
+			productLocations = append(productLocations, pl)
+		}
+	}
+
+	return productLocations, nil
+}
+
+func (r *memoryProductLocations) FindDuplicateProductLocations() ([]domain.ProductLocation, error) {
+	counts := map[string]int{}
+	for _, pl := range r.store.productLocations {
+		counts[pl.LocationID+"/"+pl.LocalID]++
+	}
+
+	infos := map[string]int{}
+	for _, pi := range r.store.productInfos {
+		infos[pi.ProductLocationID]++
+	}
+
+	duplicates := []domain.ProductLocation{}
+	for _, pl := range r.store.productLocations {
+		if counts[pl.LocationID+"/"+pl.LocalID] > 1 {
+			duplicates = append(duplicates, pl)
+		}
+	}
+
+	sort.Slice(duplicates, func(i, j int) bool {
+		a, b := duplicates[i], duplicates[j]
+		if a.LocationID != b.LocationID {
+			return a.LocationID < b.LocationID
+		}
+		if a.LocalID != b.LocalID {
+			return a.LocalID < b.LocalID
+		}
+		if infos[a.ID] != infos[b.ID] {
+			return infos[a.ID] > infos[b.ID]
+		}
+		return a.ID < b.ID
+	})
+
+	return duplicates, nil
+}
+
+func (r *memoryProductLocations) DeleteProductLocation(id string) error {
+	delete(r.store.productLocations, id)
+	return nil
+}
+
+type memoryProductInfos struct {
+	hub.ProductInfoRepository
+	store *memoryStore
+}
+
+func (r *memoryProductInfos) InsertProductInfo(productInfo domain.ProductInfo) (string, error) {
+	for _, pi := range r.store.productInfos {
+		if productInfo.TaskID != "" && pi.TaskID == productInfo.TaskID {
+			return "", errors.New("duplicate key value violates unique constraint \"index_product_infos_task_id\"")
+		}
+	}
+
+	productInfo.ID = r.store.id("info")
+	r.store.productInfos[productInfo.ID] = productInfo
+	return productInfo.ID, nil
+}
+
+func (r *memoryProductInfos) MoveProductInfos(fromProductLocationID, toProductLocationID, toProductID string) error {
+	for id, pi := range r.store.productInfos {
+		if pi.ProductLocationID == fromProductLocationID {
+			pi.ProductLocationID = toProductLocationID
+			pi.ProductID = toProductID
+			r.store.productInfos[id] = pi
+		}
+	}
+
+	return nil
+}
+
+type memoryOffers struct {
+	hub.OfferRepository
+	store *memoryStore
+}
+
+func (r *memoryOffers) InsertOffer(offer domain.Offer) (string, error) {
+	offer.ID = r.store.id("offer")
+	r.store.offers[offer.ID] = offer
+	return offer.ID, nil
+}
+
+type memoryScrapeTasks struct {
+	hub.ScrapeTaskRepository
+	store *memoryStore
+}
+
+func (r *memoryScrapeTasks) FindScrapeTaskByID(id string) (*domain.ScrapeTask, error) {
+	st, ok := r.store.scrapeTasks[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	return &st, nil
+}
+
+func (r *memoryScrapeTasks) InsertScrapeTask(scrapeTask domain.ScrapeTask) (string, error) {
+	scrapeTask.ID = r.store.id("task")
+	r.store.scrapeTasks[scrapeTask.ID] = scrapeTask
+	return scrapeTask.ID, nil
+}
+
+func (r *memoryScrapeTasks) UpdateScrapeTask(scrapeTask domain.ScrapeTask) error {
+	r.store.scrapeTasks[scrapeTask.ID] = scrapeTask
+	return nil
+}
+
+func (r *memoryScrapeTasks) MoveScrapeTasks(fromProductLocationID, toProductLocationID string) error {
+	for id, st := range r.store.scrapeTasks {
+		if st.ProductLocationID == fromProductLocationID {
+			st.ProductLocationID = toProductLocationID
+			r.store.scrapeTasks[id] = st
+		}
+	}
+
+	return nil
+}
+
+func (r *memoryScrapeTasks) DeleteDuplicateScrapeTasks(productLocationID string) error {
+	earliest := map[domain.StoreContext]domain.ScrapeTask{}
+	for _, st := range r.store.scrapeTasks {
+		if st.ProductLocationID != productLocationID || st.Completed {
+			continue
+		}
+
+		if e, ok := earliest[st.Store()]; !ok || st.ScheduledFor.Before(e.ScheduledFor) {
+			earliest[st.Store()] = st
+		}
+	}
+
+	for id, st := range r.store.scrapeTasks {
+		if st.ProductLocationID == productLocationID && !st.Completed && earliest[st.Store()].ID != id {
+			delete(r.store.scrapeTasks, id)
+		}
+	}
+
+	return nil
+}
+
+type memoryCrawlTasks struct {
+	hub.CrawlTaskRepository
+	store *memoryStore
+}
+
+func (r *memoryCrawlTasks) MoveCrawlTasks(fromProductLocationID, toProductLocationID string) error {
+	for id, ct := range r.store.crawlTasks {
+		if ct.OriginProductLocationID == fromProductLocationID {
+			ct.OriginProductLocationID = toProductLocationID
+			r.store.crawlTasks[id] = ct
+		}
+	}
+
+	return nil
+}
+
+func TestCompleteTaskReplay(t *testing.T) {
+	store := newMemoryStore()
+	store.scrapeTasks["task"] = domain.ScrapeTask{
+		ID:                "task",
+		ProductLocationID: "location",
+		Repeat:            true,
+		Interval:          time.Hour,
+		ZIPCode:           "72712",
+	}
+	s := store.service()
+
+	info := domain.ProductInfo{
+		ProductID:          "product",
+		ProductLocationID:  "location",
+		AvailabilityStatus: "IN_STOCK",
+	}
+	offers := []domain.Offer{
+		{SellerName: "Walmart.com", AvailabilityStatus: "IN_STOCK", BuyBox: true},
+		{SellerName: "Missing availability"},
+	}
+
+	scheduled := []domain.ScrapeTask{}
+	schedule := func(st domain.ScrapeTask) {
+		scheduled = append(scheduled, st)
+	}
+
+	id, err := s.CompleteTask(context.Background(), "task", info, offers, schedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if saved := store.productInfos[id]; saved.TaskID != "task" {
+		t.Errorf("expected product info to record task ID %q, got %q", "task", saved.TaskID)
+	}
+
+	// The offer missing its availability is dropped rather than failing the task.
+	if len(store.offers) != 1 {
+		t.Errorf("expected 1 saved offer, got %d", len(store.offers))
+	}
+
+	if !store.scrapeTasks["task"].Completed {
+		t.Error("expected task to be completed")
+	}
+
+	if len(scheduled) != 1 || scheduled[0].ID == "" || scheduled[0].ZIPCode != "72712" {
+		t.Fatalf("expected 1 follow-up task at the same store, got %+v", scheduled)
+	}
+
+	// Replaying the same result must not save anything or schedule another task.
+	_, err = s.CompleteTask(context.Background(), "task", info, offers, schedule)
+	if !errors.Is(err, hub.ErrTaskCompleted) {
+		t.Fatalf("expected ErrTaskCompleted on replay, got %v", err)
+	}
+
+	if len(store.productInfos) != 1 || len(store.offers) != 1 {
+		t.Errorf("expected replay to save nothing, got %d product infos and %d offers", len(store.productInfos), len(store.offers))
+	}
+
+	if len(store.scrapeTasks) != 2 || len(scheduled) != 1 {
+		t.Errorf("expected replay to schedule nothing, got %d tasks and %d scheduled", len(store.scrapeTasks), len(scheduled))
+	}
+}
+
+func TestMergeDuplicateProductLocations(t *testing.T) {
+	store := newMemoryStore()
+	now := time.Now()
+
+	for _, product := range []domain.Product{
+		{ID: "product-a"},
+		{ID: "product-b"},
+		{ID: "product-c"},
+		{ID: "product-e"},
+		{ID: "variant", ParentID: "product-a"},
+	} {
+		store.products[product.ID] = product
+	}
+
+	// "1" is tracked three times, the second time also at another location, and "2"
+	// twice as the same product.
+	for _, pl := range []domain.ProductLocation{
+		{ID: "location-a", ProductID: "product-a", LocationID: "walmart", LocalID: "1"},
+		{ID: "location-b", ProductID: "product-b", LocationID: "walmart", LocalID: "1"},
+		{ID: "location-c", ProductID: "product-c", LocationID: "walmart", LocalID: "1"},
+		{ID: "location-d", ProductID: "product-c", LocationID: "jsonld", LocalID: "1"},
+		{ID: "location-e", ProductID: "product-e", LocationID: "walmart", LocalID: "2"},
+		{ID: "location-f", ProductID: "product-e", LocationID: "walmart", LocalID: "2"},
+		{ID: "location-g", ProductID: "variant", LocationID: "walmart", LocalID: "3"},
+	} {
+		store.productLocations[pl.ID] = pl
+	}
+
+	// The location with the most history survives.
+	for _, pi := range []domain.ProductInfo{
+		{ID: "info-a", ProductID: "product-a", ProductLocationID: "location-a"},
+		{ID: "info-b1", ProductID: "product-b", ProductLocationID: "location-b"},
+		{ID: "info-b2", ProductID: "product-b", ProductLocationID: "location-b"},
+	} {
+		store.productInfos[pi.ID] = pi
+	}
+
+	for _, st := range []domain.ScrapeTask{
+		{ID: "done-a", ProductLocationID: "location-a", Completed: true, ScheduledFor: now.Add(-time.Hour)},
+		{ID: "pending-a", ProductLocationID: "location-a", ScheduledFor: now.Add(time.Hour)},
+		{ID: "pending-b", ProductLocationID: "location-b", ScheduledFor: now.Add(2 * time.Hour)},
+		{ID: "pending-c", ProductLocationID: "location-c", ScheduledFor: now.Add(3 * time.Hour), ZIPCode: "72712"},
+	} {
+		store.scrapeTasks[st.ID] = st
+	}
+
+	store.crawlTasks["crawl"] = domain.CrawlTask{ID: "crawl", OriginProductLocationID: "location-a"}
+
+	s := store.service()
+	expected := []hub.ProductLocationMerge{
+		{LocationID: "walmart", LocalID: "1", SurvivorID: "location-b", DuplicateIDs: []string{"location-a", "location-c"}},
+		{LocationID: "walmart", LocalID: "2", SurvivorID: "location-e", DuplicateIDs: []string{"location-f"}},
+	}
+
+	merges, err := s.MergeDuplicateProductLocations(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(merges, expected) {
+		t.Fatalf("expected merges %+v, got %+v", expected, merges)
+	}
+
+	if len(store.productLocations) != 7 {
+		t.Fatalf("expected a dry run not to merge anything, got %d product locations", len(store.productLocations))
+	}
+
+	merges, err = s.MergeDuplicateProductLocations(context.Background(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(merges, expected) {
+		t.Fatalf("expected merges %+v, got %+v", expected, merges)
+	}
+
+	for _, id := range []string{"location-a", "location-c", "location-f"} {
+		if _, ok := store.productLocations[id]; ok {
+			t.Errorf("expected duplicate %s to be deleted", id)
+		}
+	}
+
+	if len(store.productLocations) != 4 {
+		t.Errorf("expected 4 product locations left, got %d", len(store.productLocations))
+	}
+
+	for id, pi := range store.productInfos {
+		if pi.ProductLocationID != "location-b" || pi.ProductID != "product-b" {
+			t.Errorf("expected %s to move to the survivor, got %+v", id, pi)
+		}
+	}
+
+	// product-a is unused once merged, but product-c is still tracked at another
+	// location.
+	if _, ok := store.products["product-a"]; ok {
+		t.Error("expected unused duplicate product to be deleted")
+	}
+
+	if _, ok := store.products["product-c"]; !ok {
+		t.Error("expected duplicate product still in use to be kept")
+	}
+
+	if parent := store.products["variant"].ParentID; parent != "product-b" {
+		t.Errorf("expected variant to move to the survivor's product, got parent %q", parent)
+	}
+
+	// Of the pending tasks at each store, only the earliest is kept.
+	remaining := []string{}
+	for id, st := range store.scrapeTasks {
+		if st.ProductLocationID != "location-b" {
+			t.Errorf("expected task %s to move to the survivor", id)
+		}
+		remaining = append(remaining, id)
+	}
+	sort.Strings(remaining)
+
+	if expected := []string{"done-a", "pending-a", "pending-c"}; !reflect.DeepEqual(remaining, expected) {
+		t.Errorf("expected tasks %v, got %v", expected, remaining)
+	}
+
+	if origin := store.crawlTasks["crawl"].OriginProductLocationID; origin != "location-b" {
+		t.Errorf("expected crawl task to move to the survivor, got %q", origin)
+	}
+}
@@ -1,45 +1,77 @@
 package supervisor
 
 import (
+	"context"
 	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/bfoody/Walmart-Scraper/communication"
 	"github.com/bfoody/Walmart-Scraper/domain"
 	"github.com/bfoody/Walmart-Scraper/services/hub"
+	"github.com/bfoody/Walmart-Scraper/services/hub/internal/metrics"
 	"go.uber.org/zap"
 )
 
 // A Crawler distributes and collects requests to crawl related products/add new products
 // to the scrape list.
 type Crawler struct {
-	service      hub.Service
-	log          *zap.Logger
-	crawledCache map[string]bool // a cache of already crawled items
-	callback     func(productLocationID string)
-	taskManager  *TaskManager
+	service       hub.Service
+	log           *zap.Logger
+	crawledCache  map[string]bool // a cache of already crawled items
+	cacheMutex    *sync.Mutex
+	callback      func(productLocationID string)
+	taskManager   *TaskManager
+	interval      time.Duration // the scrape interval of tasks for discovered products
+	intervalMutex *sync.RWMutex
 }
 
-// NewCrawler creates and returns a *Crawler.
-func NewCrawler(service hub.Service, logger *zap.Logger, callback func(productLocationID string), taskManager *TaskManager) *Crawler {
+// NewCrawler creates and returns a *Crawler, which schedules discovered products to be
+// scraped every `interval`.
+func NewCrawler(service hub.Service, logger *zap.Logger, callback func(productLocationID string), taskManager *TaskManager, interval time.Duration) *Crawler {
 	return &Crawler{
-		service:      service,
-		log:          logger,
-		crawledCache: map[string]bool{},
-		callback:     callback,
-		taskManager:  taskManager,
+		service:       service,
+		log:           logger,
+		crawledCache:  map[string]bool{},
+		cacheMutex:    &sync.Mutex{},
+		callback:      callback,
+		taskManager:   taskManager,
+		interval:      interval,
+		intervalMutex: &sync.RWMutex{},
 	}
 }
 
+// SetInterval changes the scrape interval of tasks for products discovered from now
+// on. Existing tasks keep their interval.
+func (c *Crawler) SetInterval(interval time.Duration) {
+	c.intervalMutex.Lock()
+	defer c.intervalMutex.Unlock()
+
+	c.interval = interval
+}
+
+// scrapeInterval returns the scrape interval of tasks for discovered products.
+func (c *Crawler) scrapeInterval() time.Duration {
+	c.intervalMutex.RLock()
+	defer c.intervalMutex.RUnlock()
+
+	return c.interval
+}
+
 // AttemptCrawl attempts a crawl from a product ID.
 func (c *Crawler) AttemptCrawl(id string) {
-	if _, ok := c.crawledCache[id]; ok {
+	c.cacheMutex.Lock()
+	_, ok := c.crawledCache[id]
+	c.cacheMutex.Unlock()
+
+	if ok {
 		// Already crawled, exit.
 		return
 	}
 
 	crawled, err := c.service.IsCrawled(id)
 	if err != nil {
+		metrics.DBErrors.WithLabelValues("is_crawled").Inc()
 		c.log.Error("error crawling", zap.Error(err))
 		return
 	}
@@ -51,58 +83,98 @@ func (c *Crawler) AttemptCrawl(id string) {
 	c.callback(id)
 }
 
+// ForceCrawl crawls from a product ID regardless of whether it was crawled before.
+func (c *Crawler) ForceCrawl(id string) {
+	c.cacheMutex.Lock()
+	delete(c.crawledCache, id)
+	c.cacheMutex.Unlock()
+
+	c.callback(id)
+}
+
 // PipeRetrieval receives a crawl.
 func (c *Crawler) PipeRetrieval(cr *communication.CrawlRetrieved) {
 	_, err := c.service.SaveCrawlTask(cr.ProductLocationID)
 	if err != nil {
+		metrics.DBErrors.WithLabelValues("save_crawl_task").Inc()
 		c.log.Error("error saving CrawlTask", zap.Error(err))
 	}
+
+	c.cacheMutex.Lock()
 	c.crawledCache[cr.ProductLocationID] = true
+	c.cacheMutex.Unlock()
+
+	// Discovered products are sold at the same location as the product they were
+	// recommended from.
+	origin, err := c.service.GetProductLocationByID(cr.ProductLocationID)
+	if err != nil {
+		metrics.DBErrors.WithLabelValues("get_product_location").Inc()
+		c.log.Error("error getting origin ProductLocation of crawl", zap.String("productLocationID", cr.ProductLocationID), zap.Error(err))
+		return
+	}
 
-	for _, item := range cr.Recommendations {
-		id, err := c.service.SaveProduct(domain.Product{
+	discovered := c.TrackProducts(origin.LocationID, cr.Recommendations)
+	metrics.CrawlDiscoveries.Add(float64(discovered))
+}
+
+// TrackProducts saves products found at a location and schedules scrape tasks for them,
+// skipping products already tracked at the location. The number of newly tracked
+// products is returned.
+func (c *Crawler) TrackProducts(locationID string, products []domain.ProductLocation) int {
+	return c.trackProducts(locationID, "", products)
+}
+
+// TrackVariants saves the variants of a product found at a location as children of the
+// product `parentID`, scheduling scrape tasks for them like TrackProducts.
+func (c *Crawler) TrackVariants(parentID string, locationID string, variants []domain.ProductLocation) int {
+	return c.trackProducts(locationID, parentID, variants)
+}
+
+// trackProducts tracks products found at a location, saving them as variants of the
+// product `parentID` if it isn't empty.
+func (c *Crawler) trackProducts(locationID string, parentID string, products []domain.ProductLocation) int {
+	interval := c.scrapeInterval()
+	tracked := 0
+
+	for _, item := range products {
+		// The product, its location and its task are saved together, so that a failure
+		// part of the way through doesn't leave an orphaned product behind.
+		st, err := c.service.TrackProduct(context.Background(), domain.Product{
 			ID:         "",
 			CommonName: item.Name,
-		})
-		if err != nil {
-			c.log.Error("error saving Product", zap.Error(err))
-			continue
-		}
-
-		plID, err := c.service.SaveProductLocation(domain.ProductLocation{
+			ParentID:   parentID,
+		}, domain.ProductLocation{
 			ID:         "",
 			Name:       item.Name,
-			ProductID:  id,
-			LocationID: "8e1922b0-6c12-4bd6-944e-9f87d0b15359",
+			LocationID: locationID,
 			URL:        item.URL,
 			LocalID:    item.LocalID,
 			Slug:       item.Slug,
 			CategoryID: item.CategoryID,
 			Category:   item.Category,
+			Variant:    item.Variant,
+		}, domain.ScrapeTask{
+			ID:           "",
+			Completed:    false,
+			CreatedAt:    time.Now(),
+			ScheduledFor: time.Now().Add(interval + time.Duration(rand.Intn(120))*time.Second),
+			Repeat:       true,
+			Interval:     interval,
 		})
 		if err != nil {
-			c.log.Error("error saving ProductLocation", zap.Error(err))
+			metrics.DBErrors.WithLabelValues("track_product").Inc()
+			c.log.Error("error tracking product", zap.String("localID", item.LocalID), zap.Error(err))
 			continue
 		}
 
-		st := domain.ScrapeTask{
-			ID:                "",
-			Completed:         false,
-			CreatedAt:         time.Now(),
-			ScheduledFor:      time.Now().Add(time.Duration(120+rand.Intn(120)) * time.Second),
-			ProductLocationID: plID,
-			Repeat:            true,
-			Interval:          120 * time.Second,
-		}
-
-		stID, err := c.service.CreateTask(st)
-		if err != nil {
-			c.log.Error("error saving ScrapeTask", zap.Error(err))
+		if st == nil {
+			// Already tracked.
 			continue
 		}
 
-		st.ID = stID
-
-		c.taskManager.pushTaskToQueue(st)
+		tracked++
+		c.taskManager.pushTaskToQueue(*st)
 	}
+
+	return tracked
 }
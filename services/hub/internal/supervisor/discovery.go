@@ -0,0 +1,107 @@
+package supervisor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bfoody/Walmart-Scraper/communication"
+	"github.com/bfoody/Walmart-Scraper/domain"
+	"github.com/bfoody/Walmart-Scraper/services/hub/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// discoveryCheckInterval is the amount of time between checks for due discovery tasks.
+const discoveryCheckInterval = 1 * time.Minute
+
+// dispatchDueDiscoveries dispatches every discovery task that is due to a client,
+// scheduling each for its next run.
+func (s *Supervisor) dispatchDueDiscoveries() {
+	tasks, err := s.service.FetchDueDiscoveryTasks()
+	if err != nil {
+		metrics.DBErrors.WithLabelValues("fetch_due_discovery_tasks").Inc()
+		s.log.Error("error fetching due discovery tasks", zap.Error(err))
+		return
+	}
+
+	for _, task := range tasks {
+		s.queueDiscoveryTask(task)
+	}
+}
+
+// queueDiscoveryTask distributes a discovery task once a client server is connected.
+func (s *Supervisor) queueDiscoveryTask(task domain.DiscoveryTask) {
+	go func() {
+		for s.serverCount() < 1 {
+			time.Sleep(5 * time.Second)
+		}
+
+		go s.distributeDiscoveryTask(task)
+	}()
+}
+
+// distributeDiscoveryTask distributes a discovery task to a client server in a
+// round-robin fashion.
+func (s *Supervisor) distributeDiscoveryTask(task domain.DiscoveryTask) {
+	// The last client may have left since one was waited for, so wait for another.
+	id, ok := s.nextServer()
+	if !ok {
+		s.queueDiscoveryTask(task)
+		return
+	}
+
+	go func() {
+		location, err := s.service.GetLocationByID(task.LocationID)
+		if err != nil {
+			metrics.DBErrors.WithLabelValues("get_location").Inc()
+			s.log.Error("Error getting Location for DiscoveryFulfillmentRequest", zap.String("locationID", task.LocationID), zap.Error(err))
+			return
+		}
+
+		req := communication.DiscoveryFulfillmentRequest{
+			SingleReceiverPacket: communication.SingleReceiverPacket{
+				SenderID:   s.identity.ID,
+				ReceiverID: id,
+			},
+			DiscoveryTaskID: task.ID,
+			Kind:            task.Kind,
+			Query:           task.Query,
+			MaxPages:        task.MaxPages,
+			Location:        *location,
+		}
+
+		err = s.conn.SendMessage(req)
+		if err != nil {
+			s.log.Error("Error sending DiscoveryFulfillmentRequest to server", zap.String("serverID", id), zap.Error(err))
+			return
+		}
+
+		metrics.DiscoveriesDispatched.Inc()
+	}()
+}
+
+// handleDiscoveryRetrieved starts tracking the products found by a discovery at the
+// discovery task's location.
+func (s *Supervisor) handleDiscoveryRetrieved(dr *communication.DiscoveryRetrieved) {
+	if dr.SenderID == s.identity.ID || dr.ReceiverID != s.identity.ID {
+		return
+	}
+
+	task, err := s.service.GetDiscoveryTaskByID(dr.DiscoveryTaskID)
+	if err != nil {
+		metrics.DBErrors.WithLabelValues("get_discovery_task").Inc()
+		s.log.Error(fmt.Sprintf("error getting discovery task %s", dr.DiscoveryTaskID), zap.Error(err))
+		return
+	}
+
+	tracked := s.crawler.TrackProducts(task.LocationID, dr.Products)
+	metrics.DiscoveredProducts.Add(float64(tracked))
+
+	s.log.Info(
+		"products discovered",
+		zap.String("discoveryTaskId", task.ID),
+		zap.String("kind", task.Kind),
+		zap.String("query", task.Query),
+		zap.Int("found", len(dr.Products)),
+		zap.Int("tracked", tracked),
+	)
+}
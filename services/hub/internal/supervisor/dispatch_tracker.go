@@ -0,0 +1,72 @@
+package supervisor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bfoody/Walmart-Scraper/domain"
+)
+
+// A dispatch is a task sent to a client and when it was sent.
+type dispatch struct {
+	task domain.ScrapeTask
+	at   time.Time
+}
+
+// A DispatchTracker records the tasks dispatched to clients and when, so that the
+// time taken to fulfill them can be measured and tasks that fail or go unanswered can
+// be requeued.
+type DispatchTracker struct {
+	mutex      *sync.Mutex
+	dispatched map[string]dispatch
+}
+
+// NewDispatchTracker creates and returns a *DispatchTracker.
+func NewDispatchTracker() *DispatchTracker {
+	return &DispatchTracker{
+		mutex:      &sync.Mutex{},
+		dispatched: map[string]dispatch{},
+	}
+}
+
+// Dispatched records that the supplied task was just dispatched.
+func (d *DispatchTracker) Dispatched(task domain.ScrapeTask) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.dispatched[task.ID] = dispatch{task, time.Now()}
+}
+
+// Completed stops tracking the task with the supplied ID, returning the task and the
+// time since it was dispatched. The returned boolean is false if the task was not
+// being tracked.
+func (d *DispatchTracker) Completed(id string) (domain.ScrapeTask, time.Duration, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	dispatch, ok := d.dispatched[id]
+	if !ok {
+		return domain.ScrapeTask{}, 0, false
+	}
+
+	delete(d.dispatched, id)
+
+	return dispatch.task, time.Since(dispatch.at), true
+}
+
+// Expire stops tracking all tasks dispatched longer than `maxAge` ago, returning the
+// tasks expired.
+func (d *DispatchTracker) Expire(maxAge time.Duration) []domain.ScrapeTask {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	expired := []domain.ScrapeTask{}
+	for id, dispatch := range d.dispatched {
+		if time.Since(dispatch.at) > maxAge {
+			delete(d.dispatched, id)
+			expired = append(expired, dispatch.task)
+		}
+	}
+
+	return expired
+}
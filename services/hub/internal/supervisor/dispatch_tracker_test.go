@@ -0,0 +1,36 @@
+package supervisor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bfoody/Walmart-Scraper/domain"
+)
+
+// TestDispatchTracker makes sure completed tasks are measured and stale tasks expire.
+func TestDispatchTracker(t *testing.T) {
+	d := NewDispatchTracker()
+
+	d.Dispatched(domain.ScrapeTask{ID: "1"})
+	d.Dispatched(domain.ScrapeTask{ID: "2"})
+
+	if task, _, ok := d.Completed("1"); !ok || task.ID != "1" {
+		t.Fatal("expected task 1 to be tracked")
+	}
+
+	if _, _, ok := d.Completed("1"); ok {
+		t.Fatal("expected task 1 to no longer be tracked after completion")
+	}
+
+	if expired := d.Expire(time.Hour); len(expired) != 0 {
+		t.Fatalf("expected 0 tasks expired, got %d", len(expired))
+	}
+
+	if expired := d.Expire(0); len(expired) != 1 || expired[0].ID != "2" {
+		t.Fatalf("expected task 2 to expire, got %v", expired)
+	}
+
+	if _, _, ok := d.Completed("2"); ok {
+		t.Fatal("expected task 2 to no longer be tracked after expiry")
+	}
+}
@@ -0,0 +1,183 @@
+package supervisor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bfoody/Walmart-Scraper/domain"
+	"github.com/bfoody/Walmart-Scraper/services/hub/internal/metrics"
+)
+
+const (
+	// minRateFraction is the fraction of the maximum dispatch rate a retailer's budget
+	// is never throttled below.
+	minRateFraction = 1.0 / 64
+	// recoveryFraction is the fraction of the maximum dispatch rate a retailer's budget
+	// recovers by with each completed task.
+	recoveryFraction = 1.0 / 20
+	// blockedPause is how long dispatches to a retailer pause for after a client is
+	// blocked, or rate limited without being told how long to wait.
+	blockedPause = 1 * time.Minute
+)
+
+// A retailerBudget is the dispatch rate of a single retailer.
+type retailerBudget struct {
+	rate        float64   // dispatches per second
+	next        time.Time // when the next dispatch may be sent
+	pausedUntil time.Time // when dispatches may resume after a block or rate limit
+}
+
+// A RateBudget spaces out the tasks dispatched to clients for each retailer. When
+// clients report that a retailer is blocking or rate limiting them, the retailer's
+// rate is halved and dispatches pause, then the rate recovers gradually as tasks
+// complete.
+type RateBudget struct {
+	mutex     *sync.Mutex
+	maxRate   float64 // the most dispatches per second to each retailer
+	retailers map[string]*retailerBudget
+	now       func() time.Time
+}
+
+// NewRateBudget creates and returns a *RateBudget allowing up to `maxRate`
+// dispatches per second to each retailer.
+func NewRateBudget(maxRate float64) *RateBudget {
+	return &RateBudget{
+		mutex:     &sync.Mutex{},
+		maxRate:   maxRate,
+		retailers: map[string]*retailerBudget{},
+		now:       time.Now,
+	}
+}
+
+// SetMaxRate replaces the maximum dispatch rate, lowering any retailer's rate above
+// it.
+func (b *RateBudget) SetMaxRate(maxRate float64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.maxRate = maxRate
+	for retailer, budget := range b.retailers {
+		if budget.rate > maxRate {
+			budget.rate = maxRate
+			metrics.DispatchRate.WithLabelValues(retailer).Set(budget.rate)
+		}
+	}
+}
+
+// budget returns the budget of a retailer, starting at the maximum rate. Must be
+// called with the mutex held.
+func (b *RateBudget) budget(retailer string) *retailerBudget {
+	budget, ok := b.retailers[retailer]
+	if !ok {
+		budget = &retailerBudget{rate: b.maxRate}
+		b.retailers[retailer] = budget
+		metrics.DispatchRate.WithLabelValues(retailer).Set(budget.rate)
+	}
+
+	return budget
+}
+
+// Reserve reserves the next dispatch to a retailer, returning how long to wait before
+// sending it. If that is longer than `maxDelay`, nothing is reserved and false is
+// returned, so the dispatch can be retried later instead of waiting.
+func (b *RateBudget) Reserve(retailer string, maxDelay time.Duration) (time.Duration, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	budget := b.budget(retailer)
+	now := b.now()
+
+	at := now
+	if budget.next.After(at) {
+		at = budget.next
+	}
+	if budget.pausedUntil.After(at) {
+		at = budget.pausedUntil
+	}
+
+	if delay := at.Sub(now); delay > maxDelay {
+		return delay, false
+	}
+
+	budget.next = at.Add(time.Duration(float64(time.Second) / budget.rate))
+
+	return at.Sub(now), true
+}
+
+// Throttle halves a retailer's dispatch rate and pauses dispatches to it for
+// `pause`, or blockedPause if it is 0.
+func (b *RateBudget) Throttle(retailer string, pause time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if pause <= 0 {
+		pause = blockedPause
+	}
+
+	budget := b.budget(retailer)
+	budget.rate /= 2
+	if min := b.maxRate * minRateFraction; budget.rate < min {
+		budget.rate = min
+	}
+
+	b.pause(budget, pause)
+
+	metrics.DispatchRate.WithLabelValues(retailer).Set(budget.rate)
+}
+
+// Pause pauses dispatches to a retailer for `pause`, or blockedPause if it is 0,
+// without slowing it down, eg. while a client's circuit for it is open.
+func (b *RateBudget) Pause(retailer string, pause time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if pause <= 0 {
+		pause = blockedPause
+	}
+
+	b.pause(b.budget(retailer), pause)
+}
+
+// pause pauses dispatches to a retailer's budget for `pause`, unless they are already
+// paused for longer. Must be called with the mutex held.
+func (b *RateBudget) pause(budget *retailerBudget, pause time.Duration) {
+	if until := b.now().Add(pause); until.After(budget.pausedUntil) {
+		budget.pausedUntil = until
+	}
+}
+
+// Completed recovers a retailer's dispatch rate after a task completes.
+func (b *RateBudget) Completed(retailer string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	budget := b.budget(retailer)
+	if budget.rate >= b.maxRate {
+		return
+	}
+
+	budget.rate += b.maxRate * recoveryFraction
+	if budget.rate > b.maxRate {
+		budget.rate = b.maxRate
+	}
+
+	metrics.DispatchRate.WithLabelValues(retailer).Set(budget.rate)
+}
+
+// Rate returns a retailer's current dispatch rate, in dispatches per second.
+func (b *RateBudget) Rate(retailer string) float64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.budget(retailer).rate
+}
+
+// retailerOrDefault returns a retailer key, or the Walmart key for locations and
+// messages from before locations had retailers, like the client does.
+func retailerOrDefault(retailer string) string {
+	if retailer == "" {
+		return domain.RetailerWalmart
+	}
+
+	return retailer
+}
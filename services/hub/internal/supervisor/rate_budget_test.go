@@ -0,0 +1,61 @@
+package supervisor
+
+import (
+	"testing"
+	"time"
+)
+
+// TestRateBudget makes sure dispatches are spaced out, pause and slow down when a
+// retailer throttles clients, recover as tasks complete, and pause while a client's
+// circuit is open.
+func TestRateBudget(t *testing.T) {
+	b := NewRateBudget(10)
+	now := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+
+	if delay, _ := b.Reserve("walmart", time.Minute); delay != 0 {
+		t.Fatalf("expected first dispatch to be immediate, got %s", delay)
+	}
+
+	if delay, _ := b.Reserve("walmart", time.Minute); delay != 100*time.Millisecond {
+		t.Fatalf("expected second dispatch after 100ms, got %s", delay)
+	}
+
+	if delay, _ := b.Reserve("jsonld", time.Minute); delay != 0 {
+		t.Fatalf("expected retailers to have separate budgets, got %s", delay)
+	}
+
+	b.Throttle("walmart", 30*time.Second)
+	if rate := b.Rate("walmart"); rate != 5 {
+		t.Fatalf("expected rate to halve to 5, got %f", rate)
+	}
+
+	// Waits longer than the caller accepts aren't reserved.
+	if delay, ok := b.Reserve("walmart", 10*time.Second); ok || delay != 30*time.Second {
+		t.Fatalf("expected a 30s pause not to be reserved within 10s, got %s, %t", delay, ok)
+	}
+
+	if delay, ok := b.Reserve("walmart", time.Minute); !ok || delay != 30*time.Second {
+		t.Fatalf("expected dispatches to pause for 30s, got %s", delay)
+	}
+
+	for i := 0; i < 20; i++ {
+		b.Throttle("walmart", 0)
+	}
+	if rate := b.Rate("walmart"); rate != 10*minRateFraction {
+		t.Fatalf("expected rate to stop at its minimum, got %f", rate)
+	}
+
+	for i := 0; i < 30; i++ {
+		b.Completed("walmart")
+	}
+	if rate := b.Rate("walmart"); rate != 10 {
+		t.Fatalf("expected rate to recover to 10, got %f", rate)
+	}
+
+	now = now.Add(time.Hour)
+	b.Pause("walmart", 20*time.Second)
+	if delay, _ := b.Reserve("walmart", time.Minute); delay != 20*time.Second || b.Rate("walmart") != 10 {
+		t.Fatalf("expected dispatches to pause for 20s at the same rate, got %s at %f", delay, b.Rate("walmart"))
+	}
+}
@@ -1,6 +1,8 @@
 package supervisor
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
 	"sync"
@@ -9,12 +11,33 @@ import (
 	"github.com/bfoody/Walmart-Scraper/communication"
 	"github.com/bfoody/Walmart-Scraper/domain"
 	"github.com/bfoody/Walmart-Scraper/identity"
+	"github.com/bfoody/Walmart-Scraper/logging"
 	"github.com/bfoody/Walmart-Scraper/services/hub"
+	"github.com/bfoody/Walmart-Scraper/services/hub/internal/metrics"
+	"github.com/bfoody/Walmart-Scraper/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
-// HeartbeatInterval is the amount of time between each heartbeat.
-const HeartbeatInterval = 3 * time.Second
+const (
+	// TaskExpiry is the amount of time after dispatch that a task is considered
+	// expired if no InfoRetrieved has been received for it.
+	TaskExpiry = 10 * time.Minute
+	// taskExpiryCheckInterval is the amount of time between checks for expired tasks.
+	taskExpiryCheckInterval = 1 * time.Minute
+	// maxDispatchDelay is the longest a task waits for its retailer's rate budget before
+	// being put back in the queue instead.
+	maxDispatchDelay = 5 * time.Second
+	// noServerRetryDelay is how long a task is put back in the queue for when no client
+	// is connected to dispatch it to.
+	noServerRetryDelay = 5 * time.Second
+	// failedTaskRetryDelay is how long a failed or expired task without an interval is
+	// put back in the queue for.
+	failedTaskRetryDelay = 5 * time.Minute
+)
+
+var tracer = tracing.Tracer("github.com/bfoody/Walmart-Scraper/services/hub/internal/supervisor")
 
 // A ServerMap stores a list of servers and their statuses.
 type ServerMap map[string]ServerStatus
@@ -22,58 +45,81 @@ type ServerMap map[string]ServerStatus
 // A Supervisor maintains a list of currently connected servers and their
 // statuses.
 type Supervisor struct {
-	identity       *identity.Server
-	conn           *communication.QueueConnection
-	service        hub.Service
-	serverMapMutex *sync.RWMutex
-	serverMap      map[string]ServerStatus
-	heartbeaters   map[string]*hub.Heartbeater
-	statusUpdates  chan communication.StatusUpdate
-	heartbeats     chan communication.Heartbeat
-	goingAways     chan communication.GoingAway
-	infoRetrieved  chan communication.InfoRetrieved
-	crawlRetrieved chan communication.CrawlRetrieved
-	serverDown     chan identity.Server // any servers sent through this channel will be considered offline
-	shutdown       chan int
-	log            *zap.Logger
-	taskManager    *TaskManager
-	roundRobin     *RoundRobin
-	crawler        *Crawler
-}
-
-// New creates and returns a new *Supervisor.
-func New(_identity *identity.Server, logger *zap.Logger, conn *communication.QueueConnection, service hub.Service) *Supervisor {
-	tm := NewTaskManager(service)
+	identity           *identity.Server
+	conn               *communication.QueueConnection
+	service            hub.Service
+	serverMapMutex     *sync.RWMutex
+	serverMap          map[string]ServerStatus
+	heartbeaters       map[string]*hub.Heartbeater
+	statusUpdates      chan communication.StatusUpdate
+	heartbeats         chan communication.Heartbeat
+	goingAways         chan communication.GoingAway
+	infoRetrieved      chan communication.InfoRetrieved
+	taskFailed         chan communication.TaskFailed
+	crawlRetrieved     chan communication.CrawlRetrieved
+	crawlRequests      chan communication.CrawlRequest
+	discoveryRetrieved chan communication.DiscoveryRetrieved
+	configs            chan *hub.Config     // reloaded configs to apply
+	serverDown         chan identity.Server // any servers sent through this channel will be considered offline
+	shutdown           chan int
+	log                *zap.Logger
+	loggers            *logging.Loggers
+	taskManager        *TaskManager
+	roundRobin         *RoundRobin
+	crawler            *Crawler
+	dispatches         *DispatchTracker
+	budget             *RateBudget
+	settingsMutex      *sync.RWMutex
+	heartbeatInterval  time.Duration // the interval between heartbeats sent to each client
+	scrapeInterval     time.Duration // the scrape interval of tasks for crawled products
+}
+
+// New creates and returns a new *Supervisor, configured using the supplied hub config.
+func New(_identity *identity.Server, loggers *logging.Loggers, conn *communication.QueueConnection, service hub.Service, config *hub.Config) *Supervisor {
+	tm := NewTaskManager(service, loggers.Component("taskmanager"))
 
 	return &Supervisor{
-		identity:       _identity,
-		conn:           conn,
-		service:        service,
-		serverMapMutex: &sync.RWMutex{},
-		serverMap:      map[string]ServerStatus{},
-		heartbeaters:   map[string]*hub.Heartbeater{},
-		statusUpdates:  make(chan communication.StatusUpdate, 4),
-		heartbeats:     make(chan communication.Heartbeat, 4),
-		goingAways:     make(chan communication.GoingAway, 4),
-		infoRetrieved:  make(chan communication.InfoRetrieved, 4),
-		crawlRetrieved: make(chan communication.CrawlRetrieved, 4),
-		serverDown:     make(chan identity.Server, 4),
-		shutdown:       make(chan int),
-		log:            logger,
-		taskManager:    tm,
-		roundRobin:     NewRoundRobin(),
+		identity:           _identity,
+		conn:               conn,
+		service:            service,
+		serverMapMutex:     &sync.RWMutex{},
+		serverMap:          map[string]ServerStatus{},
+		heartbeaters:       map[string]*hub.Heartbeater{},
+		statusUpdates:      make(chan communication.StatusUpdate, 4),
+		heartbeats:         make(chan communication.Heartbeat, 4),
+		goingAways:         make(chan communication.GoingAway, 4),
+		infoRetrieved:      make(chan communication.InfoRetrieved, 4),
+		taskFailed:         make(chan communication.TaskFailed, 4),
+		crawlRetrieved:     make(chan communication.CrawlRetrieved, 4),
+		crawlRequests:      make(chan communication.CrawlRequest, 4),
+		discoveryRetrieved: make(chan communication.DiscoveryRetrieved, 4),
+		configs:            make(chan *hub.Config, 1),
+		serverDown:         make(chan identity.Server, 4),
+		shutdown:           make(chan int),
+		log:                loggers.Component("supervisor"),
+		loggers:            loggers,
+		taskManager:        tm,
+		roundRobin:         NewRoundRobin(),
+		dispatches:         NewDispatchTracker(),
+		budget:             NewRateBudget(config.DispatchRate),
+		settingsMutex:      &sync.RWMutex{},
+		heartbeatInterval:  config.HeartbeatInterval,
+		scrapeInterval:     config.ScrapeInterval,
 	}
 }
 
 // Start starts the Supervisor.
 func (s *Supervisor) Start() error {
-	s.crawler = NewCrawler(s.service, s.log, s.crawlCallback, s.taskManager)
+	s.crawler = NewCrawler(s.service, s.loggers.Component("crawler"), s.crawlCallback, s.taskManager, s.scrapeInterval)
 
 	s.conn.RegisterStatusUpdateHandler(s.pipeStatusUpdate)
 	s.conn.RegisterHeartbeatHandler(s.pipeHeartbeat)
 	s.conn.RegisterGoingAwayHandler(s.pipeGoingAway)
 	s.conn.RegisterInfoRetrievedHandler(s.pipeInfoRetrieved)
+	s.conn.RegisterTaskFailedHandler(s.pipeTaskFailed)
 	s.conn.RegisterCrawlRetrievedHandler(s.pipeCrawlRetrieved)
+	s.conn.RegisterCrawlRequestHandler(s.pipeCrawlRequest)
+	s.conn.RegisterDiscoveryRetrievedHandler(s.pipeDiscoveryRetrieved)
 
 	err := s.taskManager.Initialize()
 	if err != nil {
@@ -85,21 +131,46 @@ func (s *Supervisor) Start() error {
 	return nil
 }
 
+// CheckTaskManager returns an error if the TaskManager's loop is not running, for use
+// as a health check.
+func (s *Supervisor) CheckTaskManager(ctx context.Context) error {
+	if !s.taskManager.Running() {
+		return errors.New("task manager loop not running")
+	}
+
+	return nil
+}
+
+// CheckClients returns an error if no clients are available for work, for use as a
+// health check.
+func (s *Supervisor) CheckClients(ctx context.Context) error {
+	s.serverMapMutex.RLock()
+	defer s.serverMapMutex.RUnlock()
+
+	for _, status := range s.serverMap {
+		if status.AvailableForWork {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no clients available for work, %d connected", len(s.serverMap))
+}
+
 // taskCallback is called by the TaskManager when a task is due to be dispatched.
-func (s *Supervisor) taskCallback(task domain.ScrapeTask) {
+func (s *Supervisor) taskCallback(ctx context.Context, task domain.ScrapeTask) {
 	go func() {
-		for len(s.serverMap) < 1 {
+		for s.serverCount() < 1 {
 			time.Sleep(5 * time.Second)
 		}
 
-		go s.distributeTask(task)
+		go s.distributeTask(ctx, task)
 	}()
 }
 
 // crawlCallback is called by the Crawler when a task is due to be dispatched.
 func (s *Supervisor) crawlCallback(productLocationID string) {
 	go func() {
-		for len(s.serverMap) < 1 {
+		for s.serverCount() < 1 {
 			time.Sleep(5 * time.Second)
 		}
 
@@ -108,46 +179,76 @@ func (s *Supervisor) crawlCallback(productLocationID string) {
 }
 
 // distributeTask distributes a task to a client server in a round-robin fashion.
-func (s *Supervisor) distributeTask(task domain.ScrapeTask) {
-	s.serverMapMutex.RLock()
-	defer s.serverMapMutex.RUnlock()
-
-	// Create an array of server IDs to choose from.
-	serverIDArray := []string{}
-	for id := range s.serverMap {
-		serverIDArray = append(serverIDArray, id)
-	}
-
-	// Get the ID of the server chosen by round-robin.
-	idx := s.roundRobin.Next(uint(len(serverIDArray)))
-	id := serverIDArray[idx]
-
+func (s *Supervisor) distributeTask(ctx context.Context, task domain.ScrapeTask) {
 	go func() {
+		ctx, span := tracer.Start(ctx, "Supervisor.distributeTask", trace.WithAttributes(
+			attribute.String("task.id", task.ID),
+		))
+		var err error
+		defer func() { tracing.End(span, err) }()
+
 		// TODO: handle error
 		pl, err := s.service.GetProductLocationByID(task.ProductLocationID)
 		if err != nil {
+			metrics.DBErrors.WithLabelValues("get_product_location").Inc()
 			s.log.Error("Error getting ProductLocation for TaskFulfillmentRequest", zap.String("productLocationID", task.ProductLocationID), zap.Error(err))
 			return
 		}
 
+		location, err := s.service.GetLocationByID(pl.LocationID)
+		if err != nil {
+			metrics.DBErrors.WithLabelValues("get_location").Inc()
+			s.log.Error("Error getting Location for TaskFulfillmentRequest", zap.String("locationID", pl.LocationID), zap.Error(err))
+			return
+		}
+
+		// Wait for the retailer's rate budget, which slows down while clients are being
+		// blocked. Longer waits put the task back in the queue rather than holding on
+		// to it here.
+		delay, ok := s.budget.Reserve(retailerOrDefault(location.Retailer), maxDispatchDelay)
+		if !ok {
+			s.requeueTask(task, delay)
+			return
+		}
+
+		if delay > 0 {
+			time.Sleep(delay)
+		}
+
+		// The client is chosen after waiting, since it may have left in the meantime.
+		id, ok := s.nextServer()
+		if !ok {
+			s.requeueTask(task, noServerRetryDelay)
+			return
+		}
+		span.SetAttributes(attribute.String("server.id", id))
+
 		req := communication.TaskFulfillmentRequest{
 			SingleReceiverPacket: communication.SingleReceiverPacket{
-				SenderID:   s.identity.ID,
-				ReceiverID: id,
+				SenderID:     s.identity.ID,
+				ReceiverID:   id,
+				TraceContext: tracing.Inject(ctx),
 			},
 			TaskID:          task.ID,
 			ProductLocation: *pl,
+			Location:        *location,
+			Store:           task.Store(),
 		}
 
 		err = s.conn.SendMessage(req)
 		if err != nil {
 			s.log.Error("Error sending TaskFulfillmentRequest to server", zap.String("serverID", id), zap.Error(err))
+			return
 		}
+
+		metrics.TasksDispatched.Inc()
+		s.dispatches.Dispatched(task)
 	}()
 }
 
-// distributeCrawlTask distributes a task to a client server in a round-robin fashion.
-func (s *Supervisor) distributeCrawlTask(productLocationID string) {
+// nextServer returns the ID of the next client server in a round-robin fashion, or
+// false if none are connected.
+func (s *Supervisor) nextServer() (string, bool) {
 	s.serverMapMutex.RLock()
 	defer s.serverMapMutex.RUnlock()
 
@@ -157,24 +258,70 @@ func (s *Supervisor) distributeCrawlTask(productLocationID string) {
 		serverIDArray = append(serverIDArray, id)
 	}
 
+	if len(serverIDArray) < 1 {
+		return "", false
+	}
+
 	// Get the ID of the server chosen by round-robin.
 	idx := s.roundRobin.Next(uint(len(serverIDArray)))
-	id := serverIDArray[idx]
+	return serverIDArray[idx], true
+}
+
+// requeueTask puts a task that couldn't be dispatched back in the queue, due after
+// `delay`.
+func (s *Supervisor) requeueTask(task domain.ScrapeTask, delay time.Duration) {
+	s.log.Debug("requeueing task", zap.String("taskId", task.ID), zap.Duration("delay", delay))
+
+	task.ScheduledFor = time.Now().Add(delay)
+	s.taskManager.pushTaskToQueue(task)
+}
+
+// retryDelay returns how long a failed or expired task is put back in the queue for:
+// `retryAfter` if the retailer asked to wait, or otherwise the task's interval.
+func retryDelay(task domain.ScrapeTask, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter
+	}
+
+	if task.Interval > 0 {
+		return task.Interval
+	}
+
+	return failedTaskRetryDelay
+}
+
+// distributeCrawlTask distributes a task to a client server in a round-robin fashion.
+func (s *Supervisor) distributeCrawlTask(productLocationID string) {
+	// The last client may have left since one was waited for, so wait for another.
+	id, ok := s.nextServer()
+	if !ok {
+		s.crawlCallback(productLocationID)
+		return
+	}
 
 	go func() {
 		// TODO: handle error
 		pl, err := s.service.GetProductLocationByID(productLocationID)
 		if err != nil {
+			metrics.DBErrors.WithLabelValues("get_product_location").Inc()
 			s.log.Error("Error getting ProductLocation for CrawlFulfillmentRequest", zap.String("productLocationID", productLocationID), zap.Error(err))
 			return
 		}
 
+		location, err := s.service.GetLocationByID(pl.LocationID)
+		if err != nil {
+			metrics.DBErrors.WithLabelValues("get_location").Inc()
+			s.log.Error("Error getting Location for CrawlFulfillmentRequest", zap.String("locationID", pl.LocationID), zap.Error(err))
+			return
+		}
+
 		req := communication.CrawlFulfillmentRequest{
 			SingleReceiverPacket: communication.SingleReceiverPacket{
 				SenderID:   s.identity.ID,
 				ReceiverID: id,
 			},
 			ProductLocation: *pl,
+			Location:        *location,
 		}
 
 		err = s.conn.SendMessage(req)
@@ -190,6 +337,12 @@ func (s *Supervisor) Shutdown() error {
 	return nil
 }
 
+// ApplyConfig applies the reloadable settings of a reloaded hub config, without
+// interrupting dispatched tasks or connected clients.
+func (s *Supervisor) ApplyConfig(config *hub.Config) {
+	s.configs <- config
+}
+
 // pipeStatusUpdate pipes a StatusUpdate into the supervisor.
 func (s *Supervisor) pipeStatusUpdate(su *communication.StatusUpdate) {
 	s.statusUpdates <- *su
@@ -210,12 +363,32 @@ func (s *Supervisor) pipeInfoRetrieved(ir *communication.InfoRetrieved) {
 	s.infoRetrieved <- *ir
 }
 
+// pipeTaskFailed pipes a TaskFailed into the supervisor.
+func (s *Supervisor) pipeTaskFailed(tf *communication.TaskFailed) {
+	s.taskFailed <- *tf
+}
+
 // pipeCrawlRetrieved pipes a CrawlRetrieved into the supervisor.
 func (s *Supervisor) pipeCrawlRetrieved(cr *communication.CrawlRetrieved) {
 	s.crawlRetrieved <- *cr
 }
 
+// pipeCrawlRequest pipes a CrawlRequest into the supervisor.
+func (s *Supervisor) pipeCrawlRequest(cr *communication.CrawlRequest) {
+	s.crawlRequests <- *cr
+}
+
+// pipeDiscoveryRetrieved pipes a DiscoveryRetrieved into the supervisor.
+func (s *Supervisor) pipeDiscoveryRetrieved(dr *communication.DiscoveryRetrieved) {
+	s.discoveryRetrieved <- *dr
+}
+
 func (s *Supervisor) loop() {
+	expiryTicker := time.NewTicker(taskExpiryCheckInterval)
+	defer expiryTicker.Stop()
+	discoveryTicker := time.NewTicker(discoveryCheckInterval)
+	defer discoveryTicker.Stop()
+
 	for {
 		select {
 		case su := <-s.statusUpdates:
@@ -226,10 +399,29 @@ func (s *Supervisor) loop() {
 			go s.handleGoingAway(&ga)
 		case ir := <-s.infoRetrieved:
 			go s.handleInfoRetrieved(&ir)
+		case tf := <-s.taskFailed:
+			go s.handleTaskFailed(&tf)
 		case cr := <-s.crawlRetrieved:
 			go s.crawler.PipeRetrieval(&cr)
+		case cr := <-s.crawlRequests:
+			go s.handleCrawlRequest(&cr)
+		case dr := <-s.discoveryRetrieved:
+			go s.handleDiscoveryRetrieved(&dr)
 		case server := <-s.serverDown:
 			s.terminateServer(&server)
+		case config := <-s.configs:
+			s.applyConfig(config)
+		case <-expiryTicker.C:
+			if expired := s.dispatches.Expire(TaskExpiry); len(expired) > 0 {
+				metrics.TasksExpired.Add(float64(len(expired)))
+				s.log.Warn("dispatched tasks expired without a response", zap.Int("count", len(expired)))
+
+				for _, task := range expired {
+					s.requeueTask(task, retryDelay(task, 0))
+				}
+			}
+		case <-discoveryTicker.C:
+			go s.dispatchDueDiscoveries()
 		case <-s.shutdown:
 			s.cleanup()
 			return
@@ -237,47 +429,80 @@ func (s *Supervisor) loop() {
 	}
 }
 
+// applyConfig updates the heartbeat interval of every heartbeater, the Crawler's
+// scrape interval and the maximum dispatch rate.
+func (s *Supervisor) applyConfig(config *hub.Config) {
+	s.settingsMutex.Lock()
+	defer s.settingsMutex.Unlock()
+
+	if config.HeartbeatInterval != s.heartbeatInterval {
+		s.heartbeatInterval = config.HeartbeatInterval
+		s.serverMapMutex.RLock()
+		for _, hb := range s.heartbeaters {
+			hb.SetInterval(config.HeartbeatInterval)
+		}
+		s.serverMapMutex.RUnlock()
+
+		s.log.Info("applied new heartbeat interval", zap.Duration("interval", config.HeartbeatInterval))
+	}
+
+	s.budget.SetMaxRate(config.DispatchRate)
+
+	if config.ScrapeInterval != s.scrapeInterval {
+		s.scrapeInterval = config.ScrapeInterval
+		s.crawler.SetInterval(config.ScrapeInterval)
+
+		s.log.Info("applied new scrape interval", zap.Duration("interval", config.ScrapeInterval))
+	}
+}
+
 // cleanup gracefully shuts down the Supervisor.
 func (s *Supervisor) cleanup() {
+	s.serverMapMutex.Lock()
+	defer s.serverMapMutex.Unlock()
+
 	for id, hb := range s.heartbeaters {
-		if hb != nil {
-			err := hb.Shutdown()
-			if err != nil {
-				s.log.Error(fmt.Sprintf("error occurred while shutting down heartbeater for server %s", id), zap.Error(err))
-			}
+		err := hb.Shutdown()
+		if err != nil {
+			s.log.Error(fmt.Sprintf("error occurred while shutting down heartbeater for server %s", id), zap.Error(err))
 		}
 	}
 }
 
 func (s *Supervisor) handleStatusUpdate(su *communication.StatusUpdate) {
-	server := identity.NewClient(su.SenderID)
+	// Updates meant for another hub mustn't welcome the client away from it.
+	if su.ReceiverID != "" && su.ReceiverID != s.identity.ID {
+		return
+	}
+
 	status := ServerStatus{
 		AvailableForWork: su.AvailableForWork,
 	}
 
-	// Compare the new status with the old one and log changes.
-	if oldStatus, ok := s.serverMap[su.SenderID]; !ok || !reflect.DeepEqual(status, oldStatus) {
-		s.log.Info(
-			fmt.Sprintf("status changed for server %s", su.SenderID),
-			zap.String("status", fmt.Sprintf("%+v", status)),
-		)
-	}
+	known := s.registerServer(su.SenderID, status)
 
-	if _, ok := s.serverMap[su.SenderID]; !ok {
-		s.heartbeaters[server.ID] = hub.NewHeartbeater(s.identity, server, HeartbeatInterval, s.serverDown, s.conn, s.log)
-		if err := s.heartbeaters[su.SenderID].Start(); err != nil {
-			s.log.Error(
-				fmt.Sprintf("error occurred starting heartbeater for server %s", su.SenderID),
-				zap.Error(err),
-			)
+	// Pause dispatching to retailers whose hosts the client is failing requests to.
+	for _, circuit := range su.OpenCircuits {
+		if circuit.State != "open" {
+			continue
 		}
-	}
 
-	s.serverMapMutex.Lock()
-	defer s.serverMapMutex.Unlock()
+		retailer := retailerOrDefault(circuit.Retailer)
+		s.budget.Pause(retailer, circuit.RetryAfter)
+		s.log.Warn(
+			"client opened circuit, pausing dispatches",
+			zap.String("host", circuit.Host),
+			zap.String("retailer", retailer),
+			zap.Duration("for", circuit.RetryAfter),
+			zap.String("serverId", su.SenderID),
+		)
+	}
 
-	// Replace the status with the new one.
-	s.serverMap[su.SenderID] = status
+	// Clients send further status updates when their circuits change, which shouldn't
+	// make them switch hubs.
+	if known {
+		return
+	}
 
 	err := s.conn.SendMessage(communication.HubWelcome{
 		SingleReceiverPacket: communication.SingleReceiverPacket{
@@ -293,13 +518,60 @@ func (s *Supervisor) handleStatusUpdate(su *communication.StatusUpdate) {
 	}
 }
 
+// registerServer records a client's status, starting to heartbeat it if it is new.
+// Returns true if the client was already known. Status updates are handled
+// concurrently, so the client is looked up and registered in one critical section to
+// start a single heartbeater for it.
+func (s *Supervisor) registerServer(id string, status ServerStatus) bool {
+	s.settingsMutex.RLock()
+	defer s.settingsMutex.RUnlock()
+	s.serverMapMutex.Lock()
+	defer s.serverMapMutex.Unlock()
+
+	// Compare the new status with the old one and log changes.
+	oldStatus, known := s.serverMap[id]
+	if !known || !reflect.DeepEqual(status, oldStatus) {
+		s.log.Info(
+			fmt.Sprintf("status changed for server %s", id),
+			zap.String("status", fmt.Sprintf("%+v", status)),
+		)
+	}
+
+	if !known {
+		heartbeater := hub.NewHeartbeater(s.identity, identity.NewClient(id), s.heartbeatInterval, s.serverDown, s.conn, s.log)
+		s.heartbeaters[id] = heartbeater
+		if err := heartbeater.Start(); err != nil {
+			s.log.Error(
+				fmt.Sprintf("error occurred starting heartbeater for server %s", id),
+				zap.Error(err),
+			)
+		}
+	}
+
+	// Replace the status with the new one.
+	s.serverMap[id] = status
+	metrics.ConnectedClients.Set(float64(len(s.serverMap)))
+
+	return known
+}
+
+// serverCount returns the number of connected client servers.
+func (s *Supervisor) serverCount() int {
+	s.serverMapMutex.RLock()
+	defer s.serverMapMutex.RUnlock()
+
+	return len(s.serverMap)
+}
+
 func (s *Supervisor) handleHeartbeat(hb *communication.Heartbeat) {
 	if hb.SenderID == s.identity.ID || hb.ReceiverID != s.identity.ID {
 		return
 	}
 
 	server := identity.NewClient(hb.SenderID)
+	s.serverMapMutex.RLock()
 	h, ok := s.heartbeaters[server.ID]
+	s.serverMapMutex.RUnlock()
 	if !ok {
 		s.log.Error(fmt.Sprintf("server %s missing heartbeater, this shouldn't happen", server.ID))
 		return
@@ -326,19 +598,46 @@ func (s *Supervisor) handleInfoRetrieved(ir *communication.InfoRetrieved) {
 		return
 	}
 
+	ctx, span := tracer.Start(tracing.Extract(context.Background(), ir.TraceContext), "Supervisor.handleInfoRetrieved", trace.WithAttributes(
+		attribute.String("task.id", ir.TaskID),
+		attribute.String("server.id", ir.SenderID),
+	))
+	defer span.End()
+
 	pi := ir.ProductInfo
 
-	id, err := s.service.SaveProductInfo(pi)
+	// The info, its offers, the task's completion and its next repetition are saved
+	// together, so a redelivered message is ignored rather than saved twice.
+	_, completeSpan := tracer.Start(ctx, "Service.CompleteTask")
+	id, err := s.service.CompleteTask(ctx, ir.TaskID, pi, ir.Offers, func(st domain.ScrapeTask) {
+		s.taskManager.pushTaskToQueue(st)
+	})
+	tracing.End(completeSpan, err)
+	if errors.Is(err, hub.ErrTaskCompleted) {
+		metrics.DuplicateResults.Inc()
+		s.log.Debug("ignoring product info for completed task", zap.String("taskId", ir.TaskID), zap.String("serverId", ir.SenderID))
+		return
+	}
 	if err != nil {
+		metrics.DBErrors.WithLabelValues("complete_task").Inc()
 		s.log.Error(fmt.Sprintf("error saving product info for task %s", ir.TaskID), zap.Error(err))
 		return
 	}
 
-	err = s.service.ResolveTask(ir.TaskID, func(st domain.ScrapeTask) {
-		s.taskManager.pushTaskToQueue(st)
-	})
+	err = s.service.UpdateProductDetails(pi.ProductID, ir.Product)
 	if err != nil {
-		s.log.Error(fmt.Sprintf("error resolving task %s", ir.TaskID), zap.Error(err))
+		metrics.DBErrors.WithLabelValues("update_product_details").Inc()
+		s.log.Error(fmt.Sprintf("error updating product details for task %s", ir.TaskID), zap.Error(err))
+	}
+
+	if len(ir.Variants) > 0 {
+		go s.trackVariants(pi, ir.Variants)
+	}
+
+	metrics.TasksCompleted.Inc()
+	s.budget.Completed(retailerOrDefault(ir.Retailer))
+	if _, latency, ok := s.dispatches.Completed(ir.TaskID); ok {
+		metrics.InfoRetrievedLatency.Observe(latency.Seconds())
 	}
 
 	s.log.Debug("product info saved for task", zap.String("taskId", ir.TaskID), zap.String("productInfoId", id))
@@ -346,6 +645,88 @@ func (s *Supervisor) handleInfoRetrieved(ir *communication.InfoRetrieved) {
 	go s.crawler.AttemptCrawl(ir.ProductInfo.ProductLocationID)
 }
 
+// handleTaskFailed slows down dispatches to a retailer when a client gave up on a task
+// because the retailer blocked or rate limited it. The task is put back in the queue,
+// due when the retailer asked to retry or otherwise at its next interval. Tasks
+// turned away by an open circuit were never attempted, so they are retried once
+// dispatches to the retailer resume.
+func (s *Supervisor) handleTaskFailed(tf *communication.TaskFailed) {
+	if tf.SenderID == s.identity.ID || tf.ReceiverID != s.identity.ID {
+		return
+	}
+
+	metrics.TasksFailed.WithLabelValues(tf.Reason).Inc()
+
+	retryAfter := tf.RetryAfter
+	if tf.Reason == "circuit_open" && retryAfter <= 0 {
+		retryAfter = blockedPause
+	}
+
+	if task, _, ok := s.dispatches.Completed(tf.TaskID); ok {
+		s.requeueTask(task, retryDelay(task, retryAfter))
+	}
+
+	retailer := retailerOrDefault(tf.Retailer)
+	switch tf.Reason {
+	case "blocked", "rate_limited":
+		s.budget.Throttle(retailer, tf.RetryAfter)
+		s.log.Warn(
+			"client throttled by retailer, slowing down dispatches",
+			zap.String("retailer", retailer),
+			zap.String("reason", tf.Reason),
+			zap.Float64("rate", s.budget.Rate(retailer)),
+			zap.String("serverId", tf.SenderID),
+		)
+	case "circuit_open":
+		s.budget.Pause(retailer, retryAfter)
+		s.log.Warn(
+			"client's circuit is open, pausing dispatches",
+			zap.String("retailer", retailer),
+			zap.Duration("for", retryAfter),
+			zap.String("serverId", tf.SenderID),
+		)
+	default:
+		s.log.Info("client gave up on task", zap.String("taskId", tf.TaskID), zap.String("productLocationId", tf.ProductLocationID), zap.String("reason", tf.Reason))
+	}
+}
+
+// handleCrawlRequest crawls from a product location requested by an operator tool, if
+// the request was addressed to this hub.
+func (s *Supervisor) handleCrawlRequest(cr *communication.CrawlRequest) {
+	if cr.ReceiverID != s.identity.ID {
+		return
+	}
+
+	s.log.Info("crawl requested", zap.String("productLocationId", cr.ProductLocationID), zap.String("senderId", cr.SenderID))
+	s.crawler.ForceCrawl(cr.ProductLocationID)
+}
+
+// trackVariants starts tracking the variants found on a product's page, as children of
+// the product or of its parent if the product is itself a variant.
+func (s *Supervisor) trackVariants(pi domain.ProductInfo, variants []domain.ProductLocation) {
+	pl, err := s.service.GetProductLocationByID(pi.ProductLocationID)
+	if err != nil {
+		metrics.DBErrors.WithLabelValues("get_product_location").Inc()
+		s.log.Error("error getting ProductLocation of variants", zap.String("productLocationID", pi.ProductLocationID), zap.Error(err))
+		return
+	}
+
+	product, err := s.service.GetProductByID(pi.ProductID)
+	if err != nil {
+		metrics.DBErrors.WithLabelValues("get_product").Inc()
+		s.log.Error("error getting Product of variants", zap.String("productID", pi.ProductID), zap.Error(err))
+		return
+	}
+
+	parentID := product.ID
+	if product.ParentID != "" {
+		parentID = product.ParentID
+	}
+
+	tracked := s.crawler.TrackVariants(parentID, pl.LocationID, variants)
+	metrics.TrackedVariants.Add(float64(tracked))
+}
+
 // terminateServer removes a single server from the supervisor and shuts down all listeners
 // attached to it.
 func (s *Supervisor) terminateServer(server *identity.Server) {
@@ -353,12 +734,15 @@ func (s *Supervisor) terminateServer(server *identity.Server) {
 	defer s.serverMapMutex.Unlock()
 
 	s.log.Debug(fmt.Sprintf("disconnecting from server %s", server.ID))
-	err := s.heartbeaters[server.ID].Shutdown()
-	if err != nil {
-		s.log.Error(fmt.Sprintf("error occurred while shutting down heartbeater for server %s", server.ID), zap.Error(err))
+	if hb, ok := s.heartbeaters[server.ID]; ok {
+		if err := hb.Shutdown(); err != nil {
+			s.log.Error(fmt.Sprintf("error occurred while shutting down heartbeater for server %s", server.ID), zap.Error(err))
+		}
+		delete(s.heartbeaters, server.ID)
 	}
 
 	delete(s.serverMap, server.ID)
+	metrics.ConnectedClients.Set(float64(len(s.serverMap)))
 
 	s.log.Info(fmt.Sprintf("disconnected from server %s", server.ID))
 }
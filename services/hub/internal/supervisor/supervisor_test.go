@@ -0,0 +1,241 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bfoody/Walmart-Scraper/communication"
+	"github.com/bfoody/Walmart-Scraper/domain"
+	"github.com/bfoody/Walmart-Scraper/identity"
+	"github.com/bfoody/Walmart-Scraper/services/hub"
+	"github.com/bfoody/Walmart-Scraper/services/hub/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+// fakeService implements the parts of hub.Service used when handling an
+// InfoRetrieved, completing tasks with whatever error the test sets. Deduplication of
+// replayed results is tested against the real service.
+type fakeService struct {
+	hub.Service
+	mutex       *sync.Mutex
+	completeErr error
+	completed   []string
+	crawlChecks chan string
+}
+
+func newFakeService() *fakeService {
+	return &fakeService{
+		mutex:       &sync.Mutex{},
+		crawlChecks: make(chan string, 4),
+	}
+}
+
+func (s *fakeService) CompleteTask(ctx context.Context, id string, productInfo domain.ProductInfo, offers []domain.Offer, newCallback func(st domain.ScrapeTask)) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.completed = append(s.completed, id)
+	if s.completeErr != nil {
+		return "", s.completeErr
+	}
+
+	newCallback(domain.ScrapeTask{ID: id + "-next", ProductLocationID: productInfo.ProductLocationID})
+	return "info-" + id, nil
+}
+
+func (s *fakeService) UpdateProductDetails(productID string, details domain.Product) error {
+	return nil
+}
+
+func (s *fakeService) IsCrawled(productLocationID string) (bool, error) {
+	s.crawlChecks <- productLocationID
+	return true, nil
+}
+
+// newTestSupervisor returns a *Supervisor of the hub "hub" handling results with
+// `service`.
+func newTestSupervisor(service *fakeService) *Supervisor {
+	s := &Supervisor{
+		identity:          identity.NewHub("hub"),
+		service:           service,
+		serverMapMutex:    &sync.RWMutex{},
+		serverMap:         map[string]ServerStatus{},
+		heartbeaters:      map[string]*hub.Heartbeater{},
+		log:               zap.NewNop(),
+		taskManager:       NewTaskManager(service, zap.NewNop()),
+		dispatches:        NewDispatchTracker(),
+		budget:            NewRateBudget(10),
+		settingsMutex:     &sync.RWMutex{},
+		heartbeatInterval: time.Hour,
+	}
+	s.crawler = NewCrawler(service, zap.NewNop(), func(string) {}, s.taskManager, time.Hour)
+
+	return s
+}
+
+// newInfoRetrieved returns an InfoRetrieved for a task, sent by "client" to "hub".
+func newInfoRetrieved(taskID string) *communication.InfoRetrieved {
+	return &communication.InfoRetrieved{
+		SingleReceiverPacket: communication.SingleReceiverPacket{SenderID: "client", ReceiverID: "hub"},
+		TaskID:               taskID,
+		ProductInfo: domain.ProductInfo{
+			ProductID:          "product",
+			ProductLocationID:  "location",
+			AvailabilityStatus: "IN_STOCK",
+		},
+		Retailer: domain.RetailerWalmart,
+	}
+}
+
+func TestHandleInfoRetrievedReplay(t *testing.T) {
+	service := newFakeService()
+	s := newTestSupervisor(service)
+	ir := newInfoRetrieved("task")
+
+	s.dispatches.Dispatched(domain.ScrapeTask{ID: "task"})
+	s.handleInfoRetrieved(ir)
+
+	select {
+	case <-service.crawlChecks:
+	case <-time.After(time.Second):
+		t.Fatal("expected the first InfoRetrieved to attempt a crawl")
+	}
+
+	// The service rejects the replayed message as already completed, so the supervisor
+	// must not schedule another task or attempt another crawl.
+	service.completeErr = hub.ErrTaskCompleted
+	s.handleInfoRetrieved(ir)
+
+	if len(service.completed) != 2 {
+		t.Fatalf("expected both messages to reach the service, got %d", len(service.completed))
+	}
+
+	if s.taskManager.queue.Len() != 1 {
+		t.Errorf("expected 1 queued task, got %d", s.taskManager.queue.Len())
+	}
+
+	select {
+	case id := <-service.crawlChecks:
+		t.Errorf("expected replay not to attempt a crawl, got one for %s", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// TestHandleInfoRetrievedCountsSuccesses tests that only results which were saved are
+// counted as completed tasks.
+func TestHandleInfoRetrievedCountsSuccesses(t *testing.T) {
+	service := newFakeService()
+	s := newTestSupervisor(service)
+	before := testutil.ToFloat64(metrics.TasksCompleted)
+
+	service.completeErr = errors.New("connection refused")
+	s.handleInfoRetrieved(newInfoRetrieved("failed"))
+	service.completeErr = hub.ErrTaskCompleted
+	s.handleInfoRetrieved(newInfoRetrieved("replayed"))
+
+	if completed := testutil.ToFloat64(metrics.TasksCompleted) - before; completed != 0 {
+		t.Errorf("expected failed and replayed results not to be counted, got %v", completed)
+	}
+
+	service.completeErr = nil
+	s.handleInfoRetrieved(newInfoRetrieved("saved"))
+
+	if completed := testutil.ToFloat64(metrics.TasksCompleted) - before; completed != 1 {
+		t.Errorf("expected the saved result to be counted, got %v", completed)
+	}
+}
+
+// TestHandleTaskFailedRequeues tests that a failed task is put back in the queue, due
+// when the retailer asked to retry or otherwise at its interval, so that it is
+// dispatched again.
+func TestHandleTaskFailedRequeues(t *testing.T) {
+	service := newFakeService()
+	s := newTestSupervisor(service)
+
+	failed := func(id string, retryAfter time.Duration) {
+		s.dispatches.Dispatched(domain.ScrapeTask{ID: id, Repeat: true, Interval: time.Hour})
+		s.handleTaskFailed(&communication.TaskFailed{
+			SingleReceiverPacket: communication.SingleReceiverPacket{SenderID: "client", ReceiverID: "hub"},
+			TaskID:               id,
+			Retailer:             domain.RetailerWalmart,
+			Reason:               "blocked",
+			RetryAfter:           retryAfter,
+		})
+	}
+
+	failed("later", 0)
+	failed("soon", time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+
+	task, ok := s.taskManager.TryPopTask()
+	if !ok || task.ID != "soon" {
+		t.Fatalf("expected the task to be dispatched again after its retry delay, got %v", task)
+	}
+
+	if _, ok := s.taskManager.TryPopTask(); ok {
+		t.Error("expected the task without a retry delay to wait for its interval")
+	}
+
+	if s.taskManager.queue.Len() != 1 {
+		t.Errorf("expected 1 queued task, got %d", s.taskManager.queue.Len())
+	}
+}
+
+// TestHandleTaskFailedCircuitOpen tests that tasks turned away by a client's open
+// circuit are retried once dispatches resume, rather than at their next interval.
+func TestHandleTaskFailedCircuitOpen(t *testing.T) {
+	service := newFakeService()
+	s := newTestSupervisor(service)
+
+	for _, id := range []string{"task-1", "task-2"} {
+		s.dispatches.Dispatched(domain.ScrapeTask{ID: id, Repeat: true, Interval: 24 * time.Hour})
+		s.handleTaskFailed(&communication.TaskFailed{
+			SingleReceiverPacket: communication.SingleReceiverPacket{SenderID: "client", ReceiverID: "hub"},
+			TaskID:               id,
+			Retailer:             domain.RetailerWalmart,
+			Reason:               "circuit_open",
+		})
+	}
+
+	if s.taskManager.queue.Len() != 2 {
+		t.Fatalf("expected both tasks to be requeued, got %d", s.taskManager.queue.Len())
+	}
+
+	for id, task := range s.taskManager.tasks {
+		if until := time.Until(task.ScheduledFor); until > blockedPause {
+			t.Errorf("%s: expected to be retried after the pause, due in %s", id, until)
+		}
+	}
+}
+
+// TestRegisterServerConcurrently tests that concurrent status updates from a new client
+// register it, and start a heartbeater for it, only once.
+func TestRegisterServerConcurrently(t *testing.T) {
+	s := newTestSupervisor(newFakeService())
+
+	wg := &sync.WaitGroup{}
+	mutex := &sync.Mutex{}
+	registered := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if !s.registerServer("client", ServerStatus{AvailableForWork: true}) {
+				mutex.Lock()
+				registered++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	defer s.cleanup()
+
+	if registered != 1 || len(s.heartbeaters) != 1 || s.serverCount() != 1 {
+		t.Errorf("expected the client to be registered once, got %d registrations and %d heartbeaters", registered, len(s.heartbeaters))
+	}
+}
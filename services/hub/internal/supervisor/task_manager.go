@@ -2,13 +2,20 @@ package supervisor
 
 import (
 	"container/list"
+	"context"
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bfoody/Walmart-Scraper/domain"
 	"github.com/bfoody/Walmart-Scraper/services/hub"
+	"github.com/bfoody/Walmart-Scraper/services/hub/internal/metrics"
+	"github.com/bfoody/Walmart-Scraper/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 )
 
 const (
@@ -22,17 +29,20 @@ type TaskManager struct {
 	tasks         map[string]domain.ScrapeTask
 	queue         *list.List
 	resolvedTasks map[string]bool
-	callback      func(task domain.ScrapeTask)
+	callback      func(ctx context.Context, task domain.ScrapeTask)
+	running       int32 // set to 1 while the main loop is running, accessed atomically
+	log           *zap.Logger
 }
 
 // NewTaskManager creates and returns a new TaskManager.
-func NewTaskManager(service hub.Service) *TaskManager {
+func NewTaskManager(service hub.Service, logger *zap.Logger) *TaskManager {
 	return &TaskManager{
 		service:       service,
 		queueMutex:    &sync.RWMutex{},
 		tasks:         map[string]domain.ScrapeTask{},
 		queue:         list.New(),
 		resolvedTasks: map[string]bool{},
+		log:           logger,
 	}
 }
 
@@ -43,20 +53,35 @@ func (t *TaskManager) Initialize() error {
 
 // Start begins the main loop of the TaskManager and delivers tasks to the `callback`
 // function when they are due.
-func (t *TaskManager) Start(callback func(task domain.ScrapeTask)) {
+func (t *TaskManager) Start(callback func(ctx context.Context, task domain.ScrapeTask)) {
 	t.callback = callback
 
 	go t.loop()
 }
 
+// Running returns true if the TaskManager's main loop is running.
+func (t *TaskManager) Running() bool {
+	return atomic.LoadInt32(&t.running) == 1
+}
+
 func (t *TaskManager) loop() {
+	atomic.StoreInt32(&t.running, 1)
+	defer atomic.StoreInt32(&t.running, 0)
+
 	for {
 		task, ready := t.TryPopTask()
 		if !ready {
 			continue
 		}
 
-		t.callback(*task)
+		t.log.Debug("task due, dispatching", zap.String("taskId", task.ID), zap.Time("scheduledFor", task.ScheduledFor))
+
+		ctx, span := tracer.Start(context.Background(), "TaskManager.popTask", trace.WithAttributes(
+			attribute.String("task.id", task.ID),
+			attribute.String("task.scheduledFor", task.ScheduledFor.String()),
+		))
+		t.callback(ctx, *task)
+		tracing.End(span, nil)
 	}
 }
 
@@ -89,6 +114,8 @@ func (t *TaskManager) fetchTaskList() error {
 		t.pushTaskToQueue(task)
 	}
 
+	t.log.Debug("fetched upcoming tasks", zap.Int("count", len(tasks)))
+
 	return nil
 }
 
@@ -100,6 +127,7 @@ func (t *TaskManager) pushTaskToQueue(task domain.ScrapeTask) {
 	t.tasks[task.ID] = task
 
 	t.sortedEnqueue(task.ID)
+	metrics.QueueDepth.Set(float64(t.queue.Len()))
 }
 
 // sortedEnqueue adds a task ID to the task queue after it has been added to the map.
@@ -153,6 +181,7 @@ func (t *TaskManager) popTask() (*domain.ScrapeTask, error) {
 
 	t.queueMutex.Lock()
 	defer t.queueMutex.Unlock()
+	defer func() { metrics.QueueDepth.Set(float64(t.queue.Len())) }()
 
 	return t._popTask()
 }
@@ -7,6 +7,7 @@ import (
 
 	"github.com/bfoody/Walmart-Scraper/domain"
 	"github.com/bfoody/Walmart-Scraper/utils/uuid"
+	"go.uber.org/zap"
 )
 
 var fakeTasks []domain.ScrapeTask = []domain.ScrapeTask{
@@ -85,7 +86,7 @@ func fakeTaskGenerator(num int) []domain.ScrapeTask {
 }
 
 func TestQueueOrder(t *testing.T) {
-	tm := NewTaskManager(nil)
+	tm := NewTaskManager(nil, zap.NewNop())
 	tasks := fakeTaskGenerator(5000)
 	// tasks := fakeTasks
 
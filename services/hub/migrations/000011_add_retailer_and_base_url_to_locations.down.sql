@@ -0,0 +1,2 @@
+ALTER TABLE locations DROP COLUMN retailer;
+ALTER TABLE locations DROP COLUMN base_url;
@@ -0,0 +1,7 @@
+ALTER TABLE locations ADD COLUMN retailer TEXT NOT NULL DEFAULT 'walmart';
+ALTER TABLE locations ADD COLUMN base_url TEXT NOT NULL DEFAULT 'https://www.walmart.com';
+ALTER TABLE locations ALTER COLUMN retailer DROP DEFAULT;
+ALTER TABLE locations ALTER COLUMN base_url DROP DEFAULT;
+
+-- The Walmart location products were previously tracked under without it being registered.
+INSERT INTO locations (id, name, retailer, base_url) VALUES ('8e1922b0-6c12-4bd6-944e-9f87d0b15359', 'Walmart', 'walmart', 'https://www.walmart.com') ON CONFLICT (id) DO NOTHING;
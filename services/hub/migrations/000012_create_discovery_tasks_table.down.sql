@@ -0,0 +1 @@
+DROP TABLE discovery_tasks;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS discovery_tasks (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL,
+	location_id UUID NOT NULL,
+	kind TEXT NOT NULL,
+	query TEXT NOT NULL,
+	max_pages INTEGER NOT NULL,
+	scheduled_for TIMESTAMPTZ NOT NULL,
+	interval BIGINT NOT NULL,
+	CONSTRAINT fk_location
+	FOREIGN KEY(location_id)
+	REFERENCES locations(id)
+);
+
+CREATE INDEX index_discovery_tasks_scheduled_for ON discovery_tasks USING btree(scheduled_for);
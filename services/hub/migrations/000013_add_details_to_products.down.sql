@@ -0,0 +1,5 @@
+DROP INDEX index_products_upc;
+ALTER TABLE products DROP COLUMN brand;
+ALTER TABLE products DROP COLUMN manufacturer;
+ALTER TABLE products DROP COLUMN upc;
+ALTER TABLE products DROP COLUMN image_urls;
@@ -0,0 +1,6 @@
+ALTER TABLE products ADD COLUMN brand TEXT NOT NULL DEFAULT '';
+ALTER TABLE products ADD COLUMN manufacturer TEXT NOT NULL DEFAULT '';
+ALTER TABLE products ADD COLUMN upc TEXT NOT NULL DEFAULT '';
+ALTER TABLE products ADD COLUMN image_urls TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX index_products_upc ON products USING btree(upc) WHERE upc <> '';
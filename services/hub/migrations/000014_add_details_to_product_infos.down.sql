@@ -0,0 +1,13 @@
+ALTER TABLE product_infos DROP COLUMN list_price;
+ALTER TABLE product_infos DROP COLUMN unit_price;
+ALTER TABLE product_infos DROP COLUMN unit_of_measure;
+ALTER TABLE product_infos DROP COLUMN seller_id;
+ALTER TABLE product_infos DROP COLUMN seller_name;
+ALTER TABLE product_infos DROP COLUMN third_party_seller;
+ALTER TABLE product_infos DROP COLUMN rating;
+ALTER TABLE product_infos DROP COLUMN review_count;
+ALTER TABLE product_infos DROP COLUMN free_shipping;
+ALTER TABLE product_infos DROP COLUMN in_store;
+ALTER TABLE product_infos DROP COLUMN online;
+ALTER TABLE product_infos DROP COLUMN preorder;
+ALTER TABLE product_infos DROP COLUMN shipping_options;
@@ -0,0 +1,13 @@
+ALTER TABLE product_infos ADD COLUMN list_price DECIMAL NOT NULL DEFAULT 0;
+ALTER TABLE product_infos ADD COLUMN unit_price DECIMAL NOT NULL DEFAULT 0;
+ALTER TABLE product_infos ADD COLUMN unit_of_measure TEXT NOT NULL DEFAULT '';
+ALTER TABLE product_infos ADD COLUMN seller_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE product_infos ADD COLUMN seller_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE product_infos ADD COLUMN third_party_seller BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE product_infos ADD COLUMN rating DECIMAL NOT NULL DEFAULT 0;
+ALTER TABLE product_infos ADD COLUMN review_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE product_infos ADD COLUMN free_shipping BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE product_infos ADD COLUMN in_store BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE product_infos ADD COLUMN online BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE product_infos ADD COLUMN preorder BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE product_infos ADD COLUMN shipping_options TEXT[] NOT NULL DEFAULT '{}';
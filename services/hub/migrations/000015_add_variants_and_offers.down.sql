@@ -0,0 +1,4 @@
+DROP TABLE offers;
+DROP INDEX index_products_parent_id;
+ALTER TABLE product_locations DROP COLUMN variant;
+ALTER TABLE products DROP COLUMN parent_id;
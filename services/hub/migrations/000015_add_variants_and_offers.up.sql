@@ -0,0 +1,21 @@
+ALTER TABLE products ADD COLUMN parent_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE product_locations ADD COLUMN variant TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX index_products_parent_id ON products USING btree(parent_id) WHERE parent_id <> '';
+
+CREATE TABLE IF NOT EXISTS offers (
+	id UUID PRIMARY KEY,
+	product_info_id UUID NOT NULL,
+	seller_id TEXT NOT NULL,
+	seller_name TEXT NOT NULL,
+	third_party_seller BOOLEAN NOT NULL,
+	price DECIMAL NOT NULL,
+	availability_status TEXT NOT NULL,
+	in_stock BOOLEAN NOT NULL,
+	buy_box BOOLEAN NOT NULL,
+	CONSTRAINT fk_product_info
+	FOREIGN KEY(product_info_id)
+	REFERENCES product_infos(id)
+);
+
+CREATE INDEX index_offers_product_info_id ON offers USING btree(product_info_id);
@@ -0,0 +1,4 @@
+ALTER TABLE scrape_tasks DROP COLUMN store_id;
+ALTER TABLE scrape_tasks DROP COLUMN zip_code;
+ALTER TABLE product_infos DROP COLUMN store_id;
+ALTER TABLE product_infos DROP COLUMN zip_code;
@@ -0,0 +1,4 @@
+ALTER TABLE scrape_tasks ADD COLUMN store_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE scrape_tasks ADD COLUMN zip_code TEXT NOT NULL DEFAULT '';
+ALTER TABLE product_infos ADD COLUMN store_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE product_infos ADD COLUMN zip_code TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE product_infos DROP COLUMN extraction_strategy;
@@ -0,0 +1 @@
+ALTER TABLE product_infos ADD COLUMN extraction_strategy TEXT NOT NULL DEFAULT '';
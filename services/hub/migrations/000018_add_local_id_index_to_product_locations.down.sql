@@ -0,0 +1 @@
+DROP INDEX index_product_locations_location_id_local_id;
@@ -0,0 +1 @@
+CREATE INDEX index_product_locations_location_id_local_id ON product_locations USING btree(location_id, local_id);
@@ -0,0 +1,2 @@
+DROP INDEX index_product_infos_task_id;
+ALTER TABLE product_infos DROP COLUMN task_id;
@@ -0,0 +1,3 @@
+ALTER TABLE product_infos ADD COLUMN task_id TEXT NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX index_product_infos_task_id ON product_infos USING btree(task_id) WHERE task_id <> '';
@@ -0,0 +1,4 @@
+-- Fails if a product is tracked more than once at a location. Stop the hub and run
+-- `make migrate-dedup` instead of `make migrate` to merge duplicates before this runs.
+DROP INDEX index_product_locations_location_id_local_id;
+ALTER TABLE product_locations ADD CONSTRAINT unique_product_locations_location_id_local_id UNIQUE (location_id, local_id);
@@ -0,0 +1,7 @@
+DROP INDEX index_products_parent_id;
+
+ALTER TABLE products DROP CONSTRAINT fk_parent_product;
+ALTER TABLE products ALTER COLUMN parent_id TYPE TEXT USING COALESCE(parent_id::text, '');
+ALTER TABLE products ALTER COLUMN parent_id SET DEFAULT '', ALTER COLUMN parent_id SET NOT NULL;
+
+CREATE INDEX index_products_parent_id ON products USING btree(parent_id) WHERE parent_id <> '';
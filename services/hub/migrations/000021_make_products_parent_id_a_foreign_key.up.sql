@@ -0,0 +1,12 @@
+DROP INDEX index_products_parent_id;
+
+ALTER TABLE products ALTER COLUMN parent_id DROP DEFAULT, ALTER COLUMN parent_id DROP NOT NULL;
+UPDATE products SET parent_id = NULL WHERE parent_id = '';
+ALTER TABLE products ALTER COLUMN parent_id TYPE UUID USING parent_id::uuid;
+
+-- Variants of products that no longer exist stop being variants.
+UPDATE products SET parent_id = NULL WHERE parent_id IS NOT NULL AND parent_id NOT IN (SELECT id FROM products);
+
+ALTER TABLE products ADD CONSTRAINT fk_parent_product FOREIGN KEY(parent_id) REFERENCES products(id);
+
+CREATE INDEX index_products_parent_id ON products USING btree(parent_id) WHERE parent_id IS NOT NULL;
@@ -1,6 +1,16 @@
 package hub
 
-import "github.com/bfoody/Walmart-Scraper/domain"
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bfoody/Walmart-Scraper/domain"
+)
+
+// ErrTaskCompleted is returned when saving the result of a scrape task that was already
+// completed, eg. because the result was delivered twice.
+var ErrTaskCompleted = errors.New("task already completed")
 
 // A ProductRepository provides methods for interfacing with Products stored
 // in the database.
@@ -11,10 +21,31 @@ type ProductRepository interface {
 	InsertProduct(product domain.Product) (string, error)
 	// UpdateProduct updates a single product in the database by ID.
 	UpdateProduct(product domain.Product) error
+	// MoveProductVariants makes all variants of a product variants of another product.
+	MoveProductVariants(fromParentID, toParentID string) error
 	// DeleteProduct deletes a single product by ID.
 	DeleteProduct(id string) error
 }
 
+// A LocationRepository provides methods for interfacing with Locations stored in the
+// database.
+type LocationRepository interface {
+	// FindLocationByID finds a single location by ID, returning an error if nothing is found.
+	FindLocationByID(id string) (*domain.Location, error)
+	// FindLocations finds all locations ordered by name, returning an empty array if
+	// nothing is found.
+	FindLocations() ([]domain.Location, error)
+	// FindMissingLocationIDs finds the IDs of locations referenced by product locations
+	// that don't exist, returning an empty array if there are none.
+	FindMissingLocationIDs() ([]string, error)
+	// InsertLocation inserts a single location into the database, returning the ID on success.
+	InsertLocation(location domain.Location) (string, error)
+	// UpdateLocation updates a single location in the database by ID.
+	UpdateLocation(location domain.Location) error
+	// DeleteLocation deletes a single location by ID.
+	DeleteLocation(id string) error
+}
+
 // A ProductLocationRepository provides methods for interfacing with ProductLocations
 // stored in the database.
 type ProductLocationRepository interface {
@@ -30,9 +61,22 @@ type ProductLocationRepository interface {
 	// FindProductLocationByProductAndLocationID finds a single product location by both a product
 	// and location ID, returning an error if nothing is found.
 	FindProductLocationByProductAndLocationID(productID, locationID string) (*domain.ProductLocation, error)
+	// FindProductLocationByLocalID finds a single product location by its location ID and
+	// the ID used by the location for it, returning an error if nothing is found.
+	FindProductLocationByLocalID(locationID, localID string) (*domain.ProductLocation, error)
+	// FindDuplicateProductLocations finds every product location sharing its location ID
+	// and local ID with another, ordered by location ID and local ID, then by the number
+	// of product infos recorded for them, most first, returning an empty array if there
+	// are none.
+	FindDuplicateProductLocations() ([]domain.ProductLocation, error)
 	// InsertProductLocation inserts a single product location into the database,
 	// returning the ID on success.
 	InsertProductLocation(productLocation domain.ProductLocation) (string, error)
+	// UpsertProductLocation inserts a single product location into the database, or
+	// updates the details of the product location with the same location ID and local ID
+	// if there is one, keeping its product and any details that are empty. It returns the
+	// ID of the product location and whether it was inserted.
+	UpsertProductLocation(productLocation domain.ProductLocation) (string, bool, error)
 	// UpdateProductLocation updates a single product location in the database by ID.
 	UpdateProductLocation(productLocation domain.ProductLocation) error
 	// DeleteProductLocation deletes a single product location by ID.
@@ -44,14 +88,31 @@ type ProductLocationRepository interface {
 type ProductInfoRepository interface {
 	// FindProductInfoByID finds a single product info by ID, returning an error if nothing is found.
 	FindProductInfoByID(id string) (*domain.ProductInfo, error)
+	// FindProductInfosByProductID finds all product infos for a product, ordered from oldest
+	// to newest, returning an empty array if nothing is found.
+	FindProductInfosByProductID(id string) ([]domain.ProductInfo, error)
 	// InsertProductInfo inserts a single product into the database, returning the ID on success.
 	InsertProductInfo(productInfo domain.ProductInfo) (string, error)
+	// MoveProductInfos moves all product infos recorded for a product location to another
+	// product location and its product.
+	MoveProductInfos(fromProductLocationID, toProductLocationID, toProductID string) error
 	// UpdateProductInfo updates a single product info in the database by ID.
 	UpdateProductInfo(productInfo domain.ProductInfo) error
 	// DeleteProductInfo deletes a single product info by ID.
 	DeleteProductInfo(id string) error
 }
 
+// An OfferRepository provides methods for interfacing with Offers stored in the database.
+type OfferRepository interface {
+	// FindOffersByProductInfoID finds all offers observed with a product info, buy box
+	// first, returning an empty array if nothing is found.
+	FindOffersByProductInfoID(id string) ([]domain.Offer, error)
+	// InsertOffer inserts a single offer into the database, returning the ID on success.
+	InsertOffer(offer domain.Offer) (string, error)
+	// DeleteOffersByProductInfoID deletes all offers observed with a product info.
+	DeleteOffersByProductInfoID(id string) error
+}
+
 // A ScrapeTaskRepository provides methods for interfacing with ScrapeTasks
 // stored in the database.
 type ScrapeTaskRepository interface {
@@ -60,6 +121,9 @@ type ScrapeTaskRepository interface {
 	// FindUpcomingScrapeTasks returns due tasks closest to the current time, using the supplied
 	// limit.
 	FindUpcomingScrapeTasks(limit uint16) ([]domain.ScrapeTask, error)
+	// FindScrapeTasksCreatedSince finds scrape tasks created after the supplied time, ordered
+	// by creation time, returning a blank array if nothing is found.
+	FindScrapeTasksCreatedSince(since time.Time) ([]domain.ScrapeTask, error)
 	// FindScrapeTasksByProductLocationID finds scrape tasks by ProductLocationID, returning a
 	// blank array if nothing is found.
 	FindScrapeTasksByProductLocationID(id string) ([]domain.ScrapeTask, error)
@@ -71,6 +135,12 @@ type ScrapeTaskRepository interface {
 	FindScrapeTasksByLocationID(id string) ([]domain.ScrapeTask, error)
 	// InsertScrapeTask inserts a single scrape task into the database, returning the ID on success.
 	InsertScrapeTask(scrapeTask domain.ScrapeTask) (string, error)
+	// MoveScrapeTasks moves all scrape tasks for a product location to another product
+	// location.
+	MoveScrapeTasks(fromProductLocationID, toProductLocationID string) error
+	// DeleteDuplicateScrapeTasks deletes the pending scrape tasks for a product location
+	// scheduled after another pending task for the same store, keeping the earliest.
+	DeleteDuplicateScrapeTasks(productLocationID string) error
 	// UpdateScrapeTask updates a single scrape task in the database by ID.
 	UpdateScrapeTask(scrapeTask domain.ScrapeTask) error
 	// DeleteScrapeTask deletes a single scrape task by ID.
@@ -86,30 +156,132 @@ type CrawlTaskRepository interface {
 	FindCrawlTaskByProductLocationID(id string) (*domain.CrawlTask, error)
 	// InsertCrawlTask inserts a single crawl task into the database, returning the ID on success.
 	InsertCrawlTask(crawlTask domain.CrawlTask) (string, error)
+	// MoveCrawlTasks moves all crawl tasks from a product location to another product
+	// location, deleting completed ones if the other product location was already crawled.
+	MoveCrawlTasks(fromProductLocationID, toProductLocationID string) error
 	// UpdateCrawlTask updates a single crawl task in the database by ID.
 	UpdateCrawlTask(crawlTask domain.CrawlTask) error
 	// DeleteCrawlTask deletes a single crawl task by ID.
 	DeleteCrawlTask(id string) error
 }
 
+// A DiscoveryTaskRepository provides methods for interfacing with DiscoveryTasks
+// stored in the database.
+type DiscoveryTaskRepository interface {
+	// FindDiscoveryTaskByID finds a single discovery task by ID, returning an error if nothing is found.
+	FindDiscoveryTaskByID(id string) (*domain.DiscoveryTask, error)
+	// FindDiscoveryTasks finds all discovery tasks ordered by when they are next to be run,
+	// returning an empty array if nothing is found.
+	FindDiscoveryTasks() ([]domain.DiscoveryTask, error)
+	// FindDueDiscoveryTasks finds discovery tasks scheduled for before the supplied time,
+	// returning an empty array if nothing is found.
+	FindDueDiscoveryTasks(before time.Time) ([]domain.DiscoveryTask, error)
+	// InsertDiscoveryTask inserts a single discovery task into the database, returning the ID on success.
+	InsertDiscoveryTask(discoveryTask domain.DiscoveryTask) (string, error)
+	// UpdateDiscoveryTask updates a single discovery task in the database by ID.
+	UpdateDiscoveryTask(discoveryTask domain.DiscoveryTask) error
+	// DeleteDiscoveryTask deletes a single discovery task by ID.
+	DeleteDiscoveryTask(id string) error
+}
+
+// Repositories are the repositories available to a unit of work.
+type Repositories struct {
+	Locations        LocationRepository
+	Products         ProductRepository
+	ProductInfos     ProductInfoRepository
+	ProductLocations ProductLocationRepository
+	ScrapeTasks      ScrapeTaskRepository
+	CrawlTasks       CrawlTaskRepository
+	DiscoveryTasks   DiscoveryTaskRepository
+	Offers           OfferRepository
+}
+
+// A UnitOfWork runs operations across multiple repositories atomically.
+type UnitOfWork interface {
+	// Do calls `fn` with repositories running in a single transaction, committing it if
+	// `fn` returns nil and rolling it back otherwise, or if `ctx` is done first. `fn` may
+	// be called again if the transaction is retried, so it must not have side effects
+	// outside of the repositories.
+	Do(ctx context.Context, fn func(repositories Repositories) error) error
+}
+
+// A ProductLocationMerge describes duplicate ProductLocations of the same product at a
+// Location merged into one of them.
+type ProductLocationMerge struct {
+	LocationID   string
+	LocalID      string
+	SurvivorID   string   // the ID of the ProductLocation kept
+	DuplicateIDs []string // the IDs of the ProductLocations merged into the survivor and deleted
+}
+
 // A Service provides abstractions for interacting with product and task data in the database.
 type Service interface {
-	// ResolveTask marks the task with the provided ID as completed.
-	ResolveTask(id string, newCallback func(st domain.ScrapeTask)) error
+	// CompleteTask saves the ProductInfo and Offers retrieved for a task, marks it as
+	// completed and schedules its next repetition atomically, calling `newCallback` with
+	// the next task, if any. Offers missing a required field are dropped. It returns the
+	// ID of the ProductInfo, or ErrTaskCompleted without saving anything if the task was
+	// already completed.
+	CompleteTask(ctx context.Context, id string, productInfo domain.ProductInfo, offers []domain.Offer, newCallback func(st domain.ScrapeTask)) (string, error)
 	// SaveProductInfo saves a new ProductInfo to the database, returning the ID on success.
 	SaveProductInfo(productInfo domain.ProductInfo) (string, error)
 	// SaveProduct saves a new Product to the database, returning the ID on success.
 	SaveProduct(product domain.Product) (string, error)
+	// UpdateProductDetails fills in the details of a Product, such as its brand and UPC,
+	// from those scraped along with its info, keeping its name.
+	UpdateProductDetails(productID string, details domain.Product) error
 	// CreateTask creates a new task using the provided object.
 	CreateTask(scrapeTask domain.ScrapeTask) (string, error)
 	// FetchUpcomingTasks fetches newest tasks with a limit.
 	FetchUpcomingTasks(limit uint16) ([]domain.ScrapeTask, error)
+	// FetchTasksCreatedSince fetches all tasks created after the supplied time.
+	FetchTasksCreatedSince(since time.Time) ([]domain.ScrapeTask, error)
+	// GetProductByID gets a single Product using the ID.
+	GetProductByID(id string) (*domain.Product, error)
 	// GetProductLocationByID gets a single ProductLocation using the ID.
 	GetProductLocationByID(id string) (*domain.ProductLocation, error)
-	// SaveProductLocation saves a ProductLocation to the database.
+	// GetProductLocationsByProductID gets all ProductLocations for a single Product.
+	GetProductLocationsByProductID(productID string) ([]domain.ProductLocation, error)
+	// GetPriceHistory gets all ProductInfos recorded for a single Product, oldest first.
+	GetPriceHistory(productID string) ([]domain.ProductInfo, error)
+	// GetProductLocationByLocalID gets a single ProductLocation using its Location's ID and
+	// the ID used by the Location for it.
+	GetProductLocationByLocalID(locationID, localID string) (*domain.ProductLocation, error)
+	// TrackProduct saves a Product found at a Location along with its ProductLocation and
+	// a ScrapeTask for it atomically, returning the saved ScrapeTask, or nil if the
+	// product is already tracked at the Location.
+	TrackProduct(ctx context.Context, product domain.Product, productLocation domain.ProductLocation, scrapeTask domain.ScrapeTask) (*domain.ScrapeTask, error)
+	// SaveProductLocation saves a ProductLocation to the database, or updates the details
+	// of the ProductLocation with the same Location and local ID if there is one,
+	// returning the ID on success.
 	SaveProductLocation(productLocation domain.ProductLocation) (string, error)
+	// MergeDuplicateProductLocations merges ProductLocations sharing their Location and
+	// local ID into the one with the most ProductInfos, moving their ProductInfos,
+	// ScrapeTasks and CrawlTasks to it, and returns the merges. If `dryRun` is true, the
+	// merges are returned without being made.
+	MergeDuplicateProductLocations(ctx context.Context, dryRun bool) ([]ProductLocationMerge, error)
 	// IsCrawled returns true if an item was already crawled.
 	IsCrawled(productLocationId string) (bool, error)
 	// SaveCrawlTask saves a crawl task with the provided ID.
 	SaveCrawlTask(productLocationId string) (string, error)
+	// RegisterLocation saves a new Location to the database, returning the ID on success.
+	RegisterLocation(location domain.Location) (string, error)
+	// GetLocationByID gets a single Location using the ID.
+	GetLocationByID(id string) (*domain.Location, error)
+	// GetLocations gets all registered Locations.
+	GetLocations() ([]domain.Location, error)
+	// CheckLocations returns an error if any ProductLocations reference a Location that
+	// doesn't exist, or any Location uses an unknown retailer.
+	CheckLocations() error
+	// CreateDiscoveryTask creates a new discovery task using the provided object,
+	// returning the ID on success.
+	CreateDiscoveryTask(discoveryTask domain.DiscoveryTask) (string, error)
+	// GetDiscoveryTaskByID gets a single DiscoveryTask using the ID.
+	GetDiscoveryTaskByID(id string) (*domain.DiscoveryTask, error)
+	// GetDiscoveryTasks gets all DiscoveryTasks, ordered by when they are next to be run.
+	GetDiscoveryTasks() ([]domain.DiscoveryTask, error)
+	// FetchDueDiscoveryTasks fetches the DiscoveryTasks due to be run, scheduling each
+	// of them for their next run.
+	FetchDueDiscoveryTasks() ([]domain.DiscoveryTask, error)
+	// DeleteDiscoveryTask deletes a single DiscoveryTask using the ID.
+	DeleteDiscoveryTask(id string) error
 }
@@ -0,0 +1,123 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// ExporterNone disables exporting spans.
+	ExporterNone = "none"
+	// ExporterStdout writes spans to stdout, which works without a collector.
+	ExporterStdout = "stdout"
+	// ExporterOTLP sends spans to an OpenTelemetry collector over gRPC.
+	ExporterOTLP = "otlp"
+)
+
+// Configure sets up the global tracer provider for the named service using the
+// supplied exporter ("none", "stdout" or "otlp") and, for OTLP, collector endpoint.
+//
+// Returns a function which flushes and stops the exporter.
+func Configure(serviceName string, exporter string, endpoint string) (func(ctx context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var spanExporter sdktrace.SpanExporter
+	var err error
+
+	switch exporter {
+	case ExporterNone, "":
+		return func(ctx context.Context) error { return nil }, nil
+	case ExporterStdout:
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		spanExporter, err = otlptracegrpc.New(
+			context.Background(),
+			otlptracegrpc.WithEndpoint(endpoint),
+			otlptracegrpc.WithInsecure(),
+		)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String(serviceName),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Tracer returns a named tracer from the global tracer provider.
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer(name)
+}
+
+// End records `err` on the span if it is not nil, then ends the span.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// Inject returns the trace context of the span in `ctx` as a map, so that it can be
+// sent along with a message.
+func Inject(ctx context.Context) map[string]string {
+	carrier := mapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	if len(carrier) < 1 {
+		return nil
+	}
+
+	return carrier
+}
+
+// Extract returns a copy of `ctx` containing the remote span described by a trace
+// context map created by Inject. A nil map returns `ctx` unchanged.
+func Extract(ctx context.Context, traceContext map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, mapCarrier(traceContext))
+}
+
+// A mapCarrier adapts a map[string]string to a propagation.TextMapCarrier.
+type mapCarrier map[string]string
+
+// Get returns the value for a key.
+func (c mapCarrier) Get(key string) string {
+	return c[key]
+}
+
+// Set stores a key-value pair.
+func (c mapCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+// Keys lists the keys stored in the carrier.
+func (c mapCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
@@ -1,64 +1,343 @@
 package config
 
 import (
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
 
+	"github.com/BurntSushi/toml"
 	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v2"
 )
 
-// A ConfigLoadError is thrown when the environment is missing one or more variables.
+// A ConfigLoadError is thrown when the config is missing one or more values, or when
+// values can't be converted to their field's type.
 type ConfigLoadError struct {
 	MissingFields []string
+	InvalidFields []string
 }
 
-// Error displays the ConfigLoadError's missing variables.
+// Error displays the ConfigLoadError's missing and invalid values.
 func (c *ConfigLoadError) Error() string {
-	return fmt.Sprintf("environment missing variables: %s", strings.Join(c.MissingFields, ", "))
+	problems := []string{}
+
+	if len(c.MissingFields) > 0 {
+		problems = append(problems, fmt.Sprintf("config missing values: %s", strings.Join(c.MissingFields, ", ")))
+	}
+
+	if len(c.InvalidFields) > 0 {
+		problems = append(problems, fmt.Sprintf("config has invalid values: %s", strings.Join(c.InvalidFields, "; ")))
+	}
+
+	return strings.Join(problems, "; ")
 }
 
-// LoadConfigFromEnv takes a struct ptr as input and uses reflection to load fields in
-// from environment variables, using the `env` struct tag to determine lookup names.
-//
-// Returns an error if any variables are not found.
+// DotEnvFile is the file Load reads environment variables from, if it exists.
+const DotEnvFile = ".env"
+
+var (
+	// dotEnvKeys holds the environment variables last set from DotEnvFile, which are
+	// replaced when it is read again, unlike the ones set in the process environment.
+	dotEnvKeys  = map[string]bool{}
+	dotEnvMutex = &sync.Mutex{}
+)
+
+// Options control where Load reads values from, in addition to environment variables.
+type Options struct {
+	File string   // the path to a YAML or TOML config file, ignored if blank or overridden by the `-config` flag
+	Args []string // command-line arguments to parse flags from, eg. os.Args[1:], or nil to skip flags
+}
+
+// LoadConfigFromEnv is shorthand for Load(configStruct, Options{}), loading values from
+// defaults and environment variables only.
 func LoadConfigFromEnv(configStruct interface{}) error {
-	// Load from a .env file if one exists. Ignore errors.
-	godotenv.Load()
+	return Load(configStruct, Options{})
+}
+
+// Load takes a struct ptr as input and uses reflection to load fields in from several
+// layers, each overriding the last:
+//
+//  1. the `default` struct tag
+//  2. a YAML or TOML file (by extension), using the `yaml` struct tag (or the lowercase
+//     field name) as the key
+//  3. environment variables, using the `env` struct tag (or the field name) as the name,
+//     including ones set in a DotEnvFile
+//  4. command-line flags, using the `flag` struct tag as the name, for tagged fields only
+//
+// Strings, bools, ints, uints, floats, time.Durations, slices of those (comma-separated
+// in env and flags) and nested structs are supported. After loading, fields are
+// checked against the rules in their `validate` tag, see Validate.
+//
+// DotEnvFile is read again on every call, so that edits to it are picked up when
+// reloading, but variables set in the process environment and flags never change
+// while running. Settings meant to be reloaded should be set in the config file or
+// DotEnvFile instead.
+//
+// Returns an error if any fields without a default are not set by any layer.
+func Load(configStruct interface{}, options Options) error {
+	loadDotEnv()
 
-	elem := reflect.TypeOf(configStruct).Elem()
-	if elem.Kind() != reflect.Struct {
-		panic("LoadConfigFromEnv must be passed a pointer to a struct")
+	typ := reflect.TypeOf(configStruct)
+	if typ.Kind() != reflect.Ptr || typ.Elem().Kind() != reflect.Struct {
+		panic("Load must be passed a pointer to a struct")
 	}
 
-	val := reflect.ValueOf(configStruct).Elem()
+	fields := collectFields(reflect.ValueOf(configStruct).Elem(), nil)
+
+	// Parse flags first so that `-config` can choose the file.
+	flagValues, configFile, err := parseFlags(fields, options)
+	if err != nil {
+		return err
+	}
+
+	var fileValues map[string]interface{}
+	if configFile != "" {
+		values, err := readConfigFile(configFile)
+		if err != nil {
+			return err
+		}
+
+		fileValues = values
+	}
 
 	missingFields := []string{}
-	for i := 0; i < elem.NumField(); i++ {
-		field := elem.Field(i)
-		name, ok := field.Tag.Lookup("env")
-		if !ok {
-			name = field.Name
+	invalidFields := []string{}
+	for _, f := range fields {
+		set := false
+		assign := func(source string, raw interface{}) {
+			if err := assignValue(f.value, raw); err != nil {
+				invalidFields = append(invalidFields, fmt.Sprintf("%s from %s: %s", f.name(), source, err))
+				return
+			}
+
+			set = true
 		}
 
-		envVal := os.Getenv(name)
-		if envVal == "" {
-			envVal, ok = field.Tag.Lookup("default")
-			if !ok {
-				missingFields = append(missingFields, name)
-				continue
+		if def, ok := f.field.Tag.Lookup("default"); ok {
+			assign("default", def)
+		}
+
+		if raw, ok := lookupPath(fileValues, f.path); ok {
+			assign("file", raw)
+		}
+
+		envName := f.envName()
+		if raw, ok := os.LookupEnv(envName); ok {
+			assign("env "+envName, raw)
+		}
+
+		if name, ok := f.field.Tag.Lookup("flag"); ok {
+			if raw, ok := flagValues[name]; ok {
+				assign("flag -"+name, raw)
 			}
 		}
 
-		val.Field(i).SetString(envVal)
+		if !set {
+			missingFields = append(missingFields, envName)
+		}
 	}
 
-	if len(missingFields) > 0 {
+	if len(missingFields) > 0 || len(invalidFields) > 0 {
 		return &ConfigLoadError{
 			missingFields,
+			invalidFields,
+		}
+	}
+
+	return Validate(configStruct)
+}
+
+// FilePath returns the path of the config file Load would read for a config struct
+// ptr, taking the `-config` flag into account, or "" if there is none.
+func FilePath(configStruct interface{}, options Options) (string, error) {
+	fields := collectFields(reflect.ValueOf(configStruct).Elem(), nil)
+
+	_, configFile, err := parseFlags(fields, options)
+	return configFile, err
+}
+
+// parseFlags parses the command-line flags for the tagged fields from the options'
+// args, returning the values of the flags that were set by name along with the path
+// of the config file.
+func parseFlags(fields []configField, options Options) (map[string]string, string, error) {
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	configFile := fs.String("config", options.File, "path to a YAML or TOML config file")
+	flagValues := map[string]*string{}
+	for _, f := range fields {
+		if name, ok := f.field.Tag.Lookup("flag"); ok {
+			flagValues[name] = fs.String(name, f.field.Tag.Get("default"), f.field.Tag.Get("usage"))
 		}
 	}
 
-	return nil
+	if options.Args != nil {
+		if err := fs.Parse(options.Args); err != nil {
+			return nil, "", err
+		}
+	}
+
+	setFlags := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		if value, ok := flagValues[f.Name]; ok {
+			setFlags[f.Name] = *value
+		}
+	})
+
+	return setFlags, *configFile, nil
+}
+
+// A configField is a single settable field found in a config struct.
+type configField struct {
+	field reflect.StructField
+	value reflect.Value
+	path  []string // the YAML keys leading to the field
+}
+
+// name returns the field's dotted YAML path, eg. "logging.level".
+func (f configField) name() string {
+	return strings.Join(f.path, ".")
+}
+
+// envName returns the name of the environment variable the field is loaded from.
+func (f configField) envName() string {
+	if name, ok := f.field.Tag.Lookup("env"); ok {
+		return name
+	}
+
+	return f.field.Name
+}
+
+// loadDotEnv sets environment variables from DotEnvFile if it exists, without
+// overriding ones set in the process environment. Variables set by a previous call are
+// replaced with the file's current values, or unset if they were removed from it.
+func loadDotEnv() {
+	values, err := godotenv.Read(DotEnvFile)
+	if os.IsNotExist(err) {
+		values = map[string]string{}
+	} else if err != nil {
+		// Keep the previous values until the file can be read.
+		return
+	}
+
+	dotEnvMutex.Lock()
+	defer dotEnvMutex.Unlock()
+
+	for key := range dotEnvKeys {
+		if _, ok := values[key]; !ok {
+			os.Unsetenv(key)
+		}
+	}
+
+	keys := map[string]bool{}
+	for key, value := range values {
+		if _, ok := os.LookupEnv(key); ok && !dotEnvKeys[key] {
+			continue
+		}
+
+		os.Setenv(key, value)
+		keys[key] = true
+	}
+
+	dotEnvKeys = keys
+}
+
+// collectFields recursively lists the settable fields of a struct, descending into
+// nested structs.
+func collectFields(val reflect.Value, path []string) []configField {
+	fields := []configField{}
+
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			// Skip unexported fields.
+			continue
+		}
+
+		key, ok := field.Tag.Lookup("yaml")
+		if !ok {
+			key = strings.ToLower(field.Name)
+		}
+
+		fieldPath := append(append([]string{}, path...), key)
+
+		if field.Type.Kind() == reflect.Struct {
+			fields = append(fields, collectFields(val.Field(i), fieldPath)...)
+			continue
+		}
+
+		fields = append(fields, configField{
+			field: field,
+			value: val.Field(i),
+			path:  fieldPath,
+		})
+	}
+
+	return fields
+}
+
+// readConfigFile reads a YAML file, or a TOML file if its name ends in ".toml", into
+// a map of keys to values.
+func readConfigFile(path string) (map[string]interface{}, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]interface{}{}
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		err = toml.Unmarshal(b, &values)
+	} else {
+		var raw map[interface{}]interface{}
+		err = yaml.Unmarshal(b, &raw)
+		values = normalizeYAML(raw)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+
+	return values, nil
+}
+
+// normalizeYAML converts the map[interface{}]interface{} maps produced by yaml.v2 to
+// map[string]interface{} so they can be looked up like TOML values.
+func normalizeYAML(raw map[interface{}]interface{}) map[string]interface{} {
+	values := map[string]interface{}{}
+	for k, v := range raw {
+		if nested, ok := v.(map[interface{}]interface{}); ok {
+			v = normalizeYAML(nested)
+		}
+
+		values[fmt.Sprint(k)] = v
+	}
+
+	return values
+}
+
+// lookupPath finds the value at a path of keys in a decoded config file.
+func lookupPath(values map[string]interface{}, path []string) (interface{}, bool) {
+	if values == nil {
+		return nil, false
+	}
+
+	val, ok := values[path[0]]
+	if !ok {
+		return nil, false
+	}
+
+	if len(path) == 1 {
+		return val, true
+	}
+
+	nested, ok := val.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	return lookupPath(nested, path[1:])
 }
@@ -0,0 +1,208 @@
+package config_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bfoody/Walmart-Scraper/utils/config"
+)
+
+type nestedConfig struct {
+	Level string `env:"TEST_CFG_LEVEL" yaml:"level" default:"info"`
+}
+
+type testConfig struct {
+	Name     string        `env:"TEST_CFG_NAME" yaml:"name" flag:"name" default:"default"`
+	Workers  int           `env:"TEST_CFG_WORKERS" yaml:"workers" default:"4" validate:"min=1"`
+	Interval time.Duration `env:"TEST_CFG_INTERVAL" yaml:"interval" default:"10s"`
+	Enabled  bool          `env:"TEST_CFG_ENABLED" yaml:"enabled" default:"false"`
+	Hosts    []string      `env:"TEST_CFG_HOSTS" yaml:"hosts" default:"a,b"`
+	Suffix   string        `env:"TEST_CFG_SUFFIX" default:"-suffix"`
+	Password string        `env:"TEST_CFG_PASSWORD" default:"hunter2" secret:"true"`
+	Nested   nestedConfig  `yaml:"nested"`
+}
+
+// writeFile writes a temporary config file and returns its path.
+func writeFile(t *testing.T, name, contents string) string {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// TestLoadLayers makes sure defaults, files, env vars and flags override each other
+// in order and are converted to their field types.
+func TestLoadLayers(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+name: file
+workers: 2
+interval: 1m
+hosts: [one, two, three]
+nested:
+  level: warn
+`)
+
+	os.Setenv("TEST_CFG_WORKERS", "6")
+	os.Setenv("TEST_CFG_SUFFIX", "")
+	defer os.Unsetenv("TEST_CFG_WORKERS")
+	defer os.Unsetenv("TEST_CFG_SUFFIX")
+
+	cfg := testConfig{}
+	err := config.Load(&cfg, config.Options{File: path, Args: []string{"-name", "flag"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Name != "flag" {
+		t.Errorf("expected name from flag, got %q", cfg.Name)
+	}
+
+	if cfg.Workers != 6 {
+		t.Errorf("expected workers from env, got %d", cfg.Workers)
+	}
+
+	if cfg.Interval != time.Minute {
+		t.Errorf("expected interval from file, got %s", cfg.Interval)
+	}
+
+	if strings.Join(cfg.Hosts, ",") != "one,two,three" {
+		t.Errorf("expected hosts from file, got %v", cfg.Hosts)
+	}
+
+	if cfg.Suffix != "" {
+		t.Errorf("expected an empty env var to override the default, got %q", cfg.Suffix)
+	}
+
+	if cfg.Nested.Level != "warn" {
+		t.Errorf("expected nested level from file, got %q", cfg.Nested.Level)
+	}
+}
+
+// TestLoadDotEnv makes sure edits to a .env file are picked up by later loads, but
+// never override the process environment.
+func TestLoadDotEnv(t *testing.T) {
+	dir := filepath.Dir(writeFile(t, config.DotEnvFile, "TEST_CFG_NAME=first\nTEST_CFG_WORKERS=2\n"))
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	os.Setenv("TEST_CFG_WORKERS", "6")
+	defer os.Unsetenv("TEST_CFG_WORKERS")
+	defer os.Unsetenv("TEST_CFG_NAME")
+
+	cfg := testConfig{}
+	if err := config.LoadConfigFromEnv(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Name != "first" || cfg.Workers != 6 {
+		t.Errorf("expected name from .env and workers from env, got %q and %d", cfg.Name, cfg.Workers)
+	}
+
+	if err := ioutil.WriteFile(config.DotEnvFile, []byte("TEST_CFG_NAME=second\nTEST_CFG_WORKERS=3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg = testConfig{}
+	if err := config.LoadConfigFromEnv(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Name != "second" || cfg.Workers != 6 {
+		t.Errorf("expected the edited name from .env and workers from env, got %q and %d", cfg.Name, cfg.Workers)
+	}
+
+	if err := ioutil.WriteFile(config.DotEnvFile, []byte("TEST_CFG_WORKERS=3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg = testConfig{}
+	if err := config.LoadConfigFromEnv(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Name != "default" {
+		t.Errorf("expected a name removed from .env to fall back to its default, got %q", cfg.Name)
+	}
+}
+
+// TestLoadTOML makes sure TOML files are decoded like YAML files.
+func TestLoadTOML(t *testing.T) {
+	path := writeFile(t, "config.toml", `
+workers = 3
+enabled = true
+
+[nested]
+level = "error"
+`)
+
+	cfg := testConfig{}
+	if err := config.Load(&cfg, config.Options{File: path}); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Workers != 3 || !cfg.Enabled || cfg.Nested.Level != "error" {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+}
+
+// TestLoadErrors makes sure invalid values and broken validation rules are reported.
+func TestLoadErrors(t *testing.T) {
+	os.Setenv("TEST_CFG_INTERVAL", "soon")
+	cfg := testConfig{}
+	err := config.LoadConfigFromEnv(&cfg)
+	os.Unsetenv("TEST_CFG_INTERVAL")
+
+	var loadErr *config.ConfigLoadError
+	if !errors.As(err, &loadErr) || len(loadErr.InvalidFields) != 1 {
+		t.Errorf("expected an invalid field error, got %v", err)
+	}
+
+	os.Setenv("TEST_CFG_WORKERS", "0")
+	cfg = testConfig{}
+	err = config.LoadConfigFromEnv(&cfg)
+	os.Unsetenv("TEST_CFG_WORKERS")
+
+	var validationErr *config.ValidationError
+	if !errors.As(err, &validationErr) || len(validationErr.Problems) != 1 {
+		t.Errorf("expected a validation error, got %v", err)
+	}
+}
+
+// TestDump makes sure every field is dumped and secrets are redacted.
+func TestDump(t *testing.T) {
+	cfg := testConfig{}
+	if err := config.LoadConfigFromEnv(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	dump := config.Dump(&cfg)
+	for _, line := range []string{"name=default", "hosts=a,b", "nested.level=info", "password=<redacted>"} {
+		if !strings.Contains(dump, line+"\n") {
+			t.Errorf("expected dump to contain %q, got:\n%s", line, dump)
+		}
+	}
+
+	if strings.Contains(dump, "hunter2") {
+		t.Errorf("expected password to be redacted, got:\n%s", dump)
+	}
+}
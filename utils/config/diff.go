@@ -0,0 +1,43 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// A Change is a single field that differs between two loads of a config.
+type Change struct {
+	Field      string // the field's dotted YAML path, eg. "logging.level"
+	Old        string // the previous value, redacted if the field is a secret
+	New        string // the new value, redacted if the field is a secret
+	Reloadable bool   // whether the field is tagged with `reload:"true"`
+}
+
+// String displays the Change.
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %q -> %q", c.Field, c.Old, c.New)
+}
+
+// Diff compares two config struct ptrs of the same type and returns the fields whose
+// values differ.
+func Diff(oldConfig interface{}, newConfig interface{}) []Change {
+	oldFields := collectFields(reflect.ValueOf(oldConfig).Elem(), nil)
+	newFields := collectFields(reflect.ValueOf(newConfig).Elem(), nil)
+
+	changes := []Change{}
+	for i, f := range newFields {
+		old := oldFields[i]
+		if old.format() == f.format() {
+			continue
+		}
+
+		changes = append(changes, Change{
+			Field:      f.name(),
+			Old:        old.display(),
+			New:        f.display(),
+			Reloadable: f.field.Tag.Get("reload") == "true",
+		})
+	}
+
+	return changes
+}
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// redacted replaces the value of secret fields in a Dump.
+const redacted = "<redacted>"
+
+// Dump returns every field of a config struct ptr as a line of `path=value`, for
+// debugging. Fields tagged with `secret:"true"` have non-empty values redacted.
+func Dump(configStruct interface{}) string {
+	var sb strings.Builder
+
+	for _, f := range collectFields(reflect.ValueOf(configStruct).Elem(), nil) {
+		fmt.Fprintf(&sb, "%s=%s\n", f.name(), f.display())
+	}
+
+	return sb.String()
+}
+
+// format returns the field's value as a string, with slices comma-separated.
+func (f configField) format() string {
+	if f.value.Kind() != reflect.Slice {
+		return fmt.Sprint(f.value.Interface())
+	}
+
+	items := []string{}
+	for i := 0; i < f.value.Len(); i++ {
+		items = append(items, fmt.Sprint(f.value.Index(i).Interface()))
+	}
+
+	return strings.Join(items, ",")
+}
+
+// display returns the field's formatted value, or a placeholder if the field is a
+// secret.
+func (f configField) display() string {
+	value := f.format()
+	if f.field.Tag.Get("secret") == "true" && value != "" {
+		return redacted
+	}
+
+	return value
+}
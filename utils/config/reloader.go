@@ -0,0 +1,167 @@
+package config
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// FilePollInterval is the amount of time between checks for changes to watched files.
+const FilePollInterval = 2 * time.Second
+
+// A Reloader reloads a config when the process receives SIGHUP or one of its watched
+// files changes, logs what changed and passes the new config to its subscribers.
+//
+// Only fields tagged with `reload:"true"` are expected to be applied by subscribers,
+// changes to other fields are logged as requiring a restart.
+type Reloader struct {
+	load        func() (interface{}, error) // loads a new config struct ptr
+	files       []string
+	modTimes    map[string]time.Time
+	current     interface{}
+	subscribers []func(config interface{})
+	mutex       *sync.Mutex
+	shutdown    chan int
+	log         *zap.Logger
+}
+
+// NewReloader creates and returns a new *Reloader for the already loaded config
+// struct ptr `current`, which reloads using `load` and watches the supplied files.
+// Blank file paths are ignored.
+func NewReloader(current interface{}, load func() (interface{}, error), files []string, logger *zap.Logger) *Reloader {
+	watched := []string{}
+	for _, file := range files {
+		if file != "" {
+			watched = append(watched, file)
+		}
+	}
+
+	return &Reloader{
+		load:        load,
+		files:       watched,
+		modTimes:    map[string]time.Time{},
+		current:     current,
+		subscribers: []func(config interface{}){},
+		mutex:       &sync.Mutex{},
+		shutdown:    make(chan int),
+		log:         logger,
+	}
+}
+
+// Subscribe registers a function to be called with the new config struct ptr after
+// each reload that changes a reloadable field.
+func (r *Reloader) Subscribe(fn func(config interface{})) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.subscribers = append(r.subscribers, fn)
+}
+
+// Start starts watching for SIGHUP and file changes in a Goroutine.
+func (r *Reloader) Start() {
+	for _, file := range r.files {
+		r.modTimes[file] = modTime(file)
+	}
+
+	go r.loop()
+}
+
+// Shutdown stops watching for SIGHUP and file changes.
+func (r *Reloader) Shutdown() {
+	r.shutdown <- 1
+}
+
+// Reload loads the config again, logs the changes and notifies subscribers if any
+// reloadable fields changed. The current config is kept if loading fails.
+func (r *Reloader) Reload() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	config, err := r.load()
+	if err != nil {
+		r.log.Error("error reloading config, keeping current config", zap.Error(err))
+		return err
+	}
+
+	changes := Diff(r.current, config)
+	r.current = config
+
+	if len(changes) == 0 {
+		r.log.Info("config reloaded with no changes")
+		return nil
+	}
+
+	reloadable := false
+	for _, change := range changes {
+		if !change.Reloadable {
+			r.log.Warn("config changed, restart required to apply", zap.Stringer("change", change))
+			continue
+		}
+
+		reloadable = true
+		r.log.Info("config changed", zap.Stringer("change", change))
+	}
+
+	if reloadable {
+		for _, fn := range r.subscribers {
+			fn(config)
+		}
+	}
+
+	return nil
+}
+
+func (r *Reloader) loop() {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+
+	ticker := time.NewTicker(FilePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-hangups:
+			r.log.Info("received SIGHUP, reloading config")
+			r.Reload()
+		case <-ticker.C:
+			if file, changed := r.filesChanged(); changed {
+				r.log.Info("config file changed, reloading config", zap.String("file", file))
+				r.Reload()
+			}
+		case <-r.shutdown:
+			return
+		}
+	}
+}
+
+// filesChanged checks whether any watched file was modified since the last check,
+// returning the first one that was.
+func (r *Reloader) filesChanged() (string, bool) {
+	changedFile := ""
+	for _, file := range r.files {
+		t := modTime(file)
+		if !t.Equal(r.modTimes[file]) && changedFile == "" {
+			changedFile = file
+		}
+
+		r.modTimes[file] = t
+	}
+
+	return changedFile, changedFile != ""
+}
+
+// modTime returns the modification time of a file, or the zero time if it can't be
+// read.
+func modTime(file string) time.Time {
+	info, err := os.Stat(file)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+}
@@ -0,0 +1,97 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/bfoody/Walmart-Scraper/utils/config"
+	"go.uber.org/zap"
+)
+
+type reloadConfig struct {
+	Address  string        `yaml:"address" default:":80"`
+	Interval time.Duration `yaml:"interval" default:"1s" reload:"true"`
+	Token    string        `yaml:"token" default:"abc" secret:"true" reload:"true"`
+}
+
+// TestReloaderReload makes sure reloads diff the configs and only notify subscribers
+// when a reloadable field changes.
+func TestReloaderReload(t *testing.T) {
+	path := writeFile(t, "config.yaml", "interval: 1s\n")
+	load := func() (interface{}, error) {
+		cfg := reloadConfig{}
+		err := config.Load(&cfg, config.Options{File: path})
+		return &cfg, err
+	}
+
+	current, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloader := config.NewReloader(current, load, []string{path}, zap.NewNop())
+
+	notified := []*reloadConfig{}
+	reloader.Subscribe(func(cfg interface{}) {
+		notified = append(notified, cfg.(*reloadConfig))
+	})
+
+	// A non-reloadable change shouldn't notify subscribers.
+	if err := ioutil.WriteFile(path, []byte("address: \":81\"\ninterval: 1s\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := reloader.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(notified) != 0 {
+		t.Fatalf("expected no notifications, got %d", len(notified))
+	}
+
+	next := "address: \":81\"\ninterval: 5s\ntoken: xyz\n"
+	if err := ioutil.WriteFile(path, []byte(next), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := reloader.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(notified) != 1 || notified[0].Interval != 5*time.Second {
+		t.Fatalf("expected a notification with the new interval, got %+v", notified)
+	}
+
+	// An invalid config should be rejected without notifying subscribers.
+	if err := ioutil.WriteFile(path, []byte("interval: later\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := reloader.Reload(); err == nil {
+		t.Fatal("expected an error reloading an invalid config")
+	}
+
+	if len(notified) != 1 {
+		t.Fatalf("expected no new notifications, got %d", len(notified))
+	}
+}
+
+// TestDiff makes sure changed fields are listed with secrets redacted.
+func TestDiff(t *testing.T) {
+	oldConfig := &reloadConfig{Address: ":80", Interval: time.Second, Token: "abc"}
+	newConfig := &reloadConfig{Address: ":80", Interval: 2 * time.Second, Token: "xyz"}
+
+	changes := config.Diff(oldConfig, newConfig)
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %v", changes)
+	}
+
+	if changes[0].Field != "interval" || changes[0].Old != "1s" || changes[0].New != "2s" || !changes[0].Reloadable {
+		t.Errorf("unexpected interval change %+v", changes[0])
+	}
+
+	if changes[1].Field != "token" || changes[1].Old != "<redacted>" || changes[1].New != "<redacted>" {
+		t.Errorf("expected token change to be redacted, got %+v", changes[1])
+	}
+}
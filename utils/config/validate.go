@@ -0,0 +1,122 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A ValidationError is thrown when one or more config values break their validation rules.
+type ValidationError struct {
+	Problems []string
+}
+
+// Error displays the ValidationError's problems.
+func (v *ValidationError) Error() string {
+	return fmt.Sprintf("config failed validation: %s", strings.Join(v.Problems, "; "))
+}
+
+// Validate checks every field of a config struct ptr against the comma-separated rules
+// in its `validate` struct tag:
+//
+//	nonempty    the value must not be blank or empty
+//	min=<n>     numbers and durations must be at least n, strings and slices must have at least n items
+//	max=<n>     numbers and durations must be at most n, strings and slices must have at most n items
+//	oneof=<a b> the value must be one of the space-separated options
+func Validate(configStruct interface{}) error {
+	problems := []string{}
+
+	for _, f := range collectFields(reflect.ValueOf(configStruct).Elem(), nil) {
+		rules, ok := f.field.Tag.Lookup("validate")
+		if !ok {
+			continue
+		}
+
+		for _, rule := range strings.Split(rules, ",") {
+			if err := checkRule(f.value, strings.TrimSpace(rule)); err != nil {
+				problems = append(problems, fmt.Sprintf("%s %s", f.name(), err))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{problems}
+	}
+
+	return nil
+}
+
+// checkRule checks a single validation rule against a value.
+func checkRule(val reflect.Value, rule string) error {
+	parts := strings.SplitN(rule, "=", 2)
+	name := parts[0]
+	arg := ""
+	if len(parts) == 2 {
+		arg = parts[1]
+	}
+
+	switch name {
+	case "nonempty":
+		if val.IsZero() || (val.Kind() == reflect.Slice && val.Len() == 0) {
+			return fmt.Errorf("must not be empty")
+		}
+	case "min", "max":
+		n, limit, err := measure(val, arg)
+		if err != nil {
+			return err
+		}
+
+		if name == "min" && n < limit {
+			return fmt.Errorf("must be at least %s", arg)
+		}
+
+		if name == "max" && n > limit {
+			return fmt.Errorf("must be at most %s", arg)
+		}
+	case "oneof":
+		str := fmt.Sprint(val.Interface())
+		for _, option := range strings.Fields(arg) {
+			if str == option {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("must be one of %s, got %q", strings.Join(strings.Fields(arg), ", "), str)
+	default:
+		return fmt.Errorf("has unknown validation rule %q", rule)
+	}
+
+	return nil
+}
+
+// measure returns the size of a value and the parsed limit to compare it with.
+func measure(val reflect.Value, limit string) (float64, float64, error) {
+	if val.Type() == durationType {
+		d, err := time.ParseDuration(limit)
+		if err != nil {
+			return 0, 0, fmt.Errorf("has invalid duration limit %q", limit)
+		}
+
+		return float64(val.Int()), float64(d), nil
+	}
+
+	l, err := strconv.ParseFloat(limit, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("has invalid limit %q", limit)
+	}
+
+	switch val.Kind() {
+	case reflect.String, reflect.Slice:
+		return float64(val.Len()), l, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(val.Int()), l, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(val.Uint()), l, nil
+	case reflect.Float32, reflect.Float64:
+		return val.Float(), l, nil
+	}
+
+	return 0, 0, fmt.Errorf("can't be measured")
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// assignValue converts a raw value, either a string from env/flags/defaults or a
+// decoded YAML value, to the type of `val` and sets it.
+func assignValue(val reflect.Value, raw interface{}) error {
+	if val.Kind() == reflect.Slice {
+		var items []interface{}
+
+		switch r := raw.(type) {
+		case []interface{}:
+			items = r
+		case string:
+			items = []interface{}{}
+			for _, item := range strings.Split(r, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+		default:
+			items = []interface{}{r}
+		}
+
+		slice := reflect.MakeSlice(val.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := assignScalar(slice.Index(i), fmt.Sprint(item)); err != nil {
+				return err
+			}
+		}
+
+		val.Set(slice)
+		return nil
+	}
+
+	if raw == nil {
+		raw = ""
+	}
+
+	return assignScalar(val, fmt.Sprint(raw))
+}
+
+// assignScalar parses a string into the type of `val` and sets it.
+func assignScalar(val reflect.Value, raw string) error {
+	if val.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+
+		val.SetInt(int64(d))
+		return nil
+	}
+
+	switch val.Kind() {
+	case reflect.String:
+		val.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+
+		val.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(raw, 10, val.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		val.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(raw, 10, val.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		val.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, val.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		val.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported config field type %s", val.Type())
+	}
+
+	return nil
+}